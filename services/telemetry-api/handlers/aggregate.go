@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+)
+
+// Aggregation limits
+const (
+	// MinAggregateBucket is the smallest accepted bucket width
+	MinAggregateBucket = 1 * time.Second
+	// MaxAggregateBuckets caps the number of buckets per series ((to - from) / bucket)
+	MaxAggregateBuckets = 10000
+	// MaxAggregateScan caps raw readings scanned by in-process aggregation
+	MaxAggregateScan = 200000
+	// aggregatePageSize is the page size used when streaming raw readings
+	aggregatePageSize = 1000
+)
+
+var errAggregateScanLimit = errors.New("too many readings in range")
+
+var validAggFuncs = map[string]bool{
+	AggAvg:   true,
+	AggMin:   true,
+	AggMax:   true,
+	AggSum:   true,
+	AggCount: true,
+	AggLast:  true,
+}
+
+// GetTelemetryAggregate handles GET /telemetry/aggregate - bucketed series for authenticated device
+// Query: type (repeatable), from (required), to (default now), bucket (Go duration), fn (avg|min|max|sum|count|last)
+func (h *Handlers) GetTelemetryAggregate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	deviceID := GetDeviceIDFromContext(ctx)
+	if deviceID == "" {
+		h.jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	fromStr := query.Get("from")
+	if fromStr == "" {
+		h.jsonError(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse(time.RFC3339, fromStr)
+	if err != nil {
+		h.jsonError(w, "invalid from: must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if toStr := query.Get("to"); toStr != "" {
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			h.jsonError(w, "invalid to: must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		h.jsonError(w, "invalid time range: to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	bucketStr := query.Get("bucket")
+	if bucketStr == "" {
+		h.jsonError(w, "bucket is required", http.StatusBadRequest)
+		return
+	}
+	bucket, err := time.ParseDuration(bucketStr)
+	if err != nil || bucket < MinAggregateBucket {
+		h.jsonError(w, fmt.Sprintf("invalid bucket: must be a duration of at least %s", MinAggregateBucket), http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/bucket > MaxAggregateBuckets {
+		h.jsonError(w, fmt.Sprintf("too many buckets: maximum is %d per series", MaxAggregateBuckets), http.StatusBadRequest)
+		return
+	}
+
+	fn := query.Get("fn")
+	if fn == "" {
+		fn = AggAvg
+	}
+	if !validAggFuncs[fn] {
+		h.jsonError(w, "invalid fn: must be one of avg, min, max, sum, count, last", http.StatusBadRequest)
+		return
+	}
+
+	types := query["type"]
+	if len(types) > MaxTelemetryQueryTypes {
+		h.jsonError(w, fmt.Sprintf("too many types: maximum is %d", MaxTelemetryQueryTypes), http.StatusBadRequest)
+		return
+	}
+	for _, t := range types {
+		if err := validate.TelemetryType(t); err != nil {
+			h.jsonError(w, fmt.Sprintf("invalid telemetry type: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	q := AggregateQuery{
+		Types:  types,
+		From:   from.UTC(),
+		To:     to.UTC(),
+		Bucket: bucket,
+		Func:   fn,
+	}
+
+	series, err := h.aggregateTelemetry(ctx, deviceID, q)
+	if errors.Is(err, errAggregateScanLimit) {
+		h.jsonError(w, "too many readings in range: narrow the time range or filter by type", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to aggregate telemetry",
+			"request_id", reqID,
+			"error", err,
+			"device_id", deviceID,
+		)
+		h.jsonError(w, "failed to aggregate telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"fn":     q.Func,
+		"bucket": q.Bucket.String(),
+		"from":   q.From,
+		"to":     q.To,
+		"series": series,
+	}, http.StatusOK)
+}
+
+// aggregateTelemetry answers from pre-computed rollups when the query is aligned to
+// them (one read per bucket), then pushes the aggregation down to the store when
+// supported, and otherwise streams raw readings page by page and aggregates in-process.
+func (h *Handlers) aggregateTelemetry(ctx context.Context, deviceID string, q AggregateQuery) ([]AggregateSeries, error) {
+	if period, ok := rollupPeriodFor(q); ok && h.rollupStore != nil {
+		rollups, err := h.rollupStore.Query(ctx, deviceID, period, q.Types, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		acc := newAggregator(q)
+		for i := range rollups {
+			acc.addRollup(&rollups[i])
+		}
+		return acc.series(), nil
+	}
+
+	if agg, ok := h.telemetryStore.(TelemetryAggregator); ok {
+		series, err := agg.Aggregate(ctx, deviceID, q)
+		if !errors.Is(err, ErrAggregateUnsupported) {
+			return series, err
+		}
+	}
+
+	acc := newAggregator(q)
+	tq := TelemetryQuery{
+		From:  q.From,
+		To:    q.To,
+		Types: q.Types,
+		Order: OrderAsc,
+		Limit: aggregatePageSize,
+	}
+
+	var cursor *PageCursor
+	scanned := 0
+	for {
+		page, next, err := h.telemetryStore.QueryPage(ctx, deviceID, tq, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page {
+			acc.add(&page[i])
+		}
+		scanned += len(page)
+		if next == nil {
+			break
+		}
+		if scanned >= MaxAggregateScan {
+			return nil, errAggregateScanLimit
+		}
+		cursor = next
+	}
+
+	return acc.series(), nil
+}
+
+// MaxAggregatePushdownQueries caps the store queries of one push-down (one per type and
+// bucket); larger requests are aggregated in-process
+const MaxAggregatePushdownQueries = 100
+
+// aggregateRange is one bucket of a push-down: readings in [From, To) belong to the bucket at Start
+type aggregateRange struct {
+	Start    time.Time
+	From, To time.Time
+}
+
+// pushdownRanges returns the buckets a store computes with one count/sum/avg query each.
+// Push-down needs explicit types (stores cannot group by type) and at most
+// MaxAggregatePushdownQueries queries; otherwise it returns ErrAggregateUnsupported.
+func pushdownRanges(q AggregateQuery) ([]aggregateRange, error) {
+	if q.Func != AggCount && q.Func != AggSum && q.Func != AggAvg {
+		return nil, ErrAggregateUnsupported
+	}
+	if len(q.Types) == 0 {
+		return nil, ErrAggregateUnsupported
+	}
+
+	first := bucketStart(q.From, q.Bucket)
+	buckets := (q.To.UnixNano() - first + int64(q.Bucket) - 1) / int64(q.Bucket)
+	if buckets*int64(len(q.Types)) > MaxAggregatePushdownQueries {
+		return nil, ErrAggregateUnsupported
+	}
+
+	ranges := make([]aggregateRange, 0, buckets)
+	for start := first; start < q.To.UnixNano(); start += int64(q.Bucket) {
+		r := aggregateRange{
+			Start: time.Unix(0, start).UTC(),
+			From:  time.Unix(0, start).UTC(),
+			To:    time.Unix(0, start+int64(q.Bucket)).UTC(),
+		}
+		if r.From.Before(q.From) {
+			r.From = q.From
+		}
+		if r.To.After(q.To) {
+			r.To = q.To
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// pushdownPoint builds the point of a bucket from its count and sum or average
+// (empty buckets are omitted, as with in-process aggregation)
+func pushdownPoint(fn string, start time.Time, count int, value float64) (AggregatePoint, bool) {
+	if count == 0 {
+		return AggregatePoint{}, false
+	}
+	if fn == AggCount {
+		value = float64(count)
+	}
+	return AggregatePoint{Time: start, Value: value, Count: count}, true
+}
+
+// aggregator folds raw readings into per-type buckets
+type aggregator struct {
+	q       AggregateQuery
+	buckets map[string]map[int64]*Rollup // type -> bucket start (unix nanos) -> accumulator
+	units   map[string]string
+}
+
+func newAggregator(q AggregateQuery) *aggregator {
+	return &aggregator{
+		q:       q,
+		buckets: make(map[string]map[int64]*Rollup),
+		units:   make(map[string]string),
+	}
+}
+
+func (a *aggregator) add(d *TelemetryData) {
+	if !d.IsNumeric() {
+		return
+	}
+	b := a.bucket(d.Type, d.Timestamp, d.Unit)
+	b.add(d.Timestamp, d.Value)
+}
+
+// addRollup merges a pre-computed rollup into the bucket containing it
+func (a *aggregator) addRollup(r *Rollup) {
+	b := a.bucket(r.Type, r.BucketStart, r.Unit)
+	b.combine(r)
+}
+
+func (a *aggregator) bucket(typ string, ts time.Time, unit string) *Rollup {
+	byBucket, ok := a.buckets[typ]
+	if !ok {
+		byBucket = make(map[int64]*Rollup)
+		a.buckets[typ] = byBucket
+	}
+	if unit != "" {
+		a.units[typ] = unit
+	}
+
+	start := bucketStart(ts, a.q.Bucket)
+	b, ok := byBucket[start]
+	if !ok {
+		b = &Rollup{}
+		byBucket[start] = b
+	}
+	return b
+}
+
+// series returns one series per type (sorted by type), points in time order
+func (a *aggregator) series() []AggregateSeries {
+	result := make([]AggregateSeries, 0, len(a.buckets))
+	for typ, byBucket := range a.buckets {
+		s := AggregateSeries{
+			Type:   typ,
+			Unit:   a.units[typ],
+			Points: make([]AggregatePoint, 0, len(byBucket)),
+		}
+		for start, b := range byBucket {
+			s.Points = append(s.Points, AggregatePoint{
+				Time:  time.Unix(0, start).UTC(),
+				Value: b.Value(a.q.Func),
+				Count: b.Count,
+			})
+		}
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
+
+// rollupPeriodFor returns the coarsest rollup period that can answer the query exactly:
+// the bucket must be a whole number of periods and the range aligned to period boundaries.
+func rollupPeriodFor(q AggregateQuery) (string, bool) {
+	for i := len(rollupPeriods) - 1; i >= 0; i-- {
+		period := rollupPeriods[i]
+		d := periodDuration(period)
+		if q.Bucket%d == 0 && q.From.UnixNano()%int64(d) == 0 && q.To.UnixNano()%int64(d) == 0 {
+			return period, true
+		}
+	}
+	return "", false
+}
+
+// bucketStart aligns a timestamp to the start of its bucket (multiples of width since the Unix epoch)
+func bucketStart(t time.Time, width time.Duration) int64 {
+	ns := t.UnixNano()
+	w := int64(width)
+	start := ns - ns%w
+	if ns < 0 && ns%w != 0 {
+		start -= w
+	}
+	return start
+}
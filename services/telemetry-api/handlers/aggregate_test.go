@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type aggregateResponse struct {
+	Fn     string            `json:"fn"`
+	Bucket string            `json:"bucket"`
+	Series []AggregateSeries `json:"series"`
+}
+
+func seedAggregateReadings(store *MockTelemetryStore, base time.Time) {
+	// Two 5-minute buckets of temperature, one of humidity
+	readings := []struct {
+		typ    string
+		offset time.Duration
+		value  float64
+	}{
+		{"temperature", 0, 20},
+		{"temperature", 1 * time.Minute, 22},
+		{"temperature", 4 * time.Minute, 24},
+		{"temperature", 6 * time.Minute, 30},
+		{"humidity", 2 * time.Minute, 50},
+	}
+	for _, r := range readings {
+		store.Save(context.Background(), &TelemetryData{
+			DeviceID:  telTestDeviceUUID,
+			Type:      r.typ,
+			Unit:      "unit-" + r.typ,
+			Value:     r.value,
+			Timestamp: base.Add(r.offset),
+		})
+	}
+}
+
+func TestGetTelemetryAggregate_Functions(t *testing.T) {
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		fn   string
+		want []float64 // temperature buckets
+	}{
+		{AggAvg, []float64{22, 30}},
+		{AggMin, []float64{20, 30}},
+		{AggMax, []float64{24, 30}},
+		{AggSum, []float64{66, 30}},
+		{AggCount, []float64{3, 1}},
+		{AggLast, []float64{24, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			mockStore := NewMockTelemetryStore()
+			seedAggregateReadings(mockStore, base)
+			h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodGet,
+				"/telemetry/aggregate?type=temperature&from=2026-01-15T10:00:00Z&to=2026-01-15T11:00:00Z&bucket=5m&fn="+tt.fn, nil)
+			req = withDeviceContext(req, telTestDeviceUUID)
+			w := httptest.NewRecorder()
+
+			h.GetTelemetryAggregate(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var response aggregateResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Series) != 1 || response.Series[0].Type != "temperature" {
+				t.Fatalf("expected single temperature series, got %+v", response.Series)
+			}
+
+			points := response.Series[0].Points
+			if len(points) != len(tt.want) {
+				t.Fatalf("expected %d points, got %d", len(tt.want), len(points))
+			}
+			for i, want := range tt.want {
+				if points[i].Value != want {
+					t.Errorf("bucket %d: expected %v, got %v", i, want, points[i].Value)
+				}
+			}
+			if !points[1].Time.Equal(base.Add(5 * time.Minute)) {
+				t.Errorf("expected second bucket at %v, got %v", base.Add(5*time.Minute), points[1].Time)
+			}
+		})
+	}
+}
+
+func TestGetTelemetryAggregate_AllTypes(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	seedAggregateReadings(mockStore, time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC))
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/telemetry/aggregate?from=2026-01-15T10:00:00Z&to=2026-01-15T11:00:00Z&bucket=1h", nil)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetryAggregate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response aggregateResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Fn != AggAvg {
+		t.Errorf("expected default fn %q, got %q", AggAvg, response.Fn)
+	}
+	if len(response.Series) != 2 || response.Series[0].Type != "humidity" || response.Series[1].Type != "temperature" {
+		t.Fatalf("expected humidity and temperature series, got %+v", response.Series)
+	}
+	if response.Series[0].Unit != "unit-humidity" {
+		t.Errorf("expected unit to be carried over, got %q", response.Series[0].Unit)
+	}
+}
+
+func TestGetTelemetryAggregate_PushDown(t *testing.T) {
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		query  string
+		pushed bool
+	}{
+		{"avg", "type=temperature&type=humidity&bucket=5m&fn=avg", true},
+		{"sum", "type=temperature&bucket=5m&fn=sum", true},
+		{"count", "type=temperature&bucket=5m&fn=count", true},
+		{"unaligned range", "type=temperature&bucket=5m&fn=avg&from=2026-01-15T10:02:00Z", true},
+		{"max has no store function", "type=temperature&bucket=5m&fn=max", false},
+		{"all types", "bucket=5m&fn=avg", false},
+		{"too many buckets", "type=temperature&bucket=10s&fn=avg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := "/telemetry/aggregate?" + tt.query
+			if !strings.Contains(tt.query, "from=") {
+				query += "&from=2026-01-15T10:00:00Z"
+			}
+			query += "&to=2026-01-15T11:00:00Z"
+
+			// The same request answered in-process
+			plain := NewMockTelemetryStore()
+			seedAggregateReadings(plain, base)
+			want := httptest.NewRecorder()
+			NewWithStores(plain, nil, nil, nil, nil, nil).GetTelemetryAggregate(want, withDeviceContext(httptest.NewRequest(http.MethodGet, query, nil), telTestDeviceUUID))
+
+			store := NewMockAggregatingTelemetryStore()
+			seedAggregateReadings(store.MockTelemetryStore, base)
+			w := httptest.NewRecorder()
+			NewWithStores(store, nil, nil, nil, nil, nil).GetTelemetryAggregate(w, withDeviceContext(httptest.NewRequest(http.MethodGet, query, nil), telTestDeviceUUID))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if store.AggregateCalls != 1 || (store.Pushdowns == 1) != tt.pushed {
+				t.Errorf("expected pushed=%v, got %d calls, %d push-downs", tt.pushed, store.AggregateCalls, store.Pushdowns)
+			}
+			if w.Body.String() != want.Body.String() {
+				t.Errorf("push-down result differs from in-process:\n got %s\nwant %s", w.Body.String(), want.Body.String())
+			}
+		})
+	}
+}
+
+func TestPushdownRanges(t *testing.T) {
+	q := AggregateQuery{
+		Types:  []string{"temperature"},
+		From:   time.Date(2026, 1, 15, 10, 2, 0, 0, time.UTC),
+		To:     time.Date(2026, 1, 15, 10, 12, 0, 0, time.UTC),
+		Bucket: 5 * time.Minute,
+		Func:   AggAvg,
+	}
+	ranges, err := pushdownRanges(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Buckets 10:00, 10:05 and 10:10, clipped to [10:02, 10:12)
+	if len(ranges) != 3 ||
+		!ranges[0].Start.Equal(time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)) || !ranges[0].From.Equal(q.From) ||
+		!ranges[2].To.Equal(q.To) || !ranges[1].From.Equal(ranges[0].To) {
+		t.Errorf("unexpected ranges %+v", ranges)
+	}
+
+	q.Func = AggLast
+	if _, err := pushdownRanges(q); !errors.Is(err, ErrAggregateUnsupported) {
+		t.Errorf("expected ErrAggregateUnsupported for last, got %v", err)
+	}
+}
+
+func TestGetTelemetryAggregate_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing from", "bucket=5m"},
+		{"invalid from", "from=yesterday&bucket=5m"},
+		{"to before from", "from=2026-01-15T11:00:00Z&to=2026-01-15T10:00:00Z&bucket=5m"},
+		{"missing bucket", "from=2026-01-15T10:00:00Z"},
+		{"invalid bucket", "from=2026-01-15T10:00:00Z&bucket=five"},
+		{"bucket too small", "from=2026-01-15T10:00:00Z&bucket=10ms"},
+		{"too many buckets", "from=2026-01-01T00:00:00Z&to=2026-02-01T00:00:00Z&bucket=1s"},
+		{"invalid fn", "from=2026-01-15T10:00:00Z&bucket=5m&fn=median"},
+		{"invalid type", "from=2026-01-15T10:00:00Z&bucket=5m&type=123invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/telemetry/aggregate?"+tt.query, nil)
+			req = withDeviceContext(req, telTestDeviceUUID)
+			w := httptest.NewRecorder()
+
+			h.GetTelemetryAggregate(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTelemetryAggregate_Unauthorized(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/telemetry/aggregate?from=2026-01-15T10:00:00Z&bucket=5m", nil)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetryAggregate(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestGetTelemetryAggregate_StoreError(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockStore.GetErr = errors.New("database error")
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/telemetry/aggregate?from=2026-01-15T10:00:00Z&to=2026-01-15T11:00:00Z&bucket=5m", nil)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetryAggregate(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	ts := time.Date(2026, 1, 15, 10, 7, 42, 0, time.UTC)
+
+	if got := time.Unix(0, bucketStart(ts, 5*time.Minute)).UTC(); !got.Equal(time.Date(2026, 1, 15, 10, 5, 0, 0, time.UTC)) {
+		t.Errorf("5m bucket: got %v", got)
+	}
+	if got := time.Unix(0, bucketStart(ts, 24*time.Hour)).UTC(); !got.Equal(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("1d bucket: got %v", got)
+	}
+}
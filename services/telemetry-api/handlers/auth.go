@@ -226,6 +226,16 @@ func GetDeviceIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// ClaimTokenExpiry is the claims key AuthService implementations set to the verified
+// token's expiry (time.Time), so long-lived connections can end when the token does
+const ClaimTokenExpiry = "token_expires_at"
+
+// tokenExpiry returns when the token behind claims expires (zero if unknown)
+func tokenExpiry(claims map[string]interface{}) time.Time {
+	exp, _ := claims[ClaimTokenExpiry].(time.Time)
+	return exp
+}
+
 // GetDeviceClaimsFromContext extracts device claims from request context
 func GetDeviceClaimsFromContext(ctx context.Context) map[string]interface{} {
 	if v := ctx.Value(deviceClaimsKey); v != nil {
@@ -346,6 +356,9 @@ func (h *Handlers) RevokeDevice(w http.ResponseWriter, r *http.Request) {
 		h.deviceStatusCache.Invalidate(deviceID)
 	}
 
+	// End open command streams now (other instances learn through StartRevocationWatcher)
+	h.commandStreams.disconnect(deviceID, errDeviceRevoked)
+
 	h.logger.Info("device revoked",
 		"request_id", reqID,
 		"device_id", deviceID,
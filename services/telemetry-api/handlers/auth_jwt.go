@@ -171,6 +171,9 @@ func (s *JWTAuthService) VerifyToken(ctx context.Context, tokenString string) (s
 	for k, v := range claims.Claims {
 		claimsMap[k] = v
 	}
+	if claims.ExpiresAt != nil {
+		claimsMap[ClaimTokenExpiry] = claims.ExpiresAt.Time // Set last so custom claims cannot override it
+	}
 
 	return claims.DeviceID, claimsMap, nil
 }
@@ -63,17 +63,27 @@ func (m *MockAuthService) VerifyToken(ctx context.Context, token string) (string
 		return "", nil, errors.New("token expired")
 	}
 
-	return t.deviceID, t.claims, nil
+	claims := make(map[string]interface{}, len(t.claims)+1)
+	for k, v := range t.claims {
+		claims[k] = v
+	}
+	claims[ClaimTokenExpiry] = t.expiresAt
+	return t.deviceID, claims, nil
 }
 
 // AddToken adds a token directly (for testing)
 func (m *MockAuthService) AddToken(token, deviceID string, claims map[string]interface{}) {
+	m.AddTokenWithExpiry(token, deviceID, claims, time.Now().Add(1*time.Hour))
+}
+
+// AddTokenWithExpiry adds a token that expires at expiresAt (for testing)
+func (m *MockAuthService) AddTokenWithExpiry(token, deviceID string, claims map[string]interface{}, expiresAt time.Time) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.tokens[token] = mockToken{
 		deviceID:  deviceID,
 		claims:    claims,
-		expiresAt: time.Now().Add(1 * time.Hour),
+		expiresAt: expiresAt,
 	}
 }
@@ -15,6 +15,8 @@ type schemaKey struct {
 
 // SchemaCache provides cached access to measurement schemas.
 // It wraps a SchemaStore and caches results for the configured TTL.
+// Lookups fall back to a compatible schema when a version has no exact upload
+// (see resolveSchema).
 type SchemaCache struct {
 	store SchemaStore
 	cache *cache.TTL[schemaKey, *MeasurementSchema]
@@ -28,13 +30,13 @@ func NewSchemaCache(store SchemaStore, ttl time.Duration) *SchemaCache {
 	// Note: loader doesn't have context, so we use a background context
 	// This is a tradeoff for the generic cache design
 	sc.cache = cache.NewTTL(func(key schemaKey) (*MeasurementSchema, error) {
-		return store.Get(context.Background(), key.appName, key.version)
+		return resolveSchema(context.Background(), store, key.appName, key.version)
 	}, ttl)
 
 	return sc
 }
 
-// Get retrieves a schema, using cache if available.
+// Get resolves the schema for a firmware version, using cache if available.
 func (c *SchemaCache) Get(ctx context.Context, appName, version string) (*MeasurementSchema, error) {
 	// For now, we ignore ctx since the generic cache doesn't support it
 	// In a production system, you might want a context-aware cache
@@ -47,11 +49,34 @@ func (c *SchemaCache) Save(ctx context.Context, appName, version string, schema
 		return err
 	}
 
-	// Update cache immediately
+	// Other versions may have resolved to a fallback this upload supersedes;
+	// schema writes are rare, so drop everything rather than track fallbacks
+	c.cache.InvalidateAll()
 	c.cache.Set(schemaKey{appName, version}, schema)
 	return nil
 }
 
+// ListVersions reads through to the store (listings are not cached).
+func (c *SchemaCache) ListVersions(ctx context.Context, appName string) ([]MeasurementSchema, error) {
+	return c.store.ListVersions(ctx, appName)
+}
+
+// List reads through to the store (listings are not cached).
+func (c *SchemaCache) List(ctx context.Context) ([]MeasurementSchema, error) {
+	return c.store.List(ctx)
+}
+
+// Delete removes from store and invalidates cached schemas.
+func (c *SchemaCache) Delete(ctx context.Context, appName, version string) error {
+	if err := c.store.Delete(ctx, appName, version); err != nil {
+		return err
+	}
+
+	// Clears fallbacks resolved to the deleted version as well
+	c.cache.InvalidateAll()
+	return nil
+}
+
 // Invalidate removes a schema from cache.
 func (c *SchemaCache) Invalidate(appName, version string) {
 	c.cache.Invalidate(schemaKey{appName, version})
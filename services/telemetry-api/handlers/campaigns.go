@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/semver"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+	"github.com/google/uuid"
+)
+
+// MaxCampaignDevices bounds the devices targeted by one bulk command
+// (its commands are created in a single atomic batch)
+const MaxCampaignDevices = MaxAtomicBatchSize
+
+// Reasons a device is skipped by a bulk command
+const (
+	CampaignSkipNotFound = "not_found"
+	CampaignSkipRevoked  = "revoked"
+)
+
+// BulkCommandRequest is the body of POST /admin/commands/bulk.
+// Exactly one of DeviceIDs and Selector chooses the target devices.
+type BulkCommandRequest struct {
+	Type      string                 `json:"type"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+	NotBefore *time.Time             `json:"not_before,omitempty"` // Devices receive the commands from then on
+	ExpiresAt *time.Time             `json:"expires_at,omitempty"`
+	DeviceIDs []string               `json:"device_ids,omitempty"`
+	Selector  *DeviceSelector        `json:"selector,omitempty"`
+	DryRun    bool                   `json:"dry_run"` // Report the target devices without creating commands
+}
+
+// DeviceSelector matches devices on every set field (at least one is required)
+type DeviceSelector struct {
+	AppName    string `json:"app_name,omitempty" firestore:"app_name,omitempty"`
+	AppVersion string `json:"app_version,omitempty" firestore:"app_version,omitempty"` // Exact version or range, e.g. ">=1.4.0 <2.0.0"
+	Tag        string `json:"tag,omitempty" firestore:"tag,omitempty"`
+}
+
+// CampaignSkip reports a requested device that received no command
+type CampaignSkip struct {
+	DeviceID string `json:"device_id"`
+	Reason   string `json:"reason"` // CampaignSkip* constant
+}
+
+// CampaignCommand is one device's command of a campaign
+type CampaignCommand struct {
+	DeviceID     string    `json:"device_id"`
+	CommandID    string    `json:"command_id"`
+	Status       string    `json:"status,omitempty"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at,omitzero"`
+}
+
+// CampaignCounts summarizes the statuses of a campaign's commands. Pending commands past
+// their expiry are counted as expired: devices no longer receive them.
+type CampaignCounts struct {
+	Pending      int `json:"pending"`
+	Acknowledged int `json:"acknowledged"`
+	Completed    int `json:"completed"`
+	Failed       int `json:"failed"`
+	Expired      int `json:"expired"`
+}
+
+// CampaignStatus is the response of GET /admin/campaigns/{id}
+type CampaignStatus struct {
+	CampaignID string            `json:"campaign_id"`
+	Type       string            `json:"type"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+	Total      int               `json:"total"`
+	Counts     CampaignCounts    `json:"counts"`
+	Commands   []CampaignCommand `json:"commands"` // Ordered by device ID
+}
+
+// deviceMatcher is a validated DeviceSelector
+type deviceMatcher struct {
+	appName  string
+	versions *semver.Range // nil = any version
+	tag      string
+}
+
+// compile validates the selector
+func (s *DeviceSelector) compile() (*deviceMatcher, error) {
+	if s.AppName == "" && s.AppVersion == "" && s.Tag == "" {
+		return nil, errors.New("selector needs at least one of app_name, app_version, tag")
+	}
+	m := &deviceMatcher{appName: s.AppName, tag: s.Tag}
+	if s.AppName != "" {
+		if err := validate.Identifier(s.AppName); err != nil {
+			return nil, fmt.Errorf("invalid selector app_name: %v", err)
+		}
+	}
+	if s.AppVersion != "" {
+		versions, err := semver.ParseRange(s.AppVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector app_version: %v", err)
+		}
+		m.versions = &versions
+	}
+	if s.Tag != "" {
+		if err := validate.Identifier(s.Tag); err != nil {
+			return nil, fmt.Errorf("invalid selector tag: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// matches reports whether a device satisfies the selector.
+// Devices reporting an unparsable firmware version never match a version selector.
+func (m *deviceMatcher) matches(d *Device) bool {
+	if m.appName != "" && d.AppName != m.appName {
+		return false
+	}
+	if m.tag != "" && !slices.Contains(d.Tags, m.tag) {
+		return false
+	}
+	if m.versions != nil {
+		v, err := semver.Parse(d.AppVersion)
+		if err != nil || !m.versions.Contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateBulkCommand handles POST /admin/commands/bulk - fans a command out to a list of
+// devices or to the devices matching a selector. Each device gets its own command, all
+// sharing a campaign_id (see GetCampaign). Revoked and unknown devices are skipped.
+func (h *Handlers) CreateBulkCommand(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	var req BulkCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	template := Command{Type: req.Type, Payload: req.Payload, NotBefore: req.NotBefore, ExpiresAt: req.ExpiresAt}
+	if err := validateNewCommand(&template); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matcher, err := compileTargets(req.DeviceIDs, req.Selector)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, skipped, err := h.resolveTargets(ctx, req.DeviceIDs, matcher)
+	if err != nil {
+		h.logger.Error("failed to list devices",
+			"request_id", reqID,
+			"error", err,
+		)
+		h.jsonError(w, "failed to list devices", http.StatusInternalServerError)
+		return
+	}
+	if skipped == nil {
+		skipped = []CampaignSkip{}
+	}
+
+	if len(targets) > MaxCampaignDevices {
+		h.jsonError(w, fmt.Sprintf("selector matches %d devices (max %d)", len(targets), MaxCampaignDevices), http.StatusBadRequest)
+		return
+	}
+
+	if req.DryRun {
+		if targets == nil {
+			targets = []string{}
+		}
+		h.jsonResponse(w, map[string]interface{}{
+			"dry_run":    true,
+			"count":      len(targets),
+			"device_ids": targets,
+			"skipped":    skipped,
+		}, http.StatusOK)
+		return
+	}
+
+	if len(targets) == 0 {
+		h.jsonError(w, "no active devices to command", http.StatusBadRequest)
+		return
+	}
+
+	campaignID, ids, err := h.createCampaign(ctx, &template, targets)
+	if err != nil {
+		h.logger.Error("failed to store bulk command",
+			"request_id", reqID,
+			"error", err,
+			"campaign_id", campaignID,
+			"type", req.Type,
+			"devices", len(targets),
+		)
+		h.jsonError(w, "failed to create commands", http.StatusInternalServerError)
+		return
+	}
+
+	created := make([]CampaignCommand, len(ids))
+	for i, id := range ids {
+		created[i] = CampaignCommand{DeviceID: targets[i], CommandID: id}
+	}
+
+	h.logger.Info("bulk command created",
+		"request_id", reqID,
+		"campaign_id", campaignID,
+		"type", req.Type,
+		"devices", len(created),
+		"skipped", len(skipped),
+	)
+
+	h.jsonResponse(w, map[string]interface{}{
+		"campaign_id": campaignID,
+		"type":        req.Type,
+		"count":       len(created),
+		"commands":    created,
+		"skipped":     skipped,
+	}, http.StatusCreated)
+}
+
+// compileTargets validates the target devices of a bulk command or schedule: exactly one
+// of deviceIDs and selector. The matcher is nil when deviceIDs are given.
+func compileTargets(deviceIDs []string, selector *DeviceSelector) (*deviceMatcher, error) {
+	if (len(deviceIDs) > 0) == (selector != nil) {
+		return nil, errors.New("exactly one of device_ids and selector is required")
+	}
+	if len(deviceIDs) > MaxCampaignDevices {
+		return nil, fmt.Errorf("too many device_ids (max %d)", MaxCampaignDevices)
+	}
+	for _, id := range deviceIDs {
+		if err := validate.UUID(id); err != nil {
+			return nil, fmt.Errorf("invalid device_id %q: %v", id, err)
+		}
+	}
+	if selector == nil {
+		return nil, nil
+	}
+	return selector.compile()
+}
+
+// resolveTargets returns the devices to command (matched by m, else the listed deviceIDs)
+// and the ones skipped because they are revoked or unknown
+func (h *Handlers) resolveTargets(ctx context.Context, deviceIDs []string, m *deviceMatcher) ([]string, []CampaignSkip, error) {
+	if m != nil {
+		return h.selectDevices(ctx, m)
+	}
+	return h.lookupDevices(ctx, deviceIDs)
+}
+
+// createCampaign creates a copy of the template command for each target device under a
+// new campaign ID and wakes the devices. The command IDs are index-aligned with targets.
+func (h *Handlers) createCampaign(ctx context.Context, template *Command, targets []string) (string, []string, error) {
+	campaignID := uuid.New().String()
+	now := time.Now().UTC()
+	cmds := make([]Command, len(targets))
+	for i, deviceID := range targets {
+		cmds[i] = Command{
+			DeviceID:   deviceID,
+			Type:       template.Type,
+			Payload:    template.Payload,
+			NotBefore:  template.NotBefore,
+			ExpiresAt:  template.ExpiresAt,
+			CampaignID: campaignID,
+			ScheduleID: template.ScheduleID,
+		}
+		newPendingCommand(&cmds[i], now)
+	}
+
+	ids, err := h.commandStore.SaveMany(ctx, cmds)
+	if err != nil {
+		return campaignID, nil, err
+	}
+	for _, deviceID := range targets {
+		h.commandHub.Notify(deviceID)
+	}
+	return campaignID, ids, nil
+}
+
+// lookupDevices returns the requested devices that can receive commands, without
+// duplicates and in request order, and reports unknown and revoked ones as skipped.
+// Other device store errors fail the lookup.
+func (h *Handlers) lookupDevices(ctx context.Context, deviceIDs []string) ([]string, []CampaignSkip, error) {
+	var targets []string
+	var skipped []CampaignSkip
+	seen := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		device, err := h.deviceStore.GetByID(ctx, id)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			skipped = append(skipped, CampaignSkip{DeviceID: id, Reason: CampaignSkipNotFound})
+		case err != nil:
+			return nil, nil, err
+		case device.Revoked:
+			skipped = append(skipped, CampaignSkip{DeviceID: id, Reason: CampaignSkipRevoked})
+		default:
+			targets = append(targets, id)
+		}
+	}
+	return targets, skipped, nil
+}
+
+// selectDevices returns the devices matching m that can receive commands (ordered by
+// device ID) and reports matching revoked devices as skipped
+func (h *Handlers) selectDevices(ctx context.Context, m *deviceMatcher) ([]string, []CampaignSkip, error) {
+	devices, err := h.deviceStore.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var targets []string
+	var skipped []CampaignSkip
+	for i := range devices {
+		switch {
+		case !m.matches(&devices[i]):
+		case devices[i].Revoked:
+			skipped = append(skipped, CampaignSkip{DeviceID: devices[i].DeviceID, Reason: CampaignSkipRevoked})
+		default:
+			targets = append(targets, devices[i].DeviceID)
+		}
+	}
+	sort.Strings(targets)
+	return targets, skipped, nil
+}
+
+// GetCampaign handles GET /admin/campaigns/{id} - status of the commands created by one
+// bulk request: counts per status and each device's command
+func (h *Handlers) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	campaignID := r.PathValue("id")
+	if err := validate.UUID(campaignID); err != nil {
+		h.jsonError(w, "invalid campaign id", http.StatusBadRequest)
+		return
+	}
+
+	cmds, err := h.commandStore.GetByCampaign(ctx, campaignID)
+	if err != nil {
+		h.logger.Error("failed to retrieve campaign",
+			"request_id", reqID,
+			"error", err,
+			"campaign_id", campaignID,
+		)
+		h.jsonError(w, "failed to retrieve campaign", http.StatusInternalServerError)
+		return
+	}
+	if len(cmds) == 0 {
+		h.jsonError(w, "campaign not found", http.StatusNotFound)
+		return
+	}
+
+	h.jsonResponse(w, summarizeCampaign(campaignID, cmds, time.Now()), http.StatusOK)
+}
+
+// summarizeCampaign counts a campaign's commands by status as of now
+func summarizeCampaign(campaignID string, cmds []Command, now time.Time) CampaignStatus {
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].DeviceID < cmds[j].DeviceID })
+
+	status := CampaignStatus{
+		CampaignID: campaignID,
+		Type:       cmds[0].Type,
+		CreatedAt:  cmds[0].CreatedAt,
+		ExpiresAt:  cmds[0].ExpiresAt,
+		Total:      len(cmds),
+		Commands:   make([]CampaignCommand, len(cmds)),
+	}
+	for i, cmd := range cmds {
+		state := cmd.Status
+		if state == CommandPending && cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(now) {
+			state = "expired"
+		}
+		switch state {
+		case CommandPending:
+			status.Counts.Pending++
+		case CommandAcknowledged:
+			status.Counts.Acknowledged++
+		case CommandCompleted:
+			status.Counts.Completed++
+		case CommandFailed:
+			status.Counts.Failed++
+		case "expired":
+			status.Counts.Expired++
+		}
+		status.Commands[i] = CampaignCommand{
+			DeviceID:     cmd.DeviceID,
+			CommandID:    cmd.ID,
+			Status:       state,
+			ErrorMessage: cmd.ErrorMessage,
+			UpdatedAt:    cmd.UpdatedAt,
+		}
+	}
+	return status
+}
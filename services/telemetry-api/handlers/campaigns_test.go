@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test UUIDs for campaign tests
+const (
+	campTestDeviceA = "550e8400-e29b-41d4-a716-446655440061"
+	campTestDeviceB = "550e8400-e29b-41d4-a716-446655440062"
+	campTestDeviceC = "550e8400-e29b-41d4-a716-446655440063"
+	campTestRevoked = "550e8400-e29b-41d4-a716-446655440064"
+	campTestUnknown = "550e8400-e29b-41d4-a716-446655440065"
+)
+
+type bulkResponse struct {
+	CampaignID string            `json:"campaign_id"`
+	Count      int               `json:"count"`
+	Commands   []CampaignCommand `json:"commands"`
+	Skipped    []CampaignSkip    `json:"skipped"`
+	DeviceIDs  []string          `json:"device_ids"`
+	DryRun     bool              `json:"dry_run"`
+}
+
+// newCampaignTestHandlers registers a small fleet
+func newCampaignTestHandlers() (*Handlers, *MockCommandStore) {
+	devices := NewMockDeviceStore()
+	devices.data[campTestDeviceA] = Device{DeviceID: campTestDeviceA, AppName: "probe", AppVersion: "1.4.2", Tags: []string{"greenhouse"}}
+	devices.data[campTestDeviceB] = Device{DeviceID: campTestDeviceB, AppName: "probe", AppVersion: "2.0.0"}
+	devices.data[campTestDeviceC] = Device{DeviceID: campTestDeviceC, AppName: "valve", AppVersion: "1.5.0", Tags: []string{"greenhouse"}}
+	devices.data[campTestRevoked] = Device{DeviceID: campTestRevoked, AppName: "probe", AppVersion: "1.4.0", Revoked: true}
+	commands := NewMockCommandStore()
+	return NewWithStores(nil, commands, devices, nil, nil, nil), commands
+}
+
+func postBulkCommand(h *Handlers, body string) (*httptest.ResponseRecorder, bulkResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/admin/commands/bulk", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.CreateBulkCommand(w, req)
+
+	var response bulkResponse
+	json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&response)
+	return w, response
+}
+
+func getCampaign(h *Handlers, id string) (*httptest.ResponseRecorder, CampaignStatus) {
+	req := httptest.NewRequest(http.MethodGet, "/admin/campaigns/"+id, nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	h.GetCampaign(w, req)
+
+	var status CampaignStatus
+	json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&status)
+	return w, status
+}
+
+func commandDevices(cmds []CampaignCommand) []string {
+	ids := make([]string, len(cmds))
+	for i, c := range cmds {
+		ids[i] = c.DeviceID
+	}
+	return ids
+}
+
+func TestCreateBulkCommand_DeviceIDs(t *testing.T) {
+	h, commands := newCampaignTestHandlers()
+
+	body := `{"type": "reboot", "payload": {"delay": 5}, "device_ids": ["` +
+		campTestDeviceB + `", "` + campTestRevoked + `", "` + campTestUnknown + `", "` + campTestDeviceA + `", "` + campTestDeviceB + `"]}`
+	w, response := postBulkCommand(h, body)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	// Request order, duplicates removed
+	if got := commandDevices(response.Commands); response.Count != 2 || len(got) != 2 || got[0] != campTestDeviceB || got[1] != campTestDeviceA {
+		t.Errorf("expected commands for B and A, got %+v", response)
+	}
+	wantSkipped := []CampaignSkip{{campTestRevoked, CampaignSkipRevoked}, {campTestUnknown, CampaignSkipNotFound}}
+	if len(response.Skipped) != 2 || response.Skipped[0] != wantSkipped[0] || response.Skipped[1] != wantSkipped[1] {
+		t.Errorf("expected skipped %v, got %v", wantSkipped, response.Skipped)
+	}
+
+	for _, c := range response.Commands {
+		cmd, err := commands.GetByID(context.Background(), c.CommandID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.DeviceID != c.DeviceID || cmd.CampaignID != response.CampaignID || cmd.Type != "reboot" ||
+			cmd.Status != CommandPending || cmd.Payload["delay"] != float64(5) || cmd.ExpiresAt == nil {
+			t.Errorf("unexpected stored command %+v", cmd)
+		}
+	}
+}
+
+func TestCreateBulkCommand_Selector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+		skipped  int
+	}{
+		{"app", `{"app_name": "probe"}`, []string{campTestDeviceA, campTestDeviceB}, 1},
+		{"exact version", `{"app_name": "probe", "app_version": "v2.0.0"}`, []string{campTestDeviceB}, 0},
+		{"version range", `{"app_version": ">=1.4.0 <2.0.0"}`, []string{campTestDeviceA, campTestDeviceC}, 1},
+		{"tag", `{"tag": "greenhouse"}`, []string{campTestDeviceA, campTestDeviceC}, 0},
+		{"app and tag", `{"app_name": "valve", "tag": "greenhouse"}`, []string{campTestDeviceC}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newCampaignTestHandlers()
+			w, response := postBulkCommand(h, `{"type": "reboot", "selector": `+tt.selector+`}`)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+			}
+			got := commandDevices(response.Commands)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected devices %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected devices %v, got %v", tt.want, got)
+				}
+			}
+			if len(response.Skipped) != tt.skipped {
+				t.Errorf("expected %d skipped, got %v", tt.skipped, response.Skipped)
+			}
+		})
+	}
+}
+
+func TestCreateBulkCommand_DryRun(t *testing.T) {
+	h, commands := newCampaignTestHandlers()
+
+	w, response := postBulkCommand(h, `{"type": "reboot", "selector": {"app_name": "probe"}, "dry_run": true}`)
+
+	if w.Code != http.StatusOK || !response.DryRun || response.Count != 2 || response.CampaignID != "" {
+		t.Errorf("unexpected dry run response %d: %s", w.Code, w.Body.String())
+	}
+	if len(commands.data) != 0 {
+		t.Errorf("dry run stored %d commands", len(commands.data))
+	}
+}
+
+func TestCreateBulkCommand_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{`},
+		{"missing type", `{"device_ids": ["` + campTestDeviceA + `"]}`},
+		{"no targets", `{"type": "reboot"}`},
+		{"both targets", `{"type": "reboot", "device_ids": ["` + campTestDeviceA + `"], "selector": {"tag": "greenhouse"}}`},
+		{"invalid device id", `{"type": "reboot", "device_ids": ["nope"]}`},
+		{"empty selector", `{"type": "reboot", "selector": {}}`},
+		{"invalid range", `{"type": "reboot", "selector": {"app_version": ">=x"}}`},
+		{"invalid tag", `{"type": "reboot", "selector": {"tag": "a b"}}`},
+		{"nothing matched", `{"type": "reboot", "selector": {"app_name": "other"}}`},
+		{"only revoked", `{"type": "reboot", "device_ids": ["` + campTestRevoked + `"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, commands := newCampaignTestHandlers()
+			w, _ := postBulkCommand(h, tt.body)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+			if len(commands.data) != 0 {
+				t.Errorf("stored %d commands", len(commands.data))
+			}
+		})
+	}
+}
+
+func TestCreateBulkCommand_StoreError(t *testing.T) {
+	h, commands := newCampaignTestHandlers()
+	commands.SaveErr = errors.New("firestore unavailable")
+
+	w, _ := postBulkCommand(h, `{"type": "reboot", "selector": {"tag": "greenhouse"}}`)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestCreateBulkCommand_DeviceLookupError(t *testing.T) {
+	h, commands := newCampaignTestHandlers()
+	h.deviceStore.(*MockDeviceStore).GetErr = errors.New("firestore unavailable")
+
+	// A failed lookup is not an unknown device: nothing is skipped or created
+	w, _ := postBulkCommand(h, `{"type": "reboot", "device_ids": ["`+campTestDeviceA+`"]}`)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+	if len(commands.data) != 0 {
+		t.Errorf("expected no commands, got %d", len(commands.data))
+	}
+}
+
+func TestCreateBulkCommand_WakesDevices(t *testing.T) {
+	h, _ := newCampaignTestHandlers()
+	wake, cancel := h.commandHub.Subscribe(campTestDeviceC)
+	defer cancel()
+
+	postBulkCommand(h, `{"type": "open_valve", "selector": {"app_name": "valve"}}`)
+
+	select {
+	case <-wake:
+	default:
+		t.Error("expected the targeted device to be woken")
+	}
+}
+
+func TestGetCampaign(t *testing.T) {
+	h, _ := newCampaignTestHandlers()
+	_, created := postBulkCommand(h, `{"type": "reboot", "selector": {"tag": "greenhouse"}}`)
+
+	// Device A runs the command to completion, device C fails it
+	run := func(deviceID, to string, report *CommandReport) {
+		for _, c := range created.Commands {
+			if c.DeviceID != deviceID {
+				continue
+			}
+			if _, _, err := h.setCommandStatus(context.Background(), deviceID, c.CommandID, CommandAcknowledged, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := h.setCommandStatus(context.Background(), deviceID, c.CommandID, to, report.apply); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	run(campTestDeviceA, CommandCompleted, &CommandReport{})
+	run(campTestDeviceC, CommandFailed, &CommandReport{ErrorMessage: "valve stuck"})
+
+	w, status := getCampaign(h, created.CampaignID)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if status.Total != 2 || status.Type != "reboot" || status.Counts != (CampaignCounts{Completed: 1, Failed: 1}) {
+		t.Errorf("unexpected campaign status %+v", status)
+	}
+	if len(status.Commands) != 2 || status.Commands[1].DeviceID != campTestDeviceC || status.Commands[1].ErrorMessage != "valve stuck" {
+		t.Errorf("unexpected campaign commands %+v", status.Commands)
+	}
+}
+
+func TestGetCampaign_NotFound(t *testing.T) {
+	h, _ := newCampaignTestHandlers()
+
+	if w, _ := getCampaign(h, campTestUnknown); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w, _ := getCampaign(h, "not-a-uuid"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestSummarizeCampaign(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	cmds := []Command{
+		{ID: "c4", DeviceID: "d4", Status: CommandAcknowledged, ExpiresAt: &past},
+		{ID: "c1", DeviceID: "d1", Status: CommandPending, ExpiresAt: &future},
+		{ID: "c3", DeviceID: "d3", Status: CommandPending, ExpiresAt: &past},
+		{ID: "c2", DeviceID: "d2", Status: CommandCompleted},
+	}
+
+	status := summarizeCampaign("camp", cmds, now)
+
+	want := CampaignCounts{Pending: 1, Acknowledged: 1, Completed: 1, Expired: 1}
+	if status.Counts != want || status.Total != 4 {
+		t.Errorf("expected counts %+v, got %+v", want, status.Counts)
+	}
+	if status.Commands[0].CommandID != "c1" || status.Commands[2].Status != "expired" {
+		t.Errorf("unexpected commands %+v", status.Commands)
+	}
+}
@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
 )
 
 // GetCommands handles GET /commands - retrieves pending commands for authenticated device
+// Paginated via limit + page_token; expired commands and commands whose not_before is
+// still in the future are skipped, reading further pages until limit commands are found.
+// With wait (e.g. wait=30s) an empty first page of pending commands blocks until a
+// command is created for the device or the wait elapses.
+// Responds with a protobuf CommandList when the device sends Accept: application/x-protobuf
 func (h *Handlers) GetCommands(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	reqID := middleware.GetRequestID(ctx)
@@ -24,45 +33,104 @@ func (h *Handlers) GetCommands(w http.ResponseWriter, r *http.Request) {
 
 	status := r.URL.Query().Get("status")
 	if status == "" {
-		status = "pending"
+		status = CommandPending
 	}
 
 	// Validate status to prevent injection
-	validStatuses := map[string]bool{
-		"pending":      true,
-		"acknowledged": true,
-		"completed":    true,
-		"failed":       true,
-	}
-	if !validStatuses[status] {
+	if !isCommandStatus(status) {
 		h.jsonError(w, "invalid status: must be one of pending, acknowledged, completed, failed", http.StatusBadRequest)
 		return
 	}
 
-	commands, err := h.commandStore.GetByDeviceID(ctx, deviceID, status)
+	limit, err := parsePageSize(r)
 	if err != nil {
-		h.logger.Error("failed to retrieve commands",
-			"request_id", reqID,
-			"error", err,
-			"device_id", deviceID,
-		)
-		h.jsonError(w, "failed to retrieve commands", http.StatusInternalServerError)
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Filter expired commands
+	after, err := decodePageToken(r.URL.Query().Get("page_token"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wait, err := parseCommandWait(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wait > 0 && (status != CommandPending || after != nil) {
+		h.jsonError(w, "wait is only supported on the first page of pending commands", http.StatusBadRequest)
+		return
+	}
+
+	var wake <-chan struct{}
+	var deadline <-chan time.Time
+	if wait > 0 {
+		// Subscribe before the first read so a command created in between still wakes us
+		var unsubscribe func()
+		wake, unsubscribe = h.commandHub.Subscribe(deviceID)
+		defer unsubscribe()
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+
+		// Long-polls outlive the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + commandWaitWriteSlack))
+	}
+
 	var validCommands []Command
-	now := time.Now()
-	for _, cmd := range commands {
-		if cmd.ExpiresAt == nil || cmd.ExpiresAt.After(now) {
-			validCommands = append(validCommands, cmd)
+	var next *PageCursor
+poll:
+	for {
+		var nextDue time.Time
+		var err error
+		validCommands, next, nextDue, err = h.deliverableCommands(ctx, deviceID, status, limit, after)
+		if err != nil {
+			h.logger.Error("failed to retrieve commands",
+				"request_id", reqID,
+				"error", err,
+				"device_id", deviceID,
+			)
+			h.jsonError(w, "failed to retrieve commands", http.StatusInternalServerError)
+			return
+		}
+
+		if len(validCommands) > 0 || wait == 0 {
+			break
+		}
+		var due <-chan time.Time
+		if !nextDue.IsZero() {
+			due = time.After(time.Until(nextDue))
+		}
+
+		select {
+		case <-wake: // A command was created for this device, read again
+		case <-due: // A command scheduled for later became due
+		case <-deadline:
+			break poll // Empty response, the device polls again
+		case <-ctx.Done():
+			return // Device disconnected
 		}
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
+	// Constrained devices can ask for protobuf instead of JSON
+	if acceptsProtobuf(r) {
+		w.Header().Set("Content-Type", ProtobufContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(encodeCommandList(validCommands, encodePageToken(next)))
+		return
+	}
+
+	response := map[string]interface{}{
 		"data":  validCommands,
 		"count": len(validCommands),
-	}, http.StatusOK)
+	}
+	if token := encodePageToken(next); token != "" {
+		response["next_page_token"] = token
+	}
+
+	h.jsonResponse(w, response, http.StatusOK)
 }
 
 // CreateCommand handles POST /commands - creates a new command (admin only)
@@ -88,42 +156,14 @@ func (h *Handlers) CreateCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if cmd.Type == "" {
-		h.jsonError(w, "type is required", http.StatusBadRequest)
+	if err := validateNewCommand(&cmd); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate command type
-	if err := validate.CommandType(cmd.Type); err != nil {
-		h.jsonError(w, fmt.Sprintf("invalid command type: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	// Validate payload size if present (prevent oversized payloads)
-	if cmd.Payload != nil {
-		payloadBytes, err := json.Marshal(cmd.Payload)
-		if err != nil {
-			h.jsonError(w, "invalid payload", http.StatusBadRequest)
-			return
-		}
-		const maxPayloadSize = 32 * 1024 // 32KB max payload
-		if len(payloadBytes) > maxPayloadSize {
-			h.jsonError(w, "payload too large (max 32KB)", http.StatusBadRequest)
-			return
-		}
-	}
-
 	// Set defaults
-	now := time.Now().UTC()
-	cmd.Status = "pending"
-	cmd.CreatedAt = now
-	cmd.UpdatedAt = now
-
-	// Default expiration: 24 hours
-	if cmd.ExpiresAt == nil {
-		expires := now.Add(24 * time.Hour)
-		cmd.ExpiresAt = &expires
-	}
+	cmd.CampaignID = "" // Only bulk commands belong to a campaign
+	newPendingCommand(&cmd, time.Now().UTC())
 
 	id, err := h.commandStore.Save(ctx, &cmd)
 	if err != nil {
@@ -137,6 +177,7 @@ func (h *Handlers) CreateCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cmd.ID = id
+	h.commandHub.Notify(cmd.DeviceID)
 
 	h.logger.Info("command created",
 		"request_id", reqID,
@@ -148,10 +189,184 @@ func (h *Handlers) CreateCommand(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, cmd, http.StatusCreated)
 }
 
+// validateNewCommand checks the type, payload and delivery window of a new command
+func validateNewCommand(cmd *Command) error {
+	if cmd.Type == "" {
+		return errors.New("type is required")
+	}
+
+	// Validate command type
+	if err := validate.CommandType(cmd.Type); err != nil {
+		return fmt.Errorf("invalid command type: %v", err)
+	}
+
+	// Validate payload size if present (prevent oversized payloads)
+	if cmd.Payload != nil {
+		payloadBytes, err := json.Marshal(cmd.Payload)
+		if err != nil {
+			return errors.New("invalid payload")
+		}
+		if len(payloadBytes) > MaxCommandPayloadSize {
+			return errors.New("payload too large (max 32KB)")
+		}
+	}
+
+	if cmd.NotBefore != nil && cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(*cmd.NotBefore) {
+		return errors.New("expires_at must be after not_before")
+	}
+	return nil
+}
+
+// newPendingCommand resets the server-managed fields of a command created at now
+func newPendingCommand(cmd *Command, now time.Time) {
+	cmd.Status = CommandPending
+	cmd.CreatedAt = now
+	cmd.UpdatedAt = now
+	cmd.AcknowledgedAt, cmd.CompletedAt, cmd.FailedAt = nil, nil, nil // Lifecycle is server-managed
+	cmd.Result, cmd.ErrorMessage, cmd.History = nil, "", nil
+
+	// Default expiration counts from when the command becomes due
+	if cmd.ExpiresAt == nil {
+		due := now
+		if cmd.NotBefore != nil && cmd.NotBefore.After(now) {
+			due = *cmd.NotBefore
+		}
+		expires := due.Add(DefaultCommandExpiry)
+		cmd.ExpiresAt = &expires
+	}
+}
+
+// filterDeliverable returns the commands a device may see at now: not expired and not
+// scheduled for later. next is the earliest not_before held back (zero if none).
+// deliverableCommands reads pages of a device's commands until limit deliverable ones
+// are found, the commands run out or maxCommandScanPages pages were read. next resumes
+// after the last command read; nextDue is the earliest not_before still ahead.
+func (h *Handlers) deliverableCommands(ctx context.Context, deviceID, status string, limit int, after *PageCursor) (
+	deliverable []Command, next *PageCursor, nextDue time.Time, err error) {
+	next = after
+	for pages := 0; pages < maxCommandScanPages; pages++ {
+		commands, cursor, err := h.commandStore.GetByDeviceIDPage(ctx, deviceID, status, limit, next)
+		if err != nil {
+			return nil, nil, time.Time{}, err
+		}
+
+		due, pageNext := filterDeliverable(commands, time.Now())
+		if !pageNext.IsZero() && (nextDue.IsZero() || pageNext.Before(nextDue)) {
+			nextDue = pageNext
+		}
+		if len(deliverable)+len(due) > limit {
+			// Stop within the page; the next page starts after the last command returned
+			deliverable = append(deliverable, due[:limit-len(deliverable)]...)
+			last := deliverable[len(deliverable)-1]
+			return deliverable, &PageCursor{Time: last.CreatedAt, ID: last.ID}, nextDue, nil
+		}
+		deliverable = append(deliverable, due...)
+		next = cursor
+		if next == nil || len(deliverable) == limit {
+			break
+		}
+	}
+	return deliverable, next, nextDue, nil
+}
+
+// filterDeliverable drops expired commands and commands whose not_before is in the
+// future, returning the earliest such not_before
+func filterDeliverable(commands []Command, now time.Time) (deliverable []Command, next time.Time) {
+	for _, cmd := range commands {
+		if cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(now) {
+			continue
+		}
+		if cmd.NotBefore != nil && cmd.NotBefore.After(now) {
+			if next.IsZero() || cmd.NotBefore.Before(next) {
+				next = *cmd.NotBefore
+			}
+			continue
+		}
+		deliverable = append(deliverable, cmd)
+	}
+	return deliverable, next
+}
+
 // AckCommand handles POST /commands/{id}/ack - device acknowledges a command
 func (h *Handlers) AckCommand(w http.ResponseWriter, r *http.Request) {
+	h.updateCommandStatus(w, r, CommandAcknowledged, nil)
+}
+
+// CommandReport is the body of POST /commands/{id}/complete and /commands/{id}/fail
+type CommandReport struct {
+	Result       map[string]interface{} `json:"result,omitempty"`        // Optional outcome details
+	ErrorMessage string                 `json:"error_message,omitempty"` // Why the command failed (required for fail)
+}
+
+// CompleteCommand handles POST /commands/{id}/complete - device reports success of an
+// acknowledged command, with an optional result
+func (h *Handlers) CompleteCommand(w http.ResponseWriter, r *http.Request) {
+	report, err := decodeCommandReport(r, CommandCompleted)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.updateCommandStatus(w, r, CommandCompleted, report.apply)
+}
+
+// FailCommand handles POST /commands/{id}/fail - device reports that an acknowledged
+// command failed, with an error message and an optional result
+func (h *Handlers) FailCommand(w http.ResponseWriter, r *http.Request) {
+	report, err := decodeCommandReport(r, CommandFailed)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.updateCommandStatus(w, r, CommandFailed, report.apply)
+}
+
+// decodeCommandReport reads an optional CommandReport body for a move to status `to`
+func decodeCommandReport(r *http.Request, to string) (*CommandReport, error) {
+	var report CommandReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid request body")
+	}
+	if err := report.validate(to); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// validate checks a report for a move to status `to`: only failures carry (and require)
+// an error message, and both fields are size-limited
+func (report *CommandReport) validate(to string) error {
+	switch {
+	case to == CommandFailed && report.ErrorMessage == "":
+		return errors.New("error_message is required")
+	case to != CommandFailed && report.ErrorMessage != "":
+		return errors.New("error_message is only accepted by /fail")
+	}
+	if report.Result != nil {
+		resultBytes, err := json.Marshal(report.Result)
+		if err != nil {
+			return errors.New("invalid result")
+		}
+		if len(resultBytes) > MaxCommandPayloadSize {
+			return fmt.Errorf("result too large (max %dKB)", MaxCommandPayloadSize/1024)
+		}
+	}
+	if utf8.RuneCountInString(report.ErrorMessage) > MaxCommandErrorMessage {
+		return fmt.Errorf("error_message too long (max %d characters)", MaxCommandErrorMessage)
+	}
+	return nil
+}
+
+// apply copies the reported details onto a command
+func (report *CommandReport) apply(cmd *Command) {
+	cmd.Result = report.Result
+	cmd.ErrorMessage = report.ErrorMessage
+}
+
+// updateCommandStatus moves one of the device's own commands to status `to` following the
+// command state machine; apply sets the reported details. Repeating the current status
+// returns the command unchanged (with the Idempotent-Replayed header), so retries are safe.
+func (h *Handlers) updateCommandStatus(w http.ResponseWriter, r *http.Request, to string, apply func(cmd *Command)) {
 	ctx := r.Context()
-	reqID := middleware.GetRequestID(ctx)
 
 	// Get device ID from auth context
 	deviceID := GetDeviceIDFromContext(ctx)
@@ -172,46 +387,112 @@ func (h *Handlers) AckCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if command exists and belongs to this device
-	cmd, err := h.commandStore.GetByID(ctx, commandID)
-	if err != nil {
-		h.logger.Debug("command not found for ack",
-			"request_id", reqID,
-			"command_id", commandID,
-			"device_id", deviceID,
-		)
+	cmd, changed, err := h.setCommandStatus(ctx, deviceID, commandID, to, apply)
+
+	var transitionErr *CommandTransitionError
+	switch {
+	case errors.Is(err, ErrNotFound):
 		h.jsonError(w, "command not found", http.StatusNotFound)
 		return
+	case errors.As(err, &transitionErr):
+		h.jsonResponse(w, map[string]string{
+			"error":  transitionErr.Error(),
+			"status": transitionErr.From,
+		}, http.StatusConflict)
+		return
+	case err != nil:
+		h.jsonError(w, "failed to update command", http.StatusInternalServerError)
+		return
 	}
 
-	// Security: device can only acknowledge their own commands
-	if cmd.DeviceID != deviceID {
-		h.logger.Warn("unauthorized command ack attempt",
+	if !changed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	h.jsonResponse(w, cmd, http.StatusOK)
+}
+
+// setCommandStatus applies a device's status update atomically and reports whether the
+// command changed. Commands of other devices are reported as ErrNotFound, so devices
+// cannot probe for them; state machine violations return a *CommandTransitionError.
+func (h *Handlers) setCommandStatus(ctx context.Context, deviceID, commandID, to string, apply func(cmd *Command)) (*Command, bool, error) {
+	reqID := middleware.GetRequestID(ctx)
+
+	var owner string
+	changed := false
+	cmd, err := h.commandStore.Transition(ctx, commandID, func(cmd *Command) (bool, error) {
+		// Security: devices can only update their own commands
+		if cmd.DeviceID != deviceID {
+			owner = cmd.DeviceID
+			return false, errCommandNotOwned
+		}
+		var err error
+		if changed, err = transitionCommand(cmd, to, time.Now().UTC()); err != nil || !changed {
+			return false, err
+		}
+		if apply != nil {
+			apply(cmd)
+		}
+		return true, nil
+	})
+
+	var transitionErr *CommandTransitionError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		h.logger.Debug("command not found for status update",
+			"request_id", reqID,
+			"command_id", commandID,
+			"device_id", deviceID,
+			"status", to,
+		)
+		return nil, false, ErrNotFound
+	case errors.Is(err, errCommandNotOwned):
+		h.logger.Warn("unauthorized command status update attempt",
 			"request_id", reqID,
 			"command_id", commandID,
 			"requesting_device", deviceID,
-			"owning_device", cmd.DeviceID,
+			"owning_device", owner,
+			"status", to,
 		)
-		h.jsonError(w, "command not found", http.StatusNotFound) // Don't reveal it exists
-		return
+		return nil, false, ErrNotFound // Don't reveal it exists
+	case errors.As(err, &transitionErr):
+		return nil, false, err
+	case err != nil:
+		h.logger.Error("failed to update command status",
+			"request_id", reqID,
+			"error", err,
+			"command_id", commandID,
+			"status", to,
+		)
+		return nil, false, err
 	}
 
-	// Mark as acknowledged
-	err = h.commandStore.Update(ctx, commandID, map[string]interface{}{
-		"status":     "acknowledged",
-		"updated_at": time.Now().UTC(),
-	})
-	if err != nil {
-		h.logger.Error("failed to acknowledge command",
+	if changed {
+		h.logger.Info("command status updated",
 			"request_id", reqID,
-			"error", err,
 			"command_id", commandID,
+			"device_id", deviceID,
+			"type", cmd.Type,
+			"status", to,
 		)
-		h.jsonError(w, "failed to acknowledge command", http.StatusInternalServerError)
+	}
+	return cmd, changed, nil
+}
+
+// GetCommand handles GET /admin/commands/{id} - admin views a command with its
+// status history and the result reported by the device
+func (h *Handlers) GetCommand(w http.ResponseWriter, r *http.Request) {
+	commandID := r.PathValue("id")
+	if err := validate.UUID(commandID); err != nil {
+		h.jsonError(w, "invalid command id", http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := h.commandStore.GetByID(r.Context(), commandID)
+	if err != nil {
+		h.jsonError(w, "command not found", http.StatusNotFound)
 		return
 	}
 
-	cmd.Status = "acknowledged"
 	h.jsonResponse(w, cmd, http.StatusOK)
 }
 
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+// ProtobufContentType is the media type of protobuf request and response bodies
+const ProtobufContentType = "application/x-protobuf"
+
+// Protobuf layout of GET /commands responses (Accept: application/x-protobuf):
+//
+//	message CommandList {
+//	  repeated Command commands = 1;
+//	  uint32 count = 2;
+//	  string next_page_token = 3;
+//	}
+//	message Command {
+//	  string id = 1;
+//	  string type = 2;
+//	  repeated PayloadEntry payload = 3; // Sorted by key
+//	  string status = 4;
+//	  int64 created_at_ms = 5;
+//	  int64 expires_at_ms = 6;           // Absent = never expires
+//	  int64 not_before_ms = 7;           // Absent = due on creation
+//	  string campaign_id = 8;            // Absent = not part of a campaign
+//	}
+//	message PayloadEntry {
+//	  string key = 1;
+//	  oneof value {
+//	    double number = 2;
+//	    string text = 3;
+//	    bool flag = 4;
+//	    string json = 5;                 // Objects, arrays and null as JSON text
+//	  }
+//	}
+const (
+	commandListFieldCommands  uint32 = 1
+	commandListFieldCount     uint32 = 2
+	commandListFieldPageToken uint32 = 3
+
+	commandFieldID        uint32 = 1
+	commandFieldType      uint32 = 2
+	commandFieldPayload   uint32 = 3
+	commandFieldStatus    uint32 = 4
+	commandFieldCreatedAt uint32 = 5
+	commandFieldExpiresAt uint32 = 6
+	commandFieldNotBefore uint32 = 7
+	commandFieldCampaign  uint32 = 8
+
+	payloadFieldKey    uint32 = 1
+	payloadFieldNumber uint32 = 2
+	payloadFieldText   uint32 = 3
+	payloadFieldFlag   uint32 = 4
+	payloadFieldJSON   uint32 = 5
+)
+
+// acceptsProtobuf reports whether the client asked for a protobuf response
+func acceptsProtobuf(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ProtobufContentType, "application/vnd.google.protobuf":
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCommandList encodes commands as a CommandList message
+func encodeCommandList(commands []Command, nextPageToken string) []byte {
+	var b proto.Builder
+	for i := range commands {
+		b.Message(commandListFieldCommands, encodeCommand(&commands[i]))
+	}
+	b.Uint32(commandListFieldCount, uint32(len(commands)))
+	if nextPageToken != "" {
+		b.String(commandListFieldPageToken, nextPageToken)
+	}
+	return b.Build()
+}
+
+func encodeCommand(cmd *Command) *proto.Builder {
+	b := new(proto.Builder).
+		String(commandFieldID, cmd.ID).
+		String(commandFieldType, cmd.Type)
+
+	keys := make([]string, 0, len(cmd.Payload))
+	for k := range cmd.Payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.Message(commandFieldPayload, encodePayloadEntry(k, cmd.Payload[k]))
+	}
+
+	b.String(commandFieldStatus, cmd.Status).
+		Int64(commandFieldCreatedAt, cmd.CreatedAt.UnixMilli())
+	if cmd.ExpiresAt != nil {
+		b.Int64(commandFieldExpiresAt, cmd.ExpiresAt.UnixMilli())
+	}
+	if cmd.NotBefore != nil {
+		b.Int64(commandFieldNotBefore, cmd.NotBefore.UnixMilli())
+	}
+	if cmd.CampaignID != "" {
+		b.String(commandFieldCampaign, cmd.CampaignID)
+	}
+	return b
+}
+
+// encodePayloadEntry encodes a payload value with its native type where protobuf has one
+func encodePayloadEntry(key string, value interface{}) *proto.Builder {
+	b := new(proto.Builder).String(payloadFieldKey, key)
+	switch v := value.(type) {
+	case float64: // JSON numbers
+		return b.Double(payloadFieldNumber, v)
+	case int64: // Firestore integers
+		return b.Double(payloadFieldNumber, float64(v))
+	case string:
+		return b.String(payloadFieldText, v)
+	case bool:
+		return b.Bool(payloadFieldFlag, v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte("null")
+	}
+	return b.Bytes(payloadFieldJSON, data)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+func TestAcceptsProtobuf(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-protobuf", true},
+		{"application/json;q=0.5, application/x-protobuf", true},
+		{"application/vnd.google.protobuf; proto=CommandList", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/commands", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := acceptsProtobuf(req); got != tt.want {
+			t.Errorf("acceptsProtobuf(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestGetCommands_Protobuf(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := time.Now().Add(time.Hour)
+	notBefore := created.Add(time.Minute)
+	mockStore.Save(context.Background(), &Command{
+		DeviceID:   cmdTestDeviceUUID,
+		Type:       "set_interval",
+		Status:     "pending",
+		CreatedAt:  created,
+		ExpiresAt:  &expires,
+		NotBefore:  &notBefore,
+		CampaignID: "campaign-1",
+		Payload: map[string]interface{}{
+			"seconds": float64(30),
+			"sensor":  "bme680",
+			"enabled": true,
+			"window":  []interface{}{1.0, 2.0},
+		},
+	})
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/commands", nil)
+	req.Header.Set("Accept", "application/x-protobuf")
+	req = withDeviceCtx(req, cmdTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetCommands(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ProtobufContentType {
+		t.Errorf("expected Content-Type %s, got %s", ProtobufContentType, ct)
+	}
+
+	list, err := proto.Decode(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := list.GetField(commandListFieldCount); count == nil || count.Value.AsUint32() != 1 {
+		t.Fatalf("expected count 1, got %+v", count)
+	}
+	cmd, err := list.GetField(commandListFieldCommands).Value.AsMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.GetField(commandFieldType).Value.AsString() != "set_interval" ||
+		cmd.GetField(commandFieldStatus).Value.AsString() != "pending" ||
+		cmd.GetField(commandFieldCreatedAt).Value.AsInt64() != created.UnixMilli() ||
+		cmd.GetField(commandFieldExpiresAt).Value.AsInt64() != expires.UnixMilli() ||
+		cmd.GetField(commandFieldNotBefore).Value.AsInt64() != notBefore.UnixMilli() ||
+		cmd.GetField(commandFieldCampaign).Value.AsString() != "campaign-1" {
+		t.Errorf("unexpected command fields: %+v", cmd)
+	}
+
+	// Payload entries are sorted by key and keep native types
+	entries := cmd.GetAllFields(commandFieldPayload)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 payload entries, got %d", len(entries))
+	}
+	want := []struct {
+		key   string
+		field uint32
+	}{
+		{"enabled", payloadFieldFlag},
+		{"seconds", payloadFieldNumber},
+		{"sensor", payloadFieldText},
+		{"window", payloadFieldJSON},
+	}
+	for i, e := range entries {
+		entry, err := e.Value.AsMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.GetField(payloadFieldKey).Value.AsString() != want[i].key || entry.GetField(want[i].field) == nil {
+			t.Errorf("entry %d: expected %s in field %d, got %+v", i, want[i].key, want[i].field, entry)
+		}
+	}
+	seconds, _ := entries[1].Value.AsMessage()
+	if seconds.GetField(payloadFieldNumber).Value.AsFloat64() != 30 {
+		t.Errorf("expected seconds = 30, got %+v", seconds)
+	}
+	window, _ := entries[3].Value.AsMessage()
+	if got := window.GetField(payloadFieldJSON).Value.AsString(); got != "[1,2]" {
+		t.Errorf("expected JSON text [1,2], got %q", got)
+	}
+}
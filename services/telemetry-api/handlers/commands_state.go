@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Command statuses
+const (
+	CommandPending      = "pending"
+	CommandAcknowledged = "acknowledged"
+	CommandCompleted    = "completed"
+	CommandFailed       = "failed"
+)
+
+// commandTransitions lists the statuses a command may move to from each status.
+// Completed and failed are final; nothing moves backwards.
+var commandTransitions = map[string][]string{
+	CommandPending:      {CommandAcknowledged},
+	CommandAcknowledged: {CommandCompleted, CommandFailed},
+}
+
+// Limits of the results devices report on POST /commands/{id}/complete and /fail
+const (
+	MaxCommandPayloadSize  = 32 * 1024 // JSON size of a command payload or result
+	MaxCommandErrorMessage = 1024      // Characters
+)
+
+// DefaultCommandExpiry applies to commands created without expires_at
+const DefaultCommandExpiry = 24 * time.Hour
+
+// isCommandStatus reports whether status is one of the Command* statuses
+func isCommandStatus(status string) bool {
+	switch status {
+	case CommandPending, CommandAcknowledged, CommandCompleted, CommandFailed:
+		return true
+	}
+	return false
+}
+
+// CommandTransitionError rejects a status change the state machine does not allow
+type CommandTransitionError struct {
+	From, To  string
+	ExpiredAt *time.Time // Set when a pending command expired before it was acknowledged
+}
+
+func (e *CommandTransitionError) Error() string {
+	if e.ExpiredAt != nil {
+		return fmt.Sprintf("command expired at %s and cannot become %s", e.ExpiredAt.Format(time.RFC3339), e.To)
+	}
+	return fmt.Sprintf("command is %s and cannot become %s", e.From, e.To)
+}
+
+// errCommandNotOwned aborts a transition requested by another device
+var errCommandNotOwned = errors.New("command belongs to another device")
+
+// transitionCommand applies a status change to cmd, recording when it happened.
+// Repeating the current status is not a change (false, nil): device retries are safe.
+// A pending command cannot be acknowledged once expired; acknowledged commands may
+// still report their outcome after expires_at.
+func transitionCommand(cmd *Command, to string, now time.Time) (bool, error) {
+	if cmd.Status == to {
+		return false, nil
+	}
+	if !slices.Contains(commandTransitions[cmd.Status], to) {
+		return false, &CommandTransitionError{From: cmd.Status, To: to}
+	}
+	if cmd.Status == CommandPending && cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(now) {
+		return false, &CommandTransitionError{From: cmd.Status, To: to, ExpiredAt: cmd.ExpiresAt}
+	}
+
+	cmd.History = append(cmd.History, CommandTransition{From: cmd.Status, To: to, At: now})
+	cmd.Status = to
+	cmd.UpdatedAt = now
+	switch to {
+	case CommandAcknowledged:
+		cmd.AcknowledgedAt = &now
+	case CommandCompleted:
+		cmd.CompletedAt = &now
+	case CommandFailed:
+		cmd.FailedAt = &now
+	}
+	return true, nil
+}
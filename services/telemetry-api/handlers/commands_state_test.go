@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postCommandStatus calls a device command status handler (ack, complete or fail)
+func postCommandStatus(handler http.HandlerFunc, action, deviceID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/commands/"+cmdTestCommandUUID+"/"+action, bytes.NewBufferString(body))
+	req.SetPathValue("id", cmdTestCommandUUID)
+	req = withDeviceCtx(req, deviceID)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestTransitionCommand(t *testing.T) {
+	tests := []struct {
+		from, to    string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{CommandPending, CommandAcknowledged, true, false},
+		{CommandAcknowledged, CommandCompleted, true, false},
+		{CommandAcknowledged, CommandFailed, true, false},
+		{CommandAcknowledged, CommandAcknowledged, false, false}, // Repeat
+		{CommandCompleted, CommandCompleted, false, false},
+		{CommandPending, CommandCompleted, false, true}, // Must be acknowledged first
+		{CommandPending, CommandFailed, false, true},
+		{CommandAcknowledged, CommandPending, false, true}, // Backwards
+		{CommandCompleted, CommandAcknowledged, false, true},
+		{CommandCompleted, CommandFailed, false, true}, // Final
+		{CommandFailed, CommandCompleted, false, true},
+	}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		cmd := &Command{Status: tt.from}
+		changed, err := transitionCommand(cmd, tt.to, now)
+		if changed != tt.wantChanged || (err != nil) != tt.wantErr {
+			t.Errorf("%s -> %s: got (%v, %v), want changed=%v err=%v", tt.from, tt.to, changed, err, tt.wantChanged, tt.wantErr)
+			continue
+		}
+		if changed && (cmd.Status != tt.to || !cmd.UpdatedAt.Equal(now) || len(cmd.History) != 1 || cmd.History[0].From != tt.from) {
+			t.Errorf("%s -> %s: transition not recorded: %+v", tt.from, tt.to, cmd)
+		}
+		if !changed && cmd.Status != tt.from {
+			t.Errorf("%s -> %s: status changed to %s", tt.from, tt.to, cmd.Status)
+		}
+	}
+}
+
+func TestTransitionCommand_Expired(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+
+	var transitionErr *CommandTransitionError
+	_, err := transitionCommand(&Command{Status: CommandPending, ExpiresAt: &expired}, CommandAcknowledged, now)
+	if !errors.As(err, &transitionErr) || transitionErr.ExpiredAt == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected expiry error acknowledging an expired command, got %v", err)
+	}
+
+	// Acknowledged in time: the outcome may be reported after expiry
+	cmd := &Command{Status: CommandAcknowledged, ExpiresAt: &expired}
+	if changed, err := transitionCommand(cmd, CommandCompleted, now); !changed || err != nil {
+		t.Errorf("expected completion after expiry, got (%v, %v)", changed, err)
+	}
+}
+
+func TestCommandLifecycle_Complete(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "set_interval", Status: CommandPending}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	if w := postCommandStatus(h.AckCommand, "ack", cmdTestDeviceUUID, ""); w.Code != http.StatusOK {
+		t.Fatalf("ack: expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w := postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID, `{"result": {"interval": 60}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("complete: expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var cmd Command
+	json.NewDecoder(w.Body).Decode(&cmd)
+	if cmd.Status != CommandCompleted || cmd.Result["interval"] != float64(60) || cmd.AcknowledgedAt == nil || cmd.CompletedAt == nil {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+	if len(cmd.History) != 2 || cmd.History[0].To != CommandAcknowledged || cmd.History[1].To != CommandCompleted {
+		t.Errorf("unexpected history: %+v", cmd.History)
+	}
+
+	// A retried completion is acknowledged without changing the stored result
+	w = postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID, `{"result": {"interval": 30}}`)
+	if w.Code != http.StatusOK || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("repeat: expected idempotent replay, got %d %v", w.Code, w.Header())
+	}
+	if stored := mockStore.data[cmdTestCommandUUID]; stored.Result["interval"] != float64(60) || len(stored.History) != 2 {
+		t.Errorf("repeat changed the command: %+v", stored)
+	}
+
+	// Final: cannot fail afterwards
+	w = postCommandStatus(h.FailCommand, "fail", cmdTestDeviceUUID, `{"error_message": "too late"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("fail after complete: expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestCommandLifecycle_CreatedCommand(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	body := `{"device_id": "` + cmdTestDeviceUUID + `", "type": "reboot"}`
+	w := httptest.NewRecorder()
+	h.CreateCommand(w, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created Command
+	json.NewDecoder(w.Body).Decode(&created)
+
+	// The ID returned on creation addresses the command on the device endpoints
+	for _, step := range []struct {
+		action  string
+		handler http.HandlerFunc
+	}{
+		{"ack", h.AckCommand},
+		{"complete", h.CompleteCommand},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/commands/"+created.ID+"/"+step.action, nil)
+		req.SetPathValue("id", created.ID)
+		req = withDeviceCtx(req, cmdTestDeviceUUID)
+		w := httptest.NewRecorder()
+		step.handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.action, http.StatusOK, w.Code, w.Body.String())
+		}
+	}
+
+	if cmd := mockStore.data[created.ID]; cmd.Status != CommandCompleted {
+		t.Errorf("expected command %s completed, got %+v", created.ID, cmd)
+	}
+}
+
+func TestCommandLifecycle_Fail(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandAcknowledged}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	w := postCommandStatus(h.FailCommand, "fail", cmdTestDeviceUUID, `{"error_message": "watchdog busy", "result": {"code": 16}}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	stored := mockStore.data[cmdTestCommandUUID]
+	if stored.Status != CommandFailed || stored.ErrorMessage != "watchdog busy" || stored.Result["code"] != float64(16) || stored.FailedAt == nil {
+		t.Errorf("unexpected command: %+v", stored)
+	}
+
+	// Acknowledging again would move it backwards
+	if w := postCommandStatus(h.AckCommand, "ack", cmdTestDeviceUUID, ""); w.Code != http.StatusConflict {
+		t.Errorf("ack after fail: expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestCompleteCommand_RequiresAck(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	w := postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID, "")
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	var response map[string]string
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["status"] != CommandPending {
+		t.Errorf("expected current status in response, got %v", response)
+	}
+}
+
+func TestCommandStatus_InvalidReports(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandAcknowledged}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		action  string
+		body    string
+	}{
+		{"fail without message", h.FailCommand, "fail", `{}`},
+		{"complete with error message", h.CompleteCommand, "complete", `{"error_message": "x"}`},
+		{"invalid JSON", h.CompleteCommand, "complete", `{`},
+		{"message too long", h.FailCommand, "fail", `{"error_message": "` + strings.Repeat("x", MaxCommandErrorMessage+1) + `"}`},
+		{"result too large", h.CompleteCommand, "complete", `{"result": {"blob": "` + strings.Repeat("x", MaxCommandPayloadSize) + `"}}`},
+	}
+	for _, tt := range tests {
+		if w := postCommandStatus(tt.handler, tt.action, cmdTestDeviceUUID, tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusBadRequest, w.Code)
+		}
+	}
+	if mockStore.data[cmdTestCommandUUID].Status != CommandAcknowledged {
+		t.Error("invalid reports must not change the command")
+	}
+}
+
+func TestCompleteCommand_WrongDevice(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandAcknowledged}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	w := postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID2, "")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if mockStore.data[cmdTestCommandUUID].Status != CommandAcknowledged {
+		t.Error("another device must not change the command")
+	}
+}
+
+func TestCompleteCommand_NotFound(t *testing.T) {
+	h := NewWithStores(nil, NewMockCommandStore(), nil, nil, nil, nil)
+
+	if w := postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCompleteCommand_StoreError(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.UpdateErr = errors.New("transaction aborted")
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	if w := postCommandStatus(h.CompleteCommand, "complete", cmdTestDeviceUUID, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestGetCommand(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandFailed, ErrorMessage: "busy"}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/commands/"+cmdTestCommandUUID, nil)
+	req.SetPathValue("id", cmdTestCommandUUID)
+	w := httptest.NewRecorder()
+	h.GetCommand(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var cmd Command
+	json.NewDecoder(w.Body).Decode(&cmd)
+	if cmd.ID != cmdTestCommandUUID || cmd.ErrorMessage != "busy" {
+		t.Errorf("unexpected command: %+v", cmd)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/commands/"+cmdTestDeviceUUID2, nil)
+	req.SetPathValue("id", cmdTestDeviceUUID2)
+	w = httptest.NewRecorder()
+	h.GetCommand(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
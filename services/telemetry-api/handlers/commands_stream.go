@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/websocket"
+)
+
+// Command stream settings (GET /commands/stream)
+const (
+	// CommandStreamHeartbeat keeps idle streams open through proxies and detects dead devices
+	CommandStreamHeartbeat = 25 * time.Second
+	// MaxCommandStreamDuration ends streams before the platform request timeout (Cloud Run: 1h)
+	MaxCommandStreamDuration = 55 * time.Minute
+	// MaxCommandStreamMessage is the largest WebSocket message a device may send
+	MaxCommandStreamMessage = MaxCommandPayloadSize + 4*1024
+	// commandStreamWriteTimeout bounds each event write; streams replace the server's
+	// request-wide WriteTimeout with this per-write deadline
+	commandStreamWriteTimeout = 10 * time.Second
+	// commandStreamRetry is the reconnect delay suggested to SSE clients
+	commandStreamRetry = 5 * time.Second
+)
+
+// Reasons a command stream is ended by the server
+const (
+	StreamClosedTokenExpired = "token_expired" // Refresh the token and reconnect
+	StreamClosedRevoked      = "revoked"       // Do not reconnect
+	StreamClosedReconnect    = "reconnect"     // Maximum duration reached or server shutting down
+)
+
+// WebSocket close codes for command streams (application range 4000-4999)
+const (
+	streamCloseTokenExpired = 4001
+	streamCloseRevoked      = 4003
+)
+
+var (
+	errDeviceRevoked  = errors.New("device revoked")
+	errServerShutdown = errors.New("server shutting down")
+	errStreamWrite    = errors.New("stream write failed")
+)
+
+// CommandStreamMessage is a server message on a command stream: the data of an SSE
+// event (the event name is the type) or a WebSocket text message
+type CommandStreamMessage struct {
+	Type     string   `json:"type"`               // command, updated, authenticated, error, closed
+	ID       string   `json:"id,omitempty"`       // Command ID (command, updated, error)
+	Command  *Command `json:"command,omitempty"`  // command, updated
+	Replayed bool     `json:"replayed,omitempty"` // updated: the command already had this status
+	Status   string   `json:"status,omitempty"`   // error: current command status on a conflict
+	Error    string   `json:"error,omitempty"`    // error
+	Reason   string   `json:"reason,omitempty"`   // closed
+}
+
+// CommandStreamRequest is a device message on a WebSocket command stream
+type CommandStreamRequest struct {
+	Type         string                 `json:"type"`                    // ack, complete, fail, auth
+	ID           string                 `json:"id,omitempty"`            // Command ID (ack, complete, fail)
+	Result       map[string]interface{} `json:"result,omitempty"`        // complete, fail
+	ErrorMessage string                 `json:"error_message,omitempty"` // fail
+	Token        string                 `json:"token,omitempty"`         // auth: a refreshed token
+}
+
+// streamRequestStatus maps device request types to the command status they report
+var streamRequestStatus = map[string]string{
+	"ack":      CommandAcknowledged,
+	"complete": CommandCompleted,
+	"fail":     CommandFailed,
+}
+
+// StreamCommands handles GET /commands/stream - pushes pending commands to the device as
+// they are created. Server-Sent Events by default; a WebSocket upgrade request gets the
+// WebSocket variant, which also accepts ack/complete/fail reports and token refreshes.
+// Streams end when the token expires, the device is revoked or after MaxCommandStreamDuration.
+func (h *Handlers) StreamCommands(w http.ResponseWriter, r *http.Request) {
+	deviceID := GetDeviceIDFromContext(r.Context())
+	if deviceID == "" {
+		h.jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if websocket.IsUpgrade(r) {
+		h.streamCommandsWebSocket(w, r, deviceID)
+		return
+	}
+	h.streamCommandsSSE(w, r, deviceID)
+}
+
+// CloseCommandStreams ends all command streams, asking devices to reconnect (for shutdown)
+func (h *Handlers) CloseCommandStreams() {
+	h.commandStreams.disconnectAll(errServerShutdown)
+}
+
+// StartRevocationWatcher listens for devices revoked on any instance and ends their
+// command streams here, until ctx is cancelled. Without a watcher-capable store, streams
+// notice revocations on other instances through the status cache on their heartbeat.
+func (h *Handlers) StartRevocationWatcher(ctx context.Context) {
+	watcher, ok := h.deviceStore.(DeviceWatcher)
+	if !ok {
+		return
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			err := watcher.WatchRevoked(ctx, func(deviceID string) {
+				if h.deviceStatusCache != nil {
+					h.deviceStatusCache.Invalidate(deviceID)
+				}
+				h.commandStreams.disconnect(deviceID, errDeviceRevoked)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			h.logger.Warn("revocation watcher failed, retrying", "error", err, "retry_in", commandWatchRetry.String())
+			select {
+			case <-ctx.Done():
+			case <-time.After(commandWatchRetry):
+			}
+		}
+	}()
+}
+
+// commandStreamTransport delivers stream messages to one device connection
+type commandStreamTransport interface {
+	send(msg *CommandStreamMessage) error
+	heartbeat() error
+	close(reason string)
+}
+
+// commandStream pushes a device's pending commands over one transport
+type commandStream struct {
+	h         *Handlers
+	deviceID  string
+	reqID     string
+	transport commandStreamTransport
+	sent      map[string]bool // Pending commands already delivered on this stream
+	renewed   chan time.Time  // New token expiry after an in-band refresh
+}
+
+func (h *Handlers) newCommandStream(ctx context.Context, deviceID string, transport commandStreamTransport) *commandStream {
+	return &commandStream{
+		h:         h,
+		deviceID:  deviceID,
+		reqID:     middleware.GetRequestID(ctx),
+		transport: transport,
+		sent:      make(map[string]bool),
+		renewed:   make(chan time.Time),
+	}
+}
+
+// run delivers pending commands, then new ones as they are created, until the device
+// disconnects (ctx), the token expires, the device is revoked or the stream is too old
+func (s *commandStream) run(ctx context.Context, tokenExpires time.Time) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer s.h.commandStreams.register(s.deviceID, cancel)()
+
+	// Subscribe before the first read so a command created in between still wakes us
+	wake, unsubscribe := s.h.commandHub.Subscribe(s.deviceID)
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(CommandStreamHeartbeat)
+	defer heartbeat.Stop()
+	streamEnd := time.NewTimer(MaxCommandStreamDuration)
+	defer streamEnd.Stop()
+	tokenEnd := time.NewTimer(streamTokenTTL(tokenExpires))
+	defer tokenEnd.Stop()
+
+	s.h.logger.Info("command stream opened", "request_id", s.reqID, "device_id", s.deviceID)
+	defer s.h.logger.Info("command stream closed", "request_id", s.reqID, "device_id", s.deviceID)
+
+	// Fires when a command scheduled for later (not_before) becomes due
+	due := time.NewTimer(MaxCommandStreamDuration)
+	defer due.Stop()
+	deliver := func() error {
+		next, err := s.deliver(ctx)
+		if err == nil && !next.IsZero() {
+			due.Reset(time.Until(next))
+		}
+		return err
+	}
+
+	if err := deliver(); err != nil {
+		s.end(ctx, err)
+		return
+	}
+	for {
+		select {
+		case <-wake:
+			if err := deliver(); err != nil {
+				s.end(ctx, err)
+				return
+			}
+		case <-due.C:
+			if err := deliver(); err != nil {
+				s.end(ctx, err)
+				return
+			}
+		case <-heartbeat.C:
+			// Fallback for revocations missed by StartRevocationWatcher
+			if s.h.deviceStatusCache != nil {
+				if revoked, err := s.h.deviceStatusCache.Get(s.deviceID); err != nil || revoked {
+					s.transport.close(StreamClosedRevoked)
+					return
+				}
+			}
+			if err := s.transport.heartbeat(); err != nil {
+				return
+			}
+		case expires := <-s.renewed:
+			if !tokenEnd.Stop() {
+				<-tokenEnd.C
+			}
+			tokenEnd.Reset(streamTokenTTL(expires))
+		case <-tokenEnd.C:
+			s.transport.close(StreamClosedTokenExpired)
+			return
+		case <-streamEnd.C:
+			s.transport.close(StreamClosedReconnect)
+			return
+		case <-ctx.Done():
+			s.end(ctx, context.Cause(ctx))
+			return
+		}
+	}
+}
+
+// end closes the stream after err, telling the device why when it is still connected
+func (s *commandStream) end(ctx context.Context, err error) {
+	switch {
+	case errors.Is(err, errDeviceRevoked):
+		s.transport.close(StreamClosedRevoked)
+	case errors.Is(err, errServerShutdown):
+		s.transport.close(StreamClosedReconnect)
+	case errors.Is(err, errStreamWrite), ctx.Err() != nil:
+		// Device gone, nothing to tell
+	default:
+		s.h.logger.Error("command stream failed",
+			"request_id", s.reqID,
+			"error", err,
+			"device_id", s.deviceID,
+		)
+		s.transport.close(StreamClosedReconnect) // Resynchronizes on reconnect
+	}
+}
+
+// deliver sends pending commands not yet sent on this stream, oldest first. It returns
+// when the next command scheduled for later becomes due (zero if none).
+func (s *commandStream) deliver(ctx context.Context) (time.Time, error) {
+	commands, _, err := s.h.commandStore.GetByDeviceIDPage(ctx, s.deviceID, CommandPending, MaxPageSize, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return time.Time{}, context.Cause(ctx)
+		}
+		return time.Time{}, fmt.Errorf("failed to retrieve commands: %w", err)
+	}
+
+	commands, next := filterDeliverable(commands, time.Now())
+	pending := make(map[string]bool, len(commands))
+	for i := len(commands) - 1; i >= 0; i-- {
+		cmd := &commands[i]
+		pending[cmd.ID] = true
+		if s.sent[cmd.ID] {
+			continue
+		}
+		if err := s.transport.send(&CommandStreamMessage{Type: "command", ID: cmd.ID, Command: cmd}); err != nil {
+			return time.Time{}, fmt.Errorf("%w: %v", errStreamWrite, err)
+		}
+		s.sent[cmd.ID] = true
+	}
+
+	// Forget commands that left the pending state
+	for id := range s.sent {
+		if !pending[id] {
+			delete(s.sent, id)
+		}
+	}
+	return next, nil
+}
+
+// streamTokenTTL returns how long a stream may run on a token (the maximum if unknown)
+func streamTokenTTL(expires time.Time) time.Duration {
+	if expires.IsZero() {
+		return MaxCommandStreamDuration
+	}
+	return max(time.Until(expires), 0)
+}
+
+// =============================================================================
+// Server-Sent Events
+// =============================================================================
+
+func (h *Handlers) streamCommandsSSE(w http.ResponseWriter, r *http.Request, deviceID string) {
+	rc := http.NewResponseController(w)
+	// The server's ReadTimeout would cancel the request context of a long-lived stream
+	rc.SetReadDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+
+	t := &sseTransport{w: w, rc: rc}
+	if err := t.write(fmt.Sprintf("retry: %d\n\n", commandStreamRetry.Milliseconds())); err != nil {
+		return
+	}
+
+	ctx := r.Context()
+	h.newCommandStream(ctx, deviceID, t).run(ctx, tokenExpiry(GetDeviceClaimsFromContext(ctx)))
+}
+
+// sseTransport writes command stream messages as Server-Sent Events
+type sseTransport struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (t *sseTransport) send(msg *CommandStreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	event := "event: " + msg.Type + "\n"
+	if msg.ID != "" {
+		event += "id: " + msg.ID + "\n"
+	}
+	return t.write(event + "data: " + string(data) + "\n\n")
+}
+
+func (t *sseTransport) heartbeat() error {
+	return t.write(": keep-alive\n\n")
+}
+
+func (t *sseTransport) close(reason string) {
+	t.send(&CommandStreamMessage{Type: "closed", Reason: reason})
+}
+
+// write sends one event with its own write deadline and flushes it to the device
+func (t *sseTransport) write(event string) error {
+	t.rc.SetWriteDeadline(time.Now().Add(commandStreamWriteTimeout))
+	if _, err := t.w.Write([]byte(event)); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// =============================================================================
+// WebSocket
+// =============================================================================
+
+func (h *Handlers) streamCommandsWebSocket(w http.ResponseWriter, r *http.Request, deviceID string) {
+	conn, err := websocket.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Debug("websocket upgrade failed",
+			"request_id", middleware.GetRequestID(r.Context()),
+			"error", err,
+			"device_id", deviceID,
+		)
+		return // Upgrade wrote the HTTP error
+	}
+	defer conn.Close()
+	conn.SetReadLimit(MaxCommandStreamMessage)
+	// Devices must send something, at least the pong to our heartbeat ping, every two heartbeats
+	conn.SetReadIdleTimeout(2 * CommandStreamHeartbeat)
+
+	// The hijacked connection outlives r.Context(); the reader ends the stream on disconnect
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	s := h.newCommandStream(ctx, deviceID, &wsTransport{conn: conn})
+	go func() {
+		defer cancel()
+		s.readRequests(ctx, conn)
+	}()
+	s.run(ctx, tokenExpiry(GetDeviceClaimsFromContext(r.Context())))
+}
+
+// wsTransport writes command stream messages as WebSocket text messages
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) send(msg *CommandStreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(commandStreamWriteTimeout))
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *wsTransport) heartbeat() error {
+	t.conn.SetWriteDeadline(time.Now().Add(commandStreamWriteTimeout))
+	return t.conn.WritePing(nil)
+}
+
+func (t *wsTransport) close(reason string) {
+	code := websocket.CloseGoingAway
+	switch reason {
+	case StreamClosedTokenExpired:
+		code = streamCloseTokenExpired
+	case StreamClosedRevoked:
+		code = streamCloseRevoked
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(commandStreamWriteTimeout))
+	t.conn.WriteClose(code, reason)
+}
+
+// readRequests handles device messages until the connection closes
+func (s *commandStream) readRequests(ctx context.Context, conn *websocket.Conn) {
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType != websocket.TextMessage {
+			s.transport.send(&CommandStreamMessage{Type: "error", Error: "messages must be JSON text"})
+			continue
+		}
+
+		var req CommandStreamRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.transport.send(&CommandStreamMessage{Type: "error", Error: "invalid message"})
+			continue
+		}
+		if err := s.transport.send(s.handleRequest(ctx, &req)); err != nil {
+			return
+		}
+	}
+}
+
+// handleRequest applies one device message and returns the reply
+func (s *commandStream) handleRequest(ctx context.Context, req *CommandStreamRequest) *CommandStreamMessage {
+	if req.Type == "auth" {
+		return s.renewToken(ctx, req.Token)
+	}
+
+	to, ok := streamRequestStatus[req.Type]
+	if !ok {
+		return &CommandStreamMessage{Type: "error", ID: req.ID, Error: "type must be one of ack, complete, fail, auth"}
+	}
+	if err := validate.UUID(req.ID); err != nil {
+		return &CommandStreamMessage{Type: "error", ID: req.ID, Error: "invalid command id"}
+	}
+
+	var apply func(cmd *Command)
+	if to != CommandAcknowledged {
+		report := &CommandReport{Result: req.Result, ErrorMessage: req.ErrorMessage}
+		if err := report.validate(to); err != nil {
+			return &CommandStreamMessage{Type: "error", ID: req.ID, Error: err.Error()}
+		}
+		apply = report.apply
+	}
+
+	cmd, changed, err := s.h.setCommandStatus(ctx, s.deviceID, req.ID, to, apply)
+	var transitionErr *CommandTransitionError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return &CommandStreamMessage{Type: "error", ID: req.ID, Error: "command not found"}
+	case errors.As(err, &transitionErr):
+		return &CommandStreamMessage{Type: "error", ID: req.ID, Error: transitionErr.Error(), Status: transitionErr.From}
+	case err != nil:
+		return &CommandStreamMessage{Type: "error", ID: req.ID, Error: "failed to update command"}
+	}
+	return &CommandStreamMessage{Type: "updated", ID: req.ID, Command: cmd, Replayed: !changed}
+}
+
+// renewToken extends the stream with a refreshed token for the same device
+func (s *commandStream) renewToken(ctx context.Context, token string) *CommandStreamMessage {
+	deviceID, claims, err := s.h.authService.VerifyToken(ctx, token)
+	if err != nil || deviceID != s.deviceID {
+		s.h.logger.Warn("command stream token refresh rejected",
+			"request_id", s.reqID,
+			"device_id", s.deviceID,
+			"error", err,
+		)
+		return &CommandStreamMessage{Type: "error", Error: "invalid token"}
+	}
+
+	select {
+	case s.renewed <- tokenExpiry(claims):
+		return &CommandStreamMessage{Type: "authenticated"}
+	case <-ctx.Done():
+		return &CommandStreamMessage{Type: "error", Error: "stream closed"}
+	}
+}
+
+// =============================================================================
+// Stream registry
+// =============================================================================
+
+// commandStreamRegistry tracks open command streams so they can be ended early
+// (device revoked, server shutdown)
+type commandStreamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]map[*context.CancelCauseFunc]struct{}
+}
+
+func newCommandStreamRegistry() *commandStreamRegistry {
+	return &commandStreamRegistry{streams: make(map[string]map[*context.CancelCauseFunc]struct{})}
+}
+
+// register adds a stream of deviceID and returns the function that removes it
+func (reg *commandStreamRegistry) register(deviceID string, cancel context.CancelCauseFunc) func() {
+	key := &cancel
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.streams[deviceID] == nil {
+		reg.streams[deviceID] = make(map[*context.CancelCauseFunc]struct{})
+	}
+	reg.streams[deviceID][key] = struct{}{}
+
+	return func() {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		delete(reg.streams[deviceID], key)
+		if len(reg.streams[deviceID]) == 0 {
+			delete(reg.streams, deviceID)
+		}
+	}
+}
+
+// disconnect ends the streams of deviceID with cause and returns how many were open
+func (reg *commandStreamRegistry) disconnect(deviceID string, cause error) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for cancel := range reg.streams[deviceID] {
+		(*cancel)(cause)
+	}
+	return len(reg.streams[deviceID])
+}
+
+// disconnectAll ends every stream with cause
+func (reg *commandStreamRegistry) disconnectAll(cause error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, streams := range reg.streams {
+		for cancel := range streams {
+			(*cancel)(cause)
+		}
+	}
+}
+
+// count returns the number of open streams of deviceID
+func (reg *commandStreamRegistry) count(deviceID string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return len(reg.streams[deviceID])
+}
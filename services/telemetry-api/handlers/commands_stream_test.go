@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/websocket"
+)
+
+// streamTestEnv serves GET /commands/stream behind the real auth middleware
+type streamTestEnv struct {
+	h        *Handlers
+	commands *MockCommandStore
+	devices  *MockDeviceStore
+	auth     *MockAuthService
+	srv      *httptest.Server
+}
+
+func newStreamTestEnv(t *testing.T) *streamTestEnv {
+	t.Helper()
+	env := &streamTestEnv{
+		commands: NewMockCommandStore(),
+		devices:  NewMockDeviceStore(),
+		auth:     NewMockAuthService(),
+	}
+	env.devices.Register(context.Background(), &Device{DeviceID: cmdTestDeviceUUID})
+	env.h = NewWithStores(nil, env.commands, env.devices, nil, env.auth, nil)
+	env.srv = httptest.NewServer(env.h.AuthMiddleware(env.h.StreamCommands))
+	t.Cleanup(env.srv.Close)
+	return env
+}
+
+// token returns a device token valid for ttl
+func (env *streamTestEnv) token(name string, ttl time.Duration) string {
+	token := name + strings.Repeat("t", 120)
+	env.auth.AddTokenWithExpiry(token, cmdTestDeviceUUID, nil, time.Now().Add(ttl))
+	return token
+}
+
+// createCommand creates a pending command through the admin handler
+func (env *streamTestEnv) createCommand(t *testing.T, cmdType string) {
+	t.Helper()
+	body := `{"device_id": "` + cmdTestDeviceUUID + `", "type": "` + cmdType + `"}`
+	w := httptest.NewRecorder()
+	env.h.CreateCommand(w, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+// revoke revokes the test device through the admin handler
+func (env *streamTestEnv) revoke(t *testing.T) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/devices/"+cmdTestDeviceUUID+"/revoke", nil)
+	req.SetPathValue("id", cmdTestDeviceUUID)
+	w := httptest.NewRecorder()
+	env.h.RevokeDevice(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// waitForStream blocks until the device has an open stream
+func (env *streamTestEnv) waitForStream(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); env.h.commandStreams.count(cmdTestDeviceUUID) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("stream never registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// sseClient reads Server-Sent Events
+type sseClient struct {
+	resp *http.Response
+	r    *bufio.Reader
+}
+
+func (env *streamTestEnv) openSSE(t *testing.T, token string) *sseClient {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, env.srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &sseClient{resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next returns the next event's name and message, skipping comments and retry hints
+func (c *sseClient) next(t *testing.T) (string, CommandStreamMessage) {
+	t.Helper()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			c.resp.Body.Close() // Unblocks the read below
+		}
+	}()
+
+	var event string
+	var msg CommandStreamMessage
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the next event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && event != "":
+			return event, msg
+		}
+	}
+}
+
+// expectEnd checks that the server closed the stream
+func (c *sseClient) expectEnd(t *testing.T) {
+	t.Helper()
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "event: ") {
+			t.Fatalf("unexpected event after close: %s", line)
+		}
+	}
+}
+
+func (env *streamTestEnv) openWebSocket(t *testing.T, token string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, env.srv.URL, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) (CommandStreamMessage, error) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg CommandStreamMessage
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg, nil
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, req CommandStreamRequest) CommandStreamMessage {
+	t.Helper()
+	data, _ := json.Marshal(req)
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := readWS(t, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func expectWSClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	_, err := readWS(t, conn)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != code {
+		t.Fatalf("expected close code %d, got %v", code, err)
+	}
+}
+
+func TestStreamCommands_SSE(t *testing.T) {
+	env := newStreamTestEnv(t)
+	env.commands.Save(context.Background(), &Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: time.Now()})
+	expired := time.Now().Add(-time.Minute)
+	env.commands.Save(context.Background(), &Command{DeviceID: cmdTestDeviceUUID, Type: "stale", Status: CommandPending, ExpiresAt: &expired})
+
+	client := env.openSSE(t, env.token("sse", time.Hour))
+
+	// Pending commands are delivered on connect (expired ones are skipped)
+	event, msg := client.next(t)
+	if event != "command" || msg.Command == nil || msg.Command.Type != "reboot" || msg.ID != msg.Command.ID {
+		t.Fatalf("expected pending command, got %s %+v", event, msg)
+	}
+
+	// New commands are pushed, already delivered ones are not repeated
+	env.createCommand(t, "open_valve")
+	event, msg = client.next(t)
+	if event != "command" || msg.Command.Type != "open_valve" {
+		t.Fatalf("expected pushed command, got %s %+v", event, msg)
+	}
+
+	env.h.CloseCommandStreams()
+	if event, msg = client.next(t); event != "closed" || msg.Reason != StreamClosedReconnect {
+		t.Errorf("expected reconnect on shutdown, got %s %+v", event, msg)
+	}
+	client.expectEnd(t)
+}
+
+func TestStreamCommands_SSETokenExpiry(t *testing.T) {
+	env := newStreamTestEnv(t)
+	client := env.openSSE(t, env.token("short", 300*time.Millisecond))
+
+	if event, msg := client.next(t); event != "closed" || msg.Reason != StreamClosedTokenExpired {
+		t.Errorf("expected token_expired, got %s %+v", event, msg)
+	}
+	client.expectEnd(t)
+}
+
+func TestStreamCommands_SSERevoked(t *testing.T) {
+	env := newStreamTestEnv(t)
+	client := env.openSSE(t, env.token("sse", time.Hour))
+	env.waitForStream(t)
+
+	env.revoke(t)
+
+	if event, msg := client.next(t); event != "closed" || msg.Reason != StreamClosedRevoked {
+		t.Errorf("expected revoked, got %s %+v", event, msg)
+	}
+	client.expectEnd(t)
+	if n := env.h.commandStreams.count(cmdTestDeviceUUID); n != 0 {
+		t.Errorf("expected stream to unregister, got %d", n)
+	}
+
+	// Reconnecting is refused by the auth middleware
+	req, _ := http.NewRequest(http.MethodGet, env.srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer "+env.token("again", time.Hour))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+// watchingDeviceStore is a device store that pushes revocations like a Firestore listener
+type watchingDeviceStore struct {
+	*MockDeviceStore
+	revoked chan string
+}
+
+func (s *watchingDeviceStore) WatchRevoked(ctx context.Context, notify func(deviceID string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case deviceID := <-s.revoked:
+			notify(deviceID)
+		}
+	}
+}
+
+func TestStartRevocationWatcher(t *testing.T) {
+	env := newStreamTestEnv(t)
+	store := &watchingDeviceStore{MockDeviceStore: env.devices, revoked: make(chan string)}
+	env.h.deviceStore = store
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env.h.StartRevocationWatcher(ctx)
+
+	client := env.openSSE(t, env.token("sse", time.Hour))
+	env.waitForStream(t)
+
+	// Revoked on another instance: only the watcher sees it
+	env.devices.Revoke(context.Background(), cmdTestDeviceUUID)
+	store.revoked <- cmdTestDeviceUUID
+
+	if event, msg := client.next(t); event != "closed" || msg.Reason != StreamClosedRevoked {
+		t.Errorf("expected revoked, got %s %+v", event, msg)
+	}
+	client.expectEnd(t)
+}
+
+func TestStreamCommands_WebSocketLifecycle(t *testing.T) {
+	env := newStreamTestEnv(t)
+	env.commands.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "open_valve", Status: CommandPending, CreatedAt: time.Now()}
+	conn := env.openWebSocket(t, env.token("ws", time.Hour))
+
+	msg, err := readWS(t, conn)
+	if err != nil || msg.Type != "command" || msg.ID != cmdTestCommandUUID {
+		t.Fatalf("expected pending command, got %+v (%v)", msg, err)
+	}
+	id := msg.ID
+
+	// Reports go over the same connection
+	if reply := sendWS(t, conn, CommandStreamRequest{Type: "ack", ID: id}); reply.Type != "updated" || reply.Command.Status != CommandAcknowledged {
+		t.Errorf("ack: unexpected reply %+v", reply)
+	}
+	if reply := sendWS(t, conn, CommandStreamRequest{Type: "ack", ID: id}); reply.Type != "updated" || !reply.Replayed {
+		t.Errorf("repeated ack: expected replayed update, got %+v", reply)
+	}
+	reply := sendWS(t, conn, CommandStreamRequest{Type: "complete", ID: id, Result: map[string]interface{}{"open": true}})
+	if reply.Type != "updated" || reply.Command.Status != CommandCompleted || reply.Command.Result["open"] != true {
+		t.Errorf("complete: unexpected reply %+v", reply)
+	}
+	if reply := sendWS(t, conn, CommandStreamRequest{Type: "fail", ID: id, ErrorMessage: "late"}); reply.Type != "error" || reply.Status != CommandCompleted {
+		t.Errorf("fail after complete: expected conflict, got %+v", reply)
+	}
+
+	// Invalid requests are answered without closing the stream
+	for _, req := range []CommandStreamRequest{
+		{Type: "delete", ID: id},
+		{Type: "ack", ID: "not-a-uuid"},
+		{Type: "fail", ID: id},                                    // error_message required
+		{Type: "ack", ID: "550e8400-e29b-41d4-a716-446655440099"}, // Unknown command
+		{Type: "auth", Token: "bogus"},
+	} {
+		if reply := sendWS(t, conn, req); reply.Type != "error" {
+			t.Errorf("%+v: expected error reply, got %+v", req, reply)
+		}
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := readWS(t, conn); err != nil || msg.Type != "error" {
+		t.Errorf("invalid JSON: expected error reply, got %+v (%v)", msg, err)
+	}
+
+	// The stream is still live and pushes new commands
+	env.createCommand(t, "close_valve")
+	if msg, err := readWS(t, conn); err != nil || msg.Command == nil || msg.Command.Type != "close_valve" {
+		t.Errorf("expected second command, got %+v (%v)", msg, err)
+	}
+}
+
+func TestStreamCommands_WebSocketAckExpired(t *testing.T) {
+	env := newStreamTestEnv(t)
+	expired := time.Now().Add(-time.Minute)
+	env.commands.data[cmdTestCommandUUID] = Command{DeviceID: cmdTestDeviceUUID, Type: "open_valve", Status: CommandPending, ExpiresAt: &expired}
+	conn := env.openWebSocket(t, env.token("ws", time.Hour))
+	env.waitForStream(t)
+
+	reply := sendWS(t, conn, CommandStreamRequest{Type: "ack", ID: cmdTestCommandUUID})
+	if reply.Type != "error" || reply.Status != CommandPending || !strings.Contains(reply.Error, "expired") {
+		t.Errorf("expected expiry error, got %+v", reply)
+	}
+	if cmd := env.commands.data[cmdTestCommandUUID]; cmd.Status != CommandPending {
+		t.Errorf("expired command was acknowledged: %+v", cmd)
+	}
+}
+
+func TestStreamCommands_WebSocketTokenRefresh(t *testing.T) {
+	env := newStreamTestEnv(t)
+	conn := env.openWebSocket(t, env.token("short", 400*time.Millisecond))
+	env.waitForStream(t)
+
+	if reply := sendWS(t, conn, CommandStreamRequest{Type: "auth", Token: env.token("refreshed", time.Hour)}); reply.Type != "authenticated" {
+		t.Fatalf("expected authenticated, got %+v", reply)
+	}
+
+	// Past the original expiry the stream still delivers commands
+	time.Sleep(600 * time.Millisecond)
+	env.createCommand(t, "reboot")
+	if msg, err := readWS(t, conn); err != nil || msg.Type != "command" {
+		t.Errorf("expected command after refresh, got %+v (%v)", msg, err)
+	}
+}
+
+func TestStreamCommands_WebSocketTokenExpiry(t *testing.T) {
+	env := newStreamTestEnv(t)
+	conn := env.openWebSocket(t, env.token("short", 300*time.Millisecond))
+
+	expectWSClose(t, conn, streamCloseTokenExpired)
+}
+
+func TestStreamCommands_WebSocketRevoked(t *testing.T) {
+	env := newStreamTestEnv(t)
+	conn := env.openWebSocket(t, env.token("ws", time.Hour))
+	env.waitForStream(t)
+
+	env.revoke(t)
+
+	expectWSClose(t, conn, streamCloseRevoked)
+}
+
+func TestStreamCommands_Unauthorized(t *testing.T) {
+	h := NewWithStores(nil, NewMockCommandStore(), nil, nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	h.StreamCommands(w, httptest.NewRequest(http.MethodGet, "/commands/stream", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestStreamTokenTTL(t *testing.T) {
+	if got := streamTokenTTL(time.Time{}); got != MaxCommandStreamDuration {
+		t.Errorf("unknown expiry: got %v", got)
+	}
+	if got := streamTokenTTL(time.Now().Add(-time.Minute)); got != 0 {
+		t.Errorf("expired token: got %v", got)
+	}
+	if got := streamTokenTTL(time.Now().Add(time.Minute)); got <= 0 || got > time.Minute {
+		t.Errorf("valid token: got %v", got)
+	}
+}
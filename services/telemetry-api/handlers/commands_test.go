@@ -7,6 +7,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 )
@@ -251,6 +252,106 @@ func TestGetCommands_FilterExpired(t *testing.T) {
 	}
 }
 
+func TestGetCommands_HidesNotBefore(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	mockStore.data["cmd-due"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, NotBefore: &past}
+	mockStore.data["cmd-later"] = Command{DeviceID: cmdTestDeviceUUID, Type: "calibrate", Status: CommandPending, NotBefore: &future}
+
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/commands", nil)
+	req = withDeviceCtx(req, cmdTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetCommands(w, req)
+
+	var response struct {
+		Data  []Command `json:"data"`
+		Count int       `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 1 || response.Data[0].Type != "reboot" {
+		t.Errorf("expected only the due command, got %+v", response.Data)
+	}
+}
+
+func TestGetCommands_SkipsUndeliverablePages(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	base := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Minute)
+	// Newest first: a not yet due and an expired command fill the first page of 2
+	mockStore.data["cmd-1"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: base}
+	mockStore.data["cmd-2"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: base.Add(time.Minute)}
+	mockStore.data["cmd-3"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: base.Add(2 * time.Minute)}
+	mockStore.data["cmd-4"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: base.Add(3 * time.Minute), ExpiresAt: &expired}
+	mockStore.data["cmd-5"] = Command{DeviceID: cmdTestDeviceUUID, Type: "calibrate", Status: CommandPending, CreatedAt: base.Add(4 * time.Minute), NotBefore: &future}
+
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	get := func(query string) (ids []string, token string) {
+		req := httptest.NewRequest(http.MethodGet, "/commands?"+query, nil)
+		req = withDeviceCtx(req, cmdTestDeviceUUID)
+		w := httptest.NewRecorder()
+		h.GetCommands(w, req)
+
+		var response struct {
+			Data          []Command `json:"data"`
+			NextPageToken string    `json:"next_page_token"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		for _, cmd := range response.Data {
+			ids = append(ids, cmd.ID)
+		}
+		return ids, response.NextPageToken
+	}
+
+	ids, token := get("limit=2")
+	if !slices.Equal(ids, []string{"cmd-3", "cmd-2"}) || token == "" {
+		t.Fatalf("expected the two newest due commands and a token, got %v %q", ids, token)
+	}
+	ids, token = get("limit=2&page_token=" + token)
+	if !slices.Equal(ids, []string{"cmd-1"}) || token != "" {
+		t.Errorf("expected the remaining due command and no token, got %v %q", ids, token)
+	}
+}
+
+func TestCreateCommand_NotBefore(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	notBefore := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	body := `{"device_id": "` + cmdTestDeviceUUID + `", "type": "calibrate", "not_before": "` + notBefore + `"}`
+	w := httptest.NewRecorder()
+	h.CreateCommand(w, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created Command
+	json.NewDecoder(w.Body).Decode(&created)
+	cmd := mockStore.data[created.ID]
+	if cmd.NotBefore == nil || cmd.ExpiresAt == nil || !cmd.ExpiresAt.Equal(cmd.NotBefore.Add(DefaultCommandExpiry)) {
+		t.Errorf("expected expiry %v after not_before, got %+v", DefaultCommandExpiry, cmd)
+	}
+
+	// Expiring before it becomes visible is rejected
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body = `{"device_id": "` + cmdTestDeviceUUID + `", "type": "calibrate", "not_before": "` + notBefore + `", "expires_at": "` + expiresAt + `"}`
+	w = httptest.NewRecorder()
+	h.CreateCommand(w, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
 func TestAckCommand_Success(t *testing.T) {
 	mockStore := NewMockCommandStore()
 	mockStore.data[cmdTestCommandUUID] = Command{
@@ -580,6 +681,80 @@ func TestGetCommands_MultipleCommands(t *testing.T) {
 	}
 }
 
+func TestGetCommands_Pagination(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	future := time.Now().Add(24 * time.Hour)
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"cmd-1", "cmd-2", "cmd-3"} {
+		mockStore.data[id] = Command{
+			DeviceID:  cmdTestDeviceUUID,
+			Type:      "reboot",
+			Status:    "pending",
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			ExpiresAt: &future,
+		}
+	}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	// First page: newest two commands
+	req := httptest.NewRequest(http.MethodGet, "/commands?limit=2", nil)
+	req = withDeviceCtx(req, cmdTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetCommands(w, req)
+
+	var first struct {
+		Data          []Command `json:"data"`
+		NextPageToken string    `json:"next_page_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&first); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Data) != 2 || first.Data[0].ID != "cmd-3" || first.Data[1].ID != "cmd-2" {
+		t.Fatalf("unexpected first page: %+v", first.Data)
+	}
+	if first.NextPageToken == "" {
+		t.Fatal("expected next_page_token on first page")
+	}
+
+	// Second page: remaining command, no further token
+	req = httptest.NewRequest(http.MethodGet, "/commands?limit=2&page_token="+first.NextPageToken, nil)
+	req = withDeviceCtx(req, cmdTestDeviceUUID)
+	w = httptest.NewRecorder()
+
+	h.GetCommands(w, req)
+
+	var second struct {
+		Data          []Command `json:"data"`
+		NextPageToken string    `json:"next_page_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&second); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Data) != 1 || second.Data[0].ID != "cmd-1" {
+		t.Fatalf("unexpected second page: %+v", second.Data)
+	}
+	if second.NextPageToken != "" {
+		t.Errorf("expected no next_page_token on last page, got %q", second.NextPageToken)
+	}
+}
+
+func TestGetCommands_InvalidPaging(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=5000", "page_token=garbage!"} {
+		h := NewWithStores(nil, NewMockCommandStore(), nil, nil, nil, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/commands?"+query, nil)
+		req = withDeviceCtx(req, cmdTestDeviceUUID)
+		w := httptest.NewRecorder()
+
+		h.GetCommands(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
 func TestCreateCommand_AllFieldsSet(t *testing.T) {
 	mockStore := NewMockCommandStore()
 	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Long-polling limits for GET /commands?wait=
+const (
+	// MaxCommandWait is the longest a device may block waiting for a command
+	MaxCommandWait = 60 * time.Second
+	// commandWaitWriteSlack is added to the wait for the write deadline of long-polls
+	commandWaitWriteSlack = 10 * time.Second
+	// maxCommandScanPages bounds the pages GET /commands reads looking for deliverable
+	// commands past expired and not yet due ones
+	maxCommandScanPages = 10
+)
+
+// Command watcher settings (see StartCommandWatcher)
+const (
+	// commandWatchWindow is how long one listener runs before it is re-anchored,
+	// so expired pending commands do not accumulate in its result set
+	commandWatchWindow = time.Hour
+	// commandWatchOverlap re-covers commands created while a listener restarts
+	commandWatchOverlap = time.Minute
+	// commandWatchRetry is the pause after a failed listener
+	commandWatchRetry = 5 * time.Second
+)
+
+// CommandHub wakes long-polling requests when a command is created for their device.
+// It only reaches requests on this instance; StartCommandWatcher feeds it commands
+// created on other instances.
+type CommandHub struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// NewCommandHub creates an empty hub
+func NewCommandHub() *CommandHub {
+	return &CommandHub{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+// Subscribe registers a waiter for deviceID. The channel receives a value when a
+// command may have been created; cancel must be called once the waiter is done.
+func (hub *CommandHub) Subscribe(deviceID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	hub.mu.Lock()
+	if hub.waiters[deviceID] == nil {
+		hub.waiters[deviceID] = make(map[chan struct{}]struct{})
+	}
+	hub.waiters[deviceID][ch] = struct{}{}
+	hub.mu.Unlock()
+
+	return ch, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		delete(hub.waiters[deviceID], ch)
+		if len(hub.waiters[deviceID]) == 0 {
+			delete(hub.waiters, deviceID)
+		}
+	}
+}
+
+// Notify wakes every waiter of deviceID without blocking
+func (hub *CommandHub) Notify(deviceID string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.waiters[deviceID] {
+		select {
+		case ch <- struct{}{}:
+		default: // Already has a pending wake-up
+		}
+	}
+}
+
+// Waiters returns the number of requests waiting for deviceID
+func (hub *CommandHub) Waiters(deviceID string) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.waiters[deviceID])
+}
+
+// parseCommandWait parses the wait query parameter (e.g. "30s"); zero means no waiting
+func parseCommandWait(r *http.Request) (time.Duration, error) {
+	waitStr := r.URL.Query().Get("wait")
+	if waitStr == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil || wait < 0 {
+		return 0, errors.New("invalid wait: must be a duration such as 30s")
+	}
+	if wait > MaxCommandWait {
+		return 0, fmt.Errorf("invalid wait: maximum is %s", MaxCommandWait)
+	}
+	return wait, nil
+}
+
+// StartCommandWatcher listens for pending commands created on any instance and wakes
+// local long-polls for their devices, until ctx is cancelled. Without a watcher-capable
+// store, long-polls only wake for commands created on this instance (or on timeout).
+func (h *Handlers) StartCommandWatcher(ctx context.Context) {
+	watcher, ok := h.commandStore.(CommandWatcher)
+	if !ok {
+		return
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			windowCtx, cancel := context.WithTimeout(ctx, commandWatchWindow)
+			err := watcher.WatchPending(windowCtx, time.Now().Add(-commandWatchOverlap), h.commandHub.Notify)
+			windowEnded := windowCtx.Err() != nil
+			cancel()
+			if windowEnded {
+				continue
+			}
+
+			h.logger.Warn("command watcher failed, retrying", "error", err, "retry_in", commandWatchRetry.String())
+			select {
+			case <-ctx.Done():
+			case <-time.After(commandWatchRetry):
+			}
+		}
+	}()
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startLongPoll runs GET /commands with the given query in the background
+func startLongPoll(ctx context.Context, h *Handlers, query string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	req := httptest.NewRequest(http.MethodGet, "/commands?"+query, nil).WithContext(ctx)
+	req = withDeviceCtx(req, cmdTestDeviceUUID)
+	go func() {
+		w := httptest.NewRecorder()
+		h.GetCommands(w, req)
+		done <- w
+	}()
+	return done
+}
+
+// waitForWaiter blocks until a long-poll for deviceID is registered with the hub
+func waitForWaiter(t *testing.T, h *Handlers, deviceID string) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); h.commandHub.Waiters(deviceID) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("long-poll never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParseCommandWait(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"wait=30s", 30 * time.Second, false},
+		{"wait=0s", 0, false},
+		{"wait=1m", time.Minute, false},
+		{"wait=61s", 0, true},
+		{"wait=-1s", 0, true},
+		{"wait=30", 0, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/commands?"+tt.query, nil)
+		got, err := parseCommandWait(req)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: got (%v, %v), want %v err=%v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCommandHub(t *testing.T) {
+	hub := NewCommandHub()
+	wake, cancel := hub.Subscribe("dev-1")
+	other, cancelOther := hub.Subscribe("dev-2")
+	defer cancelOther()
+
+	hub.Notify("dev-1")
+	hub.Notify("dev-1") // Coalesced, must not block
+
+	select {
+	case <-wake:
+	default:
+		t.Fatal("expected wake-up for dev-1")
+	}
+	select {
+	case <-other:
+		t.Fatal("dev-2 must not be woken")
+	default:
+	}
+
+	cancel()
+	if n := hub.Waiters("dev-1"); n != 0 {
+		t.Errorf("expected no waiters after cancel, got %d", n)
+	}
+	hub.Notify("dev-1") // No waiters left
+}
+
+func TestGetCommands_WaitWakesOnCreate(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	start := time.Now()
+	done := startLongPoll(context.Background(), h, "wait=10s")
+	waitForWaiter(t, h, cmdTestDeviceUUID)
+
+	body := `{"device_id": "` + cmdTestDeviceUUID + `", "type": "open_valve"}`
+	create := httptest.NewRecorder()
+	h.CreateCommand(create, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+	if create.Code != http.StatusCreated {
+		t.Fatalf("create: expected status %d, got %d", http.StatusCreated, create.Code)
+	}
+
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll was not woken by the new command")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("long-poll took %v", elapsed)
+	}
+
+	var response struct {
+		Data  []Command `json:"data"`
+		Count int       `json:"count"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Count != 1 || response.Data[0].Type != "open_valve" {
+		t.Errorf("unexpected response %d: %+v", w.Code, response)
+	}
+	if n := h.commandHub.Waiters(cmdTestDeviceUUID); n != 0 {
+		t.Errorf("expected waiter to unsubscribe, got %d", n)
+	}
+}
+
+func TestGetCommands_WaitIgnoresOtherDevices(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	done := startLongPoll(context.Background(), h, "wait=100ms")
+	waitForWaiter(t, h, cmdTestDeviceUUID)
+
+	body := `{"device_id": "` + cmdTestDeviceUUID2 + `", "type": "reboot"}`
+	h.CreateCommand(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+
+	w := <-done
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response["count"] != float64(0) {
+		t.Errorf("expected empty response after timeout, got %d: %v", w.Code, response)
+	}
+}
+
+func TestGetCommands_WaitReturnsExistingCommands(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	mockStore.data["cmd-1"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: time.Now()}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	start := time.Now()
+	w := <-startLongPoll(context.Background(), h, "wait=10s")
+
+	if w.Code != http.StatusOK || time.Since(start) > time.Second {
+		t.Errorf("expected immediate response, got %d after %v", w.Code, time.Since(start))
+	}
+}
+
+func TestGetCommands_WaitWakesOnNotBefore(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	notBefore := time.Now().Add(200 * time.Millisecond)
+	mockStore.data["cmd-1"] = Command{DeviceID: cmdTestDeviceUUID, Type: "calibrate", Status: CommandPending, NotBefore: &notBefore}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-startLongPoll(context.Background(), h, "wait=10s"):
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll was not woken when the command became due")
+	}
+	if time.Now().Before(notBefore) {
+		t.Error("long-poll returned before not_before")
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response["count"] != float64(1) {
+		t.Errorf("expected the scheduled command, got %d: %v", w.Code, response)
+	}
+}
+
+func TestGetCommands_WaitReturnsDueCommandsPastFirstPage(t *testing.T) {
+	mockStore := NewMockCommandStore()
+	notBefore := time.Now().Add(time.Hour)
+	mockStore.data["cmd-1"] = Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: time.Now().Add(-time.Minute)}
+	mockStore.data["cmd-2"] = Command{DeviceID: cmdTestDeviceUUID, Type: "calibrate", Status: CommandPending, CreatedAt: time.Now(), NotBefore: &notBefore}
+	h := NewWithStores(nil, mockStore, nil, nil, nil, nil)
+
+	start := time.Now()
+	w := <-startLongPoll(context.Background(), h, "wait=10s&limit=1")
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response["count"] != float64(1) || time.Since(start) > time.Second {
+		t.Errorf("expected the due command immediately, got %d after %v: %v", w.Code, time.Since(start), response)
+	}
+}
+
+func TestGetCommands_WaitClientGone(t *testing.T) {
+	h := NewWithStores(nil, NewMockCommandStore(), nil, nil, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startLongPoll(ctx, h, "wait=10s")
+	waitForWaiter(t, h, cmdTestDeviceUUID)
+	cancel()
+
+	select {
+	case w := <-done:
+		if w.Body.Len() != 0 {
+			t.Errorf("expected no response for a disconnected device, got %s", w.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll did not stop when the device disconnected")
+	}
+}
+
+func TestGetCommands_InvalidWait(t *testing.T) {
+	h := NewWithStores(nil, NewMockCommandStore(), nil, nil, nil, nil)
+
+	for _, query := range []string{
+		"wait=forever",
+		"wait=5m",
+		"wait=10s&status=acknowledged",
+		"wait=10s&page_token=" + encodePageToken(&PageCursor{Time: time.Now(), ID: "cmd-1"}),
+	} {
+		w := <-startLongPoll(context.Background(), h, query)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// watchingCommandStore is a command store that pushes notifications like Firestore listeners
+type watchingCommandStore struct {
+	*MockCommandStore
+	notify chan string
+}
+
+func (s *watchingCommandStore) WatchPending(ctx context.Context, since time.Time, notify func(deviceID string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case deviceID := <-s.notify:
+			notify(deviceID)
+		}
+	}
+}
+
+func TestStartCommandWatcher(t *testing.T) {
+	store := &watchingCommandStore{MockCommandStore: NewMockCommandStore(), notify: make(chan string)}
+	h := NewWithStores(nil, store, nil, nil, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartCommandWatcher(ctx)
+
+	done := startLongPoll(context.Background(), h, "wait=10s")
+	waitForWaiter(t, h, cmdTestDeviceUUID)
+
+	// Command created by another instance: only the watcher sees it
+	store.Save(context.Background(), &Command{DeviceID: cmdTestDeviceUUID, Type: "reboot", Status: CommandPending, CreatedAt: time.Now()})
+	store.notify <- cmdTestDeviceUUID
+
+	select {
+	case w := <-done:
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		if response["count"] != float64(1) {
+			t.Errorf("expected 1 command, got %v", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher notification did not wake the long-poll")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
@@ -140,3 +141,76 @@ func (h *Handlers) GetDevice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(device)
 }
+
+// MaxDeviceTags bounds the tags of one device
+const MaxDeviceTags = 20
+
+// SetDeviceTagsRequest is the request body for PUT /admin/devices/{id}/tags
+type SetDeviceTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetDeviceTags handles PUT /admin/devices/{id}/tags
+// Admin endpoint to replace a device's tags (used by bulk command selectors)
+func (h *Handlers) SetDeviceTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	deviceID := r.PathValue("id")
+	if err := validate.UUID(deviceID); err != nil {
+		h.jsonError(w, "invalid device_id format", http.StatusBadRequest)
+		return
+	}
+
+	var req SetDeviceTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.deviceStore.GetByID(ctx, deviceID); err != nil {
+		h.jsonError(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.deviceStore.UpdateTags(ctx, deviceID, tags); err != nil {
+		h.logger.Error("failed to update device tags",
+			"request_id", reqID,
+			"error", err,
+			"device_id", deviceID,
+		)
+		h.jsonError(w, "failed to update device tags", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("device tags updated",
+		"request_id", reqID,
+		"device_id", deviceID,
+		"tags", tags,
+	)
+
+	h.jsonResponse(w, map[string]interface{}{
+		"device_id": deviceID,
+		"tags":      tags,
+	}, http.StatusOK)
+}
+
+// normalizeTags validates tags and returns them sorted without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > MaxDeviceTags {
+		return nil, fmt.Errorf("too many tags (max %d)", MaxDeviceTags)
+	}
+	for _, tag := range tags {
+		if err := validate.Identifier(tag); err != nil {
+			return nil, fmt.Errorf("invalid tag: %v", err)
+		}
+	}
+	tags = append([]string{}, tags...)
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
@@ -382,4 +382,46 @@ func TestUpdateDeviceInfo_ValidVersionFormats(t *testing.T) {
 	}
 }
 
+func TestSetDeviceTags(t *testing.T) {
+	mockStore := NewMockDeviceStore()
+	mockStore.data[devTestDeviceUUID] = Device{DeviceID: devTestDeviceUUID, Tags: []string{"old"}}
+	h := NewWithStores(nil, nil, mockStore, nil, nil, nil)
+
+	tests := []struct {
+		name     string
+		deviceID string
+		body     string
+		want     int
+		wantTags []string
+	}{
+		{"sorted and deduplicated", devTestDeviceUUID, `{"tags": ["greenhouse", "beta", "greenhouse"]}`, http.StatusOK, []string{"beta", "greenhouse"}},
+		{"cleared", devTestDeviceUUID, `{"tags": []}`, http.StatusOK, []string{}},
+		{"invalid tag", devTestDeviceUUID, `{"tags": ["no spaces"]}`, http.StatusBadRequest, nil},
+		{"too many tags", devTestDeviceUUID, `{"tags": [` + strings.Repeat(`"t",`, MaxDeviceTags) + `"t"]}`, http.StatusBadRequest, nil},
+		{"invalid JSON", devTestDeviceUUID, `{`, http.StatusBadRequest, nil},
+		{"invalid device id", "not-a-uuid", `{"tags": []}`, http.StatusBadRequest, nil},
+		{"unknown device", devTestDeviceUUID2, `{"tags": []}`, http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/admin/devices/"+tt.deviceID+"/tags", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.deviceID)
+			w := httptest.NewRecorder()
+
+			h.SetDeviceTags(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.wantTags == nil {
+				return
+			}
+			device, _ := mockStore.GetByID(req.Context(), tt.deviceID)
+			if strings.Join(device.Tags, ",") != strings.Join(tt.wantTags, ",") || device.Tags == nil {
+				t.Errorf("expected tags %v, got %v", tt.wantTags, device.Tags)
+			}
+		})
+	}
+}
+
 // Note: withDeviceContext is defined in telemetry_test.go
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -23,8 +24,11 @@ const (
 
 // Config holds handler configuration
 type Config struct {
-	ProjectID  string
-	ServiceURL string // Cloud Run service URL for JWT audience (optional, defaults to constructed URL)
+	ProjectID       string
+	ServiceURL      string // Cloud Run service URL for JWT audience (optional, defaults to constructed URL)
+	Retention       RetentionPolicy
+	TimestampWindow TimestampWindow // Accepted range of device-supplied sample timestamps (protobuf)
+	SchemaCompat    string          // Default schema upload compatibility mode (see ParseSchemaCompatMode)
 }
 
 // Handlers contains all HTTP handlers and their dependencies
@@ -34,13 +38,24 @@ type Handlers struct {
 	commandStore   CommandStore
 	deviceStore    DeviceStore
 	schemaStore    SchemaStore
+	rollupStore    RollupStore
+	quarantine     QuarantineStore      // nil = undecodable payloads are rejected, not kept
+	scheduleStore  CommandScheduleStore // nil = recurring commands are disabled
 	authService    AuthService
 	publisher      EventPublisher
 	logger         *slog.Logger
 
+	// Wakes long-polling GET /commands requests and command streams when a command is created
+	commandHub *CommandHub
+	// Open GET /commands/stream connections, ended early on revocation and shutdown
+	commandStreams *commandStreamRegistry
+
 	// Cache for device revocation status (reduces Firestore reads)
 	deviceStatusCache *cache.TTL[string, bool]
 
+	// Serializes retention runs (admin endpoint and background sweeper)
+	retentionMu sync.Mutex
+
 	// Keep references for cleanup
 	firestoreClient *firestore.Client
 	pubsubClient    *pubsub.Client
@@ -90,9 +105,14 @@ func New(ctx context.Context, cfg Config) (*Handlers, error) {
 		commandStore:      NewFirestoreCommandStore(fsClient),
 		deviceStore:       deviceStore,
 		schemaStore:       schemaStore,
+		rollupStore:       NewFirestoreRollupStore(fsClient),
+		quarantine:        NewFirestoreQuarantineStore(fsClient),
+		scheduleStore:     NewFirestoreScheduleStore(fsClient),
 		authService:       authService,
 		publisher:         NewPubSubPublisher(psClient),
 		logger:            slog.Default(),
+		commandHub:        NewCommandHub(),
+		commandStreams:    newCommandStreamRegistry(),
 		deviceStatusCache: deviceStatusCache,
 		firestoreClient:   fsClient,
 		pubsubClient:      psClient,
@@ -122,6 +142,8 @@ func NewWithStores(telemetry TelemetryStore, commands CommandStore, devices Devi
 		authService:       auth,
 		publisher:         publisher,
 		logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		commandHub:        NewCommandHub(),
+		commandStreams:    newCommandStreamRegistry(),
 		deviceStatusCache: deviceStatusCache,
 	}
 }
@@ -139,11 +161,14 @@ func (h *Handlers) Close() error {
 
 // Collections and topics
 const (
-	TelemetryCollection = "telemetry"
-	CommandsCollection  = "commands"
-	DevicesCollection   = "devices"
-	SchemasCollection   = "schemas"
-	TelemetryTopic      = "telemetry-events"
+	TelemetryCollection  = "telemetry"
+	CommandsCollection   = "commands"
+	DevicesCollection    = "devices"
+	SchemasCollection    = "schemas"
+	QuarantineCollection = "telemetry_quarantine"
+	RollupsCollection    = "telemetry_rollups"
+	SchedulesCollection  = "command_schedules"
+	TelemetryTopic       = "telemetry-events"
 )
 
 // Health returns service health status
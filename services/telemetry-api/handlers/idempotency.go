@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Idempotency headers
+const (
+	// IdempotencyKeyHeader lets clients retry an ingestion request without double-writing
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to "true" when a request only matched previously stored readings
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Idempotency key limits
+const (
+	MaxIdempotencyKeyLength = 255
+	MaxMsgIDLength          = 128
+)
+
+// idempotencyKey returns the request's Idempotency-Key header ("" when absent)
+func idempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return "", nil
+	}
+	if err := validateMessageKey(key, MaxIdempotencyKeyLength); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", IdempotencyKeyHeader, err)
+	}
+	return key, nil
+}
+
+// validateMsgID checks a per-reading msg_id ("" is allowed: no idempotency)
+func validateMsgID(msgID string) error {
+	if msgID == "" {
+		return nil
+	}
+	if err := validateMessageKey(msgID, MaxMsgIDLength); err != nil {
+		return fmt.Errorf("invalid msg_id: %w", err)
+	}
+	return nil
+}
+
+// validateMessageKey accepts printable ASCII keys of at most maxLen bytes
+func validateMessageKey(key string, maxLen int) error {
+	if len(key) > maxLen {
+		return fmt.Errorf("must be at most %d characters", maxLen)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return fmt.Errorf("must be printable ASCII without spaces")
+		}
+	}
+	return nil
+}
+
+// readingKey picks the idempotency key of the reading at index i of a request:
+// its own msg_id, else the request's Idempotency-Key qualified by the index ("" = none)
+func readingKey(msgID, requestKey string, i int) string {
+	if msgID != "" {
+		return "m:" + msgID
+	}
+	if requestKey != "" {
+		return "k:" + requestKey + ":" + strconv.Itoa(i)
+	}
+	return ""
+}
+
+// telemetryDocID derives a deterministic document ID from a device and idempotency key,
+// so a retried reading maps to the document written by the first attempt
+func telemetryDocID(deviceID, key string) string {
+	sum := sha256.Sum256([]byte(deviceID + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// setIdempotentID presets the deterministic document ID of a reading with an idempotency key
+func setIdempotentID(d *TelemetryData, key string) {
+	if key != "" {
+		d.ID = telemetryDocID(d.DeviceID, key)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+func TestTelemetryDocID(t *testing.T) {
+	a := telemetryDocID(telTestDeviceUUID, "m:abc")
+	if a != telemetryDocID(telTestDeviceUUID, "m:abc") {
+		t.Error("expected deterministic ID")
+	}
+	if a == telemetryDocID(retentionTestDeviceUUID2, "m:abc") {
+		t.Error("expected IDs to be namespaced by device")
+	}
+	if a == telemetryDocID(telTestDeviceUUID, "m:abd") {
+		t.Error("expected different keys to map to different IDs")
+	}
+}
+
+func TestReadingKey(t *testing.T) {
+	if got := readingKey("msg-1", "req", 3); got != "m:msg-1" {
+		t.Errorf("msg_id must take precedence, got %q", got)
+	}
+	if got := readingKey("", "req", 3); got != "k:req:3" {
+		t.Errorf("expected request key qualified by index, got %q", got)
+	}
+	if got := readingKey("", "", 3); got != "" {
+		t.Errorf("expected no key, got %q", got)
+	}
+}
+
+func postBatch(h *Handlers, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+	h.HandleTelemetryBatch(w, req)
+	return w
+}
+
+func TestHandleTelemetryBatch_IdempotencyKeyRetry(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockPublisher := NewMockEventPublisher()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, mockPublisher)
+
+	body := `[{"type": "temperature", "value": 1}, {"type": "humidity", "value": 2}]`
+
+	first := postBatch(h, "retry-key-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, first.Code)
+	}
+	retry := postBatch(h, "retry-key-1", body)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, retry.Code)
+	}
+
+	if len(mockStore.data) != 2 {
+		t.Errorf("expected 2 stored readings after retry, got %d", len(mockStore.data))
+	}
+	if len(mockPublisher.Published) != 2 {
+		t.Errorf("retry must not republish, got %d events", len(mockPublisher.Published))
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("expected replayed header on retry")
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(retry.Body).Decode(&response)
+	if response["saved"] != float64(2) || response["duplicates"] != float64(2) {
+		t.Errorf("retry should report the original result, got %v", response)
+	}
+
+	// A different key is a new request
+	postBatch(h, "retry-key-2", body)
+	if len(mockStore.data) != 4 {
+		t.Errorf("expected 4 stored readings, got %d", len(mockStore.data))
+	}
+}
+
+func TestHandleTelemetryBatch_MsgID(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	// Second reading repeats the first msg_id within the same request
+	body := `[
+		{"type": "temperature", "value": 1, "msg_id": "a"},
+		{"type": "temperature", "value": 1, "msg_id": "a"},
+		{"type": "temperature", "value": 2, "msg_id": "b"}
+	]`
+	w := postBatch(h, "", body)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["saved"] != float64(3) || response["duplicates"] != float64(1) {
+		t.Errorf("unexpected response: %v", response)
+	}
+	if len(mockStore.data) != 2 {
+		t.Errorf("expected 2 stored readings, got %d", len(mockStore.data))
+	}
+
+	// Retrying a single reading by msg_id without any request key
+	postBatch(h, "", `[{"type": "temperature", "value": 2, "msg_id": "b"}]`)
+	if len(mockStore.data) != 2 {
+		t.Errorf("expected msg_id retry to be deduplicated, got %d readings", len(mockStore.data))
+	}
+}
+
+func TestHandleTelemetryBatch_InvalidMsgID(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	w := postBatch(h, "", `[{"type": "temperature", "value": 1, "msg_id": "has space"}]`)
+
+	var response struct {
+		Rejected []BatchItemError `json:"rejected"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Rejected) != 1 || response.Rejected[0].Code != ReasonInvalidMsgID {
+		t.Errorf("expected invalid_msg_id rejection, got %+v", response.Rejected)
+	}
+}
+
+func TestHandleTelemetryBatch_InvalidIdempotencyKey(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	w := postBatch(h, strings.Repeat("k", MaxIdempotencyKeyLength+1), `[{"type": "temperature", "value": 1}]`)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleTelemetry_IdempotentRetry(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockPublisher := NewMockEventPublisher()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, mockPublisher)
+
+	var responses []TelemetryData
+	for attempt, body := range []string{`{"type": "temperature", "value": 21.5}`, `{"type": "temperature", "value": 99}`} {
+		req := httptest.NewRequest(http.MethodPost, "/telemetry", bytes.NewBufferString(body))
+		req.Header.Set(IdempotencyKeyHeader, "single-1")
+		req = withDeviceContext(req, telTestDeviceUUID)
+		w := httptest.NewRecorder()
+
+		h.HandleTelemetry(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("attempt %d: expected status %d, got %d", attempt, http.StatusCreated, w.Code)
+		}
+		if replayed := w.Header().Get(IdempotentReplayedHeader) == "true"; replayed != (attempt == 1) {
+			t.Errorf("attempt %d: unexpected replayed header %v", attempt, replayed)
+		}
+
+		var response TelemetryData
+		json.NewDecoder(w.Body).Decode(&response)
+		responses = append(responses, response)
+	}
+
+	// The retry answers with the stored original, not its own body
+	first, retry := responses[0], responses[1]
+	if first.ID == "" || retry.ID != first.ID || retry.Value != 21.5 || !retry.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("expected retry to return the original reading %+v, got %+v", first, retry)
+	}
+	if len(mockStore.data) != 1 || len(mockPublisher.Published) != 1 {
+		t.Errorf("expected a single stored and published reading, got %d/%d", len(mockStore.data), len(mockPublisher.Published))
+	}
+}
+
+func TestHandleTelemetryProto_IdempotentRetry(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	body := encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40})
+
+	for attempt := 0; attempt < 2; attempt++ {
+		req := httptest.NewRequest(http.MethodPost, "/telemetry/proto", bytes.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "proto-retry-1")
+		req = withDeviceContext(req, protoTestDeviceUUID)
+		w := httptest.NewRecorder()
+
+		h.HandleTelemetryProto(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected status %d, got %d", attempt, http.StatusOK, w.Code)
+		}
+
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		if response["measurements"] != float64(2) {
+			t.Errorf("attempt %d: expected 2 measurements, got %v", attempt, response["measurements"])
+		}
+	}
+
+	if len(telemetry.data) != 2 {
+		t.Errorf("expected 2 stored readings after retry, got %d", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_InvalidMsgID(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	b := new(proto.Builder)
+	b.Message(batchFieldMeasurements, new(proto.Builder).Uint32(measurementFieldID, 1).Double(measurementFieldDouble, 21.5))
+	b.Message(batchFieldMeasurements, new(proto.Builder).Uint32(measurementFieldID, 2).Double(measurementFieldDouble, 40).
+		String(measurementFieldMsgID, "has space"))
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/proto", bytes.NewReader(b.Build()))
+	req = withDeviceContext(req, protoTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryProto(w, req)
+
+	var response struct {
+		Measurements int              `json:"measurements"`
+		Rejected     []BatchItemError `json:"rejected"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Measurements != 1 || len(telemetry.data) != 1 {
+		t.Fatalf("expected the valid measurement stored, got %d: %+v", w.Code, response)
+	}
+	if len(response.Rejected) != 1 || response.Rejected[0].Index != 1 || response.Rejected[0].Code != ReasonInvalidMsgID {
+		t.Errorf("expected measurement 1 rejected with %s, got %+v", ReasonInvalidMsgID, response.Rejected)
+	}
+}
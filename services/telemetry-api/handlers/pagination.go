@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Page size limits for list endpoints
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// maxPageTokenLength bounds the page_token parameter before decoding
+const maxPageTokenLength = 512
+
+var errInvalidPageToken = errors.New("invalid page_token")
+
+// encodePageToken serializes a cursor into an opaque, URL-safe continuation token.
+// Returns "" for a nil cursor (no more pages).
+func encodePageToken(c *PageCursor) string {
+	if c == nil {
+		return ""
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodePageToken parses a continuation token produced by encodePageToken.
+// Returns nil for an empty token (first page).
+func decodePageToken(token string) (*PageCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if len(token) > maxPageTokenLength {
+		return nil, errInvalidPageToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	var c PageCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" || c.Time.IsZero() {
+		return nil, errInvalidPageToken
+	}
+	return &c, nil
+}
+
+// parsePageSize reads the limit query parameter (default DefaultPageSize, max MaxPageSize)
+func parsePageSize(r *http.Request) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return DefaultPageSize, nil
+	}
+	l, err := strconv.Atoi(limitStr)
+	if err != nil || l < 1 {
+		return 0, errors.New("invalid limit: must be a positive integer")
+	}
+	if l > MaxPageSize {
+		return 0, fmt.Errorf("invalid limit: maximum is %d", MaxPageSize)
+	}
+	return l, nil
+}
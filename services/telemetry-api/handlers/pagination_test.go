@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPageToken_RoundTrip(t *testing.T) {
+	cursor := &PageCursor{
+		Time: time.Date(2026, 1, 15, 10, 0, 0, 123, time.UTC),
+		ID:   "abc123",
+	}
+
+	token := encodePageToken(cursor)
+	if token == "" {
+		t.Fatal("expected non-empty token")
+	}
+
+	decoded, err := decodePageToken(token)
+	if err != nil {
+		t.Fatalf("decodePageToken failed: %v", err)
+	}
+	if !decoded.Time.Equal(cursor.Time) || decoded.ID != cursor.ID {
+		t.Errorf("round trip mismatch: got %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestPageToken_Empty(t *testing.T) {
+	if token := encodePageToken(nil); token != "" {
+		t.Errorf("expected empty token for nil cursor, got %q", token)
+	}
+
+	cursor, err := decodePageToken("")
+	if err != nil || cursor != nil {
+		t.Errorf("expected nil cursor and no error for empty token, got %+v, %v", cursor, err)
+	}
+}
+
+func TestPageToken_Invalid(t *testing.T) {
+	tokens := []string{
+		"not base64!",
+		"bm90IGpzb24", // "not json"
+		"e30",         // "{}" - missing fields
+		string(make([]byte, maxPageTokenLength+1)),
+	}
+
+	for _, token := range tokens {
+		if _, err := decodePageToken(token); err == nil {
+			t.Errorf("expected error for token %q", token)
+		}
+	}
+}
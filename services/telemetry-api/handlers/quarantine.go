@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+)
+
+// Quarantine reasons: why a protobuf payload could not be (fully) ingested
+const (
+	QuarantineSchemaNotFound     = "schema_not_found"    // No schema resolves for the device's app/version
+	QuarantineInvalidMeasurement = "invalid_measurement" // Value encoding does not match the schema type
+	QuarantineUnknownMeasurement = "unknown_measurement" // Measurement IDs missing from the schema (others were stored)
+)
+
+// Quarantine statuses
+const (
+	QuarantinePending  = "pending"
+	QuarantineReplayed = "replayed"
+)
+
+// MaxQuarantinePayload bounds the payloads kept in quarantine (Firestore documents are limited to 1 MiB)
+const MaxQuarantinePayload = 900 * 1024
+
+// MaxQuarantineReplay is the maximum number of payloads replayed per bulk request
+const MaxQuarantineReplay = 100
+
+var quarantineReasons = map[string]bool{
+	QuarantineSchemaNotFound:     true,
+	QuarantineInvalidMeasurement: true,
+	QuarantineUnknownMeasurement: true,
+}
+
+// unknownIDsMessage describes measurement IDs missing from a schema
+func unknownIDsMessage(ids []uint32) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return "unknown measurement IDs: " + strings.Join(parts, ", ")
+}
+
+// quarantinePayload keeps a rejected upload for replay. It reports false when the payload
+// was not kept: quarantine disabled, a reason that replay cannot fix, too large, or a store error.
+func (h *Handlers) quarantinePayload(ctx context.Context, reqID string, up protoUpload, reason, message string, unknownIDs []uint32) (string, bool) {
+	if h.quarantine == nil || reason == "" {
+		return "", false
+	}
+	if len(up.body) > MaxQuarantinePayload {
+		h.logger.Warn("payload too large to quarantine",
+			"request_id", reqID,
+			"device_id", up.deviceID,
+			"size", len(up.body),
+		)
+		return "", false
+	}
+
+	p := &QuarantinedPayload{
+		DeviceID:       up.deviceID,
+		AppName:        up.appName,
+		AppVersion:     up.appVersion,
+		Reason:         reason,
+		Error:          message,
+		UnknownIDs:     unknownIDs,
+		Payload:        bytes.Clone(up.body), // up.body may be a pooled request buffer
+		PayloadSize:    len(up.body),
+		Mode:           up.mode,
+		IdempotencyKey: up.requestKey,
+		Status:         QuarantinePending,
+		ReceivedAt:     up.receivedAt,
+	}
+	id, err := h.quarantine.Save(ctx, p)
+	if err != nil {
+		h.logger.Error("failed to quarantine telemetry",
+			"request_id", reqID,
+			"error", err,
+			"device_id", up.deviceID,
+			"reason", reason,
+		)
+		return "", false
+	}
+
+	h.logger.Warn("telemetry quarantined",
+		"request_id", reqID,
+		"quarantine_id", id,
+		"device_id", up.deviceID,
+		"app", up.appName,
+		"version", up.appVersion,
+		"reason", reason,
+	)
+	return id, true
+}
+
+// QuarantineReplayResult is the outcome of replaying one quarantined payload
+type QuarantineReplayResult struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"` // QuarantineReplayed, or QuarantinePending when it failed again
+	Measurements int    `json:"measurements"`
+	Duplicates   int    `json:"duplicates"`
+	Reason       string `json:"reason,omitempty"` // Why the payload is still quarantined
+	Error        string `json:"error,omitempty"`
+}
+
+// replayQuarantined ingests a quarantined payload with the schema for the firmware
+// version it was received from, and records the outcome.
+func (h *Handlers) replayQuarantined(ctx context.Context, reqID string, p *QuarantinedPayload) (QuarantineReplayResult, error) {
+	up := protoUpload{
+		deviceID:   p.DeviceID,
+		appName:    p.AppName,
+		appVersion: p.AppVersion,
+		body:       p.Payload,
+		mode:       p.Mode,
+		requestKey: p.IdempotencyKey,
+		receivedAt: p.ReceivedAt, // Readings keep the time of the original upload
+	}
+	if up.mode == "" {
+		up.mode = BatchBestEffort
+	}
+	// Derive an idempotency key so that replaying twice cannot store readings twice
+	if up.requestKey == "" {
+		up.requestKey = "quarantine:" + p.ID
+	}
+	// Readings with known IDs were stored when the payload was received
+	if len(p.UnknownIDs) > 0 {
+		up.onlyIDs = make(map[uint32]bool, len(p.UnknownIDs))
+		for _, id := range p.UnknownIDs {
+			up.onlyIDs[id] = true
+		}
+	}
+
+	result := QuarantineReplayResult{ID: p.ID, Status: QuarantinePending}
+	updates := map[string]interface{}{"replay_attempts": p.ReplayAttempts + 1}
+
+	res, ingestErr := h.ingestProto(ctx, reqID, up)
+	switch {
+	case ingestErr != nil:
+		if ingestErr.reason == "" {
+			// Storage failures and timestamp rejections are not recorded as the quarantine reason
+			return result, errors.New(ingestErr.message)
+		}
+		result.Reason, result.Error = ingestErr.reason, ingestErr.message
+		updates["reason"], updates["error"] = ingestErr.reason, ingestErr.message
+
+	case len(res.unknownIDs) > 0:
+		result.Measurements, result.Duplicates = res.saved, res.out.duplicates
+		result.Reason, result.Error = QuarantineUnknownMeasurement, unknownIDsMessage(res.unknownIDs)
+		updates["reason"], updates["error"] = result.Reason, result.Error
+		updates["unknown_ids"] = res.unknownIDs
+
+	default:
+		result.Status = QuarantineReplayed
+		result.Measurements, result.Duplicates = res.saved, res.out.duplicates
+		updates["status"] = QuarantineReplayed
+		updates["replayed_at"] = time.Now().UTC()
+	}
+
+	if err := h.quarantine.Update(ctx, p.ID, updates); err != nil {
+		return result, fmt.Errorf("failed to update quarantine record: %w", err)
+	}
+	return result, nil
+}
+
+// validateQuarantineQuery checks the filters of quarantine list and bulk replay requests
+func validateQuarantineQuery(q QuarantineQuery) error {
+	if q.DeviceID != "" {
+		if err := validate.UUID(q.DeviceID); err != nil {
+			return fmt.Errorf("invalid device_id: %v", err)
+		}
+	}
+	if q.AppName != "" {
+		if err := validate.Identifier(q.AppName); err != nil {
+			return fmt.Errorf("invalid app: %v", err)
+		}
+	}
+	if q.AppVersion != "" {
+		if err := validate.Version(q.AppVersion); err != nil {
+			return fmt.Errorf("invalid version: %v", err)
+		}
+	}
+	if q.Reason != "" && !quarantineReasons[q.Reason] {
+		return fmt.Errorf("invalid reason: must be one of %s, %s, %s",
+			QuarantineSchemaNotFound, QuarantineInvalidMeasurement, QuarantineUnknownMeasurement)
+	}
+	if q.Status != "" && q.Status != QuarantinePending && q.Status != QuarantineReplayed {
+		return fmt.Errorf("invalid status: must be %s or %s", QuarantinePending, QuarantineReplayed)
+	}
+	return nil
+}
+
+// ListQuarantine handles GET /admin/quarantine - lists quarantined payloads (newest first).
+// Filters: device_id, app, version, reason, status; paginated via limit + page_token.
+// Payload bytes are omitted (see GetQuarantined).
+func (h *Handlers) ListQuarantine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.quarantine == nil {
+		h.jsonError(w, "quarantine is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	q := QuarantineQuery{
+		DeviceID:   params.Get("device_id"),
+		AppName:    params.Get("app"),
+		AppVersion: params.Get("version"),
+		Reason:     params.Get("reason"),
+		Status:     params.Get("status"),
+	}
+	if err := validateQuarantineQuery(q); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parsePageSize(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	after, err := decodePageToken(params.Get("page_token"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payloads, next, err := h.quarantine.ListPage(ctx, q, limit, after)
+	if err != nil {
+		h.logger.Error("failed to list quarantined telemetry",
+			"request_id", reqID,
+			"error", err,
+		)
+		h.jsonError(w, "failed to list quarantined telemetry", http.StatusInternalServerError)
+		return
+	}
+	for i := range payloads {
+		payloads[i].Payload = nil
+	}
+	if payloads == nil {
+		payloads = []QuarantinedPayload{}
+	}
+
+	response := map[string]interface{}{
+		"data":  payloads,
+		"count": len(payloads),
+	}
+	if token := encodePageToken(next); token != "" {
+		response["next_page_token"] = token
+	}
+
+	h.jsonResponse(w, response, http.StatusOK)
+}
+
+// GetQuarantined handles GET /admin/quarantine/{id} - a quarantined payload including its bytes
+func (h *Handlers) GetQuarantined(w http.ResponseWriter, r *http.Request) {
+	if h.quarantine == nil {
+		h.jsonError(w, "quarantine is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := validate.PathSegment(id); err != nil {
+		h.jsonError(w, "invalid quarantine id", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.quarantine.GetByID(r.Context(), id)
+	if err != nil {
+		h.jsonError(w, "quarantined payload not found", http.StatusNotFound)
+		return
+	}
+
+	h.jsonResponse(w, p, http.StatusOK)
+}
+
+// ReplayQuarantined handles POST /admin/quarantine/{id}/replay - ingests one quarantined payload
+// again, typically after the missing schema has been uploaded
+func (h *Handlers) ReplayQuarantined(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.quarantine == nil {
+		h.jsonError(w, "quarantine is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := validate.PathSegment(id); err != nil {
+		h.jsonError(w, "invalid quarantine id", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.quarantine.GetByID(ctx, id)
+	if err != nil {
+		h.jsonError(w, "quarantined payload not found", http.StatusNotFound)
+		return
+	}
+	if p.Status == QuarantineReplayed {
+		h.jsonError(w, "payload was already replayed", http.StatusConflict)
+		return
+	}
+
+	result, err := h.replayQuarantined(ctx, reqID, p)
+	if err != nil {
+		h.logger.Error("failed to replay quarantined telemetry",
+			"request_id", reqID,
+			"error", err,
+			"quarantine_id", id,
+		)
+		h.jsonError(w, "failed to replay quarantined telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("quarantined telemetry replayed",
+		"request_id", reqID,
+		"quarantine_id", id,
+		"status", result.Status,
+		"measurements", result.Measurements,
+	)
+
+	h.jsonResponse(w, result, http.StatusOK)
+}
+
+// ReplayQuarantineRequest selects pending payloads for a bulk replay (empty fields match all)
+type ReplayQuarantineRequest struct {
+	DeviceID   string `json:"device_id"`
+	AppName    string `json:"app_name"`
+	AppVersion string `json:"app_version"`
+	Reason     string `json:"reason"`
+	Limit      int    `json:"limit"` // Default and maximum MaxQuarantineReplay
+}
+
+// ReplayQuarantine handles POST /admin/quarantine/replay - replays pending payloads matching
+// the request, newest first. Payloads that fail again stay pending; "remaining" reports
+// whether more pending payloads matched than were replayed.
+func (h *Handlers) ReplayQuarantine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.quarantine == nil {
+		h.jsonError(w, "quarantine is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req ReplayQuarantineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	q := QuarantineQuery{
+		DeviceID:   req.DeviceID,
+		AppName:    req.AppName,
+		AppVersion: req.AppVersion,
+		Reason:     req.Reason,
+		Status:     QuarantinePending,
+	}
+	if err := validateQuarantineQuery(q); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Limit < 0 || req.Limit > MaxQuarantineReplay {
+		h.jsonError(w, fmt.Sprintf("invalid limit: must be between 1 and %d", MaxQuarantineReplay), http.StatusBadRequest)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = MaxQuarantineReplay
+	}
+
+	payloads, next, err := h.quarantine.ListPage(ctx, q, req.Limit, nil)
+	if err != nil {
+		h.logger.Error("failed to list quarantined telemetry",
+			"request_id", reqID,
+			"error", err,
+		)
+		h.jsonError(w, "failed to list quarantined telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]QuarantineReplayResult, 0, len(payloads))
+	replayed := 0
+	for i := range payloads {
+		result, err := h.replayQuarantined(ctx, reqID, &payloads[i])
+		if err != nil {
+			h.logger.Error("failed to replay quarantined telemetry",
+				"request_id", reqID,
+				"error", err,
+				"quarantine_id", payloads[i].ID,
+			)
+			result.Error = err.Error()
+		}
+		if result.Status == QuarantineReplayed {
+			replayed++
+		}
+		results = append(results, result)
+	}
+
+	h.logger.Info("quarantine replay completed",
+		"request_id", reqID,
+		"attempted", len(results),
+		"replayed", replayed,
+	)
+
+	h.jsonResponse(w, map[string]interface{}{
+		"results":   results,
+		"attempted": len(results),
+		"replayed":  replayed,
+		"remaining": next != nil,
+	}, http.StatusOK)
+}
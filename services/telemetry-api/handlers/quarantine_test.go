@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newQuarantineTestHandlers(t *testing.T) (*Handlers, *MockTelemetryStore, *MockQuarantineStore) {
+	t.Helper()
+	h, telemetry := newProtoTestHandlers(t)
+	quarantine := NewMockQuarantineStore()
+	h.quarantine = quarantine
+	return h, telemetry, quarantine
+}
+
+func replayQuarantined(h *Handlers, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/quarantine/"+id+"/replay", nil)
+	req.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	h.ReplayQuarantined(w, req)
+	return w
+}
+
+func TestHandleTelemetryProto_QuarantinesMissingSchema(t *testing.T) {
+	h, telemetry, quarantine := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+	body := encodeMeasurementBatch(protoMeasurement{1, 21.5})
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	id, _ := response["quarantine_id"].(string)
+	if id == "" || response["reason"] != QuarantineSchemaNotFound {
+		t.Fatalf("unexpected response: %v", response)
+	}
+
+	p, err := quarantine.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DeviceID != protoTestDeviceUUID || p.AppVersion != "2.0.0" || p.Status != QuarantinePending || !bytes.Equal(p.Payload, body) {
+		t.Errorf("unexpected quarantine record: %+v", p)
+	}
+	if len(telemetry.data) != 0 {
+		t.Errorf("expected nothing stored, got %d readings", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_QuarantineKeepsPayloadCopy(t *testing.T) {
+	h, _, quarantine := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+	first := encodeMeasurementBatch(protoMeasurement{1, 21.5})
+
+	w := postProto(h, "", first)
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	id, _ := response["quarantine_id"].(string)
+
+	// Later requests reuse the pooled body buffer
+	for i := 0; i < 10; i++ {
+		postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 99}, protoMeasurement{2, 99}))
+	}
+
+	p, err := quarantine.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Payload, first) {
+		t.Errorf("quarantined payload changed: % x, want % x", p.Payload, first)
+	}
+}
+
+func TestHandleTelemetryProto_QuarantineDisabled(t *testing.T) {
+	h, _ := newProtoTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleTelemetryProto_QuarantineSaveError(t *testing.T) {
+	h, _, quarantine := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+	quarantine.SaveErr = errors.New("firestore unavailable")
+
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleTelemetryProto_MalformedNotQuarantined(t *testing.T) {
+	h, _, quarantine := newQuarantineTestHandlers(t)
+
+	w := postProto(h, "", []byte{0xff, 0xff})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if len(quarantine.data) != 0 {
+		t.Errorf("expected malformed payload not to be quarantined, got %d records", len(quarantine.data))
+	}
+}
+
+func TestQuarantine_ReplayAfterSchemaUpload(t *testing.T) {
+	h, telemetry, quarantine := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40}))
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	id := response["quarantine_id"].(string)
+
+	// Still no schema: stays pending
+	w = replayQuarantined(h, id)
+	var result QuarantineReplayResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result.Status != QuarantinePending || result.Reason != QuarantineSchemaNotFound {
+		t.Fatalf("expected pending replay, got %d %+v", w.Code, result)
+	}
+
+	h.schemaStore.Save(context.Background(), "measurement-probe", "2.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"temperature": {ID: 1, Name: "temperature", Type: "double"},
+			"humidity":    {ID: 2, Name: "humidity", Type: "double"},
+		},
+	})
+
+	w = replayQuarantined(h, id)
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result.Status != QuarantineReplayed || result.Measurements != 2 {
+		t.Fatalf("expected replayed, got %d %+v", w.Code, result)
+	}
+	if len(telemetry.data) != 2 {
+		t.Errorf("expected 2 readings stored, got %d", len(telemetry.data))
+	}
+
+	p, _ := quarantine.GetByID(context.Background(), id)
+	if p.Status != QuarantineReplayed || p.ReplayedAt == nil || p.ReplayAttempts != 2 {
+		t.Errorf("unexpected quarantine record: %+v", p)
+	}
+
+	// A replayed payload is not replayed again
+	if w := replayQuarantined(h, id); w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestQuarantine_ReplayUsesReceivedTime(t *testing.T) {
+	h, telemetry, quarantine := newQuarantineTestHandlers(t)
+	h.config.TimestampWindow = TimestampWindow{MaxAge: 24 * time.Hour, MaxFutureSkew: time.Minute}
+	receivedAt := time.Now().UTC().Add(-36 * time.Hour).Truncate(time.Millisecond)
+
+	// A sample group that was in the window when received, but is older than MaxAge now
+	var body []byte
+	body = appendSampleGroup(body, receivedAt.Add(-time.Hour), protoMeasurement{1, 19})
+	body = append(body, encodeMeasurementBatch(protoMeasurement{2, 40})...)
+	id, _ := quarantine.Save(context.Background(), &QuarantinedPayload{
+		DeviceID:   protoTestDeviceUUID,
+		AppName:    "measurement-probe",
+		AppVersion: "1.0.0",
+		Reason:     QuarantineSchemaNotFound,
+		Payload:    body,
+		Status:     QuarantinePending,
+		ReceivedAt: receivedAt,
+	})
+
+	w := replayQuarantined(h, id)
+	var result QuarantineReplayResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Status != QuarantineReplayed || result.Measurements != 2 {
+		t.Fatalf("expected both readings replayed, got %d %+v", w.Code, result)
+	}
+
+	byValue := make(map[float64]time.Time)
+	for _, d := range telemetry.data {
+		byValue[d.Value] = d.Timestamp
+	}
+	if !byValue[19].Equal(receivedAt.Add(-time.Hour)) {
+		t.Errorf("expected sample group at %v, got %v", receivedAt.Add(-time.Hour), byValue[19])
+	}
+	if !byValue[40].Equal(receivedAt) {
+		t.Errorf("expected flat measurement at the received time %v, got %v", receivedAt, byValue[40])
+	}
+}
+
+func TestQuarantine_UnknownMeasurements(t *testing.T) {
+	h, telemetry, quarantine := newQuarantineTestHandlers(t)
+
+	// ID 3 is not in the schema: 1 and 2 are stored, the payload is kept for 3
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40}, protoMeasurement{3, 1013}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	id, _ := response["quarantine_id"].(string)
+	if id == "" || response["measurements"] != float64(2) {
+		t.Fatalf("unexpected response: %v", response)
+	}
+	p, _ := quarantine.GetByID(context.Background(), id)
+	if p.Reason != QuarantineUnknownMeasurement || len(p.UnknownIDs) != 1 || p.UnknownIDs[0] != 3 {
+		t.Fatalf("unexpected quarantine record: %+v", p)
+	}
+
+	h.schemaStore.Save(context.Background(), "measurement-probe", "1.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"temperature": {ID: 1, Name: "temperature", Type: "double"},
+			"humidity":    {ID: 2, Name: "humidity", Type: "double"},
+			"pressure":    {ID: 3, Name: "pressure", Type: "double"},
+		},
+	})
+
+	w = replayQuarantined(h, id)
+	var result QuarantineReplayResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Status != QuarantineReplayed || result.Measurements != 1 {
+		t.Fatalf("expected only the unknown measurement to be replayed, got %+v", result)
+	}
+	if len(telemetry.data) != 3 {
+		t.Errorf("expected 3 readings in total, got %d", len(telemetry.data))
+	}
+}
+
+func TestListQuarantine(t *testing.T) {
+	h, _, quarantine := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "2.0.0")
+	body := encodeMeasurementBatch(protoMeasurement{1, 21.5})
+	postProto(h, "", body)
+	postProto(h, "", body)
+	quarantine.Save(context.Background(), &QuarantinedPayload{DeviceID: protoTestDeviceUUID, Reason: QuarantineUnknownMeasurement, Status: QuarantinePending})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/quarantine?reason=schema_not_found&limit=1", nil)
+	w := httptest.NewRecorder()
+	h.ListQuarantine(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data          []QuarantinedPayload `json:"data"`
+		NextPageToken string               `json:"next_page_token"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Data) != 1 || response.NextPageToken == "" {
+		t.Fatalf("expected one page of 1 with a next page, got %+v", response)
+	}
+	if response.Data[0].Reason != QuarantineSchemaNotFound || response.Data[0].Payload != nil || response.Data[0].PayloadSize != len(body) {
+		t.Errorf("unexpected listed payload: %+v", response.Data[0])
+	}
+}
+
+func TestListQuarantine_InvalidFilter(t *testing.T) {
+	h, _, _ := newQuarantineTestHandlers(t)
+
+	for _, query := range []string{"reason=unknown", "status=done", "device_id=not-a-uuid", "version=../1"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/quarantine?"+query, nil)
+		w := httptest.NewRecorder()
+		h.ListQuarantine(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestGetQuarantined_NotFound(t *testing.T) {
+	h, _, _ := newQuarantineTestHandlers(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/quarantine/missing", nil)
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+	h.GetQuarantined(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestReplayQuarantine_Bulk(t *testing.T) {
+	h, telemetry, _ := newQuarantineTestHandlers(t)
+	h.deviceStore.UpdateAppInfo(context.Background(), protoTestDeviceUUID, "measurement-probe", "1.1.0")
+	postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}))
+	postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 22.5}))
+
+	h.schemaStore.Save(context.Background(), "measurement-probe", "1.1.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"temperature": {ID: 1, Name: "temperature", Type: "double"},
+		},
+	})
+
+	body := `{"app_name": "measurement-probe", "app_version": "1.1.0", "reason": "schema_not_found"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/quarantine/replay", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.ReplayQuarantine(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Attempted int  `json:"attempted"`
+		Replayed  int  `json:"replayed"`
+		Remaining bool `json:"remaining"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Attempted != 2 || response.Replayed != 2 || response.Remaining {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if len(telemetry.data) != 2 {
+		t.Errorf("expected 2 readings stored, got %d", len(telemetry.data))
+	}
+}
+
+func TestReplayQuarantine_InvalidLimit(t *testing.T) {
+	h, _, _ := newQuarantineTestHandlers(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/quarantine/replay", bytes.NewBufferString(`{"limit": 1000}`))
+	w := httptest.NewRecorder()
+	h.ReplayQuarantine(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
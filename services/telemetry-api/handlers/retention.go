@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+)
+
+// Retention limits
+const (
+	// RetentionBatchSize is the number of deletes per Firestore batch write (max 500)
+	RetentionBatchSize = 400
+	// DefaultRetentionMaxDeletes bounds the documents deleted by a single run
+	DefaultRetentionMaxDeletes = 10000
+	// MaxRetentionMaxDeletes is the largest max_deletes accepted by POST /admin/retention/run
+	MaxRetentionMaxDeletes = 100000
+	// MaxRetentionTypeOverrides is limited by Firestore's not-in filter (10 values)
+	MaxRetentionTypeOverrides = 10
+	// MinRetention guards against policies that would purge fresh data
+	MinRetention = 24 * time.Hour
+)
+
+var errRetentionRunning = errors.New("retention run already in progress")
+
+// RetentionPolicy configures how long telemetry is kept. A zero duration keeps data forever.
+// Raw retention is resolved per reading: a type override wins over an app override,
+// which wins over the default.
+type RetentionPolicy struct {
+	Raw    time.Duration            // Default raw telemetry retention
+	Hourly time.Duration            // Hourly rollup retention
+	Daily  time.Duration            // Daily rollup retention
+	Types  map[string]time.Duration // Raw retention per measurement type
+	Apps   map[string]time.Duration // Raw retention per app (device app_name)
+}
+
+// IsZero reports whether the policy never deletes anything
+func (p RetentionPolicy) IsZero() bool {
+	if p.Raw > 0 || p.Hourly > 0 || p.Daily > 0 {
+		return false
+	}
+	for _, d := range p.Types {
+		if d > 0 {
+			return false
+		}
+	}
+	for _, d := range p.Apps {
+		if d > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rawFor returns the default raw retention for a device's app
+func (p RetentionPolicy) rawFor(appName string) time.Duration {
+	if d, ok := p.Apps[appName]; ok {
+		return d
+	}
+	return p.Raw
+}
+
+// rawCutoff returns the time before which retention may have purged raw readings of a
+// device's app (any type), or the zero time when raw telemetry is kept forever
+func (p RetentionPolicy) rawCutoff(appName string, now time.Time) time.Time {
+	keep := p.rawFor(appName)
+	for _, d := range p.Types {
+		if d > 0 && (keep == 0 || d < keep) {
+			keep = d
+		}
+	}
+	if keep == 0 {
+		return time.Time{}
+	}
+	return now.Add(-keep)
+}
+
+// ParseRetentionPolicy parses the RETENTION_POLICY JSON document, e.g.
+//
+//	{"raw":"30d","hourly":"90d","daily":"730d","types":{"co2":"7d"},"apps":{"measurement-probe":"90d"}}
+//
+// Durations accept a day suffix ("30d") or Go duration syntax; "0" keeps data forever.
+func ParseRetentionPolicy(s string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	if strings.TrimSpace(s) == "" {
+		return policy, nil
+	}
+
+	var raw struct {
+		Raw    string            `json:"raw"`
+		Hourly string            `json:"hourly"`
+		Daily  string            `json:"daily"`
+		Types  map[string]string `json:"types"`
+		Apps   map[string]string `json:"apps"`
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return policy, fmt.Errorf("invalid retention policy: %w", err)
+	}
+
+	var err error
+	if policy.Raw, err = parseRetention("raw", raw.Raw); err != nil {
+		return policy, err
+	}
+	if policy.Hourly, err = parseRetention("hourly", raw.Hourly); err != nil {
+		return policy, err
+	}
+	if policy.Daily, err = parseRetention("daily", raw.Daily); err != nil {
+		return policy, err
+	}
+
+	if len(raw.Types) > MaxRetentionTypeOverrides {
+		return policy, fmt.Errorf("invalid retention policy: at most %d type overrides", MaxRetentionTypeOverrides)
+	}
+	policy.Types = make(map[string]time.Duration, len(raw.Types))
+	for typ, v := range raw.Types {
+		if err := validate.TelemetryType(typ); err != nil {
+			return policy, fmt.Errorf("invalid retention policy type %q: %w", typ, err)
+		}
+		if policy.Types[typ], err = parseRetention("types."+typ, v); err != nil {
+			return policy, err
+		}
+	}
+
+	policy.Apps = make(map[string]time.Duration, len(raw.Apps))
+	for app, v := range raw.Apps {
+		if err := validate.Identifier(app); err != nil {
+			return policy, fmt.Errorf("invalid retention policy app %q: %w", app, err)
+		}
+		if policy.Apps[app], err = parseRetention("apps."+app, v); err != nil {
+			return policy, err
+		}
+	}
+
+	return policy, nil
+}
+
+// parseRetention parses "30d", Go durations ("720h") or "0"/"" (keep forever)
+func parseRetention(field, s string) (time.Duration, error) {
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %s: %q", field, s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid retention %s: %q", field, s)
+		}
+	}
+
+	if d < MinRetention {
+		return 0, fmt.Errorf("invalid retention %s: must be at least %s", field, MinRetention)
+	}
+	return d, nil
+}
+
+// RetentionRunRequest is the (optional) request body for POST /admin/retention/run
+type RetentionRunRequest struct {
+	DryRun     bool `json:"dry_run"`
+	MaxDeletes int  `json:"max_deletes"`
+}
+
+// RetentionResult reports one retention rule applied during a run
+type RetentionResult struct {
+	Scope     string    `json:"scope"` // "raw" or a rollup period
+	DeviceID  string    `json:"device_id,omitempty"`
+	Types     []string  `json:"types,omitempty"`
+	Excluded  []string  `json:"excluded_types,omitempty"`
+	Retention string    `json:"retention"`
+	Before    time.Time `json:"before"`
+	Deleted   int       `json:"deleted"` // Matching documents in dry-run mode
+}
+
+// RetentionReport summarizes a retention run
+type RetentionReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Deleted   int               `json:"deleted"`
+	Truncated bool              `json:"truncated"` // max_deletes reached; run again to continue
+	Results   []RetentionResult `json:"results"`
+}
+
+// RunRetention handles POST /admin/retention/run - purges telemetry older than the retention policy
+func (h *Handlers) RunRetention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.config.Retention.IsZero() {
+		h.jsonError(w, "retention policy not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Body is optional: an empty request runs with defaults
+	var req RetentionRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MaxDeletes < 0 || req.MaxDeletes > MaxRetentionMaxDeletes {
+		h.jsonError(w, fmt.Sprintf("invalid max_deletes: must be between 1 and %d", MaxRetentionMaxDeletes), http.StatusBadRequest)
+		return
+	}
+	if req.MaxDeletes == 0 {
+		req.MaxDeletes = DefaultRetentionMaxDeletes
+	}
+
+	report, err := h.runRetention(ctx, req.DryRun, req.MaxDeletes)
+	if errors.Is(err, errRetentionRunning) {
+		h.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("retention run failed",
+			"request_id", reqID,
+			"error", err,
+			"deleted", report.Deleted,
+		)
+		h.jsonError(w, "retention run failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("retention run completed",
+		"request_id", reqID,
+		"dry_run", report.DryRun,
+		"deleted", report.Deleted,
+		"truncated", report.Truncated,
+	)
+
+	h.jsonResponse(w, report, http.StatusOK)
+}
+
+// StartRetentionSweeper runs the retention policy every interval until ctx is cancelled
+func (h *Handlers) StartRetentionSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := h.runRetention(ctx, false, DefaultRetentionMaxDeletes)
+				if errors.Is(err, errRetentionRunning) {
+					continue
+				}
+				if err != nil {
+					h.logger.Error("retention sweep failed", "error", err, "deleted", report.Deleted)
+					continue
+				}
+				h.logger.Info("retention sweep completed",
+					"deleted", report.Deleted,
+					"truncated", report.Truncated,
+				)
+			}
+		}
+	}()
+}
+
+// runRetention applies the retention policy, deleting at most maxDeletes documents.
+// Only one run executes at a time; the report is valid up to the point of failure.
+func (h *Handlers) runRetention(ctx context.Context, dryRun bool, maxDeletes int) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Results: []RetentionResult{}}
+
+	if !h.retentionMu.TryLock() {
+		return report, errRetentionRunning
+	}
+	defer h.retentionMu.Unlock()
+
+	now := time.Now().UTC()
+	policy := h.config.Retention
+	remaining := maxDeletes
+
+	// record appends a result and reports whether the delete budget allows continuing
+	record := func(res RetentionResult, keep time.Duration, n int) bool {
+		res.Retention = formatRetention(keep)
+		res.Deleted = n
+		report.Results = append(report.Results, res)
+		report.Deleted += n
+		remaining -= n
+		if remaining <= 0 {
+			report.Truncated = true
+			return false
+		}
+		return true
+	}
+
+	// Raw telemetry: rules are resolved per device (app overrides) and per type
+	devices, err := h.deviceStore.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list devices: %w", err)
+	}
+	// Telemetry of devices deleted from the registry follows the default raw retention
+	withTelemetry, err := h.telemetryStore.DeviceIDs(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list telemetry devices: %w", err)
+	}
+	registered := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		registered[device.DeviceID] = true
+	}
+	for _, id := range withTelemetry {
+		if !registered[id] {
+			devices = append(devices, Device{DeviceID: id})
+		}
+	}
+
+	overrides := make([]string, 0, len(policy.Types))
+	for typ := range policy.Types {
+		overrides = append(overrides, typ)
+	}
+	sort.Strings(overrides)
+
+	for _, device := range devices {
+		for _, typ := range overrides {
+			keep := policy.Types[typ]
+			if keep == 0 {
+				continue
+			}
+			q := PurgeQuery{DeviceID: device.DeviceID, Types: []string{typ}, Before: now.Add(-keep)}
+			n, err := h.telemetryStore.Purge(ctx, q, remaining, dryRun)
+			if !record(RetentionResult{Scope: "raw", DeviceID: device.DeviceID, Types: q.Types, Before: q.Before}, keep, n) {
+				return report, err
+			}
+			if err != nil {
+				return report, fmt.Errorf("purge telemetry for %s: %w", device.DeviceID, err)
+			}
+		}
+
+		keep := policy.rawFor(device.AppName)
+		if keep == 0 {
+			continue
+		}
+		q := PurgeQuery{DeviceID: device.DeviceID, ExcludeTypes: overrides, Before: now.Add(-keep)}
+		n, err := h.telemetryStore.Purge(ctx, q, remaining, dryRun)
+		if !record(RetentionResult{Scope: "raw", DeviceID: device.DeviceID, Excluded: q.ExcludeTypes, Before: q.Before}, keep, n) {
+			return report, err
+		}
+		if err != nil {
+			return report, fmt.Errorf("purge telemetry for %s: %w", device.DeviceID, err)
+		}
+	}
+
+	// Rollups expire per period across all devices
+	if h.rollupStore == nil {
+		return report, nil
+	}
+	for _, rule := range []struct {
+		period string
+		keep   time.Duration
+	}{
+		{RollupHourly, policy.Hourly},
+		{RollupDaily, policy.Daily},
+	} {
+		if rule.keep == 0 {
+			continue
+		}
+		before := now.Add(-rule.keep)
+		n, err := h.rollupStore.Purge(ctx, rule.period, before, remaining, dryRun)
+		if !record(RetentionResult{Scope: rule.period, Before: before}, rule.keep, n) {
+			return report, err
+		}
+		if err != nil {
+			return report, fmt.Errorf("purge %s rollups: %w", rule.period, err)
+		}
+	}
+
+	return report, nil
+}
+
+// formatRetention renders whole days as "30d", anything else in Go duration syntax
+func formatRetention(d time.Duration) string {
+	day := 24 * time.Hour
+	if d%day == 0 {
+		return strconv.Itoa(int(d/day)) + "d"
+	}
+	return d.String()
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const retentionTestDeviceUUID2 = "550e8400-e29b-41d4-a716-446655440031"
+
+func TestParseRetentionPolicy(t *testing.T) {
+	policy, err := ParseRetentionPolicy(`{"raw":"30d","hourly":"2160h","daily":"730d","types":{"co2":"7d","uptime":"0"},"apps":{"measurement-probe":"90d"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	day := 24 * time.Hour
+	if policy.Raw != 30*day || policy.Hourly != 90*day || policy.Daily != 730*day {
+		t.Errorf("unexpected durations: %+v", policy)
+	}
+	if policy.Types["co2"] != 7*day || policy.Types["uptime"] != 0 {
+		t.Errorf("unexpected type overrides: %v", policy.Types)
+	}
+	if policy.rawFor("measurement-probe") != 90*day || policy.rawFor("other") != 30*day {
+		t.Errorf("unexpected app resolution")
+	}
+}
+
+func TestParseRetentionPolicy_Empty(t *testing.T) {
+	policy, err := ParseRetentionPolicy("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !policy.IsZero() {
+		t.Error("expected empty policy to be zero")
+	}
+}
+
+func TestParseRetentionPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"invalid json", `{`},
+		{"unknown field", `{"forever":"1d"}`},
+		{"invalid duration", `{"raw":"thirty days"}`},
+		{"too short", `{"raw":"1h"}`},
+		{"invalid type", `{"types":{"bad type!":"7d"}}`},
+		{"invalid app", `{"apps":{"../app":"7d"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRetentionPolicy(tt.policy); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// seedRetention stores readings at the given ages for a device
+func seedRetention(store *MockTelemetryStore, deviceID, typ string, ages ...time.Duration) {
+	now := time.Now().UTC()
+	for _, age := range ages {
+		store.Save(context.Background(), &TelemetryData{
+			DeviceID:  deviceID,
+			Type:      typ,
+			Value:     1,
+			Timestamp: now.Add(-age),
+		})
+	}
+}
+
+func newRetentionHandlers(t *testing.T, policy string) (*Handlers, *MockTelemetryStore, *MockRollupStore) {
+	t.Helper()
+
+	p, err := ParseRetentionPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	telemetry := NewMockTelemetryStore()
+	devices := NewMockDeviceStore()
+	devices.Register(context.Background(), &Device{DeviceID: telTestDeviceUUID, AppName: "measurement-probe"})
+	devices.Register(context.Background(), &Device{DeviceID: retentionTestDeviceUUID2, AppName: "air-quality"})
+	rollups := NewMockRollupStore()
+
+	h := NewWithStores(telemetry, nil, devices, nil, nil, nil)
+	h.rollupStore = rollups
+	h.config.Retention = p
+	return h, telemetry, rollups
+}
+
+func runRetentionRequest(h *Handlers, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/retention/run", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.RunRetention(w, req)
+	return w
+}
+
+func TestRunRetention_Success(t *testing.T) {
+	day := 24 * time.Hour
+	h, telemetry, rollups := newRetentionHandlers(t, `{"raw":"30d","daily":"365d","types":{"co2":"7d"},"apps":{"measurement-probe":"90d"}}`)
+
+	// measurement-probe keeps raw data for 90 days, co2 only 7 days for every app
+	seedRetention(telemetry, telTestDeviceUUID, "temperature", 10*day, 60*day, 100*day)
+	seedRetention(telemetry, telTestDeviceUUID, "co2", 1*day, 10*day)
+	seedRetention(telemetry, retentionTestDeviceUUID2, "temperature", 10*day, 60*day)
+
+	old := time.Now().UTC().Add(-400 * day).Truncate(day)
+	rollups.data["old"] = Rollup{DeviceID: telTestDeviceUUID, Type: "temperature", Period: RollupDaily, BucketStart: old}
+	rollups.data["hourly"] = Rollup{DeviceID: telTestDeviceUUID, Type: "temperature", Period: RollupHourly, BucketStart: old}
+
+	w := runRetentionRequest(h, "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report RetentionReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	// 100d temperature + 10d co2 for device 1, 60d temperature for device 2, one daily rollup
+	if report.Deleted != 4 || report.Truncated || report.DryRun {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(telemetry.data) != 4 {
+		t.Errorf("expected 4 readings to remain, got %d", len(telemetry.data))
+	}
+	if _, ok := rollups.data["hourly"]; !ok {
+		t.Error("hourly rollups have no retention and must be kept")
+	}
+	if _, ok := rollups.data["old"]; ok {
+		t.Error("expected expired daily rollup to be deleted")
+	}
+}
+
+func TestRunRetention_UnregisteredDevice(t *testing.T) {
+	day := 24 * time.Hour
+	h, telemetry, _ := newRetentionHandlers(t, `{"raw":"30d","types":{"co2":"7d"}}`)
+
+	// A device deleted from the registry still has readings
+	const deleted = "550e8400-e29b-41d4-a716-446655440099"
+	seedRetention(telemetry, deleted, "temperature", 10*day, 60*day)
+	seedRetention(telemetry, deleted, "co2", 1*day, 10*day)
+
+	w := runRetentionRequest(h, "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var report RetentionReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 2 || len(telemetry.data) != 2 {
+		t.Errorf("expected the 60d temperature and 10d co2 readings purged, got %+v (%d left)", report, len(telemetry.data))
+	}
+}
+
+func TestPurgeQuery_TypesAndExcludeTypes(t *testing.T) {
+	telemetry := NewMockTelemetryStore()
+	q := PurgeQuery{DeviceID: telTestDeviceUUID, Types: []string{"co2"}, ExcludeTypes: []string{"temperature"}, Before: time.Now()}
+
+	if _, err := telemetry.Purge(context.Background(), q, 10, true); err == nil {
+		t.Error("expected types with exclude types to be rejected")
+	}
+}
+
+func TestRunRetention_DryRun(t *testing.T) {
+	h, telemetry, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+	seedRetention(telemetry, telTestDeviceUUID, "temperature", 40*24*time.Hour, 50*24*time.Hour)
+
+	w := runRetentionRequest(h, `{"dry_run":true}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report RetentionReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Deleted != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(telemetry.data) != 2 {
+		t.Errorf("dry run must not delete, have %d readings", len(telemetry.data))
+	}
+}
+
+func TestRunRetention_MaxDeletes(t *testing.T) {
+	h, telemetry, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+	seedRetention(telemetry, telTestDeviceUUID, "temperature", 40*24*time.Hour, 50*24*time.Hour, 60*24*time.Hour)
+
+	w := runRetentionRequest(h, `{"max_deletes":2}`)
+
+	var report RetentionReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 2 || !report.Truncated {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(telemetry.data) != 1 {
+		t.Errorf("expected 1 reading to remain, got %d", len(telemetry.data))
+	}
+}
+
+func TestRunRetention_NotConfigured(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, NewMockDeviceStore(), nil, nil, nil)
+
+	w := runRetentionRequest(h, "")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestRunRetention_InvalidRequest(t *testing.T) {
+	h, _, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+
+	for _, body := range []string{`{`, `{"max_deletes":-1}`, `{"max_deletes":1000000}`} {
+		w := runRetentionRequest(h, body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: expected status %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestRunRetention_AlreadyRunning(t *testing.T) {
+	h, _, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+	h.retentionMu.Lock()
+	defer h.retentionMu.Unlock()
+
+	w := runRetentionRequest(h, "")
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestRunRetention_StoreError(t *testing.T) {
+	h, telemetry, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+	telemetry.DeleteErr = errors.New("firestore unavailable")
+
+	w := runRetentionRequest(h, "")
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+)
+
+// MaxRollupRebuildRange bounds a single rebuild request (keeps it within the request timeout)
+const MaxRollupRebuildRange = 31 * 24 * time.Hour
+
+// rollupPeriods lists the maintained rollup periods, finest first
+var rollupPeriods = []string{RollupHourly, RollupDaily}
+
+// periodDuration returns the bucket width of a rollup period
+func periodDuration(period string) time.Duration {
+	if period == RollupDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// rollupDocID is the deterministic document ID of a rollup bucket
+func rollupDocID(deviceID, period, typ string, bucketStart time.Time) string {
+	return deviceID + ":" + period + ":" + typ + ":" + strconv.FormatInt(bucketStart.Unix(), 10)
+}
+
+// add folds a single reading into the rollup
+func (r *Rollup) add(ts time.Time, v float64) {
+	if r.Count == 0 || v < r.Min {
+		r.Min = v
+	}
+	if r.Count == 0 || v > r.Max {
+		r.Max = v
+	}
+	r.Sum += v
+	r.Count++
+	if r.Count == 1 || !ts.Before(r.LastAt) {
+		r.Last = v
+		r.LastAt = ts
+	}
+}
+
+// combine merges another partial rollup of the same bucket into r
+func (r *Rollup) combine(o *Rollup) {
+	if o.Count == 0 {
+		return
+	}
+	if r.Count == 0 || o.Min < r.Min {
+		r.Min = o.Min
+	}
+	if r.Count == 0 || o.Max > r.Max {
+		r.Max = o.Max
+	}
+	if r.Count == 0 || !o.LastAt.Before(r.LastAt) {
+		r.Last = o.Last
+		r.LastAt = o.LastAt
+	}
+	r.Sum += o.Sum
+	r.Count += o.Count
+	if o.Unit != "" {
+		r.Unit = o.Unit
+	}
+}
+
+// Value returns the rollup statistic for an aggregation function
+func (r *Rollup) Value(fn string) float64 {
+	switch fn {
+	case AggMin:
+		return r.Min
+	case AggMax:
+		return r.Max
+	case AggSum:
+		return r.Sum
+	case AggCount:
+		return float64(r.Count)
+	case AggLast:
+		return r.Last
+	default:
+		if r.Count == 0 {
+			return 0
+		}
+		return r.Sum / float64(r.Count)
+	}
+}
+
+// buildRollups computes partial rollups for a set of readings, keyed by rollupDocID
+func buildRollups(readings []TelemetryData, periods ...string) map[string]*Rollup {
+	rollups := make(map[string]*Rollup)
+	for i := range readings {
+		d := &readings[i]
+		if !d.IsNumeric() {
+			continue
+		}
+		for _, period := range periods {
+			start := time.Unix(0, bucketStart(d.Timestamp, periodDuration(period))).UTC()
+			key := rollupDocID(d.DeviceID, period, d.Type, start)
+			r, ok := rollups[key]
+			if !ok {
+				r = &Rollup{
+					DeviceID:    d.DeviceID,
+					Type:        d.Type,
+					Period:      period,
+					BucketStart: start,
+				}
+				rollups[key] = r
+			}
+			if d.Unit != "" {
+				r.Unit = d.Unit
+			}
+			r.add(d.Timestamp, d.Value)
+		}
+	}
+	return rollups
+}
+
+// applyRollups updates rollups for freshly stored readings.
+// Failures are logged, not returned: raw data is already persisted and rollups can be rebuilt.
+func (h *Handlers) applyRollups(ctx context.Context, reqID string, readings []TelemetryData) {
+	if h.rollupStore == nil || len(readings) == 0 {
+		return
+	}
+	if err := h.rollupStore.Apply(ctx, readings); err != nil {
+		h.logger.Error("failed to update telemetry rollups",
+			"request_id", reqID,
+			"error", err,
+			"device_id", readings[0].DeviceID,
+			"readings", len(readings),
+		)
+	}
+}
+
+// RebuildRollupsRequest is the request body for rollup rebuilds
+type RebuildRollupsRequest struct {
+	DeviceID string    `json:"device_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// RebuildRollups handles POST /admin/rollups/rebuild - recomputes rollups from raw telemetry
+// The range is widened to whole UTC days so daily rollups are never partially rebuilt, and
+// starts no earlier than the raw retention cutoff so rollups outliving raw data are kept.
+func (h *Handlers) RebuildRollups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.rollupStore == nil {
+		h.jsonError(w, "rollups are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req RebuildRollupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.UUID(req.DeviceID); err != nil {
+		h.jsonError(w, fmt.Sprintf("invalid device_id: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.From.IsZero() || req.To.IsZero() {
+		h.jsonError(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+
+	day := periodDuration(RollupDaily)
+	from := time.Unix(0, bucketStart(req.From, day)).UTC()
+	to := time.Unix(0, bucketStart(req.To, day)).UTC()
+	if to.Before(req.To) {
+		to = to.Add(day)
+	}
+	if !to.After(from) {
+		h.jsonError(w, "invalid time range: to must be after from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > MaxRollupRebuildRange {
+		h.jsonError(w, fmt.Sprintf("time range too large: maximum is %d days", int(MaxRollupRebuildRange/day)), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	var appName string
+	if h.deviceStore != nil {
+		device, err := h.deviceStore.GetByID(ctx, req.DeviceID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			h.logger.Error("failed to get device for rollup rebuild",
+				"request_id", reqID,
+				"error", err,
+				"device_id", req.DeviceID,
+			)
+			h.jsonError(w, "failed to rebuild rollups", http.StatusInternalServerError)
+			return
+		}
+		if device != nil {
+			appName = device.AppName
+		}
+	}
+	// Only whole days after the cutoff still have all of their raw readings
+	if cutoff := h.config.Retention.rawCutoff(appName, now); !cutoff.IsZero() {
+		kept := time.Unix(0, bucketStart(cutoff, day)).UTC()
+		if kept.Before(cutoff) {
+			kept = kept.Add(day)
+		}
+		if from.Before(kept) {
+			from = kept
+		}
+		if !to.After(from) {
+			h.jsonError(w, "invalid time range: raw telemetry before "+from.Format(time.RFC3339)+" may have been purged by retention", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Stream raw readings and fold them into fresh rollups
+	rollups := make(map[string]*Rollup)
+	tq := TelemetryQuery{From: from, To: to, Order: OrderAsc, Limit: aggregatePageSize}
+	var cursor *PageCursor
+	scanned := 0
+	for {
+		page, next, err := h.telemetryStore.QueryPage(ctx, req.DeviceID, tq, cursor)
+		if err != nil {
+			h.logger.Error("failed to read telemetry for rollup rebuild",
+				"request_id", reqID,
+				"error", err,
+				"device_id", req.DeviceID,
+			)
+			h.jsonError(w, "failed to rebuild rollups", http.StatusInternalServerError)
+			return
+		}
+		for key, partial := range buildRollups(page, rollupPeriods...) {
+			if existing, ok := rollups[key]; ok {
+				existing.combine(partial)
+			} else {
+				rollups[key] = partial
+			}
+		}
+		scanned += len(page)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	counts := make(map[string]int, len(rollupPeriods))
+	for _, period := range rollupPeriods {
+		var set []Rollup
+		for _, r := range rollups {
+			if r.Period == period {
+				r.UpdatedAt = now
+				set = append(set, *r)
+			}
+		}
+		if err := h.rollupStore.Replace(ctx, req.DeviceID, period, from, to, set); err != nil {
+			h.logger.Error("failed to replace rollups",
+				"request_id", reqID,
+				"error", err,
+				"device_id", req.DeviceID,
+				"period", period,
+			)
+			h.jsonError(w, "failed to rebuild rollups", http.StatusInternalServerError)
+			return
+		}
+		counts[period] = len(set)
+	}
+
+	h.logger.Info("rollups rebuilt",
+		"request_id", reqID,
+		"device_id", req.DeviceID,
+		"from", from,
+		"to", to,
+		"readings", scanned,
+	)
+
+	h.jsonResponse(w, map[string]interface{}{
+		"device_id": req.DeviceID,
+		"from":      from,
+		"to":        to,
+		"readings":  scanned,
+		"hourly":    counts[RollupHourly],
+		"daily":     counts[RollupDaily],
+	}, http.StatusOK)
+}
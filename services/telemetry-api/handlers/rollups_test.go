@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRollup_AddCombineValue(t *testing.T) {
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	var a Rollup
+	a.add(base.Add(2*time.Minute), 20)
+	a.add(base.Add(1*time.Minute), 10) // out of order: must not become last
+
+	var b Rollup
+	b.add(base.Add(3*time.Minute), 30)
+
+	a.combine(&b)
+
+	tests := []struct {
+		fn   string
+		want float64
+	}{
+		{AggAvg, 20},
+		{AggMin, 10},
+		{AggMax, 30},
+		{AggSum, 60},
+		{AggCount, 3},
+		{AggLast, 30},
+	}
+	for _, tt := range tests {
+		if got := a.Value(tt.fn); got != tt.want {
+			t.Errorf("Value(%s) = %v, want %v", tt.fn, got, tt.want)
+		}
+	}
+}
+
+func TestBuildRollups(t *testing.T) {
+	base := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	readings := []TelemetryData{
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 20, Timestamp: base},
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 24, Timestamp: base.Add(10 * time.Minute)},
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 30, Timestamp: base.Add(time.Hour)},
+	}
+
+	rollups := buildRollups(readings, rollupPeriods...)
+
+	// Two hourly buckets + one daily bucket
+	if len(rollups) != 3 {
+		t.Fatalf("expected 3 rollups, got %d", len(rollups))
+	}
+
+	hour := rollups[rollupDocID(telTestDeviceUUID, RollupHourly, "temperature", base.Truncate(time.Hour))]
+	if hour == nil || hour.Count != 2 || hour.Sum != 44 {
+		t.Errorf("unexpected hourly rollup: %+v", hour)
+	}
+	day := rollups[rollupDocID(telTestDeviceUUID, RollupDaily, "temperature", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC))]
+	if day == nil || day.Count != 3 || day.Max != 30 || day.Last != 30 {
+		t.Errorf("unexpected daily rollup: %+v", day)
+	}
+}
+
+func TestHandleTelemetry_UpdatesRollups(t *testing.T) {
+	rollups := NewMockRollupStore()
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+	h.rollupStore = rollups
+
+	body := `[{"type":"temperature","value":20,"timestamp":"2026-01-15T10:00:00Z"},{"type":"temperature","value":22,"timestamp":"2026-01-15T10:30:00Z"}]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	from := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	hourly, _ := rollups.Query(context.Background(), telTestDeviceUUID, RollupHourly, nil, from, from.Add(24*time.Hour))
+	if len(hourly) != 1 || hourly[0].Count != 2 || hourly[0].Sum != 42 {
+		t.Errorf("unexpected hourly rollups: %+v", hourly)
+	}
+}
+
+func TestHandleTelemetry_RollupErrorDoesNotFail(t *testing.T) {
+	rollups := NewMockRollupStore()
+	rollups.ApplyErr = errors.New("rollup failure")
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+	h.rollupStore = rollups
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry", bytes.NewBufferString(`{"type":"temperature","value":20}`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetry(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestGetTelemetryAggregate_UsesRollups(t *testing.T) {
+	rollups := NewMockRollupStore()
+	rollups.Apply(context.Background(), []TelemetryData{
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 20, Timestamp: time.Date(2026, 1, 15, 10, 5, 0, 0, time.UTC)},
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 30, Timestamp: time.Date(2026, 1, 15, 11, 5, 0, 0, time.UTC)},
+	})
+
+	// Raw store is empty: results can only come from rollups
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+	h.rollupStore = rollups
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/telemetry/aggregate?type=temperature&from=2026-01-15T10:00:00Z&to=2026-01-15T12:00:00Z&bucket=2h&fn=avg", nil)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetryAggregate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response aggregateResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Series) != 1 || len(response.Series[0].Points) != 1 {
+		t.Fatalf("unexpected series: %+v", response.Series)
+	}
+	if p := response.Series[0].Points[0]; p.Value != 25 || p.Count != 2 {
+		t.Errorf("expected avg 25 over 2 readings, got %+v", p)
+	}
+}
+
+func TestRollupPeriodFor(t *testing.T) {
+	day := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		q      AggregateQuery
+		want   string
+		wantOK bool
+	}{
+		{"daily", AggregateQuery{From: day, To: day.Add(48 * time.Hour), Bucket: 24 * time.Hour}, RollupDaily, true},
+		{"hourly bucket", AggregateQuery{From: day, To: day.Add(48 * time.Hour), Bucket: 3 * time.Hour}, RollupHourly, true},
+		{"unaligned range", AggregateQuery{From: day.Add(time.Hour), To: day.Add(25 * time.Hour), Bucket: 24 * time.Hour}, RollupHourly, true},
+		{"sub-hour bucket", AggregateQuery{From: day, To: day.Add(time.Hour), Bucket: 5 * time.Minute}, "", false},
+		{"unaligned minutes", AggregateQuery{From: day.Add(time.Minute), To: day.Add(2 * time.Hour), Bucket: time.Hour}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rollupPeriodFor(tt.q)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("rollupPeriodFor() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRebuildRollups_Success(t *testing.T) {
+	telemetry := NewMockTelemetryStore()
+	telemetry.Save(context.Background(), &TelemetryData{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 20, Timestamp: time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)})
+	telemetry.Save(context.Background(), &TelemetryData{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 30, Timestamp: time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)})
+
+	rollups := NewMockRollupStore()
+	// Stale bucket with no raw readings behind it
+	stale := Rollup{DeviceID: telTestDeviceUUID, Type: "temperature", Period: RollupHourly, BucketStart: time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC), Count: 5}
+	rollups.data[rollupDocID(stale.DeviceID, stale.Period, stale.Type, stale.BucketStart)] = stale
+
+	h := NewWithStores(telemetry, nil, nil, nil, nil, nil)
+	h.rollupStore = rollups
+
+	body := `{"device_id":"` + telTestDeviceUUID + `","from":"2026-01-15T09:00:00Z","to":"2026-01-15T13:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/rollups/rebuild", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	h.RebuildRollups(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response["readings"] != float64(2) || response["hourly"] != float64(2) || response["daily"] != float64(1) {
+		t.Errorf("unexpected response: %v", response)
+	}
+	if len(rollups.data) != 3 {
+		t.Errorf("expected stale rollup to be removed, have %d rollups", len(rollups.data))
+	}
+}
+
+func TestRebuildRollups_AfterRetention(t *testing.T) {
+	day := 24 * time.Hour
+	h, telemetry, rollups := newRetentionHandlers(t, `{"raw":"30d"}`)
+
+	now := time.Now().UTC()
+	readings := []TelemetryData{
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 20, Timestamp: now.Add(-30*day - 6*time.Hour)},
+		{DeviceID: telTestDeviceUUID, Type: "temperature", Value: 30, Timestamp: now.Add(-10 * day)},
+	}
+	for i := range readings {
+		telemetry.Save(context.Background(), &readings[i])
+	}
+	rollups.Apply(context.Background(), readings)
+
+	if w := runRetentionRequest(h, ""); w.Code != http.StatusOK {
+		t.Fatalf("retention: expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(telemetry.data) != 1 {
+		t.Fatalf("expected retention to purge the 30 day old reading, have %d readings", len(telemetry.data))
+	}
+
+	body := `{"device_id":"` + telTestDeviceUUID + `","from":"` + now.Add(-30*day-12*time.Hour).Format(time.RFC3339) + `","to":"` + now.Add(-5*day).Format(time.RFC3339) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/rollups/rebuild", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	h.RebuildRollups(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		From time.Time `json:"from"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.From.Before(now.Add(-30 * day)) {
+		t.Errorf("expected rebuild to start after the raw retention cutoff, got %v", response.From)
+	}
+	// Hourly and daily rollups of the purged reading outlive the raw data
+	for _, period := range rollupPeriods {
+		got, _ := rollups.Query(context.Background(), telTestDeviceUUID, period, nil, now.Add(-32*day), now.Add(-30*day))
+		if len(got) != 1 {
+			t.Errorf("expected %s rollup older than raw retention to be kept, got %d", period, len(got))
+		}
+	}
+}
+
+func TestRebuildRollups_RangeBeforeRetention(t *testing.T) {
+	h, _, _ := newRetentionHandlers(t, `{"raw":"30d"}`)
+
+	body := `{"device_id":"` + telTestDeviceUUID + `","from":"2020-01-01T00:00:00Z","to":"2020-01-10T00:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/rollups/rebuild", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	h.RebuildRollups(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestRebuildRollups_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{`},
+		{"invalid device", `{"device_id":"nope","from":"2026-01-15T00:00:00Z","to":"2026-01-16T00:00:00Z"}`},
+		{"missing range", `{"device_id":"` + telTestDeviceUUID + `"}`},
+		{"reversed range", `{"device_id":"` + telTestDeviceUUID + `","from":"2026-01-16T00:00:00Z","to":"2026-01-14T00:00:00Z"}`},
+		{"range too large", `{"device_id":"` + telTestDeviceUUID + `","from":"2026-01-01T00:00:00Z","to":"2026-03-01T00:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+			h.rollupStore = NewMockRollupStore()
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/rollups/rebuild", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			h.RebuildRollups(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRebuildRollups_Disabled(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/rollups/rebuild", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+
+	h.RebuildRollups(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
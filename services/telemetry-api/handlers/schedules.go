@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/cron"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
+)
+
+// Command scheduler timing
+const (
+	// CommandSchedulerInterval is how often each instance looks for due schedules
+	CommandSchedulerInterval = 30 * time.Second
+	// commandScheduleLookahead creates a run's commands this long before it is due
+	// (hidden by not_before until then), so devices receive them on time
+	commandScheduleLookahead = time.Minute
+)
+
+// MaxScheduleNameLength bounds the optional schedule name
+const MaxScheduleNameLength = 100
+
+// compiledSchedule is a validated CommandSchedule
+type compiledSchedule struct {
+	cron         cron.Schedule
+	loc          *time.Location
+	expiresAfter time.Duration
+	matcher      *deviceMatcher // nil = the schedule lists device IDs
+}
+
+// compile validates the schedule definition
+func (s *CommandSchedule) compile() (*compiledSchedule, error) {
+	var c compiledSchedule
+	var err error
+	if s.Name != "" {
+		if err := validate.StringLength(s.Name, 1, MaxScheduleNameLength); err != nil {
+			return nil, fmt.Errorf("invalid name: %v", err)
+		}
+	}
+	if c.cron, err = cron.Parse(s.Cron); err != nil {
+		return nil, err
+	}
+	if s.Timezone == "Local" {
+		return nil, errors.New("invalid timezone: use an IANA time zone name, e.g. Europe/Skopje")
+	}
+	if c.loc, err = time.LoadLocation(s.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if c.expiresAfter, err = time.ParseDuration(s.ExpiresAfter); err != nil || c.expiresAfter <= 0 {
+		return nil, fmt.Errorf("invalid expires_after %q: must be a positive duration, e.g. 6h", s.ExpiresAfter)
+	}
+	if err := validateNewCommand(&Command{Type: s.Type, Payload: s.Payload}); err != nil {
+		return nil, err
+	}
+	if c.matcher, err = compileTargets(s.DeviceIDs, s.Selector); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateSchedule handles POST /admin/schedules - creates a recurring command. Each run sends
+// the command to the schedule's devices (device_ids, or the devices matching the selector at
+// run time) as a campaign; see GetCampaign.
+func (h *Handlers) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.scheduleStore == nil {
+		h.jsonError(w, "command schedules are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var schedule CommandSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		h.jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Set defaults
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if schedule.ExpiresAfter == "" {
+		schedule.ExpiresAfter = "24h" // DefaultCommandExpiry
+	}
+
+	compiled, err := schedule.compile()
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	schedule.NextRunAt = compiled.cron.Next(now.In(compiled.loc))
+	if schedule.NextRunAt.IsZero() {
+		h.jsonError(w, "cron expression never matches", http.StatusBadRequest)
+		return
+	}
+	schedule.NextRunAt = schedule.NextRunAt.UTC()
+	schedule.CreatedAt = now
+	schedule.LastRunAt, schedule.LastCampaignID, schedule.LastError = nil, "", "" // Server-managed
+
+	id, err := h.scheduleStore.Save(ctx, &schedule)
+	if err != nil {
+		h.logger.Error("failed to store command schedule",
+			"request_id", reqID,
+			"error", err,
+			"type", schedule.Type,
+		)
+		h.jsonError(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+	schedule.ID = id
+
+	h.logger.Info("command schedule created",
+		"request_id", reqID,
+		"schedule_id", id,
+		"type", schedule.Type,
+		"cron", schedule.Cron,
+		"timezone", schedule.Timezone,
+		"next_run_at", schedule.NextRunAt,
+	)
+
+	h.jsonResponse(w, schedule, http.StatusCreated)
+}
+
+// ListSchedules handles GET /admin/schedules - lists command schedules by next run
+func (h *Handlers) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.scheduleStore == nil {
+		h.jsonError(w, "command schedules are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	schedules, err := h.scheduleStore.List(ctx)
+	if err != nil {
+		h.logger.Error("failed to list command schedules",
+			"request_id", reqID,
+			"error", err,
+		)
+		h.jsonError(w, "failed to list schedules", http.StatusInternalServerError)
+		return
+	}
+	if schedules == nil {
+		schedules = []CommandSchedule{}
+	}
+
+	h.jsonResponse(w, map[string]interface{}{
+		"data":  schedules,
+		"count": len(schedules),
+	}, http.StatusOK)
+}
+
+// GetSchedule handles GET /admin/schedules/{id} - a schedule with its next and latest run
+func (h *Handlers) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	if h.scheduleStore == nil {
+		h.jsonError(w, "command schedules are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := validate.PathSegment(id); err != nil {
+		h.jsonError(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := h.scheduleStore.GetByID(r.Context(), id)
+	if err != nil {
+		h.jsonError(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+
+	h.jsonResponse(w, schedule, http.StatusOK)
+}
+
+// DeleteSchedule handles DELETE /admin/schedules/{id} - stops a schedule.
+// Commands of earlier runs are kept.
+func (h *Handlers) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	if h.scheduleStore == nil {
+		h.jsonError(w, "command schedules are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := validate.PathSegment(id); err != nil {
+		h.jsonError(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.scheduleStore.GetByID(ctx, id); err != nil {
+		h.jsonError(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.scheduleStore.Delete(ctx, id); err != nil {
+		h.logger.Error("failed to delete command schedule",
+			"request_id", reqID,
+			"error", err,
+			"schedule_id", id,
+		)
+		h.jsonError(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("command schedule deleted",
+		"request_id", reqID,
+		"schedule_id", id,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartCommandScheduler runs due command schedules every CommandSchedulerInterval until
+// ctx is cancelled. It is safe to start on every instance: each run is claimed once.
+func (h *Handlers) StartCommandScheduler(ctx context.Context) {
+	if h.scheduleStore == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(CommandSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			h.runDueSchedules(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDueSchedules executes the schedule runs due by now (plus the lookahead) and returns
+// how many this instance claimed
+func (h *Handlers) runDueSchedules(ctx context.Context, now time.Time) int {
+	schedules, err := h.scheduleStore.ListDue(ctx, now.Add(commandScheduleLookahead))
+	if err != nil {
+		if ctx.Err() == nil {
+			h.logger.Error("failed to list due command schedules", "error", err)
+		}
+		return 0
+	}
+
+	runs := 0
+	for i := range schedules {
+		if h.runSchedule(ctx, &schedules[i], now) {
+			runs++
+		}
+	}
+	return runs
+}
+
+// runSchedule claims the schedule's next run, moving it to the following occurrence, and
+// creates the run's commands. After downtime only the latest missed run is executed, and
+// only while its commands would not already be expired. A run that fails on a store error
+// is given back, so the next pass on any instance retries it within that window.
+func (h *Handlers) runSchedule(ctx context.Context, s *CommandSchedule, now time.Time) bool {
+	compiled, err := s.compile()
+	if err != nil {
+		h.logger.Error("invalid command schedule", "error", err, "schedule_id", s.ID)
+		return false
+	}
+
+	runAt := s.NextRunAt
+	from := runAt
+	if now.After(from) {
+		from = now // Skip occurrences missed meanwhile
+	}
+	next := compiled.cron.Next(from.In(compiled.loc)).UTC()
+	if next.IsZero() {
+		h.logger.Error("command schedule never runs again", "schedule_id", s.ID, "cron", s.Cron)
+		return false
+	}
+
+	claimed, err := h.scheduleStore.Claim(ctx, s.ID, runAt, next)
+	if err != nil {
+		h.logger.Error("failed to claim command schedule run", "error", err, "schedule_id", s.ID)
+		return false
+	}
+	if !claimed {
+		return false // Another instance runs it
+	}
+
+	campaignID, retry, err := h.createScheduledCommands(ctx, s, compiled, runAt, now)
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		h.logger.Warn("command schedule run failed",
+			"error", err,
+			"schedule_id", s.ID,
+			"run_at", runAt,
+			"retry", retry,
+		)
+	}
+	if retry {
+		if released, err := h.scheduleStore.Unclaim(ctx, s.ID, runAt, next); err != nil || !released {
+			h.logger.Error("failed to give back command schedule run",
+				"error", err,
+				"schedule_id", s.ID,
+				"run_at", runAt,
+			)
+		}
+	}
+	if err := h.scheduleStore.Update(ctx, s.ID, map[string]interface{}{
+		"last_campaign_id": campaignID,
+		"last_error":       lastError,
+	}); err != nil {
+		h.logger.Error("failed to record command schedule run", "error", err, "schedule_id", s.ID)
+	}
+	return true
+}
+
+// createScheduledCommands creates the commands of the run at runAt as a campaign.
+// retry reports a failure that may succeed later (a store error, nothing was created).
+func (h *Handlers) createScheduledCommands(ctx context.Context, s *CommandSchedule, compiled *compiledSchedule, runAt, now time.Time) (campaignID string, retry bool, err error) {
+	expiresAt := runAt.Add(compiled.expiresAfter)
+	if !expiresAt.After(now) {
+		return "", false, fmt.Errorf("run missed: its commands expired at %s", expiresAt.Format(time.RFC3339))
+	}
+
+	targets, skipped, err := h.resolveTargets(ctx, s.DeviceIDs, compiled.matcher)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to list devices: %w", err)
+	}
+	if len(targets) == 0 {
+		return "", false, errors.New("no active devices to command")
+	}
+	if len(targets) > MaxCampaignDevices {
+		return "", false, fmt.Errorf("selector matches %d devices (max %d)", len(targets), MaxCampaignDevices)
+	}
+
+	template := Command{
+		Type:       s.Type,
+		Payload:    s.Payload,
+		NotBefore:  &runAt,
+		ExpiresAt:  &expiresAt,
+		ScheduleID: s.ID,
+	}
+	campaignID, _, err = h.createCampaign(ctx, &template, targets)
+	if err != nil {
+		// SaveMany writes one atomic batch: nothing of the run was stored
+		return "", true, fmt.Errorf("failed to create commands: %w", err)
+	}
+
+	h.logger.Info("command schedule run",
+		"schedule_id", s.ID,
+		"campaign_id", campaignID,
+		"type", s.Type,
+		"run_at", runAt,
+		"devices", len(targets),
+		"skipped", len(skipped),
+	)
+	return campaignID, false, nil
+}
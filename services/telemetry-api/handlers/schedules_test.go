@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newScheduleTestHandlers registers the campaign test fleet and enables schedules
+func newScheduleTestHandlers() (*Handlers, *MockScheduleStore, *MockCommandStore) {
+	h, commands := newCampaignTestHandlers()
+	schedules := NewMockScheduleStore()
+	h.scheduleStore = schedules
+	return h, schedules, commands
+}
+
+func postSchedule(h *Handlers, body string) (*httptest.ResponseRecorder, CommandSchedule) {
+	req := httptest.NewRequest(http.MethodPost, "/admin/schedules", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.CreateSchedule(w, req)
+
+	var schedule CommandSchedule
+	json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&schedule)
+	return w, schedule
+}
+
+// addSchedule stores a schedule for tag "greenhouse" whose next run is at runAt
+func addSchedule(schedules *MockScheduleStore, runAt time.Time) string {
+	id, _ := schedules.Save(context.Background(), &CommandSchedule{
+		Cron:         "0 3 * * *",
+		Timezone:     "UTC",
+		Type:         "calibrate",
+		Payload:      map[string]interface{}{"sensor": "co2"},
+		ExpiresAfter: "6h",
+		Selector:     &DeviceSelector{Tag: "greenhouse"},
+		NextRunAt:    runAt,
+	})
+	return id
+}
+
+func TestCreateSchedule_Success(t *testing.T) {
+	h, schedules, _ := newScheduleTestHandlers()
+
+	body := `{"name": "nightly recalibration", "cron": "0 3 * * sun", "timezone": "Europe/Skopje",
+		"type": "calibrate", "payload": {"sensor": "co2"}, "selector": {"app_name": "probe"}}`
+	w, schedule := postSchedule(h, body)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if schedule.ID == "" || schedule.ExpiresAfter != "24h" || schedule.CreatedAt.IsZero() {
+		t.Errorf("unexpected schedule %+v", schedule)
+	}
+
+	// Next Sunday, 03:00 in Skopje
+	loc, _ := time.LoadLocation("Europe/Skopje")
+	next := schedule.NextRunAt.In(loc)
+	if !next.After(time.Now()) || next.Weekday() != time.Sunday || next.Hour() != 3 || next.Minute() != 0 {
+		t.Errorf("unexpected next run %v", next)
+	}
+	if _, ok := schedules.data[schedule.ID]; !ok {
+		t.Error("schedule was not stored")
+	}
+}
+
+func TestCreateSchedule_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{`},
+		{"missing cron", `{"type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"invalid cron", `{"cron": "0 25 * * *", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"never matches", `{"cron": "0 0 30 2 *", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"unknown timezone", `{"cron": "@daily", "timezone": "Mars/Olympus", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"server timezone", `{"cron": "@daily", "timezone": "Local", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"invalid expires_after", `{"cron": "@daily", "expires_after": "soon", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"negative expires_after", `{"cron": "@daily", "expires_after": "-1h", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+		{"missing type", `{"cron": "@daily", "selector": {"tag": "greenhouse"}}`},
+		{"no targets", `{"cron": "@daily", "type": "reboot"}`},
+		{"invalid device id", `{"cron": "@daily", "type": "reboot", "device_ids": ["nope"]}`},
+		{"long name", `{"name": "` + strings.Repeat("a", MaxScheduleNameLength+1) + `", "cron": "@daily", "type": "reboot", "selector": {"tag": "greenhouse"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, schedules, _ := newScheduleTestHandlers()
+			w, _ := postSchedule(h, tt.body)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+			if len(schedules.data) != 0 {
+				t.Errorf("stored %d schedules", len(schedules.data))
+			}
+		})
+	}
+}
+
+func TestCreateSchedule_StoreError(t *testing.T) {
+	h, schedules, _ := newScheduleTestHandlers()
+	schedules.SaveErr = errors.New("firestore unavailable")
+
+	w, _ := postSchedule(h, `{"cron": "@daily", "type": "reboot", "selector": {"tag": "greenhouse"}}`)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestSchedules_NotEnabled(t *testing.T) {
+	h, _ := newCampaignTestHandlers()
+
+	w, _ := postSchedule(h, `{"cron": "@daily", "type": "reboot", "selector": {"tag": "greenhouse"}}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ListSchedules(w, httptest.NewRequest(http.MethodGet, "/admin/schedules", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestListGetDeleteSchedule(t *testing.T) {
+	h, schedules, _ := newScheduleTestHandlers()
+	now := time.Now().UTC()
+	later := addSchedule(schedules, now.Add(2*time.Hour))
+	sooner := addSchedule(schedules, now.Add(time.Hour))
+
+	// List by next run
+	w := httptest.NewRecorder()
+	h.ListSchedules(w, httptest.NewRequest(http.MethodGet, "/admin/schedules", nil))
+	var list struct {
+		Data  []CommandSchedule `json:"data"`
+		Count int               `json:"count"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || list.Count != 2 || list.Data[0].ID != sooner || list.Data[1].ID != later {
+		t.Errorf("unexpected list %d: %+v", w.Code, list)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/schedules/"+id, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.GetSchedule(w, req)
+		return w
+	}
+	del := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/schedules/"+id, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.DeleteSchedule(w, req)
+		return w
+	}
+
+	w = get(sooner)
+	var schedule CommandSchedule
+	json.NewDecoder(w.Body).Decode(&schedule)
+	if w.Code != http.StatusOK || schedule.ID != sooner || schedule.Type != "calibrate" {
+		t.Errorf("unexpected schedule %d: %+v", w.Code, schedule)
+	}
+
+	if w := del(sooner); w.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := get(sooner); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d after delete, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := del(sooner); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := get("a/b"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	now := time.Date(2026, 10, 16, 2, 59, 30, 0, time.UTC)
+	runAt := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	id := addSchedule(schedules, runAt)
+	addSchedule(schedules, runAt.Add(time.Hour)) // Not due yet
+
+	if n := h.runDueSchedules(context.Background(), now); n != 1 {
+		t.Fatalf("expected 1 run, got %d", n)
+	}
+
+	schedule := schedules.data[id]
+	if want := runAt.Add(24 * time.Hour); !schedule.NextRunAt.Equal(want) {
+		t.Errorf("expected next run %v, got %v", want, schedule.NextRunAt)
+	}
+	if schedule.LastRunAt == nil || !schedule.LastRunAt.Equal(runAt) || schedule.LastCampaignID == "" || schedule.LastError != "" {
+		t.Errorf("unexpected run outcome %+v", schedule)
+	}
+
+	// One command per greenhouse device, hidden until the run time
+	cmds, _ := commands.GetByCampaign(context.Background(), schedule.LastCampaignID)
+	if len(cmds) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(cmds))
+	}
+	for _, cmd := range cmds {
+		if cmd.ScheduleID != id || cmd.Type != "calibrate" || cmd.Payload["sensor"] != "co2" ||
+			cmd.NotBefore == nil || !cmd.NotBefore.Equal(runAt) || cmd.ExpiresAt == nil || !cmd.ExpiresAt.Equal(runAt.Add(6*time.Hour)) {
+			t.Errorf("unexpected command %+v", cmd)
+		}
+	}
+
+	// The run is claimed: a second pass creates nothing
+	if n := h.runDueSchedules(context.Background(), now); n != 0 {
+		t.Errorf("expected no runs, got %d", n)
+	}
+	if len(commands.data) != 2 {
+		t.Errorf("expected 2 commands, got %d", len(commands.data))
+	}
+}
+
+func TestRunDueSchedules_ClaimedElsewhere(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	now := time.Now().UTC()
+	id := addSchedule(schedules, now)
+
+	// Another instance claims the run between listing and claiming
+	due, _ := schedules.ListDue(context.Background(), now)
+	schedules.Claim(context.Background(), id, now, now.Add(24*time.Hour))
+
+	if h.runSchedule(context.Background(), &due[0], now) {
+		t.Error("expected the run to be claimed elsewhere")
+	}
+	if len(commands.data) != 0 {
+		t.Errorf("created %d commands", len(commands.data))
+	}
+}
+
+func TestRunDueSchedules_Missed(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	// Down for days: the 03:00 run four days ago expired long ago
+	stale := addSchedule(schedules, time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC))
+	// Today's 03:00 run is still within expires_after
+	recent := addSchedule(schedules, time.Date(2026, 10, 20, 3, 0, 0, 0, time.UTC))
+	schedules.data[recent] = func(s CommandSchedule) CommandSchedule { s.ExpiresAfter = "12h"; return s }(schedules.data[recent])
+
+	if n := h.runDueSchedules(context.Background(), now); n != 2 {
+		t.Fatalf("expected 2 runs, got %d", n)
+	}
+
+	// Missed occurrences are skipped, not replayed
+	tomorrow := time.Date(2026, 10, 21, 3, 0, 0, 0, time.UTC)
+	if s := schedules.data[stale]; !s.NextRunAt.Equal(tomorrow) || !strings.Contains(s.LastError, "missed") || s.LastCampaignID != "" {
+		t.Errorf("unexpected stale schedule %+v", s)
+	}
+	if s := schedules.data[recent]; !s.NextRunAt.Equal(tomorrow) || s.LastError != "" || s.LastCampaignID == "" {
+		t.Errorf("unexpected recent schedule %+v", s)
+	}
+	if len(commands.data) != 2 {
+		t.Errorf("expected 2 commands (recent run only), got %d", len(commands.data))
+	}
+}
+
+func TestRunDueSchedules_RetriesStoreError(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	runAt := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	id := addSchedule(schedules, runAt)
+	commands.SaveErr = errors.New("firestore unavailable")
+
+	// The failed run is given back instead of moving on to tomorrow
+	if n := h.runDueSchedules(context.Background(), runAt); n != 1 {
+		t.Fatalf("expected 1 run, got %d", n)
+	}
+	if s := schedules.data[id]; !s.NextRunAt.Equal(runAt) || !strings.Contains(s.LastError, "firestore unavailable") {
+		t.Fatalf("expected the run to stay due with the error recorded, got %+v", s)
+	}
+
+	// The next pass, still within expires_after, creates the commands
+	commands.SaveErr = nil
+	if n := h.runDueSchedules(context.Background(), runAt.Add(CommandSchedulerInterval)); n != 1 {
+		t.Fatalf("expected 1 run, got %d", n)
+	}
+	s := schedules.data[id]
+	if want := runAt.Add(24 * time.Hour); !s.NextRunAt.Equal(want) || s.LastError != "" || s.LastCampaignID == "" {
+		t.Errorf("unexpected schedule after retry %+v", s)
+	}
+	if len(commands.data) != 2 {
+		t.Errorf("expected 2 commands, got %d", len(commands.data))
+	}
+}
+
+func TestRunDueSchedules_RetriesDeviceLookupError(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	runAt := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	id := addSchedule(schedules, runAt)
+	schedules.data[id] = func(s CommandSchedule) CommandSchedule {
+		s.Selector, s.DeviceIDs = nil, []string{campTestDeviceA}
+		return s
+	}(schedules.data[id])
+	h.deviceStore.(*MockDeviceStore).GetErr = errors.New("firestore unavailable")
+
+	if n := h.runDueSchedules(context.Background(), runAt); n != 1 {
+		t.Fatalf("expected 1 run, got %d", n)
+	}
+	if s := schedules.data[id]; !s.NextRunAt.Equal(runAt) || !strings.Contains(s.LastError, "firestore unavailable") {
+		t.Errorf("expected the run to stay due with the error recorded, got %+v", s)
+	}
+	if len(commands.data) != 0 {
+		t.Errorf("expected no commands, got %d", len(commands.data))
+	}
+}
+
+func TestRunDueSchedules_NoDevices(t *testing.T) {
+	h, schedules, commands := newScheduleTestHandlers()
+	now := time.Now().UTC()
+	id := addSchedule(schedules, now)
+	schedules.data[id] = func(s CommandSchedule) CommandSchedule { s.Selector = &DeviceSelector{Tag: "attic"}; return s }(schedules.data[id])
+
+	if n := h.runDueSchedules(context.Background(), now); n != 1 {
+		t.Fatalf("expected 1 run, got %d", n)
+	}
+	if s := schedules.data[id]; s.LastError == "" || !s.NextRunAt.After(now) {
+		t.Errorf("expected a recorded error and the next run, got %+v", s)
+	}
+	if len(commands.data) != 0 {
+		t.Errorf("created %d commands", len(commands.data))
+	}
+}
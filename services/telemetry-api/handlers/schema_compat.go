@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/semver"
+)
+
+// Schema compatibility modes for uploads
+const (
+	SchemaCompatNone     = "none"     // Report differences, never reject
+	SchemaCompatBackward = "backward" // Reject reassigned IDs and type changes
+	SchemaCompatStrict   = "strict"   // Reject any difference, including removals and unit changes
+)
+
+// DefaultSchemaCompat is used when neither SCHEMA_COMPAT_MODE nor ?compat= is set
+const DefaultSchemaCompat = SchemaCompatBackward
+
+// Schema compatibility issue kinds
+const (
+	CompatIDReassigned = "id_reassigned" // An ID now names a different measurement
+	CompatTypeChanged  = "type_changed"  // A measurement kept its ID but changed type
+	CompatUnitChanged  = "unit_changed"
+	CompatRemoved      = "removed" // A measurement ID no longer exists
+)
+
+// SchemaCompatIssue is one difference between a schema and the version it is checked against
+type SchemaCompatIssue struct {
+	Kind        string `json:"kind"`
+	ID          uint32 `json:"id"`
+	Measurement string `json:"measurement"` // Name in the previous version
+	Message     string `json:"message"`
+	Breaking    bool   `json:"breaking"` // Rejected in backward mode
+}
+
+// SchemaCompatReport is the result of checking an upload against a previous version
+type SchemaCompatReport struct {
+	Mode           string              `json:"mode"`
+	AgainstVersion string              `json:"against_version"`
+	Compatible     bool                `json:"compatible"` // Accepted under Mode
+	Issues         []SchemaCompatIssue `json:"issues"`
+}
+
+// ParseSchemaCompatMode validates a compatibility mode ("" = DefaultSchemaCompat)
+func ParseSchemaCompatMode(s string) (string, error) {
+	switch s {
+	case "":
+		return DefaultSchemaCompat, nil
+	case SchemaCompatNone, SchemaCompatBackward, SchemaCompatStrict:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid compatibility mode %q: must be %s, %s or %s", s, SchemaCompatNone, SchemaCompatBackward, SchemaCompatStrict)
+	}
+}
+
+// checkSchemaCompat compares the measurements of a new schema with a previous version.
+// Issues are ordered by measurement ID.
+func checkSchemaCompat(prev, next map[string]MeasurementMeta) []SchemaCompatIssue {
+	nextByID := make(map[uint32]MeasurementMeta, len(next))
+	for name, meta := range next {
+		nextByID[meta.ID] = withName(name, meta)
+	}
+
+	issues := []SchemaCompatIssue{}
+	for name, old := range prev {
+		old = withName(name, old)
+		cur, ok := nextByID[old.ID]
+		switch {
+		case !ok:
+			issues = append(issues, SchemaCompatIssue{
+				Kind: CompatRemoved, ID: old.ID, Measurement: old.Name,
+				Message: fmt.Sprintf("measurement %q (ID %d) was removed", old.Name, old.ID),
+			})
+		case cur.Name != old.Name:
+			issues = append(issues, SchemaCompatIssue{
+				Kind: CompatIDReassigned, ID: old.ID, Measurement: old.Name, Breaking: true,
+				Message: fmt.Sprintf("ID %d was reassigned from %q to %q", old.ID, old.Name, cur.Name),
+			})
+		default:
+			if cur.Type != old.Type {
+				issues = append(issues, SchemaCompatIssue{
+					Kind: CompatTypeChanged, ID: old.ID, Measurement: old.Name, Breaking: true,
+					Message: fmt.Sprintf("measurement %q (ID %d) changed type from %q to %q", old.Name, old.ID, old.Type, cur.Type),
+				})
+			}
+			if cur.Unit != old.Unit {
+				issues = append(issues, SchemaCompatIssue{
+					Kind: CompatUnitChanged, ID: old.ID, Measurement: old.Name,
+					Message: fmt.Sprintf("measurement %q (ID %d) changed unit from %q to %q", old.Name, old.ID, old.Unit, cur.Unit),
+				})
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].ID != issues[j].ID {
+			return issues[i].ID < issues[j].ID
+		}
+		return issues[i].Kind < issues[j].Kind
+	})
+	return issues
+}
+
+// withName fills in a measurement's name from its schema map key
+func withName(name string, meta MeasurementMeta) MeasurementMeta {
+	if meta.Name == "" {
+		meta.Name = name
+	}
+	return meta
+}
+
+// compatible reports whether issues are acceptable under mode
+func compatible(mode string, issues []SchemaCompatIssue) bool {
+	for _, issue := range issues {
+		if mode == SchemaCompatStrict || (mode == SchemaCompatBackward && issue.Breaking) {
+			return false
+		}
+	}
+	return true
+}
+
+// latestSchema returns the app's highest stored version, which every upload is checked
+// against, including re-uploads and backports of older versions (nil when there is none)
+func (h *Handlers) latestSchema(ctx context.Context, appName string) (*MeasurementSchema, error) {
+	versions, err := h.schemaStore.ListVersions(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *MeasurementSchema
+	for i := range versions {
+		if latest == nil || semver.CompareStrings(versions[i].Version, latest.Version) > 0 {
+			latest = &versions[i]
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCheckSchemaCompat(t *testing.T) {
+	prev := map[string]MeasurementMeta{
+		"temperature": {ID: 1, Name: "temperature", Type: "float", Unit: "°C"},
+		"humidity":    {ID: 3, Name: "humidity", Type: "float", Unit: "%"},
+		"co2":         {ID: 4, Name: "co2", Type: "uint32", Unit: "ppm"},
+		"uptime":      {ID: 5, Name: "uptime", Type: "uint32", Unit: "s"},
+	}
+	next := map[string]MeasurementMeta{
+		"temperature": {ID: 1, Name: "temperature", Type: "float", Unit: "K"},
+		"pressure":    {ID: 3, Name: "pressure", Type: "float", Unit: "hPa"},
+		"co2":         {ID: 4, Name: "co2", Type: "float", Unit: "ppm"},
+	}
+
+	issues := checkSchemaCompat(prev, next)
+
+	want := []struct {
+		kind     string
+		id       uint32
+		breaking bool
+	}{
+		{CompatUnitChanged, 1, false},
+		{CompatIDReassigned, 3, true},
+		{CompatTypeChanged, 4, true},
+		{CompatRemoved, 5, false},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), issues)
+	}
+	for i, w := range want {
+		if issues[i].Kind != w.kind || issues[i].ID != w.id || issues[i].Breaking != w.breaking {
+			t.Errorf("issue %d: expected %s/%d/%v, got %+v", i, w.kind, w.id, w.breaking, issues[i])
+		}
+	}
+
+	if !compatible(SchemaCompatNone, issues) || compatible(SchemaCompatBackward, issues) {
+		t.Error("unexpected compatibility verdict")
+	}
+	if !compatible(SchemaCompatBackward, issues[:1]) || compatible(SchemaCompatStrict, issues[:1]) {
+		t.Error("unit changes must only be rejected in strict mode")
+	}
+}
+
+func TestParseSchemaCompatMode(t *testing.T) {
+	if mode, err := ParseSchemaCompatMode(""); err != nil || mode != DefaultSchemaCompat {
+		t.Errorf("expected default mode, got %q (%v)", mode, err)
+	}
+	if _, err := ParseSchemaCompatMode("forward"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func uploadSchema(h *Handlers, version, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/schemas/test-app/"+version+query, bytes.NewBufferString(body))
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", version)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.UploadSchema(w, req)
+	return w
+}
+
+func seedSchemaVersions(store *MockSchemaStore) {
+	store.Save(context.Background(), "test-app", "1.2.0", &MeasurementSchema{
+		AppName: "test-app", Version: "1.2.0",
+		Measurements: map[string]MeasurementMeta{
+			"humidity": {ID: 3, Name: "humidity", Type: "float", Unit: "%"},
+		},
+	})
+	store.Save(context.Background(), "test-app", "1.10.0", &MeasurementSchema{
+		AppName: "test-app", Version: "1.10.0",
+		Measurements: map[string]MeasurementMeta{
+			"humidity": {ID: 3, Name: "humidity", Type: "float", Unit: "%"},
+			"co2":      {ID: 4, Name: "co2", Type: "float", Unit: "ppm"},
+		},
+	})
+}
+
+func TestUploadSchema_RejectsReassignedID(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	w := uploadSchema(h, "1.11.0", "", `{"measurements": {
+		"pressure": {"id": 3, "name": "pressure", "type": "float", "unit": "hPa"},
+		"co2": {"id": 4, "name": "co2", "type": "float", "unit": "ppm"}
+	}}`)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	var response struct {
+		Compatibility SchemaCompatReport `json:"compatibility"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Compatibility.AgainstVersion != "1.10.0" {
+		t.Errorf("expected check against latest version 1.10.0, got %q", response.Compatibility.AgainstVersion)
+	}
+	if len(response.Compatibility.Issues) != 1 || response.Compatibility.Issues[0].Kind != CompatIDReassigned {
+		t.Errorf("unexpected issues: %+v", response.Compatibility.Issues)
+	}
+	if _, err := store.Get(context.Background(), "test-app", "1.11.0"); err == nil {
+		t.Error("rejected schema must not be stored")
+	}
+}
+
+func TestUploadSchema_CompatModes(t *testing.T) {
+	// Removing co2 is allowed in backward mode but rejected in strict mode
+	body := `{"measurements": {"humidity": {"id": 3, "name": "humidity", "type": "float", "unit": "%"}}}`
+
+	tests := []struct {
+		name       string
+		configured string
+		query      string
+		wantStatus int
+	}{
+		{"default backward", "", "", http.StatusCreated},
+		{"strict query", "", "?compat=strict", http.StatusConflict},
+		{"strict configured", SchemaCompatStrict, "", http.StatusConflict},
+		{"query overrides configured", SchemaCompatStrict, "?compat=none", http.StatusCreated},
+		{"invalid mode", "", "?compat=forward", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockSchemaStore()
+			seedSchemaVersions(store)
+			h := NewWithStores(nil, nil, nil, store, nil, nil)
+			h.config.SchemaCompat = tt.configured
+
+			w := uploadSchema(h, "2.0.0", tt.query, body)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadSchema_ChecksAgainstLatestVersion(t *testing.T) {
+	body := func(id4 string) string {
+		return `{"measurements": {
+			"humidity": {"id": 3, "name": "humidity", "type": "float", "unit": "%"},
+			"` + id4 + `": {"id": 4, "name": "` + id4 + `", "type": "float"}
+		}}`
+	}
+
+	tests := []struct {
+		name       string
+		version    string
+		body       string
+		wantStatus int
+		wantIssues []string
+	}{
+		// Re-uploads and backports are checked against 1.10.0, not the replaced or next lower version
+		{"replaced version", "1.2.0", `{"measurements": {"humidity": {"id": 3, "name": "humidity", "type": "float", "unit": "%"}}}`, http.StatusCreated, []string{CompatRemoved}},
+		{"backport reusing a newer ID", "1.2.1", body("voc"), http.StatusConflict, []string{CompatIDReassigned}},
+		{"latest version", "1.10.0", body("co2"), http.StatusCreated, []string{CompatUnitChanged}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockSchemaStore()
+			seedSchemaVersions(store)
+			h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+			w := uploadSchema(h, tt.version, "", tt.body)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			var response struct {
+				Compatibility SchemaCompatReport `json:"compatibility"`
+			}
+			json.NewDecoder(w.Body).Decode(&response)
+			if response.Compatibility.AgainstVersion != "1.10.0" {
+				t.Errorf("expected check against 1.10.0, got %q", response.Compatibility.AgainstVersion)
+			}
+			var kinds []string
+			for _, issue := range response.Compatibility.Issues {
+				kinds = append(kinds, issue.Kind)
+			}
+			if !slices.Equal(kinds, tt.wantIssues) {
+				t.Errorf("expected issues %v, got %+v", tt.wantIssues, response.Compatibility.Issues)
+			}
+		})
+	}
+}
+
+func TestUploadSchema_ListError(t *testing.T) {
+	store := NewMockSchemaStore()
+	store.ListErr = errors.New("firestore unavailable")
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	w := uploadSchema(h, "1.0.0", "", `{"measurements": {"temp": {"id": 1, "name": "temp", "type": "float"}}}`)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+// repeatedPrefix marks a repeated (packed or unpacked) scalar schema type, e.g. "repeated sint32"
+const repeatedPrefix = "repeated "
+
+// wireTypeName names a protobuf wire type for error messages
+func wireTypeName(wt proto.WireType) string {
+	switch wt {
+	case proto.WireVarint:
+		return "varint"
+	case proto.WireFixed32:
+		return "fixed32"
+	case proto.WireFixed64:
+		return "fixed64"
+	case proto.WireBytes:
+		return "length-delimited"
+	default:
+		return fmt.Sprintf("wire type %d", wt)
+	}
+}
+
+// schemaWireType returns the wire encoding of a scalar schema type.
+// Float and double accept either width: the wire type tells them apart unambiguously.
+func schemaWireType(scalar string) ([]proto.WireType, bool) {
+	switch scalar {
+	case "float", "double":
+		return []proto.WireType{proto.WireFixed32, proto.WireFixed64}, true
+	case "int32", "int64", "sint32", "sint64", "uint32", "uint64", "bool", "enum":
+		return []proto.WireType{proto.WireVarint}, true
+	case "fixed32", "sfixed32":
+		return []proto.WireType{proto.WireFixed32}, true
+	case "fixed64", "sfixed64":
+		return []proto.WireType{proto.WireFixed64}, true
+	case "string", "bytes":
+		return []proto.WireType{proto.WireBytes}, true
+	default:
+		return nil, false
+	}
+}
+
+// decodeScalar interprets a wire value as the given scalar schema type
+func decodeScalar(scalar string, v proto.Value) (interface{}, error) {
+	expected, ok := schemaWireType(scalar)
+	if !ok {
+		return nil, fmt.Errorf("unsupported schema type %q", scalar)
+	}
+	matched := false
+	for _, wt := range expected {
+		matched = matched || wt == v.WireType
+	}
+	if !matched {
+		return nil, fmt.Errorf("schema type %s expects %s encoding, got %s", scalar, wireTypeName(expected[0]), wireTypeName(v.WireType))
+	}
+
+	switch scalar {
+	case "float", "double":
+		if v.WireType == proto.WireFixed32 {
+			return v.AsFloat32(), nil
+		}
+		return v.AsFloat64(), nil
+	case "int32", "enum":
+		return v.AsInt32(), nil
+	case "int64":
+		return v.AsInt64(), nil
+	case "sint32":
+		return v.AsSint32(), nil
+	case "sint64":
+		return v.AsSint64(), nil
+	case "uint32":
+		return v.AsUint32(), nil
+	case "uint64":
+		return v.AsUint64(), nil
+	case "bool":
+		return v.AsBool(), nil
+	case "fixed32":
+		return v.Fixed32, nil
+	case "sfixed32":
+		return int32(v.Fixed32), nil
+	case "fixed64":
+		return v.Fixed64, nil
+	case "sfixed64":
+		return int64(v.Fixed64), nil
+	case "string":
+		if !utf8.Valid(v.Bytes) {
+			return nil, errors.New("schema type string requires valid UTF-8")
+		}
+		return v.AsString(), nil
+	default: // bytes
+		return append([]byte(nil), v.Bytes...), nil
+	}
+}
+
+// decodePacked decodes a packed repeated scalar field into its elements
+func decodePacked(scalar string, v proto.Value) ([]proto.Value, error) {
+	expected, ok := schemaWireType(scalar)
+	if !ok || expected[0] == proto.WireBytes {
+		return nil, fmt.Errorf("schema type %q cannot be packed", repeatedPrefix+scalar)
+	}
+
+	switch expected[0] {
+	case proto.WireVarint:
+		elems, err := v.AsPackedVarints()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]proto.Value, len(elems))
+		for i, x := range elems {
+			values[i] = proto.VarintValue(x)
+		}
+		return values, nil
+	case proto.WireFixed32:
+		elems, err := v.AsPackedFixed32()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]proto.Value, len(elems))
+		for i, x := range elems {
+			values[i] = proto.Fixed32Value(x)
+		}
+		return values, nil
+	default:
+		elems, err := v.AsPackedFixed64()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]proto.Value, len(elems))
+		for i, x := range elems {
+			values[i] = proto.Fixed64Value(x)
+		}
+		return values, nil
+	}
+}
+
+// schemaValue decodes a measurement's raw value fields using the schema's declared type.
+// Repeated types accept packed and unpacked encodings and decode to []float64.
+func schemaValue(meta MeasurementMeta, fields []proto.Field) (interface{}, error) {
+	scalar, repeated := strings.CutPrefix(meta.Type, repeatedPrefix)
+	if !repeated {
+		if len(fields) == 0 {
+			return nil, nil
+		}
+		return decodeScalar(scalar, fields[0].Value)
+	}
+
+	if scalar == "string" || scalar == "bytes" {
+		return nil, fmt.Errorf("schema type %q is not supported", meta.Type)
+	}
+
+	list := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		elems := []proto.Value{f.Value}
+		if f.Value.WireType == proto.WireBytes {
+			var err error
+			if elems, err = decodePacked(scalar, f.Value); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range elems {
+			v, err := decodeScalar(scalar, e)
+			if err != nil {
+				return nil, err
+			}
+			x, err := toFloat64(v)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, x)
+		}
+	}
+	return list, nil
+}
+
+// hasSchemaType reports whether the schema declares a type the decoder understands.
+// Measurements without one keep the wire-detected value.
+func hasSchemaType(meta MeasurementMeta) bool {
+	_, ok := schemaWireType(strings.TrimPrefix(meta.Type, repeatedPrefix))
+	return ok
+}
+
+// resolveMeasurementValues replaces wire-detected values with schema-driven ones.
+// A measurement whose encoding does not match its declared type is an error.
+func resolveMeasurementValues(measurements []Measurement, idToMeta map[uint32]MeasurementMeta) error {
+	for i := range measurements {
+		m := &measurements[i]
+		meta, ok := idToMeta[m.ID]
+		if !ok || !hasSchemaType(meta) {
+			continue
+		}
+		v, err := schemaValue(meta, m.Fields)
+		if err != nil {
+			return fmt.Errorf("measurement %d (%s): %w", m.ID, meta.Name, err)
+		}
+		m.Value = v
+	}
+	return nil
+}
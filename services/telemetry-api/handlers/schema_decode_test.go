@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+func TestDecodeScalar(t *testing.T) {
+	tests := []struct {
+		scalar string
+		value  proto.Value
+		want   interface{}
+	}{
+		{"sint32", proto.Value{WireType: proto.WireVarint, Varint: 3}, int32(-2)},
+		{"sint64", proto.Value{WireType: proto.WireVarint, Varint: 4}, int64(2)},
+		{"int32", proto.Value{WireType: proto.WireVarint, Varint: 7}, int32(7)},
+		{"uint64", proto.Value{WireType: proto.WireVarint, Varint: math.MaxUint64}, uint64(math.MaxUint64)},
+		{"fixed32", proto.Value{WireType: proto.WireFixed32, Fixed32: 42}, uint32(42)},
+		{"sfixed32", proto.Value{WireType: proto.WireFixed32, Fixed32: math.MaxUint32}, int32(-1)},
+		{"sfixed64", proto.Value{WireType: proto.WireFixed64, Fixed64: math.MaxUint64}, int64(-1)},
+		{"float", proto.Value{WireType: proto.WireFixed32, Fixed32: math.Float32bits(1.5)}, float32(1.5)},
+		{"float", proto.Value{WireType: proto.WireFixed64, Fixed64: math.Float64bits(2.5)}, float64(2.5)},
+		{"bool", proto.Value{WireType: proto.WireVarint, Varint: 1}, true},
+		{"string", proto.Value{WireType: proto.WireBytes, Bytes: []byte("idle")}, "idle"},
+		{"bytes", proto.Value{WireType: proto.WireBytes, Bytes: []byte{0xff}}, []byte{0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scalar, func(t *testing.T) {
+			got, err := decodeScalar(tt.scalar, tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeScalar_Mismatch(t *testing.T) {
+	tests := []struct {
+		scalar string
+		value  proto.Value
+	}{
+		{"sint32", proto.Value{WireType: proto.WireFixed32}},
+		{"fixed32", proto.Value{WireType: proto.WireVarint}},
+		{"double", proto.Value{WireType: proto.WireVarint}},
+		{"string", proto.Value{WireType: proto.WireBytes, Bytes: []byte{0xff, 0xfe}}},
+		{"bool", proto.Value{WireType: proto.WireBytes}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scalar, func(t *testing.T) {
+			if _, err := decodeScalar(tt.scalar, tt.value); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSchemaValue_Repeated(t *testing.T) {
+	// Packed sint32 [-1, 2] followed by an unpacked element 3
+	var packed []byte
+	packed = binary.AppendUvarint(packed, 1)
+	packed = binary.AppendUvarint(packed, 4)
+	fields := []proto.Field{
+		{Num: measurementFieldPacked, Value: proto.Value{WireType: proto.WireBytes, Bytes: packed}},
+		{Num: measurementFieldPacked, Value: proto.Value{WireType: proto.WireVarint, Varint: 6}},
+	}
+
+	got, err := schemaValue(MeasurementMeta{Type: "repeated sint32"}, fields)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []float64{-1, 2, 3}) {
+		t.Errorf("unexpected values: %v", got)
+	}
+
+	if _, err := schemaValue(MeasurementMeta{Type: "repeated fixed32"}, []proto.Field{
+		{Value: proto.Value{WireType: proto.WireBytes, Bytes: []byte{1, 2, 3}}},
+	}); err == nil {
+		t.Error("expected error for truncated packed fixed32")
+	}
+}
+
+// encodeRawMeasurement hand-encodes a Measurement with a single raw value field
+func encodeRawMeasurement(id, fieldNum uint32, wt proto.WireType, payload []byte) []byte {
+	var msg []byte
+	msg = binary.AppendUvarint(msg, uint64(measurementFieldID)<<3)
+	msg = binary.AppendUvarint(msg, uint64(id))
+	msg = binary.AppendUvarint(msg, uint64(fieldNum)<<3|uint64(wt))
+	if wt == proto.WireBytes {
+		msg = binary.AppendUvarint(msg, uint64(len(payload)))
+	}
+	msg = append(msg, payload...)
+	return appendBytesField(nil, batchFieldMeasurements, msg)
+}
+
+func newSchemaDecodeHandlers(t *testing.T) (*Handlers, *MockTelemetryStore) {
+	t.Helper()
+	h, telemetry := newProtoTestHandlers(t)
+	h.schemaStore.Save(context.Background(), "measurement-probe", "1.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"offset": {ID: 1, Name: "offset", Type: "sint32"},
+			"state":  {ID: 2, Name: "state", Type: "string"},
+		},
+	})
+	return h, telemetry
+}
+
+func TestHandleTelemetryProto_SchemaTypes(t *testing.T) {
+	h, telemetry := newSchemaDecodeHandlers(t)
+
+	body := encodeRawMeasurement(1, measurementFieldInt32, proto.WireVarint, binary.AppendUvarint(nil, 5)) // zigzag(-3)
+	body = append(body, encodeRawMeasurement(2, measurementFieldString, proto.WireBytes, []byte("heating"))...)
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	for _, d := range telemetry.data {
+		switch d.Type {
+		case "offset":
+			if d.IntValue == nil || *d.IntValue != -3 {
+				t.Errorf("expected zigzag-decoded -3, got %+v", d)
+			}
+		case "state":
+			if d.StringValue == nil || *d.StringValue != "heating" {
+				t.Errorf("expected string value, got %+v", d)
+			}
+		}
+	}
+	if len(telemetry.data) != 2 {
+		t.Errorf("expected 2 stored readings, got %d", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_SchemaTypeMismatch(t *testing.T) {
+	h, telemetry := newSchemaDecodeHandlers(t)
+
+	// sint32 sent as a double
+	body := encodeRawMeasurement(1, measurementFieldDouble, proto.WireFixed64, binary.LittleEndian.AppendUint64(nil, math.Float64bits(1)))
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "schema type sint32 expects varint encoding, got fixed64") {
+		t.Errorf("expected a clear mismatch error, got %s", w.Body.String())
+	}
+	if len(telemetry.data) != 0 {
+		t.Errorf("expected nothing stored, got %d", len(telemetry.data))
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+// DefaultMeasurementMessage is the message whose fields define the measurements of a
+// FileDescriptorSet upload when no ?message= is given
+const DefaultMeasurementMessage = "Measurements"
+
+// nestedIDMultiplier scales the parent ID of a nested field: field 21 of the message in
+// field 3 has measurement ID 3021, so nested fields must be numbered below 1000
+const nestedIDMultiplier = 1000
+
+// isDescriptorUpload reports whether a schema upload carries a serialized FileDescriptorSet
+func isDescriptorUpload(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case ProtobufContentType, "application/vnd.google.protobuf":
+		return true
+	default:
+		return false
+	}
+}
+
+// schemaFromDescriptorSet derives measurements from a serialized FileDescriptorSet.
+// Each scalar or enum field of the measurement message becomes a measurement whose ID is
+// the field number, which is what devices send on the wire. Fields of nested messages are
+// flattened into "parent_child" measurements with IDs parent*1000+child.
+// Units cannot be expressed in a descriptor and are left empty.
+func schemaFromDescriptorSet(data []byte, messageName string) (map[string]MeasurementMeta, error) {
+	set, err := proto.ParseFileDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := findMeasurementMessage(set, messageName)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements, err := measurementFields(set, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("message %s has no measurement fields", msg.FullName)
+	}
+	return measurements, nil
+}
+
+// findMeasurementMessage resolves the measurement message by full name, or by the
+// default short name when it is unambiguous
+func findMeasurementMessage(set *proto.DescriptorSet, messageName string) (*proto.MessageDescriptor, error) {
+	if messageName != "" {
+		msg := set.Message(messageName)
+		if msg == nil {
+			return nil, fmt.Errorf("message %q not found in descriptor set", messageName)
+		}
+		return msg, nil
+	}
+
+	var candidates []string
+	var found *proto.MessageDescriptor
+	for _, msg := range set.Messages() {
+		if msg.Name == DefaultMeasurementMessage {
+			found = msg
+			candidates = append(candidates, msg.FullName)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no %s message in descriptor set: pass ?message= with the full message name", DefaultMeasurementMessage)
+	case 1:
+		return found, nil
+	default:
+		sort.Strings(candidates)
+		return nil, fmt.Errorf("ambiguous %s message (%s): pass ?message= with the full message name", DefaultMeasurementMessage, strings.Join(candidates, ", "))
+	}
+}
+
+// measurementFields converts the fields of msg to measurements keyed by field name
+func measurementFields(set *proto.DescriptorSet, msg *proto.MessageDescriptor) (map[string]MeasurementMeta, error) {
+	measurements := make(map[string]MeasurementMeta, len(msg.Fields))
+	byID := make(map[uint32]string, len(msg.Fields))
+	if err := flattenMessage(set, msg, "", 0, measurements, byID); err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+// flattenMessage adds the leaf fields of msg to measurements, recursing into nested
+// messages; prefix and parentID identify the field that holds msg (empty and 0 at the top).
+// IDs grow by a factor of 1000 per level, which also bounds recursive message types.
+func flattenMessage(set *proto.DescriptorSet, msg *proto.MessageDescriptor, prefix string, parentID uint32,
+	measurements map[string]MeasurementMeta, byID map[uint32]string) error {
+	for _, f := range msg.Fields {
+		name := prefix + f.Name
+		repeated := f.Label == proto.LabelRepeated
+
+		id := uint64(f.Number)
+		if parentID != 0 {
+			if f.Number >= nestedIDMultiplier {
+				return fmt.Errorf("field %s: nested fields must be numbered below %d", name, nestedIDMultiplier)
+			}
+			id += uint64(parentID) * nestedIDMultiplier
+		}
+		if id > math.MaxUint32 {
+			return fmt.Errorf("field %s: measurement ID overflows, messages are nested too deeply", name)
+		}
+		meta := MeasurementMeta{ID: uint32(id), Name: name}
+
+		switch f.Type {
+		case proto.TypeMessage:
+			if repeated {
+				return fmt.Errorf("field %s: repeated messages are not supported", name)
+			}
+			nested := set.Message(f.TypeName)
+			if nested == nil {
+				return fmt.Errorf("field %s: unknown message type %s", name, f.TypeName)
+			}
+			if err := flattenMessage(set, nested, name+"_", meta.ID, measurements, byID); err != nil {
+				return err
+			}
+			continue
+
+		case proto.TypeGroup:
+			return fmt.Errorf("field %s: groups are not supported", name)
+
+		case proto.TypeEnum:
+			enum := set.Enum(f.TypeName)
+			if enum == nil {
+				return fmt.Errorf("field %s: unknown enum type %s", name, f.TypeName)
+			}
+			meta.Type = "enum"
+			meta.Enum = make(map[string]int32, len(enum.Values))
+			for _, v := range enum.Values {
+				meta.Enum[v.Name] = v.Number
+			}
+
+		case proto.TypeString, proto.TypeBytes:
+			if repeated {
+				return fmt.Errorf("field %s: repeated %s is not supported", name, f.Type)
+			}
+			meta.Type = f.Type.String()
+
+		default:
+			meta.Type = f.Type.String()
+		}
+
+		if repeated {
+			meta.Type = repeatedPrefix + meta.Type
+		}
+		if other, ok := byID[meta.ID]; ok {
+			return fmt.Errorf("fields %s and %s share measurement ID %d", other, name, meta.ID)
+		}
+		if _, ok := measurements[name]; ok {
+			return fmt.Errorf("field %s: name collides with a flattened nested field", name)
+		}
+		byID[meta.ID] = name
+		measurements[name] = meta
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+// Helpers to hand-encode a FileDescriptorSet (google/protobuf/descriptor.proto field numbers)
+func descBytes(num uint32, data []byte) []byte {
+	return appendBytesField(nil, num, data)
+}
+
+func descVarint(num uint32, v uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func descField(name string, number int32, label proto.FieldLabel, typ proto.FieldType, typeName string) []byte {
+	b := descBytes(1, []byte(name))
+	b = append(b, descVarint(3, uint64(number))...)
+	b = append(b, descVarint(4, uint64(label))...)
+	b = append(b, descVarint(5, uint64(typ))...)
+	if typeName != "" {
+		b = append(b, descBytes(6, []byte(typeName))...)
+	}
+	return descBytes(2, b) // DescriptorProto.field
+}
+
+// testDescriptorSet describes:
+//
+//	package probe.v1;
+//	enum Mode { OFF = 0; HEAT = 1; }
+//	message Measurements {
+//	  message Env { uint64 energy_wh = 20; string state = 21; }
+//	  float temperature = 1;
+//	  uint64 energy_wh = 2;
+//	  Env env = 3;
+//	  Mode mode = 10;
+//	  repeated sint32 samples = 11;
+//	}
+func testDescriptorSet(extraFields ...[]byte) []byte {
+	env := descBytes(1, []byte("Env"))
+	env = append(env, descField("energy_wh", 20, proto.LabelOptional, proto.TypeUint64, "")...)
+	env = append(env, descField("state", 21, proto.LabelOptional, proto.TypeString, "")...)
+
+	msg := descBytes(1, []byte("Measurements"))
+	msg = append(msg, descField("temperature", 1, proto.LabelOptional, proto.TypeFloat, "")...)
+	msg = append(msg, descField("energy_wh", 2, proto.LabelOptional, proto.TypeUint64, "")...)
+	msg = append(msg, descField("env", 3, proto.LabelOptional, proto.TypeMessage, ".probe.v1.Measurements.Env")...)
+	msg = append(msg, descField("mode", 10, proto.LabelOptional, proto.TypeEnum, ".probe.v1.Mode")...)
+	msg = append(msg, descField("samples", 11, proto.LabelRepeated, proto.TypeSint32, "")...)
+	for _, f := range extraFields {
+		msg = append(msg, f...)
+	}
+	msg = append(msg, descBytes(3, env)...) // nested_type
+
+	off := append(descBytes(1, []byte("OFF")), descVarint(2, 0)...)
+	heat := append(descBytes(1, []byte("HEAT")), descVarint(2, 1)...)
+	enum := append(descBytes(1, []byte("Mode")), descBytes(2, off)...)
+	enum = append(enum, descBytes(2, heat)...)
+
+	file := descBytes(1, []byte("probe.proto"))
+	file = append(file, descBytes(2, []byte("probe.v1"))...)
+	file = append(file, descBytes(4, msg)...)
+	file = append(file, descBytes(5, enum)...)
+	return descBytes(1, file)
+}
+
+func TestSchemaFromDescriptorSet(t *testing.T) {
+	measurements, err := schemaFromDescriptorSet(testDescriptorSet(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]MeasurementMeta{
+		"temperature":   {ID: 1, Name: "temperature", Type: "float"},
+		"energy_wh":     {ID: 2, Name: "energy_wh", Type: "uint64"},
+		"env_energy_wh": {ID: 3020, Name: "env_energy_wh", Type: "uint64"},
+		"env_state":     {ID: 3021, Name: "env_state", Type: "string"},
+		"mode":          {ID: 10, Name: "mode", Type: "enum"},
+		"samples":       {ID: 11, Name: "samples", Type: "repeated sint32"},
+	}
+	if len(measurements) != len(want) {
+		t.Fatalf("expected %d measurements, got %v", len(want), measurements)
+	}
+	for name, w := range want {
+		got := measurements[name]
+		if got.ID != w.ID || got.Name != w.Name || got.Type != w.Type {
+			t.Errorf("%s: expected %+v, got %+v", name, w, got)
+		}
+	}
+	if mode := measurements["mode"]; mode.Enum["HEAT"] != 1 || len(mode.Enum) != 2 {
+		t.Errorf("expected enum values, got %v", mode.Enum)
+	}
+}
+
+func TestSchemaFromDescriptorSet_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		message string
+		errText string
+	}{
+		{"not a descriptor", []byte{0xff}, "", "failed to decode"},
+		{"unknown message", testDescriptorSet(), "probe.v1.Missing", "not found"},
+		{"duplicate ID", testDescriptorSet(descField("pressure", 10, proto.LabelOptional, proto.TypeFloat, "")), "", "share measurement ID 10"},
+		{"nested ID collision", testDescriptorSet(descField("pressure", 3020, proto.LabelOptional, proto.TypeFloat, "")), "", "share measurement ID 3020"},
+		{"repeated message", testDescriptorSet(descField("envs", 4, proto.LabelRepeated, proto.TypeMessage, ".probe.v1.Measurements.Env")), "", "repeated messages"},
+		{"recursive message", testDescriptorSet(descField("self", 5, proto.LabelOptional, proto.TypeMessage, ".probe.v1.Measurements")), "", "nested too deeply"},
+		{"repeated string", testDescriptorSet(descField("tags", 30, proto.LabelRepeated, proto.TypeString, "")), "", "repeated string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schemaFromDescriptorSet(tt.data, tt.message)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("expected error containing %q, got %v", tt.errText, err)
+			}
+		})
+	}
+}
+
+func TestUploadSchema_DescriptorSet(t *testing.T) {
+	mockStore := NewMockSchemaStore()
+	h := NewWithStores(nil, nil, nil, mockStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/schemas/test-app/1.0.0?message=probe.v1.Measurements", bytes.NewReader(testDescriptorSet()))
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.0.0")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+
+	h.UploadSchema(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	schema, err := mockStore.Get(context.Background(), "test-app", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Measurements) != 6 || schema.Measurements["env_state"].ID != 3021 || schema.Measurements["energy_wh"].Type != "uint64" {
+		t.Errorf("unexpected schema: %+v", schema.Measurements)
+	}
+}
+
+func TestUploadSchema_InvalidDescriptorSet(t *testing.T) {
+	h := NewWithStores(nil, nil, nil, NewMockSchemaStore(), nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/schemas/test-app/1.0.0", bytes.NewReader([]byte{0xff}))
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.0.0")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+
+	h.UploadSchema(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "invalid descriptor set") {
+		t.Errorf("expected descriptor error, got %s", w.Body.String())
+	}
+}
+
+func TestUploadSchema_OctetStreamIsNotDescriptor(t *testing.T) {
+	mockStore := NewMockSchemaStore()
+	h := NewWithStores(nil, nil, nil, mockStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/schemas/test-app/1.0.0", bytes.NewReader(testDescriptorSet()))
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.0.0")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w := httptest.NewRecorder()
+
+	h.UploadSchema(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if _, err := mockStore.Get(context.Background(), "test-app", "1.0.0"); err == nil {
+		t.Error("expected no schema to be stored")
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/semver"
+)
+
+// resolveSchema finds the schema that decodes telemetry from firmware appName@version:
+//  1. the schema uploaded for exactly that version
+//  2. otherwise the highest version whose declared version_range contains it
+//  3. otherwise the nearest lower version with the same major version (same minor for 0.x)
+//
+// Only a missing exact version falls back; other store errors are returned as is.
+// The exact-version error is returned when nothing matches.
+func resolveSchema(ctx context.Context, store SchemaStore, appName, version string) (*MeasurementSchema, error) {
+	schema, getErr := store.Get(ctx, appName, version)
+	if getErr == nil {
+		return schema, nil
+	}
+	if !errors.Is(getErr, ErrNotFound) {
+		return nil, getErr
+	}
+
+	target, err := semver.Parse(version)
+	if err != nil {
+		return nil, getErr // Unversioned firmware only matches exactly
+	}
+	versions, err := store.ListVersions(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+	if s := selectFallbackSchema(versions, target); s != nil {
+		return s, nil
+	}
+	return nil, getErr
+}
+
+// selectFallbackSchema applies steps 2 and 3 of resolveSchema to an app's schemas
+func selectFallbackSchema(schemas []MeasurementSchema, target semver.Version) *MeasurementSchema {
+	var inRange, lower *MeasurementSchema
+	var inRangeVersion, lowerVersion semver.Version
+	for i := range schemas {
+		s := &schemas[i]
+		v, err := semver.Parse(s.Version)
+		if err != nil {
+			continue
+		}
+
+		if s.VersionRange != "" {
+			if r, err := semver.ParseRange(s.VersionRange); err == nil && r.Contains(target) &&
+				(inRange == nil || v.Compare(inRangeVersion) > 0) {
+				inRange, inRangeVersion = s, v
+			}
+		}
+		if v.Compare(target) < 0 && sameCompatLine(v, target) &&
+			(lower == nil || v.Compare(lowerVersion) > 0) {
+			lower, lowerVersion = s, v
+		}
+	}
+
+	if inRange != nil {
+		return inRange
+	}
+	return lower
+}
+
+// sameCompatLine reports whether two versions are expected to share a measurement
+// layout: same major, and for 0.x (where minor releases may break) the same minor
+func sameCompatLine(a, b semver.Version) bool {
+	if a.Major != b.Major {
+		return false
+	}
+	return a.Major != 0 || a.Minor == b.Minor
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func saveSchemaVersion(t *testing.T, store SchemaStore, version, versionRange string) {
+	t.Helper()
+	err := store.Save(context.Background(), "test-app", version, &MeasurementSchema{
+		AppName:      "test-app",
+		Version:      version,
+		VersionRange: versionRange,
+		Measurements: map[string]MeasurementMeta{
+			"temperature": {ID: 1, Name: "temperature", Type: "float"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaCache_Resolve(t *testing.T) {
+	store := NewMockSchemaStore()
+	saveSchemaVersion(t, store, "0.9.0", "")
+	saveSchemaVersion(t, store, "1.2.0", "")
+	saveSchemaVersion(t, store, "1.4.0", ">=1.4.0 <1.6.0")
+	saveSchemaVersion(t, store, "1.5.0", "")
+	saveSchemaVersion(t, store, "2.0.0", "")
+	cache := NewSchemaCache(store, time.Hour)
+
+	tests := []struct {
+		version string
+		want    string // "" = not found
+	}{
+		{"1.2.0", "1.2.0"}, // Exact
+		{"1.3.7", "1.2.0"}, // Nearest lower in the same major
+		{"1.5.3", "1.4.0"}, // Declared range wins over the nearer 1.5.0
+		{"1.7.0", "1.5.0"}, // Outside the range, nearest lower
+		{"1.0.0", ""},      // Nothing lower in major 1
+		{"2.1.0", "2.0.0"}, // Nearest lower
+		{"0.10.0", ""},     // 0.x minors are not compatible
+		{"0.9.4", "0.9.0"}, // Same 0.x minor
+		{"nightly", ""},    // Unversioned firmware only matches exactly
+		{"3.0.0-rc.1", ""}, // A new major, even as a prerelease
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			schema, err := cache.Get(context.Background(), "test-app", tt.version)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected not found, resolved %s", schema.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if schema.Version != tt.want {
+				t.Errorf("resolved %s, want %s", schema.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCache_SaveInvalidatesFallbacks(t *testing.T) {
+	store := NewMockSchemaStore()
+	saveSchemaVersion(t, store, "1.2.0", "")
+	cache := NewSchemaCache(store, time.Hour)
+
+	if s, err := cache.Get(context.Background(), "test-app", "1.2.5"); err != nil || s.Version != "1.2.0" {
+		t.Fatalf("expected fallback to 1.2.0, got %v (%v)", s, err)
+	}
+
+	// A closer upload replaces the cached fallback
+	saveSchemaVersion(t, cache, "1.2.3", "")
+	if s, err := cache.Get(context.Background(), "test-app", "1.2.5"); err != nil || s.Version != "1.2.3" {
+		t.Fatalf("expected fallback to 1.2.3 after upload, got %v (%v)", s, err)
+	}
+
+	// Deleting it falls back further again
+	if err := cache.Delete(context.Background(), "test-app", "1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := cache.Get(context.Background(), "test-app", "1.2.5"); err != nil || s.Version != "1.2.0" {
+		t.Fatalf("expected fallback to 1.2.0 after delete, got %v (%v)", s, err)
+	}
+}
+
+func TestSchemaCache_ResolveListError(t *testing.T) {
+	store := NewMockSchemaStore()
+	store.ListErr = errors.New("firestore unavailable")
+	cache := NewSchemaCache(store, time.Hour)
+
+	if _, err := cache.Get(context.Background(), "test-app", "1.0.0"); !errors.Is(err, store.ListErr) {
+		t.Errorf("expected list error, got %v", err)
+	}
+}
+
+func TestSchemaCache_ResolveGetError(t *testing.T) {
+	store := NewMockSchemaStore()
+	saveSchemaVersion(t, store, "1.0.0", "")
+	store.GetErr = errors.New("firestore unavailable")
+	cache := NewSchemaCache(store, time.Hour)
+
+	// A failed lookup is not a missing schema: no fallback to 1.0.0
+	if s, err := cache.Get(context.Background(), "test-app", "1.0.1"); !errors.Is(err, store.GetErr) {
+		t.Errorf("expected get error, got %v (%v)", s, err)
+	}
+}
+
+func TestUploadSchema_VersionRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		query      string
+		body       string
+		wantStatus int
+		wantRange  string
+	}{
+		{"json", "1.4.0", "", `{"version_range": ">=1.4 <2.0.0", "measurements": {"temp": {"id": 1, "type": "float"}}}`, http.StatusCreated, ">=1.4.0 <2.0.0"},
+		{"query", "1.4.0", "?version_range=%3E%3D1.4.0", `{"measurements": {"temp": {"id": 1, "type": "float"}}}`, http.StatusCreated, ">=1.4.0"},
+		{"invalid", "1.4.0", "", `{"version_range": "^1.4.0", "measurements": {"temp": {"id": 1, "type": "float"}}}`, http.StatusBadRequest, ""},
+		{"excludes version", "1.4.0", "", `{"version_range": ">=1.5.0", "measurements": {"temp": {"id": 1, "type": "float"}}}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockSchemaStore()
+			h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+			w := uploadSchema(h, tt.version, tt.query, tt.body)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			schema, err := store.Get(context.Background(), "test-app", tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if schema.VersionRange != tt.wantRange {
+				t.Errorf("stored range %q, want %q", schema.VersionRange, tt.wantRange)
+			}
+		})
+	}
+}
@@ -3,16 +3,20 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/semver"
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
 )
 
 // SchemaUploadRequest is the request body for schema upload
 type SchemaUploadRequest struct {
 	Measurements map[string]MeasurementMeta `json:"measurements"`
+	VersionRange string                     `json:"version_range,omitempty"` // Optional, must include the uploaded version
 }
 
 // UploadSchema handles POST /schemas/{app}/{version}
@@ -33,12 +37,52 @@ func (h *Handlers) UploadSchema(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Compatibility with previous versions: ?compat= overrides the configured mode
+	compat := r.URL.Query().Get("compat")
+	if compat == "" {
+		compat = h.config.SchemaCompat
+	}
+	compatMode, err := ParseSchemaCompatMode(compat)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Schemas are a JSON measurement map, or the firmware's compiled FileDescriptorSet
 	var req SchemaUploadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if isDescriptorUpload(r) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.jsonError(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		req.Measurements, err = schemaFromDescriptorSet(data, r.URL.Query().Get("message"))
+		if err != nil {
+			h.jsonError(w, fmt.Sprintf("invalid descriptor set: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.jsonError(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if q := r.URL.Query().Get("version_range"); q != "" {
+		req.VersionRange = q
+	}
+	if req.VersionRange != "" {
+		rng, err := semver.ParseRange(req.VersionRange)
+		if err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v, err := semver.Parse(version)
+		if err != nil || !rng.Contains(v) {
+			h.jsonError(w, fmt.Sprintf("version_range %q must include version %s", req.VersionRange, version), http.StatusBadRequest)
+			return
+		}
+		req.VersionRange = rng.String()
+	}
+
 	if len(req.Measurements) == 0 {
 		h.jsonError(w, "measurements are required", http.StatusBadRequest)
 		return
@@ -57,10 +101,47 @@ func (h *Handlers) UploadSchema(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var report *SchemaCompatReport
+	prev, err := h.latestSchema(ctx, appName)
+	if err != nil {
+		h.logger.Error("failed to load previous schema versions",
+			"request_id", reqID,
+			"error", err,
+			"app", appName,
+		)
+		h.jsonError(w, "failed to check schema compatibility", http.StatusInternalServerError)
+		return
+	}
+	if prev != nil {
+		issues := checkSchemaCompat(prev.Measurements, req.Measurements)
+		report = &SchemaCompatReport{
+			Mode:           compatMode,
+			AgainstVersion: prev.Version,
+			Compatible:     compatible(compatMode, issues),
+			Issues:         issues,
+		}
+		if !report.Compatible {
+			h.logger.Warn("schema upload rejected as incompatible",
+				"request_id", reqID,
+				"app", appName,
+				"version", version,
+				"against_version", prev.Version,
+				"mode", compatMode,
+				"issues", len(issues),
+			)
+			h.jsonResponse(w, map[string]interface{}{
+				"error":         fmt.Sprintf("schema is not %s compatible with version %s", compatMode, prev.Version),
+				"compatibility": report,
+			}, http.StatusConflict)
+			return
+		}
+	}
+
 	schema := &MeasurementSchema{
 		AppName:      appName,
 		Version:      version,
 		Measurements: req.Measurements,
+		VersionRange: req.VersionRange,
 		CreatedAt:    time.Now().UTC(),
 	}
 
@@ -82,16 +163,21 @@ func (h *Handlers) UploadSchema(w http.ResponseWriter, r *http.Request) {
 		"measurements", len(req.Measurements),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]interface{}{
 		"message": "schema uploaded successfully",
 		"app":     appName,
 		"version": version,
-	})
+	}
+	if report != nil {
+		response["compatibility"] = report
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
 }
 
 // GetSchema handles GET /schemas/{app}/{version}
+// Returns the schema the version resolves to, which may be a fallback (see resolveSchema)
 func (h *Handlers) GetSchema(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	reqID := middleware.GetRequestID(ctx)
@@ -124,3 +210,154 @@ func (h *Handlers) GetSchema(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(schema)
 }
+
+// SchemaAppSummary describes the uploaded schema versions of one app
+type SchemaAppSummary struct {
+	AppName       string    `json:"app_name"`
+	Versions      int       `json:"versions"`
+	LatestVersion string    `json:"latest_version"` // Highest semantic version
+	UpdatedAt     time.Time `json:"updated_at"`     // Most recent upload
+}
+
+// SchemaVersionSummary describes one uploaded schema version
+type SchemaVersionSummary struct {
+	Version      string    `json:"version"`
+	Measurements int       `json:"measurements"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ListSchemaApps handles GET /admin/schemas - lists apps with uploaded schemas
+func (h *Handlers) ListSchemaApps(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	schemas, err := h.schemaStore.List(ctx)
+	if err != nil {
+		h.logger.Error("failed to list schemas",
+			"request_id", reqID,
+			"error", err,
+		)
+		h.jsonError(w, "failed to list schemas", http.StatusInternalServerError)
+		return
+	}
+
+	byApp := make(map[string]*SchemaAppSummary)
+	for _, s := range schemas {
+		app, ok := byApp[s.AppName]
+		if !ok {
+			app = &SchemaAppSummary{AppName: s.AppName}
+			byApp[s.AppName] = app
+		}
+		app.Versions++
+		if app.LatestVersion == "" || semver.CompareStrings(s.Version, app.LatestVersion) > 0 {
+			app.LatestVersion = s.Version
+		}
+		if s.CreatedAt.After(app.UpdatedAt) {
+			app.UpdatedAt = s.CreatedAt
+		}
+	}
+
+	apps := make([]SchemaAppSummary, 0, len(byApp))
+	for _, app := range byApp {
+		apps = append(apps, *app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].AppName < apps[j].AppName })
+
+	h.jsonResponse(w, map[string]interface{}{
+		"apps":  apps,
+		"count": len(apps),
+	}, http.StatusOK)
+}
+
+// ListSchemaVersions handles GET /admin/schemas/{app} - version history of an app,
+// ordered by semantic version (oldest first)
+func (h *Handlers) ListSchemaVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	appName := r.PathValue("app")
+	if err := validate.Identifier(appName); err != nil {
+		h.jsonError(w, fmt.Sprintf("invalid app name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	schemas, err := h.schemaStore.ListVersions(ctx, appName)
+	if err != nil {
+		h.logger.Error("failed to list schema versions",
+			"request_id", reqID,
+			"error", err,
+			"app", appName,
+		)
+		h.jsonError(w, "failed to list schema versions", http.StatusInternalServerError)
+		return
+	}
+	if len(schemas) == 0 {
+		h.jsonError(w, "no schemas found for app", http.StatusNotFound)
+		return
+	}
+
+	versions := make([]SchemaVersionSummary, 0, len(schemas))
+	for _, s := range schemas {
+		versions = append(versions, SchemaVersionSummary{
+			Version:      s.Version,
+			Measurements: len(s.Measurements),
+			CreatedAt:    s.CreatedAt,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.CompareStrings(versions[i].Version, versions[j].Version) < 0
+	})
+
+	h.jsonResponse(w, map[string]interface{}{
+		"app_name": appName,
+		"versions": versions,
+		"count":    len(versions),
+	}, http.StatusOK)
+}
+
+// DeleteSchema handles DELETE /admin/schemas/{app}/{version} - retires a schema version.
+// Devices still reporting the version fall back to another schema like unknown versions
+// (see resolveSchema); their protobuf payloads are quarantined only when none matches.
+func (h *Handlers) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqID := middleware.GetRequestID(ctx)
+
+	appName := r.PathValue("app")
+	version := r.PathValue("version")
+
+	// Validate path parameters (prevent injection)
+	if err := validate.Identifier(appName); err != nil {
+		h.jsonError(w, fmt.Sprintf("invalid app name: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validate.Version(version); err != nil {
+		h.jsonError(w, fmt.Sprintf("invalid version: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Check if schema exists (Firestore deletes of missing documents succeed);
+	// a fallback resolved from another version does not count
+	if schema, err := h.schemaStore.Get(ctx, appName, version); err != nil || schema.Version != version {
+		h.jsonError(w, "schema not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.schemaStore.Delete(ctx, appName, version); err != nil {
+		h.logger.Error("failed to delete schema",
+			"request_id", reqID,
+			"error", err,
+			"app", appName,
+			"version", version,
+		)
+		h.jsonError(w, "failed to delete schema", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("schema deleted",
+		"request_id", reqID,
+		"app", appName,
+		"version", version,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+}
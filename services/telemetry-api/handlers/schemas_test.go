@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestUploadSchema_Success(t *testing.T) {
@@ -250,3 +252,167 @@ func TestUploadSchema_FieldIDZero(t *testing.T) {
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || (len(substr) > 0 && len(s) > 0 && (s[:len(substr)] == substr || contains(s[1:], substr))))
 }
+
+func TestListSchemaApps(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	store.Save(context.Background(), "other-app", "0.1.0", &MeasurementSchema{
+		AppName: "other-app", Version: "0.1.0", CreatedAt: time.Now(),
+	})
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/schemas", nil)
+	w := httptest.NewRecorder()
+	h.ListSchemaApps(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Apps  []SchemaAppSummary `json:"apps"`
+		Count int                `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 2 || len(response.Apps) != 2 {
+		t.Fatalf("expected 2 apps, got %+v", response)
+	}
+	if response.Apps[0].AppName != "other-app" || response.Apps[1].AppName != "test-app" {
+		t.Errorf("expected apps sorted by name, got %+v", response.Apps)
+	}
+	if response.Apps[1].Versions != 2 || response.Apps[1].LatestVersion != "1.10.0" {
+		t.Errorf("expected 2 versions with latest 1.10.0, got %+v", response.Apps[1])
+	}
+}
+
+func TestListSchemaApps_StoreError(t *testing.T) {
+	store := NewMockSchemaStore()
+	store.ListErr = errors.New("database error")
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/schemas", nil)
+	w := httptest.NewRecorder()
+	h.ListSchemaApps(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestListSchemaVersions(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/schemas/test-app", nil)
+	req.SetPathValue("app", "test-app")
+	w := httptest.NewRecorder()
+	h.ListSchemaVersions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Versions []SchemaVersionSummary `json:"versions"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	// Semantic ordering: 1.2.0 before 1.10.0
+	if len(response.Versions) != 2 || response.Versions[0].Version != "1.2.0" || response.Versions[1].Version != "1.10.0" {
+		t.Fatalf("unexpected versions: %+v", response.Versions)
+	}
+	if response.Versions[1].Measurements != 2 {
+		t.Errorf("expected 2 measurements in 1.10.0, got %d", response.Versions[1].Measurements)
+	}
+}
+
+func TestListSchemaVersions_NotFound(t *testing.T) {
+	h := NewWithStores(nil, nil, nil, NewMockSchemaStore(), nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/schemas/unknown-app", nil)
+	req.SetPathValue("app", "unknown-app")
+	w := httptest.NewRecorder()
+	h.ListSchemaVersions(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDeleteSchema_Success(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	cache := NewSchemaCache(store, time.Hour)
+	h := NewWithStores(nil, nil, nil, cache, nil, nil)
+
+	// Warm the cache so deletion has to invalidate it
+	if _, err := cache.Get(context.Background(), "test-app", "1.2.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/schemas/test-app/1.2.0", nil)
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.2.0")
+	w := httptest.NewRecorder()
+	h.DeleteSchema(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if _, err := cache.Get(context.Background(), "test-app", "1.2.0"); err == nil {
+		t.Error("expected deleted schema to be evicted from cache")
+	}
+	if _, err := store.Get(context.Background(), "test-app", "1.10.0"); err != nil {
+		t.Errorf("expected other versions to be kept: %v", err)
+	}
+}
+
+func TestDeleteSchema_NotFound(t *testing.T) {
+	h := NewWithStores(nil, nil, nil, NewMockSchemaStore(), nil, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/schemas/test-app/9.9.9", nil)
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "9.9.9")
+	w := httptest.NewRecorder()
+	h.DeleteSchema(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDeleteSchema_StoreError(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	store.DeleteErr = errors.New("database error")
+	h := NewWithStores(nil, nil, nil, store, nil, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/schemas/test-app/1.2.0", nil)
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.2.0")
+	w := httptest.NewRecorder()
+	h.DeleteSchema(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestDeleteSchema_FallbackIsNotDeleted(t *testing.T) {
+	store := NewMockSchemaStore()
+	seedSchemaVersions(store)
+	h := NewWithStores(nil, nil, nil, NewSchemaCache(store, time.Hour), nil, nil)
+
+	// 1.10.5 resolves to 1.10.0 but has no schema of its own
+	req := httptest.NewRequest(http.MethodDelete, "/admin/schemas/test-app/1.10.5", nil)
+	req.SetPathValue("app", "test-app")
+	req.SetPathValue("version", "1.10.5")
+	w := httptest.NewRecorder()
+	h.DeleteSchema(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -2,21 +2,222 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
 // TelemetryStore defines the interface for telemetry data storage
 type TelemetryStore interface {
 	Save(ctx context.Context, data *TelemetryData) (string, error)
+	// SaveBatch stores readings in bulk and returns one result per reading (index-aligned).
+	// Readings with a preset ID are created under that ID; if it already exists the reading
+	// is reported as a duplicate and left untouched (idempotent retries).
+	// In BatchAtomic mode a failure stores nothing and the error is returned.
+	// In BatchBestEffort mode failed readings get an empty ID and a *BatchWriteError lists them.
+	SaveBatch(ctx context.Context, readings []TelemetryData, mode string) ([]SaveResult, error)
 	GetByDeviceID(ctx context.Context, deviceID string, limit int) ([]TelemetryData, error)
+	// GetByID returns a stored reading (e.g. the original of an idempotent retry)
+	GetByID(ctx context.Context, id string) (*TelemetryData, error)
+	Query(ctx context.Context, deviceID string, q TelemetryQuery) ([]TelemetryData, error)
+	// QueryPage returns one page of Query results starting after the cursor (nil = first page).
+	// The returned cursor is nil when there are no more results.
+	QueryPage(ctx context.Context, deviceID string, q TelemetryQuery, after *PageCursor) ([]TelemetryData, *PageCursor, error)
+	// Purge deletes up to limit readings matching q (oldest first) and returns how many were deleted.
+	// With dryRun nothing is deleted and the number of matching readings is returned.
+	Purge(ctx context.Context, q PurgeQuery, limit int, dryRun bool) (int, error)
+	// DeviceIDs returns the distinct device IDs that have telemetry, including devices
+	// no longer registered, whose readings retention must still purge
+	DeviceIDs(ctx context.Context) ([]string, error)
+}
+
+// Batch write modes for SaveBatch
+const (
+	BatchAtomic     = "atomic"      // All readings are stored or none are
+	BatchBestEffort = "best_effort" // Each reading is stored independently
+)
+
+// MaxAtomicBatchSize is the largest atomic batch (Firestore transaction write limit)
+const MaxAtomicBatchSize = 500
+
+// SaveResult is the outcome of storing one reading of a batch
+type SaveResult struct {
+	ID        string
+	Duplicate bool // A reading with the same ID was already stored
+}
+
+// BatchWriteError reports the readings a best-effort SaveBatch failed to store
+type BatchWriteError struct {
+	Failed map[int]error // Index into the batch -> write error
+}
+
+func (e *BatchWriteError) Error() string {
+	for _, err := range e.Failed {
+		return fmt.Sprintf("%d of the batch writes failed (e.g. %v)", len(e.Failed), err)
+	}
+	return "batch write failed"
+}
+
+// PurgeQuery selects a device's readings older than a retention cutoff
+type PurgeQuery struct {
+	DeviceID     string
+	Types        []string  // Only these measurement types (empty = all types)
+	ExcludeTypes []string  // Skip these measurement types (they have their own retention)
+	Before       time.Time // Exclusive upper bound on timestamp
+}
+
+// validate rejects queries Firestore cannot run: "in" and "not-in" on the same field
+func (q PurgeQuery) validate() error {
+	if len(q.Types) > 0 && len(q.ExcludeTypes) > 0 {
+		return errors.New("purge query: types and exclude types are mutually exclusive")
+	}
+	return nil
+}
+
+// PageCursor identifies the last item of a page (sort key + document ID as tie-breaker)
+type PageCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// Sort orders for telemetry queries
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// TelemetryQuery filters telemetry readings for a device.
+// Results are ordered by the reading's timestamp (not ingestion time).
+type TelemetryQuery struct {
+	From  time.Time // Inclusive lower bound on timestamp (zero = unbounded)
+	To    time.Time // Exclusive upper bound on timestamp (zero = unbounded)
+	Types []string  // Measurement types to include (empty = all types)
+	Order string    // OrderAsc or OrderDesc (default OrderDesc)
+	Limit int
+}
+
+// TelemetryAggregator is implemented by telemetry stores that can compute
+// bucketed aggregates natively. Stores without it are aggregated in-process.
+type TelemetryAggregator interface {
+	// Aggregate returns ErrAggregateUnsupported for queries the store cannot push down
+	Aggregate(ctx context.Context, deviceID string, q AggregateQuery) ([]AggregateSeries, error)
+}
+
+// ErrAggregateUnsupported makes aggregation fall back to rollups or in-process aggregation
+var ErrAggregateUnsupported = errors.New("aggregation not supported by store")
+
+// Aggregation functions for telemetry buckets
+const (
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggSum   = "sum"
+	AggCount = "count"
+	AggLast  = "last"
+)
+
+// AggregateQuery describes a bucketed aggregation over [From, To)
+type AggregateQuery struct {
+	Types  []string // Measurement types to include (empty = all types)
+	From   time.Time
+	To     time.Time
+	Bucket time.Duration // Bucket width; buckets are aligned to multiples of Bucket since the Unix epoch
+	Func   string        // One of the Agg* functions
+}
+
+// AggregateSeries is the bucketed series for one measurement type
+type AggregateSeries struct {
+	Type   string           `json:"type"`
+	Unit   string           `json:"unit,omitempty"`
+	Points []AggregatePoint `json:"points"`
+}
+
+// AggregatePoint is a single bucket; empty buckets are omitted
+type AggregatePoint struct {
+	Time  time.Time `json:"time"` // Bucket start
+	Value float64   `json:"value"`
+	Count int       `json:"count"` // Raw readings in the bucket
+}
+
+// RollupStore maintains pre-computed hourly and daily telemetry summaries
+type RollupStore interface {
+	// Apply folds readings into their hourly and daily rollups
+	Apply(ctx context.Context, readings []TelemetryData) error
+	// Query returns rollups with bucket_start in [from, to), ordered by bucket_start (empty types = all)
+	Query(ctx context.Context, deviceID, period string, types []string, from, to time.Time) ([]Rollup, error)
+	// Replace swaps the rollups of a device/period with bucket_start in [from, to) for the given set
+	Replace(ctx context.Context, deviceID, period string, from, to time.Time, rollups []Rollup) error
+	// Purge deletes up to limit rollups of a period with bucket_start before the cutoff (all devices).
+	// With dryRun nothing is deleted and the number of matching rollups is returned.
+	Purge(ctx context.Context, period string, before time.Time, limit int, dryRun bool) (int, error)
+}
+
+// Rollup periods
+const (
+	RollupHourly = "hour"
+	RollupDaily  = "day"
+)
+
+// Rollup summarizes one measurement type of one device over an hour or a day.
+// Average is derived from Sum/Count so rollups can be merged incrementally.
+type Rollup struct {
+	DeviceID    string    `json:"device_id" firestore:"device_id"`
+	Type        string    `json:"type" firestore:"type"`
+	Period      string    `json:"period" firestore:"period"`
+	BucketStart time.Time `json:"bucket_start" firestore:"bucket_start"`
+	Unit        string    `json:"unit,omitempty" firestore:"unit,omitempty"`
+	Min         float64   `json:"min" firestore:"min"`
+	Max         float64   `json:"max" firestore:"max"`
+	Sum         float64   `json:"sum" firestore:"sum"`
+	Count       int       `json:"count" firestore:"count"`
+	Last        float64   `json:"last" firestore:"last"`
+	LastAt      time.Time `json:"last_at" firestore:"last_at"`
+	UpdatedAt   time.Time `json:"updated_at" firestore:"updated_at"`
 }
 
 // CommandStore defines the interface for command storage
 type CommandStore interface {
 	Save(ctx context.Context, cmd *Command) (string, error)
 	GetByDeviceID(ctx context.Context, deviceID string, status string) ([]Command, error)
+	// GetByDeviceIDPage returns one page of commands (newest first) starting after the cursor
+	GetByDeviceIDPage(ctx context.Context, deviceID string, status string, limit int, after *PageCursor) ([]Command, *PageCursor, error)
 	GetByID(ctx context.Context, id string) (*Command, error)
 	Update(ctx context.Context, id string, updates map[string]interface{}) error
+	// Transition reads a command and applies fn to it atomically. fn reports whether
+	// it changed the command (false = nothing is written) or returns an error to abort.
+	// Returns the command as fn left it, or ErrNotFound.
+	Transition(ctx context.Context, id string, fn func(cmd *Command) (bool, error)) (*Command, error)
+	Delete(ctx context.Context, id string) error
+	// SaveMany stores commands atomically (all or none) and returns their IDs (index-aligned).
+	// At most MaxAtomicBatchSize commands.
+	SaveMany(ctx context.Context, cmds []Command) ([]string, error)
+	// GetByCampaign returns every command created by a bulk request (unordered)
+	GetByCampaign(ctx context.Context, campaignID string) ([]Command, error)
+}
+
+// CommandWatcher is implemented by command stores that can push new pending commands,
+// so long-polling devices on every instance wake up when any instance creates one
+type CommandWatcher interface {
+	// WatchPending calls notify with the device ID of each pending command created after
+	// since, until ctx is cancelled or the watch fails. Notifications may repeat.
+	WatchPending(ctx context.Context, since time.Time, notify func(deviceID string)) error
+}
+
+// CommandScheduleStore defines the interface for recurring command storage
+type CommandScheduleStore interface {
+	Save(ctx context.Context, schedule *CommandSchedule) (string, error)
+	GetByID(ctx context.Context, id string) (*CommandSchedule, error)
+	List(ctx context.Context) ([]CommandSchedule, error)
+	// ListDue returns the schedules whose next run is at or before t
+	ListDue(ctx context.Context, t time.Time) ([]CommandSchedule, error)
+	// Claim atomically moves a schedule's next run from runAt to next and records runAt as
+	// its last run. It returns false (and changes nothing) when the next run is no longer
+	// runAt, e.g. because another instance claimed it first.
+	Claim(ctx context.Context, id string, runAt, next time.Time) (bool, error)
+	// Unclaim gives back a claimed run whose commands could not be created: it moves the
+	// next run from next back to runAt, unless the schedule changed meanwhile (false).
+	Unclaim(ctx context.Context, id string, runAt, next time.Time) (bool, error)
+	Update(ctx context.Context, id string, updates map[string]interface{}) error
 	Delete(ctx context.Context, id string) error
 }
 
@@ -27,26 +228,78 @@ type EventPublisher interface {
 
 // TelemetryData represents a telemetry reading
 type TelemetryData struct {
-	ID        string                 `json:"id,omitempty" firestore:"-"`
-	DeviceID  string                 `json:"device_id" firestore:"device_id"`
-	Timestamp time.Time              `json:"timestamp" firestore:"timestamp"`
-	Type      string                 `json:"type" firestore:"type"`
-	Value     float64                `json:"value" firestore:"value"`
-	Unit      string                 `json:"unit,omitempty" firestore:"unit,omitempty"`
+	ID        string    `json:"id,omitempty" firestore:"-"`
+	DeviceID  string    `json:"device_id" firestore:"device_id"`
+	Timestamp time.Time `json:"timestamp" firestore:"timestamp"`
+	Type      string    `json:"type" firestore:"type"`
+	Value     float64   `json:"value" firestore:"value"` // Float value, or a float64 approximation of a typed value
+	Unit      string    `json:"unit,omitempty" firestore:"unit,omitempty"`
+
+	// Typed values preserve the native type of a reading (see ValueType* constants).
+	// At most one is set; plain float readings have none and an empty ValueType.
+	ValueType   string    `json:"value_type,omitempty" firestore:"value_type,omitempty"`
+	IntValue    *int64    `json:"int_value,omitempty" firestore:"int_value,omitempty"`
+	UintValue   *uint64   `json:"uint_value,omitempty" firestore:"-"`
+	UintText    string    `json:"-" firestore:"uint_value,omitempty"` // Firestore has no uint64: stored as decimal text
+	BoolValue   *bool     `json:"bool_value,omitempty" firestore:"bool_value,omitempty"`
+	StringValue *string   `json:"string_value,omitempty" firestore:"string_value,omitempty"`
+	BytesValue  []byte    `json:"bytes_value,omitempty" firestore:"bytes_value,omitempty"` // base64 in JSON
+	ListValue   []float64 `json:"list_value,omitempty" firestore:"list_value,omitempty"`   // Repeated numeric values
+
 	Metadata  map[string]interface{} `json:"metadata,omitempty" firestore:"metadata,omitempty"`
+	MsgID     string                 `json:"msg_id,omitempty" firestore:"msg_id,omitempty"` // Client message ID (idempotency)
 	CreatedAt time.Time              `json:"created_at" firestore:"created_at"`
 }
 
 // Command represents a command to be sent to a device
 type Command struct {
-	ID        string                 `json:"id,omitempty" firestore:"-"`
-	DeviceID  string                 `json:"device_id" firestore:"device_id"`
-	Type      string                 `json:"type" firestore:"type"`
-	Payload   map[string]interface{} `json:"payload,omitempty" firestore:"payload,omitempty"`
-	Status    string                 `json:"status" firestore:"status"`
-	CreatedAt time.Time              `json:"created_at" firestore:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at" firestore:"updated_at"`
-	ExpiresAt *time.Time             `json:"expires_at,omitempty" firestore:"expires_at,omitempty"`
+	ID         string                 `json:"id,omitempty" firestore:"-"`
+	DeviceID   string                 `json:"device_id" firestore:"device_id"`
+	Type       string                 `json:"type" firestore:"type"`
+	Payload    map[string]interface{} `json:"payload,omitempty" firestore:"payload,omitempty"`
+	Status     string                 `json:"status" firestore:"status"`
+	CreatedAt  time.Time              `json:"created_at" firestore:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at" firestore:"updated_at"`
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty" firestore:"expires_at,omitempty"`
+	NotBefore  *time.Time             `json:"not_before,omitempty" firestore:"not_before,omitempty"`   // Hidden from the device until then
+	CampaignID string                 `json:"campaign_id,omitempty" firestore:"campaign_id,omitempty"` // Shared by the commands of one POST /admin/commands/bulk
+	ScheduleID string                 `json:"schedule_id,omitempty" firestore:"schedule_id,omitempty"` // Set on commands created by a CommandSchedule
+
+	// Lifecycle (see commandTransitions): when each status was reached and what the device reported
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty" firestore:"acknowledged_at,omitempty"`
+	CompletedAt    *time.Time             `json:"completed_at,omitempty" firestore:"completed_at,omitempty"`
+	FailedAt       *time.Time             `json:"failed_at,omitempty" firestore:"failed_at,omitempty"`
+	Result         map[string]interface{} `json:"result,omitempty" firestore:"result,omitempty"`               // Reported with complete or fail
+	ErrorMessage   string                 `json:"error_message,omitempty" firestore:"error_message,omitempty"` // Reported with fail
+	History        []CommandTransition    `json:"history,omitempty" firestore:"history,omitempty"`
+}
+
+// CommandSchedule creates a command for its target devices on a cron schedule.
+// Each run is a campaign (see POST /admin/commands/bulk) whose commands are due at the run time.
+type CommandSchedule struct {
+	ID           string                 `json:"id,omitempty" firestore:"-"`
+	Name         string                 `json:"name,omitempty" firestore:"name,omitempty"`
+	Cron         string                 `json:"cron" firestore:"cron"`         // 5-field cron expression, e.g. "0 3 * * sun"
+	Timezone     string                 `json:"timezone" firestore:"timezone"` // IANA time zone the expression is evaluated in
+	Type         string                 `json:"type" firestore:"type"`
+	Payload      map[string]interface{} `json:"payload,omitempty" firestore:"payload,omitempty"`
+	ExpiresAfter string                 `json:"expires_after" firestore:"expires_after"` // How long after its run a command expires (Go duration)
+	DeviceIDs    []string               `json:"device_ids,omitempty" firestore:"device_ids,omitempty"`
+	Selector     *DeviceSelector        `json:"selector,omitempty" firestore:"selector,omitempty"` // Resolved at each run
+	CreatedAt    time.Time              `json:"created_at" firestore:"created_at"`
+	NextRunAt    time.Time              `json:"next_run_at" firestore:"next_run_at"`
+
+	// Outcome of the latest run
+	LastRunAt      *time.Time `json:"last_run_at,omitempty" firestore:"last_run_at,omitempty"`
+	LastCampaignID string     `json:"last_campaign_id,omitempty" firestore:"last_campaign_id,omitempty"`
+	LastError      string     `json:"last_error,omitempty" firestore:"last_error,omitempty"`
+}
+
+// CommandTransition records a command status change
+type CommandTransition struct {
+	From string    `json:"from" firestore:"from"`
+	To   string    `json:"to" firestore:"to"`
+	At   time.Time `json:"at" firestore:"at"`
 }
 
 // DeviceStore defines the interface for device storage
@@ -54,15 +307,39 @@ type DeviceStore interface {
 	Register(ctx context.Context, device *Device) error
 	GetByID(ctx context.Context, deviceID string) (*Device, error)
 	GetByMAC(ctx context.Context, macAddress string) (*Device, error) // Check if MAC already registered
+	List(ctx context.Context) ([]Device, error)
 	UpdateLastSeen(ctx context.Context, deviceID string) error
 	UpdateAppInfo(ctx context.Context, deviceID, appName, appVersion string) error // Update firmware info on auth
 	Revoke(ctx context.Context, deviceID string) error
+	UpdateTags(ctx context.Context, deviceID string, tags []string) error // Replaces the device's tags
+}
+
+// DeviceWatcher is implemented by device stores that can push revocations, so every
+// instance ends the command streams of a device revoked on any instance
+type DeviceWatcher interface {
+	// WatchRevoked calls notify with the ID of each revoked device, starting with the
+	// devices already revoked, until ctx is cancelled or the watch fails
+	WatchRevoked(ctx context.Context, notify func(deviceID string)) error
 }
 
 // SchemaStore defines the interface for measurement schema storage
 type SchemaStore interface {
 	Save(ctx context.Context, appName, version string, schema *MeasurementSchema) error
 	Get(ctx context.Context, appName, version string) (*MeasurementSchema, error)
+	// ListVersions returns every schema version uploaded for an app (unordered)
+	ListVersions(ctx context.Context, appName string) ([]MeasurementSchema, error)
+	// List returns every uploaded schema without its measurements (unordered)
+	List(ctx context.Context) ([]MeasurementSchema, error)
+	Delete(ctx context.Context, appName, version string) error
+}
+
+// QuarantineStore persists telemetry payloads that could not be ingested
+type QuarantineStore interface {
+	Save(ctx context.Context, p *QuarantinedPayload) (string, error)
+	GetByID(ctx context.Context, id string) (*QuarantinedPayload, error)
+	// ListPage returns one page of payloads matching q (newest first) starting after the cursor
+	ListPage(ctx context.Context, q QuarantineQuery, limit int, after *PageCursor) ([]QuarantinedPayload, *PageCursor, error)
+	Update(ctx context.Context, id string, updates map[string]interface{}) error
 }
 
 // Device represents a registered IoT device
@@ -75,6 +352,7 @@ type Device struct {
 	Revoked      bool      `json:"revoked" firestore:"revoked"` // true if device access is revoked
 	RegisteredAt time.Time `json:"registered_at" firestore:"registered_at"`
 	LastSeen     time.Time `json:"last_seen" firestore:"last_seen"`
+	Tags         []string  `json:"tags,omitempty" firestore:"tags,omitempty"` // Admin-assigned labels for fleet targeting
 }
 
 // MeasurementSchema defines the schema for measurement interpretation
@@ -82,13 +360,43 @@ type MeasurementSchema struct {
 	AppName      string                     `json:"app_name" firestore:"app_name"`
 	Version      string                     `json:"version" firestore:"version"`
 	Measurements map[string]MeasurementMeta `json:"measurements" firestore:"measurements"`
+	VersionRange string                     `json:"version_range,omitempty" firestore:"version_range,omitempty"` // Other firmware versions this schema decodes, e.g. ">=1.4.0 <2.0.0"
 	CreatedAt    time.Time                  `json:"created_at" firestore:"created_at"`
 }
 
 // MeasurementMeta defines metadata for a measurement type
 type MeasurementMeta struct {
-	ID   uint32 `json:"id" firestore:"id"`
-	Name string `json:"name" firestore:"name"`
-	Type string `json:"type" firestore:"type"`
-	Unit string `json:"unit" firestore:"unit"`
+	ID   uint32           `json:"id" firestore:"id"`
+	Name string           `json:"name" firestore:"name"`
+	Type string           `json:"type" firestore:"type"`
+	Unit string           `json:"unit" firestore:"unit"`
+	Enum map[string]int32 `json:"enum,omitempty" firestore:"enum,omitempty"` // Value names of an "enum" measurement
+}
+
+// QuarantinedPayload is a raw protobuf telemetry upload kept for replay
+type QuarantinedPayload struct {
+	ID             string     `json:"id" firestore:"-"`
+	DeviceID       string     `json:"device_id" firestore:"device_id"`
+	AppName        string     `json:"app_name" firestore:"app_name"`
+	AppVersion     string     `json:"app_version" firestore:"app_version"` // Firmware version at receipt, used for replay
+	Reason         string     `json:"reason" firestore:"reason"`           // Quarantine* reason code
+	Error          string     `json:"error" firestore:"error"`
+	UnknownIDs     []uint32   `json:"unknown_ids,omitempty" firestore:"unknown_ids,omitempty"` // Only these are replayed for QuarantineUnknownMeasurement
+	Payload        []byte     `json:"payload,omitempty" firestore:"payload"`                   // base64 in JSON
+	PayloadSize    int        `json:"payload_size" firestore:"payload_size"`
+	Mode           string     `json:"mode,omitempty" firestore:"mode,omitempty"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty" firestore:"idempotency_key,omitempty"`
+	Status         string     `json:"status" firestore:"status"` // QuarantinePending or QuarantineReplayed
+	ReplayAttempts int        `json:"replay_attempts" firestore:"replay_attempts"`
+	ReceivedAt     time.Time  `json:"received_at" firestore:"received_at"`
+	ReplayedAt     *time.Time `json:"replayed_at,omitempty" firestore:"replayed_at,omitempty"`
+}
+
+// QuarantineQuery filters quarantined payloads (empty fields match everything)
+type QuarantineQuery struct {
+	DeviceID   string
+	AppName    string
+	AppVersion string
+	Reason     string
+	Status     string
 }
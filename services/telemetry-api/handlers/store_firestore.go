@@ -2,9 +2,18 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/google/uuid"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FirestoreTelemetryStore implements TelemetryStore using Firestore
@@ -22,13 +31,134 @@ func NewFirestoreTelemetryStore(client *firestore.Client) *FirestoreTelemetrySto
 }
 
 func (s *FirestoreTelemetryStore) Save(ctx context.Context, data *TelemetryData) (string, error) {
-	docRef, _, err := s.client.Collection(s.collection).Add(ctx, data)
+	docRef, _, err := s.client.Collection(s.collection).Add(ctx, data.firestoreDoc())
 	if err != nil {
 		return "", err
 	}
 	return docRef.ID, nil
 }
 
+func (s *FirestoreTelemetryStore) GetByID(ctx context.Context, id string) (*TelemetryData, error) {
+	doc, err := s.client.Collection(s.collection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var data TelemetryData
+	if err := doc.DataTo(&data); err != nil {
+		return nil, err
+	}
+	if err := data.decodeUint(); err != nil {
+		return nil, err
+	}
+	data.ID = doc.Ref.ID
+	return &data, nil
+}
+
+func (s *FirestoreTelemetryStore) SaveBatch(ctx context.Context, readings []TelemetryData, mode string) ([]SaveResult, error) {
+	// Allocate IDs client-side so results line up with the input
+	refs := make([]*firestore.DocumentRef, len(readings))
+	var preset []int // readings with deterministic (idempotent) IDs
+	for i := range readings {
+		if readings[i].ID != "" {
+			refs[i] = s.client.Collection(s.collection).Doc(readings[i].ID)
+			preset = append(preset, i)
+		} else {
+			refs[i] = s.client.Collection(s.collection).NewDoc()
+		}
+	}
+	presetRefs := make([]*firestore.DocumentRef, len(preset))
+	for k, i := range preset {
+		presetRefs[k] = refs[i]
+	}
+
+	results := make([]SaveResult, len(readings))
+	markDuplicates := func(docs []*firestore.DocumentSnapshot) {
+		for k, doc := range docs {
+			results[preset[k]].Duplicate = doc.Exists()
+		}
+	}
+
+	if mode == BatchAtomic {
+		if len(readings) > MaxAtomicBatchSize {
+			return nil, fmt.Errorf("atomic batch too large: %d readings (maximum %d)", len(readings), MaxAtomicBatchSize)
+		}
+		err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			if len(presetRefs) > 0 {
+				docs, err := tx.GetAll(presetRefs)
+				if err != nil {
+					return err
+				}
+				markDuplicates(docs)
+			}
+			for i := range readings {
+				if results[i].Duplicate {
+					continue
+				}
+				if err := tx.Create(refs[i], readings[i].firestoreDoc()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range results {
+			results[i].ID = refs[i].ID
+		}
+		return results, nil
+	}
+
+	if len(presetRefs) > 0 {
+		docs, err := s.client.GetAll(ctx, presetRefs)
+		if err != nil {
+			return nil, err
+		}
+		markDuplicates(docs)
+	}
+
+	// Best effort: BulkWriter parallelizes and retries each write independently.
+	// Create (not Set) so a concurrent retry of the same reading fails instead of overwriting.
+	bw := s.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, len(readings))
+	failed := make(map[int]error)
+	for i := range readings {
+		if results[i].Duplicate {
+			continue
+		}
+		job, err := bw.Create(refs[i], readings[i].firestoreDoc())
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		jobs[i] = job
+	}
+	bw.End()
+
+	for i, job := range jobs {
+		if job == nil {
+			continue
+		}
+		if _, err := job.Results(); err != nil {
+			if status.Code(err) == codes.AlreadyExists {
+				// A concurrent retry of the same reading won the race
+				results[i].Duplicate = true
+				continue
+			}
+			failed[i] = err
+		}
+	}
+	for i := range results {
+		if failed[i] == nil {
+			results[i].ID = refs[i].ID
+		}
+	}
+	if len(failed) > 0 {
+		return results, &BatchWriteError{Failed: failed}
+	}
+	return results, nil
+}
+
 func (s *FirestoreTelemetryStore) GetByDeviceID(ctx context.Context, deviceID string, limit int) ([]TelemetryData, error) {
 	query := s.client.Collection(s.collection).
 		Where("device_id", "==", deviceID).
@@ -52,12 +182,452 @@ func (s *FirestoreTelemetryStore) GetByDeviceID(ctx context.Context, deviceID st
 		if err := doc.DataTo(&data); err != nil {
 			return nil, err
 		}
+		if err := data.decodeUint(); err != nil {
+			return nil, err
+		}
+		data.ID = doc.Ref.ID
+		results = append(results, data)
+	}
+	return results, nil
+}
+
+func (s *FirestoreTelemetryStore) Query(ctx context.Context, deviceID string, q TelemetryQuery) ([]TelemetryData, error) {
+	query, _ := s.buildQuery(deviceID, q)
+	return s.collect(query.Limit(q.Limit).Documents(ctx))
+}
+
+func (s *FirestoreTelemetryStore) QueryPage(ctx context.Context, deviceID string, q TelemetryQuery, after *PageCursor) ([]TelemetryData, *PageCursor, error) {
+	query, direction := s.buildQuery(deviceID, q)
+
+	// Document ID breaks ties between readings with identical timestamps
+	query = query.OrderBy(firestore.DocumentID, direction)
+	if after != nil {
+		query = query.StartAfter(after.Time, after.ID)
+	}
+
+	// Fetch one extra document to detect whether another page exists
+	results, err := s.collect(query.Limit(q.Limit + 1).Documents(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(results) <= q.Limit {
+		return results, nil, nil
+	}
+	results = results[:q.Limit]
+	last := results[len(results)-1]
+	return results, &PageCursor{Time: last.Timestamp, ID: last.ID}, nil
+}
+
+// buildQuery applies the device, type and time-window filters, ordered by reading timestamp
+func (s *FirestoreTelemetryStore) buildQuery(deviceID string, q TelemetryQuery) (firestore.Query, firestore.Direction) {
+	query := s.client.Collection(s.collection).Where("device_id", "==", deviceID)
+
+	switch len(q.Types) {
+	case 0:
+	case 1:
+		query = query.Where("type", "==", q.Types[0])
+	default:
+		query = query.Where("type", "in", q.Types)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("timestamp", ">=", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("timestamp", "<", q.To)
+	}
+
+	direction := firestore.Desc
+	if q.Order == OrderAsc {
+		direction = firestore.Asc
+	}
+	return query.OrderBy("timestamp", direction), direction
+}
+
+// collect drains a document iterator into telemetry readings
+func (s *FirestoreTelemetryStore) collect(iter *firestore.DocumentIterator) ([]TelemetryData, error) {
+	defer iter.Stop()
+
+	var results []TelemetryData
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var data TelemetryData
+		if err := doc.DataTo(&data); err != nil {
+			return nil, err
+		}
+		if err := data.decodeUint(); err != nil {
+			return nil, err
+		}
 		data.ID = doc.Ref.ID
 		results = append(results, data)
 	}
 	return results, nil
 }
 
+// aggregatePushdownConcurrency bounds the aggregation queries of one request in flight
+const aggregatePushdownConcurrency = 8
+
+// Aggregate computes count, sum and avg buckets with Firestore aggregation queries, one per
+// type and bucket (see pushdownRanges). Each type's latest reading in range supplies its unit;
+// types whose readings are not numeric (strings, bytes, lists) yield no series.
+func (s *FirestoreTelemetryStore) Aggregate(ctx context.Context, deviceID string, q AggregateQuery) ([]AggregateSeries, error) {
+	ranges, err := pushdownRanges(q)
+	if err != nil {
+		return nil, err
+	}
+
+	types := append([]string(nil), q.Types...)
+	sort.Strings(types)
+
+	series := make([]AggregateSeries, 0, len(types))
+	for _, typ := range types {
+		latest, err := s.collect(s.latestQuery(deviceID, typ, q.From, q.To).Limit(1).Documents(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if len(latest) == 0 || !latest[0].IsNumeric() {
+			continue
+		}
+
+		points, err := s.aggregateBuckets(ctx, deviceID, typ, q.Func, ranges)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, AggregateSeries{Type: typ, Unit: latest[0].Unit, Points: points})
+	}
+	return series, nil
+}
+
+// latestQuery selects one type's readings in [from, to), newest first
+func (s *FirestoreTelemetryStore) latestQuery(deviceID, typ string, from, to time.Time) firestore.Query {
+	query, _ := s.buildQuery(deviceID, TelemetryQuery{From: from, To: to, Types: []string{typ}})
+	return query
+}
+
+// aggregateBuckets runs one aggregation query per bucket and returns the non-empty buckets in time order
+func (s *FirestoreTelemetryStore) aggregateBuckets(ctx context.Context, deviceID, typ, fn string, ranges []aggregateRange) ([]AggregatePoint, error) {
+	points := make([]AggregatePoint, len(ranges))
+	found := make([]bool, len(ranges))
+	errs := make([]error, len(ranges))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, aggregatePushdownConcurrency)
+	for i, r := range ranges {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+
+			query := s.latestQuery(deviceID, typ, r.From, r.To)
+			agg := query.NewAggregationQuery().WithCount("count")
+			switch fn {
+			case AggSum:
+				agg = agg.WithSum("value", "value")
+			case AggAvg:
+				agg = agg.WithAvg("value", "value")
+			}
+			result, err := agg.Get(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			count, _ := aggregationNumber(result["count"])
+			value, _ := aggregationNumber(result["value"])
+			points[i], found[i] = pushdownPoint(fn, r.Start, int(count), value)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	result := make([]AggregatePoint, 0, len(ranges))
+	for i := range points {
+		if found[i] {
+			result = append(result, points[i])
+		}
+	}
+	return result, nil
+}
+
+// aggregationNumber reads a count, sum or avg result (avg over no readings is null)
+func aggregationNumber(v interface{}) (float64, bool) {
+	value, ok := v.(*firestorepb.Value)
+	if !ok {
+		return 0, false
+	}
+	switch n := value.GetValueType().(type) {
+	case *firestorepb.Value_IntegerValue:
+		return float64(n.IntegerValue), true
+	case *firestorepb.Value_DoubleValue:
+		return n.DoubleValue, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *FirestoreTelemetryStore) Purge(ctx context.Context, q PurgeQuery, limit int, dryRun bool) (int, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	query := s.client.Collection(s.collection).Where("device_id", "==", q.DeviceID)
+	switch len(q.Types) {
+	case 0:
+	case 1:
+		query = query.Where("type", "==", q.Types[0])
+	default:
+		query = query.Where("type", "in", q.Types)
+	}
+	if len(q.ExcludeTypes) > 0 {
+		query = query.Where("type", "not-in", q.ExcludeTypes)
+	}
+	query = query.Where("timestamp", "<", q.Before).OrderBy("timestamp", firestore.Asc)
+
+	return purgeDocuments(ctx, s.client, query.Limit(limit), dryRun)
+}
+
+// DeviceIDs walks the distinct device_id values in order, reading one document per device
+func (s *FirestoreTelemetryStore) DeviceIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	for {
+		query := s.client.Collection(s.collection).Select("device_id")
+		if len(ids) > 0 {
+			query = query.Where("device_id", ">", ids[len(ids)-1])
+		}
+		docs, err := query.OrderBy("device_id", firestore.Asc).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) == 0 {
+			return ids, nil
+		}
+		v, err := docs[0].DataAt("device_id")
+		if err != nil {
+			return nil, err
+		}
+		id, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("telemetry %s: device_id is not a string", docs[0].Ref.ID)
+		}
+		ids = append(ids, id)
+	}
+}
+
+// purgeDocuments deletes the documents matched by query in batches of RetentionBatchSize
+// and returns how many were deleted. With dryRun it only counts them.
+func purgeDocuments(ctx context.Context, client *firestore.Client, query firestore.Query, dryRun bool) (int, error) {
+	// Document references are enough to delete (no field data transferred)
+	iter := query.Select().Documents(ctx)
+	defer iter.Stop()
+
+	batch := client.Batch()
+	pending, deleted := 0, 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if dryRun {
+			deleted++
+			continue
+		}
+
+		batch.Delete(doc.Ref)
+		pending++
+		if pending == RetentionBatchSize {
+			if _, err := batch.Commit(ctx); err != nil {
+				return deleted, err
+			}
+			deleted += pending
+			batch = client.Batch()
+			pending = 0
+		}
+	}
+
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return deleted, err
+		}
+		deleted += pending
+	}
+	return deleted, nil
+}
+
+// rollupTxChunk bounds the rollup documents touched per transaction (Firestore allows 500 writes)
+const rollupTxChunk = 250
+
+// FirestoreRollupStore implements RollupStore using Firestore
+type FirestoreRollupStore struct {
+	client     *firestore.Client
+	collection string
+}
+
+// NewFirestoreRollupStore creates a new Firestore-backed rollup store
+func NewFirestoreRollupStore(client *firestore.Client) *FirestoreRollupStore {
+	return &FirestoreRollupStore{
+		client:     client,
+		collection: RollupsCollection,
+	}
+}
+
+func (s *FirestoreRollupStore) Apply(ctx context.Context, readings []TelemetryData) error {
+	partials := buildRollups(readings, rollupPeriods...)
+	keys := make([]string, 0, len(partials))
+	for key := range partials {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for start := 0; start < len(keys); start += rollupTxChunk {
+		chunk := keys[start:min(start+rollupTxChunk, len(keys))]
+		refs := make([]*firestore.DocumentRef, len(chunk))
+		for i, key := range chunk {
+			refs[i] = s.client.Collection(s.collection).Doc(key)
+		}
+
+		// Read-modify-write so concurrent ingests for the same bucket don't lose updates
+		err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			docs, err := tx.GetAll(refs)
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			for i, doc := range docs {
+				var current Rollup
+				if doc.Exists() {
+					if err := doc.DataTo(&current); err != nil {
+						return err
+					}
+				} else {
+					p := partials[chunk[i]]
+					current = Rollup{DeviceID: p.DeviceID, Type: p.Type, Period: p.Period, BucketStart: p.BucketStart}
+				}
+				current.combine(partials[chunk[i]])
+				current.UpdatedAt = now
+				if err := tx.Set(refs[i], &current); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreRollupStore) Query(ctx context.Context, deviceID, period string, types []string, from, to time.Time) ([]Rollup, error) {
+	query := s.rangeQuery(deviceID, period, from, to)
+	switch len(types) {
+	case 0:
+	case 1:
+		query = query.Where("type", "==", types[0])
+	default:
+		query = query.Where("type", "in", types)
+	}
+
+	iter := query.OrderBy("bucket_start", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var results []Rollup
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var r Rollup
+		if err := doc.DataTo(&r); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func (s *FirestoreRollupStore) Replace(ctx context.Context, deviceID, period string, from, to time.Time, rollups []Rollup) error {
+	bw := s.client.BulkWriter(ctx)
+
+	// Delete stale buckets first: a bucket may no longer have any raw readings
+	iter := s.rangeQuery(deviceID, period, from, to).Documents(ctx)
+	defer iter.Stop()
+
+	var jobs []*firestore.BulkWriterJob
+	keep := make(map[string]bool, len(rollups))
+	for i := range rollups {
+		keep[rollupDocID(rollups[i].DeviceID, rollups[i].Period, rollups[i].Type, rollups[i].BucketStart)] = true
+	}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			bw.End()
+			return err
+		}
+		if keep[doc.Ref.ID] {
+			continue
+		}
+		job, err := bw.Delete(doc.Ref)
+		if err != nil {
+			bw.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+
+	for i := range rollups {
+		r := &rollups[i]
+		ref := s.client.Collection(s.collection).Doc(rollupDocID(r.DeviceID, r.Period, r.Type, r.BucketStart))
+		job, err := bw.Set(ref, r)
+		if err != nil {
+			bw.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+
+	bw.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreRollupStore) Purge(ctx context.Context, period string, before time.Time, limit int, dryRun bool) (int, error) {
+	query := s.client.Collection(s.collection).
+		Where("period", "==", period).
+		Where("bucket_start", "<", before).
+		OrderBy("bucket_start", firestore.Asc).
+		Limit(limit)
+	return purgeDocuments(ctx, s.client, query, dryRun)
+}
+
+// rangeQuery selects a device's rollups of one period with bucket_start in [from, to)
+func (s *FirestoreRollupStore) rangeQuery(deviceID, period string, from, to time.Time) firestore.Query {
+	return s.client.Collection(s.collection).
+		Where("device_id", "==", deviceID).
+		Where("period", "==", period).
+		Where("bucket_start", ">=", from).
+		Where("bucket_start", "<", to)
+}
+
 // FirestoreCommandStore implements CommandStore using Firestore
 type FirestoreCommandStore struct {
 	client     *firestore.Client
@@ -73,11 +643,56 @@ func NewFirestoreCommandStore(client *firestore.Client) *FirestoreCommandStore {
 }
 
 func (s *FirestoreCommandStore) Save(ctx context.Context, cmd *Command) (string, error) {
-	docRef, _, err := s.client.Collection(s.collection).Add(ctx, cmd)
-	if err != nil {
+	// UUID document IDs (see SaveMany): Add would assign 20-character IDs that the
+	// device endpoints reject
+	id := uuid.New().String()
+	if _, err := s.client.Collection(s.collection).Doc(id).Create(ctx, cmd); err != nil {
 		return "", err
 	}
-	return docRef.ID, nil
+	return id, nil
+}
+
+func (s *FirestoreCommandStore) SaveMany(ctx context.Context, cmds []Command) ([]string, error) {
+	if len(cmds) > MaxAtomicBatchSize {
+		return nil, fmt.Errorf("too many commands: %d (maximum %d)", len(cmds), MaxAtomicBatchSize)
+	}
+
+	// UUID document IDs, so devices can address the commands on /commands/{id}/...
+	ids := make([]string, len(cmds))
+	batch := s.client.Batch()
+	for i := range cmds {
+		ids[i] = uuid.New().String()
+		batch.Create(s.client.Collection(s.collection).Doc(ids[i]), &cmds[i])
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *FirestoreCommandStore) GetByCampaign(ctx context.Context, campaignID string) ([]Command, error) {
+	// Equality on a single field only: served by the automatic index
+	iter := s.client.Collection(s.collection).Where("campaign_id", "==", campaignID).Documents(ctx)
+	defer iter.Stop()
+
+	var results []Command
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var cmd Command
+		if err := doc.DataTo(&cmd); err != nil {
+			return nil, err
+		}
+		cmd.ID = doc.Ref.ID
+		results = append(results, cmd)
+	}
+	return results, nil
 }
 
 func (s *FirestoreCommandStore) GetByDeviceID(ctx context.Context, deviceID string, status string) ([]Command, error) {
@@ -109,6 +724,46 @@ func (s *FirestoreCommandStore) GetByDeviceID(ctx context.Context, deviceID stri
 	return results, nil
 }
 
+func (s *FirestoreCommandStore) GetByDeviceIDPage(ctx context.Context, deviceID string, status string, limit int, after *PageCursor) ([]Command, *PageCursor, error) {
+	query := s.client.Collection(s.collection).
+		Where("device_id", "==", deviceID).
+		Where("status", "==", status).
+		OrderBy("created_at", firestore.Desc).
+		OrderBy(firestore.DocumentID, firestore.Desc)
+	if after != nil {
+		query = query.StartAfter(after.Time, after.ID)
+	}
+
+	// Fetch one extra document to detect whether another page exists
+	iter := query.Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	var results []Command
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var cmd Command
+		if err := doc.DataTo(&cmd); err != nil {
+			return nil, nil, err
+		}
+		cmd.ID = doc.Ref.ID
+		results = append(results, cmd)
+	}
+
+	if len(results) <= limit {
+		return results, nil, nil
+	}
+	results = results[:limit]
+	last := results[len(results)-1]
+	return results, &PageCursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
+
 func (s *FirestoreCommandStore) GetByID(ctx context.Context, id string) (*Command, error) {
 	doc, err := s.client.Collection(s.collection).Doc(id).Get(ctx)
 	if err != nil {
@@ -132,6 +787,62 @@ func (s *FirestoreCommandStore) Update(ctx context.Context, id string, updates m
 	return err
 }
 
+func (s *FirestoreCommandStore) Transition(ctx context.Context, id string, fn func(cmd *Command) (bool, error)) (*Command, error) {
+	ref := s.client.Collection(s.collection).Doc(id)
+	var cmd *Command
+
+	// Read-check-write in a transaction so concurrent transitions cannot skip the state machine
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if doc != nil && !doc.Exists() {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		cmd = &Command{}
+		if err := doc.DataTo(cmd); err != nil {
+			return err
+		}
+		cmd.ID = doc.Ref.ID
+
+		changed, err := fn(cmd)
+		if err != nil || !changed {
+			return err
+		}
+		return tx.Set(ref, cmd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (s *FirestoreCommandStore) WatchPending(ctx context.Context, since time.Time, notify func(deviceID string)) error {
+	// One snapshot listener per instance (not per waiting device)
+	iter := s.client.Collection(s.collection).
+		Where("status", "==", CommandPending).
+		Where("created_at", ">", since).
+		Snapshots(ctx)
+	defer iter.Stop()
+
+	for {
+		snap, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		for _, change := range snap.Changes {
+			if change.Kind != firestore.DocumentAdded {
+				continue
+			}
+			deviceID, err := change.Doc.DataAt("device_id")
+			if id, ok := deviceID.(string); err == nil && ok {
+				notify(id)
+			}
+		}
+	}
+}
+
 func (s *FirestoreCommandStore) Delete(ctx context.Context, id string) error {
 	_, err := s.client.Collection(s.collection).Doc(id).Delete(ctx)
 	return err
@@ -158,6 +869,9 @@ func (s *FirestoreDeviceStore) Register(ctx context.Context, device *Device) err
 
 func (s *FirestoreDeviceStore) GetByID(ctx context.Context, deviceID string) (*Device, error) {
 	doc, err := s.client.Collection(s.collection).Doc(deviceID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +899,30 @@ func (s *FirestoreDeviceStore) GetByMAC(ctx context.Context, macAddress string)
 	return &device, nil
 }
 
+func (s *FirestoreDeviceStore) List(ctx context.Context) ([]Device, error) {
+	iter := s.client.Collection(s.collection).Documents(ctx)
+	defer iter.Stop()
+
+	var devices []Device
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var device Device
+		if err := doc.DataTo(&device); err != nil {
+			return nil, err
+		}
+		device.DeviceID = doc.Ref.ID
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
 func (s *FirestoreDeviceStore) UpdateLastSeen(ctx context.Context, deviceID string) error {
 	_, err := s.client.Collection(s.collection).Doc(deviceID).Update(ctx, []firestore.Update{
 		{Path: "last_seen", Value: firestore.ServerTimestamp},
@@ -208,6 +946,33 @@ func (s *FirestoreDeviceStore) Revoke(ctx context.Context, deviceID string) erro
 	return err
 }
 
+func (s *FirestoreDeviceStore) WatchRevoked(ctx context.Context, notify func(deviceID string)) error {
+	// One snapshot listener per instance; devices enter the result set when revoked
+	iter := s.client.Collection(s.collection).
+		Where("revoked", "==", true).
+		Snapshots(ctx)
+	defer iter.Stop()
+
+	for {
+		snap, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		for _, change := range snap.Changes {
+			if change.Kind == firestore.DocumentAdded {
+				notify(change.Doc.Ref.ID)
+			}
+		}
+	}
+}
+
+func (s *FirestoreDeviceStore) UpdateTags(ctx context.Context, deviceID string, tags []string) error {
+	_, err := s.client.Collection(s.collection).Doc(deviceID).Update(ctx, []firestore.Update{
+		{Path: "tags", Value: tags},
+	})
+	return err
+}
+
 // FirestoreSchemaStore implements SchemaStore using Firestore
 type FirestoreSchemaStore struct {
 	client     *firestore.Client
@@ -231,6 +996,9 @@ func (s *FirestoreSchemaStore) Save(ctx context.Context, appName, version string
 func (s *FirestoreSchemaStore) Get(ctx context.Context, appName, version string) (*MeasurementSchema, error) {
 	docID := appName + ":" + version
 	doc, err := s.client.Collection(s.collection).Doc(docID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -241,3 +1009,287 @@ func (s *FirestoreSchemaStore) Get(ctx context.Context, appName, version string)
 	}
 	return &schema, nil
 }
+
+func (s *FirestoreSchemaStore) ListVersions(ctx context.Context, appName string) ([]MeasurementSchema, error) {
+	iter := s.client.Collection(s.collection).Where("app_name", "==", appName).Documents(ctx)
+	defer iter.Stop()
+
+	var schemas []MeasurementSchema
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var schema MeasurementSchema
+		if err := doc.DataTo(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+func (s *FirestoreSchemaStore) List(ctx context.Context) ([]MeasurementSchema, error) {
+	// Measurement maps are not needed for listings
+	iter := s.client.Collection(s.collection).Select("app_name", "version", "created_at").Documents(ctx)
+	defer iter.Stop()
+
+	var schemas []MeasurementSchema
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var schema MeasurementSchema
+		if err := doc.DataTo(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+func (s *FirestoreSchemaStore) Delete(ctx context.Context, appName, version string) error {
+	docID := appName + ":" + version
+	_, err := s.client.Collection(s.collection).Doc(docID).Delete(ctx)
+	return err
+}
+
+// FirestoreQuarantineStore implements QuarantineStore using Firestore
+type FirestoreQuarantineStore struct {
+	client     *firestore.Client
+	collection string
+}
+
+// NewFirestoreQuarantineStore creates a new Firestore-backed quarantine store
+func NewFirestoreQuarantineStore(client *firestore.Client) *FirestoreQuarantineStore {
+	return &FirestoreQuarantineStore{
+		client:     client,
+		collection: QuarantineCollection,
+	}
+}
+
+func (s *FirestoreQuarantineStore) Save(ctx context.Context, p *QuarantinedPayload) (string, error) {
+	docRef, _, err := s.client.Collection(s.collection).Add(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	return docRef.ID, nil
+}
+
+func (s *FirestoreQuarantineStore) GetByID(ctx context.Context, id string) (*QuarantinedPayload, error) {
+	doc, err := s.client.Collection(s.collection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var p QuarantinedPayload
+	if err := doc.DataTo(&p); err != nil {
+		return nil, err
+	}
+	p.ID = doc.Ref.ID
+	return &p, nil
+}
+
+func (s *FirestoreQuarantineStore) ListPage(ctx context.Context, q QuarantineQuery, limit int, after *PageCursor) ([]QuarantinedPayload, *PageCursor, error) {
+	query := s.client.Collection(s.collection).Query
+	for _, f := range []struct{ path, value string }{
+		{"device_id", q.DeviceID},
+		{"app_name", q.AppName},
+		{"app_version", q.AppVersion},
+		{"reason", q.Reason},
+		{"status", q.Status},
+	} {
+		if f.value != "" {
+			query = query.Where(f.path, "==", f.value)
+		}
+	}
+	query = query.OrderBy("received_at", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+	if after != nil {
+		query = query.StartAfter(after.Time, after.ID)
+	}
+
+	// Fetch one extra document to detect whether another page exists
+	iter := query.Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	var results []QuarantinedPayload
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var p QuarantinedPayload
+		if err := doc.DataTo(&p); err != nil {
+			return nil, nil, err
+		}
+		p.ID = doc.Ref.ID
+		results = append(results, p)
+	}
+
+	if len(results) <= limit {
+		return results, nil, nil
+	}
+	results = results[:limit]
+	last := results[len(results)-1]
+	return results, &PageCursor{Time: last.ReceivedAt, ID: last.ID}, nil
+}
+
+func (s *FirestoreQuarantineStore) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+	var firestoreUpdates []firestore.Update
+	for k, v := range updates {
+		firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: k, Value: v})
+	}
+	_, err := s.client.Collection(s.collection).Doc(id).Update(ctx, firestoreUpdates)
+	return err
+}
+
+// FirestoreScheduleStore implements CommandScheduleStore using Firestore
+type FirestoreScheduleStore struct {
+	client     *firestore.Client
+	collection string
+}
+
+// NewFirestoreScheduleStore creates a new Firestore-backed command schedule store
+func NewFirestoreScheduleStore(client *firestore.Client) *FirestoreScheduleStore {
+	return &FirestoreScheduleStore{
+		client:     client,
+		collection: SchedulesCollection,
+	}
+}
+
+func (s *FirestoreScheduleStore) Save(ctx context.Context, schedule *CommandSchedule) (string, error) {
+	docRef, _, err := s.client.Collection(s.collection).Add(ctx, schedule)
+	if err != nil {
+		return "", err
+	}
+	return docRef.ID, nil
+}
+
+func (s *FirestoreScheduleStore) GetByID(ctx context.Context, id string) (*CommandSchedule, error) {
+	doc, err := s.client.Collection(s.collection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule CommandSchedule
+	if err := doc.DataTo(&schedule); err != nil {
+		return nil, err
+	}
+	schedule.ID = doc.Ref.ID
+	return &schedule, nil
+}
+
+func (s *FirestoreScheduleStore) List(ctx context.Context) ([]CommandSchedule, error) {
+	return s.query(ctx, s.client.Collection(s.collection).OrderBy("next_run_at", firestore.Asc))
+}
+
+func (s *FirestoreScheduleStore) ListDue(ctx context.Context, t time.Time) ([]CommandSchedule, error) {
+	return s.query(ctx, s.client.Collection(s.collection).Where("next_run_at", "<=", t))
+}
+
+func (s *FirestoreScheduleStore) query(ctx context.Context, query firestore.Query) ([]CommandSchedule, error) {
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var results []CommandSchedule
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var schedule CommandSchedule
+		if err := doc.DataTo(&schedule); err != nil {
+			return nil, err
+		}
+		schedule.ID = doc.Ref.ID
+		results = append(results, schedule)
+	}
+	return results, nil
+}
+
+func (s *FirestoreScheduleStore) Claim(ctx context.Context, id string, runAt, next time.Time) (bool, error) {
+	ref := s.client.Collection(s.collection).Doc(id)
+	claimed := false
+
+	// Compare-and-set in a transaction so each run is claimed by one instance only
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if doc != nil && !doc.Exists() {
+			return nil // Deleted meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		current, err := doc.DataAt("next_run_at")
+		if err != nil {
+			return err
+		}
+		if t, ok := current.(time.Time); !ok || !t.Equal(runAt) {
+			return nil
+		}
+		claimed = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "next_run_at", Value: next},
+			{Path: "last_run_at", Value: runAt},
+		})
+	})
+	return claimed, err
+}
+
+func (s *FirestoreScheduleStore) Unclaim(ctx context.Context, id string, runAt, next time.Time) (bool, error) {
+	ref := s.client.Collection(s.collection).Doc(id)
+	released := false
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		released = false
+		doc, err := tx.Get(ref)
+		if doc != nil && !doc.Exists() {
+			return nil // Deleted meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		current, err := doc.DataAt("next_run_at")
+		if err != nil {
+			return err
+		}
+		if t, ok := current.(time.Time); !ok || !t.Equal(next) {
+			return nil
+		}
+		released = true
+		return tx.Update(ref, []firestore.Update{{Path: "next_run_at", Value: runAt}})
+	})
+	return released, err
+}
+
+func (s *FirestoreScheduleStore) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+	var firestoreUpdates []firestore.Update
+	for k, v := range updates {
+		firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: k, Value: v})
+	}
+	_, err := s.client.Collection(s.collection).Doc(id).Update(ctx, firestoreUpdates)
+	return err
+}
+
+func (s *FirestoreScheduleStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.Collection(s.collection).Doc(id).Delete(ctx)
+	return err
+}
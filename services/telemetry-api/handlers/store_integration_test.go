@@ -114,6 +114,136 @@ func TestFirestoreTelemetryStore_GetByDeviceID_Empty(t *testing.T) {
 	}
 }
 
+func TestFirestoreTelemetryStore_Query(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreTelemetryStore(client)
+	ctx := context.Background()
+
+	deviceID := "integration-query-device-" + time.Now().Format("150405.000")
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, typ := range []string{"temperature", "humidity", "temperature", "temperature"} {
+		_, err := store.Save(ctx, &TelemetryData{
+			DeviceID:  deviceID,
+			Type:      typ,
+			Value:     float64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to save telemetry: %v", err)
+		}
+	}
+
+	results, err := store.Query(ctx, deviceID, TelemetryQuery{
+		From:  base.Add(1 * time.Hour),
+		To:    base.Add(3 * time.Hour),
+		Types: []string{"temperature"},
+		Order: OrderAsc,
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query telemetry: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if !results[0].Timestamp.Equal(base.Add(2 * time.Hour)) {
+		t.Errorf("Timestamp mismatch: got %v, want %v", results[0].Timestamp, base.Add(2*time.Hour))
+	}
+}
+
+func TestFirestoreTelemetryStore_SaveBatch(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreTelemetryStore(client)
+	ctx := context.Background()
+
+	for _, mode := range []string{BatchAtomic, BatchBestEffort} {
+		t.Run(mode, func(t *testing.T) {
+			deviceID := "integration-batch-device-" + mode + "-" + time.Now().Format("150405.000")
+			readings := make([]TelemetryData, 3)
+			for i := range readings {
+				readings[i] = TelemetryData{
+					DeviceID:  deviceID,
+					Type:      "temperature",
+					Value:     float64(i),
+					Timestamp: time.Now().UTC(),
+					CreatedAt: time.Now().UTC(),
+				}
+			}
+
+			ids, err := store.SaveBatch(ctx, readings, mode)
+			if err != nil {
+				t.Fatalf("Failed to save batch: %v", err)
+			}
+			if len(ids) != 3 {
+				t.Fatalf("Expected 3 IDs, got %d", len(ids))
+			}
+
+			results, err := store.Query(ctx, deviceID, TelemetryQuery{Limit: 10})
+			if err != nil {
+				t.Fatalf("Failed to query: %v", err)
+			}
+			if len(results) != 3 {
+				t.Errorf("Expected 3 stored readings, got %d", len(results))
+			}
+		})
+	}
+}
+
+func TestFirestoreTelemetryStore_QueryPage(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreTelemetryStore(client)
+	ctx := context.Background()
+
+	deviceID := "integration-page-device-" + time.Now().Format("150405.000")
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := store.Save(ctx, &TelemetryData{
+			DeviceID:  deviceID,
+			Type:      "temperature",
+			Value:     float64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to save telemetry: %v", err)
+		}
+	}
+
+	q := TelemetryQuery{Order: OrderAsc, Limit: 2}
+	var all []TelemetryData
+	var cursor *PageCursor
+	for pages := 0; pages < 10; pages++ {
+		page, next, err := store.QueryPage(ctx, deviceID, q, cursor)
+		if err != nil {
+			t.Fatalf("Failed to query page: %v", err)
+		}
+		all = append(all, page...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	if len(all) != 5 {
+		t.Fatalf("Expected 5 results across pages, got %d", len(all))
+	}
+	for i, d := range all {
+		if d.Value != float64(i) {
+			t.Errorf("Result %d: got value %v, want %v", i, d.Value, float64(i))
+		}
+	}
+}
+
 // =============================================================================
 // Firestore Command Store Integration Tests
 // =============================================================================
@@ -215,6 +345,106 @@ func TestFirestoreCommandStore_GetByDeviceID_Empty(t *testing.T) {
 	}
 }
 
+func TestFirestoreCommandStore_SaveManyAndGetByCampaign(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreCommandStore(client)
+	ctx := context.Background()
+
+	campaignID := "integration-test-campaign-" + time.Now().Format("150405.000")
+	now := time.Now().UTC()
+	cmds := []Command{
+		{DeviceID: "integration-test-device-1", Type: "reboot", Status: CommandPending, CreatedAt: now, UpdatedAt: now, CampaignID: campaignID},
+		{DeviceID: "integration-test-device-2", Type: "reboot", Status: CommandPending, CreatedAt: now, UpdatedAt: now, CampaignID: campaignID},
+	}
+
+	ids, err := store.SaveMany(ctx, cmds)
+	if err != nil {
+		t.Fatalf("Failed to save commands: %v", err)
+	}
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Fatalf("Expected 2 distinct IDs, got %v", ids)
+	}
+
+	results, err := store.GetByCampaign(ctx, campaignID)
+	if err != nil {
+		t.Fatalf("Failed to get campaign commands: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 commands, got %d", len(results))
+	}
+
+	for _, id := range ids {
+		store.Delete(ctx, id)
+	}
+}
+
+func TestFirestoreScheduleStore_Claim(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreScheduleStore(client)
+	ctx := context.Background()
+
+	runAt := time.Now().UTC().Truncate(time.Minute)
+	next := runAt.Add(24 * time.Hour)
+	id, err := store.Save(ctx, &CommandSchedule{
+		Cron:         "@daily",
+		Timezone:     "UTC",
+		Type:         "calibrate",
+		ExpiresAfter: "24h",
+		DeviceIDs:    []string{"integration-test-device"},
+		CreatedAt:    runAt,
+		NextRunAt:    runAt,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save schedule: %v", err)
+	}
+	defer store.Delete(ctx, id)
+
+	due, err := store.ListDue(ctx, runAt)
+	if err != nil {
+		t.Fatalf("Failed to list due schedules: %v", err)
+	}
+	found := false
+	for _, s := range due {
+		found = found || s.ID == id
+	}
+	if !found {
+		t.Error("Expected the schedule to be due")
+	}
+
+	// Only the first claim of a run succeeds
+	if claimed, err := store.Claim(ctx, id, runAt, next); err != nil || !claimed {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", claimed, err)
+	}
+	if claimed, err := store.Claim(ctx, id, runAt, next); err != nil || claimed {
+		t.Errorf("Expected second claim to fail, got %v, %v", claimed, err)
+	}
+
+	schedule, err := store.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to get schedule: %v", err)
+	}
+	if !schedule.NextRunAt.Equal(next) || schedule.LastRunAt == nil || !schedule.LastRunAt.Equal(runAt) {
+		t.Errorf("Unexpected schedule after claim: %+v", schedule)
+	}
+
+	// A run given back becomes due again, once
+	if released, err := store.Unclaim(ctx, id, runAt, next); err != nil || !released {
+		t.Fatalf("Expected unclaim to succeed, got %v, %v", released, err)
+	}
+	if released, err := store.Unclaim(ctx, id, runAt, next); err != nil || released {
+		t.Errorf("Expected second unclaim to fail, got %v, %v", released, err)
+	}
+	if claimed, err := store.Claim(ctx, id, runAt, next); err != nil || !claimed {
+		t.Errorf("Expected the run to be claimable again, got %v, %v", claimed, err)
+	}
+}
+
 // =============================================================================
 // Pub/Sub Publisher Integration Tests
 // =============================================================================
@@ -541,6 +771,98 @@ func TestFirestoreSchemaStore_Update(t *testing.T) {
 	}
 }
 
+func TestFirestoreSchemaStore_ListAndDelete(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreSchemaStore(client)
+	ctx := context.Background()
+
+	appName := "test-app-list-" + time.Now().Format("20060102150405")
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		schema := &MeasurementSchema{
+			AppName: appName,
+			Version: version,
+			Measurements: map[string]MeasurementMeta{
+				"temperature": {ID: 1, Name: "temperature", Type: "float", Unit: "celsius"},
+			},
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := store.Save(ctx, appName, version, schema); err != nil {
+			t.Fatalf("Failed to save schema %s: %v", version, err)
+		}
+	}
+
+	all, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list schemas: %v", err)
+	}
+	found := 0
+	for _, s := range all {
+		if s.AppName == appName {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("Listed versions mismatch: got %d, want %d", found, 2)
+	}
+
+	if err := store.Delete(ctx, appName, "1.0.0"); err != nil {
+		t.Fatalf("Failed to delete schema: %v", err)
+	}
+	versions, err := store.ListVersions(ctx, appName)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Version != "1.1.0" {
+		t.Errorf("Expected only 1.1.0 after delete, got %+v", versions)
+	}
+}
+
+func TestFirestoreQuarantineStore_SaveListUpdate(t *testing.T) {
+	skipIfNoEmulator(t)
+	client := setupFirestoreClient(t)
+	defer client.Close()
+
+	store := NewFirestoreQuarantineStore(client)
+	ctx := context.Background()
+
+	appName := "test-app-quarantine-" + time.Now().Format("20060102150405")
+	id, err := store.Save(ctx, &QuarantinedPayload{
+		DeviceID:    "550e8400-e29b-41d4-a716-446655440099",
+		AppName:     appName,
+		AppVersion:  "1.0.0",
+		Reason:      QuarantineSchemaNotFound,
+		Payload:     []byte{0x0a, 0x02, 0x08, 0x01},
+		PayloadSize: 4,
+		Status:      QuarantinePending,
+		ReceivedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to save quarantined payload: %v", err)
+	}
+
+	page, _, err := store.ListPage(ctx, QuarantineQuery{AppName: appName, Status: QuarantinePending}, 10, nil)
+	if err != nil {
+		t.Fatalf("Failed to list quarantined payloads: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != id || len(page[0].Payload) != 4 {
+		t.Fatalf("Unexpected listing: %+v", page)
+	}
+
+	if err := store.Update(ctx, id, map[string]interface{}{"status": QuarantineReplayed, "replayed_at": time.Now().UTC()}); err != nil {
+		t.Fatalf("Failed to update quarantined payload: %v", err)
+	}
+	p, err := store.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to get quarantined payload: %v", err)
+	}
+	if p.Status != QuarantineReplayed || p.ReplayedAt == nil {
+		t.Errorf("Update not applied: %+v", p)
+	}
+}
+
 // =============================================================================
 // Handlers New() Integration Test
 // =============================================================================
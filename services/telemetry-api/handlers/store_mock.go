@@ -3,18 +3,32 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 var ErrNotFound = errors.New("not found")
 
 // MockTelemetryStore is a mock implementation for testing
 type MockTelemetryStore struct {
-	mu      sync.RWMutex
-	data    map[string]TelemetryData
-	nextID  int
-	SaveErr error
-	GetErr  error
+	mu        sync.RWMutex
+	data      map[string]TelemetryData
+	nextID    int
+	SaveErr   error
+	GetErr    error
+	DeleteErr error
+
+	// SaveBatchErr fails a whole SaveBatch call, SaveBatchErrs individual items by index
+	SaveBatchErr  error
+	SaveBatchErrs map[int]error
+	// SaveBatchCalls counts SaveBatch round trips
+	SaveBatchCalls int
 }
 
 func NewMockTelemetryStore() *MockTelemetryStore {
@@ -36,6 +50,72 @@ func (m *MockTelemetryStore) Save(ctx context.Context, data *TelemetryData) (str
 	return id, nil
 }
 
+func (m *MockTelemetryStore) SaveBatch(ctx context.Context, readings []TelemetryData, mode string) ([]SaveResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SaveBatchCalls++
+
+	if m.SaveBatchErr != nil {
+		return nil, m.SaveBatchErr
+	}
+
+	// SaveErr fails every item (whole batch in atomic mode)
+	itemErr := func(i int) error {
+		if m.SaveErr != nil {
+			return m.SaveErr
+		}
+		return m.SaveBatchErrs[i]
+	}
+	if mode == BatchAtomic {
+		for i := range readings {
+			if err := itemErr(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	results := make([]SaveResult, len(readings))
+	failed := make(map[int]error)
+	for i := range readings {
+		if id := readings[i].ID; id != "" {
+			if _, ok := m.data[id]; ok {
+				results[i] = SaveResult{ID: id, Duplicate: true}
+				continue
+			}
+		}
+		if err := itemErr(i); err != nil {
+			failed[i] = err
+			continue
+		}
+		id := readings[i].ID
+		if id == "" {
+			m.nextID++
+			id = "mock-" + string(rune('0'+m.nextID))
+		}
+		results[i].ID = id
+		m.data[id] = readings[i]
+	}
+	if len(failed) > 0 {
+		return results, &BatchWriteError{Failed: failed}
+	}
+	return results, nil
+}
+
+func (m *MockTelemetryStore) GetByID(ctx context.Context, id string) (*TelemetryData, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.data[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data.ID = id
+	return &data, nil
+}
+
 func (m *MockTelemetryStore) GetByDeviceID(ctx context.Context, deviceID string, limit int) ([]TelemetryData, error) {
 	if m.GetErr != nil {
 		return nil, m.GetErr
@@ -56,11 +136,295 @@ func (m *MockTelemetryStore) GetByDeviceID(ctx context.Context, deviceID string,
 	return results, nil
 }
 
+func (m *MockTelemetryStore) Query(ctx context.Context, deviceID string, q TelemetryQuery) ([]TelemetryData, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	results := m.filter(deviceID, q)
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+func (m *MockTelemetryStore) QueryPage(ctx context.Context, deviceID string, q TelemetryQuery, after *PageCursor) ([]TelemetryData, *PageCursor, error) {
+	if m.GetErr != nil {
+		return nil, nil, m.GetErr
+	}
+
+	var page []TelemetryData
+	for _, d := range m.filter(deviceID, q) {
+		if isAfterCursor(d.Timestamp, d.ID, after, q.Order) {
+			page = append(page, d)
+		}
+	}
+	if len(page) <= q.Limit {
+		return page, nil, nil
+	}
+	page = page[:q.Limit]
+	last := page[len(page)-1]
+	return page, &PageCursor{Time: last.Timestamp, ID: last.ID}, nil
+}
+
+func (m *MockTelemetryStore) Purge(ctx context.Context, q PurgeQuery, limit int, dryRun bool) (int, error) {
+	if m.DeleteErr != nil {
+		return 0, m.DeleteErr
+	}
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for id, d := range m.data {
+		if d.DeviceID != q.DeviceID || !d.Timestamp.Before(q.Before) {
+			continue
+		}
+		if len(q.Types) > 0 && !slices.Contains(q.Types, d.Type) {
+			continue
+		}
+		if slices.Contains(q.ExcludeTypes, d.Type) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	// Oldest first, like the Firestore implementation
+	sort.Slice(ids, func(i, j int) bool { return m.data[ids[i]].Timestamp.Before(m.data[ids[j]].Timestamp) })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	if !dryRun {
+		for _, id := range ids {
+			delete(m.data, id)
+		}
+	}
+	return len(ids), nil
+}
+
+func (m *MockTelemetryStore) DeviceIDs(ctx context.Context) ([]string, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []string
+	for _, d := range m.data {
+		if !slices.Contains(ids, d.DeviceID) {
+			ids = append(ids, d.DeviceID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// filter returns all readings matching the query, sorted by (timestamp, id) in query order
+func (m *MockTelemetryStore) filter(deviceID string, q TelemetryQuery) []TelemetryData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []TelemetryData
+	for id, d := range m.data {
+		if d.DeviceID != deviceID {
+			continue
+		}
+		if len(q.Types) > 0 && !slices.Contains(q.Types, d.Type) {
+			continue
+		}
+		if !q.From.IsZero() && d.Timestamp.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !d.Timestamp.Before(q.To) {
+			continue
+		}
+		d.ID = id
+		results = append(results, d)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if q.Order == OrderAsc {
+			return a.Timestamp.Before(b.Timestamp) || (a.Timestamp.Equal(b.Timestamp) && a.ID < b.ID)
+		}
+		return a.Timestamp.After(b.Timestamp) || (a.Timestamp.Equal(b.Timestamp) && a.ID > b.ID)
+	})
+	return results
+}
+
+// isAfterCursor reports whether an item sorted by (t, id) comes after the cursor in the given order
+func isAfterCursor(t time.Time, id string, c *PageCursor, order string) bool {
+	if c == nil {
+		return true
+	}
+	if order == OrderAsc {
+		return t.After(c.Time) || (t.Equal(c.Time) && id > c.ID)
+	}
+	return t.Before(c.Time) || (t.Equal(c.Time) && id < c.ID)
+}
+
+// MockRollupStore is a mock implementation for testing
+type MockRollupStore struct {
+	mu         sync.RWMutex
+	data       map[string]Rollup
+	ApplyErr   error
+	GetErr     error
+	ReplaceErr error
+	DeleteErr  error
+}
+
+func NewMockRollupStore() *MockRollupStore {
+	return &MockRollupStore{
+		data: make(map[string]Rollup),
+	}
+}
+
+func (m *MockRollupStore) Apply(ctx context.Context, readings []TelemetryData) error {
+	if m.ApplyErr != nil {
+		return m.ApplyErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, partial := range buildRollups(readings, rollupPeriods...) {
+		current, ok := m.data[key]
+		if !ok {
+			current = Rollup{DeviceID: partial.DeviceID, Type: partial.Type, Period: partial.Period, BucketStart: partial.BucketStart}
+		}
+		current.combine(partial)
+		m.data[key] = current
+	}
+	return nil
+}
+
+func (m *MockRollupStore) Query(ctx context.Context, deviceID, period string, types []string, from, to time.Time) ([]Rollup, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []Rollup
+	for _, r := range m.data {
+		if r.DeviceID != deviceID || r.Period != period {
+			continue
+		}
+		if len(types) > 0 && !slices.Contains(types, r.Type) {
+			continue
+		}
+		if r.BucketStart.Before(from) || !r.BucketStart.Before(to) {
+			continue
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].BucketStart.Before(results[j].BucketStart) })
+	return results, nil
+}
+
+func (m *MockRollupStore) Replace(ctx context.Context, deviceID, period string, from, to time.Time, rollups []Rollup) error {
+	if m.ReplaceErr != nil {
+		return m.ReplaceErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, r := range m.data {
+		if r.DeviceID == deviceID && r.Period == period && !r.BucketStart.Before(from) && r.BucketStart.Before(to) {
+			delete(m.data, key)
+		}
+	}
+	for _, r := range rollups {
+		m.data[rollupDocID(r.DeviceID, r.Period, r.Type, r.BucketStart)] = r
+	}
+	return nil
+}
+
+func (m *MockRollupStore) Purge(ctx context.Context, period string, before time.Time, limit int, dryRun bool) (int, error) {
+	if m.DeleteErr != nil {
+		return 0, m.DeleteErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key, r := range m.data {
+		if r.Period == period && r.BucketStart.Before(before) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return m.data[keys[i]].BucketStart.Before(m.data[keys[j]].BucketStart) })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	if !dryRun {
+		for _, key := range keys {
+			delete(m.data, key)
+		}
+	}
+	return len(keys), nil
+}
+
+// MockAggregatingTelemetryStore is a MockTelemetryStore with aggregation push-down,
+// computed per bucket like FirestoreTelemetryStore.Aggregate
+type MockAggregatingTelemetryStore struct {
+	*MockTelemetryStore
+	// AggregateCalls counts Aggregate calls, Pushdowns the ones answered by the store
+	AggregateCalls int
+	Pushdowns      int
+}
+
+func NewMockAggregatingTelemetryStore() *MockAggregatingTelemetryStore {
+	return &MockAggregatingTelemetryStore{MockTelemetryStore: NewMockTelemetryStore()}
+}
+
+func (m *MockAggregatingTelemetryStore) Aggregate(ctx context.Context, deviceID string, q AggregateQuery) ([]AggregateSeries, error) {
+	m.AggregateCalls++
+	ranges, err := pushdownRanges(q)
+	if err != nil {
+		return nil, err
+	}
+	m.Pushdowns++
+
+	types := append([]string(nil), q.Types...)
+	sort.Strings(types)
+
+	series := make([]AggregateSeries, 0, len(types))
+	for _, typ := range types {
+		readings, err := m.Query(ctx, deviceID, TelemetryQuery{From: q.From, To: q.To, Types: []string{typ}})
+		if err != nil {
+			return nil, err
+		}
+		if len(readings) == 0 || !readings[0].IsNumeric() {
+			continue
+		}
+
+		s := AggregateSeries{Type: typ, Unit: readings[0].Unit, Points: []AggregatePoint{}}
+		for _, r := range ranges {
+			count, sum := 0, 0.0
+			for _, d := range readings {
+				if !d.Timestamp.Before(r.From) && d.Timestamp.Before(r.To) {
+					count++
+					sum += d.Value
+				}
+			}
+			value := sum
+			if q.Func == AggAvg && count > 0 {
+				value = sum / float64(count)
+			}
+			if p, ok := pushdownPoint(q.Func, r.Start, count, value); ok {
+				s.Points = append(s.Points, p)
+			}
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
 // MockCommandStore is a mock implementation for testing
 type MockCommandStore struct {
 	mu        sync.RWMutex
 	data      map[string]Command
-	nextID    int
 	SaveErr   error
 	GetErr    error
 	UpdateErr error
@@ -80,8 +444,7 @@ func (m *MockCommandStore) Save(ctx context.Context, cmd *Command) (string, erro
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.nextID++
-	id := "cmd-" + string(rune('0'+m.nextID))
+	id := uuid.New().String() // Like FirestoreCommandStore
 	m.data[id] = *cmd
 	return id, nil
 }
@@ -103,6 +466,35 @@ func (m *MockCommandStore) GetByDeviceID(ctx context.Context, deviceID string, s
 	return results, nil
 }
 
+func (m *MockCommandStore) GetByDeviceIDPage(ctx context.Context, deviceID string, status string, limit int, after *PageCursor) ([]Command, *PageCursor, error) {
+	if m.GetErr != nil {
+		return nil, nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []Command
+	for id, c := range m.data {
+		if c.DeviceID == deviceID && c.Status == status && isAfterCursor(c.CreatedAt, id, after, OrderDesc) {
+			c.ID = id
+			results = append(results, c)
+		}
+	}
+
+	// Newest first, document ID as tie-breaker
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		return a.CreatedAt.After(b.CreatedAt) || (a.CreatedAt.Equal(b.CreatedAt) && a.ID > b.ID)
+	})
+
+	if len(results) <= limit {
+		return results, nil, nil
+	}
+	results = results[:limit]
+	last := results[len(results)-1]
+	return results, &PageCursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
+
 func (m *MockCommandStore) GetByID(ctx context.Context, id string) (*Command, error) {
 	if m.GetErr != nil {
 		return nil, m.GetErr
@@ -137,6 +529,30 @@ func (m *MockCommandStore) Update(ctx context.Context, id string, updates map[st
 	return nil
 }
 
+func (m *MockCommandStore) Transition(ctx context.Context, id string, fn func(cmd *Command) (bool, error)) (*Command, error) {
+	if m.UpdateErr != nil {
+		return nil, m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cmd, ok := m.data[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cmd.ID = id
+	cmd.History = append([]CommandTransition(nil), cmd.History...) // Don't share the stored array
+
+	changed, err := fn(&cmd)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		m.data[id] = cmd
+	}
+	return &cmd, nil
+}
+
 func (m *MockCommandStore) Delete(ctx context.Context, id string) error {
 	if m.DeleteErr != nil {
 		return m.DeleteErr
@@ -151,6 +567,41 @@ func (m *MockCommandStore) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (m *MockCommandStore) SaveMany(ctx context.Context, cmds []Command) ([]string, error) {
+	if m.SaveErr != nil {
+		return nil, m.SaveErr
+	}
+	if len(cmds) > MaxAtomicBatchSize {
+		return nil, fmt.Errorf("too many commands: %d (maximum %d)", len(cmds), MaxAtomicBatchSize)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		ids[i] = uuid.New().String()
+		m.data[ids[i]] = cmd
+	}
+	return ids, nil
+}
+
+func (m *MockCommandStore) GetByCampaign(ctx context.Context, campaignID string) ([]Command, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []Command
+	for id, c := range m.data {
+		if c.CampaignID == campaignID {
+			c.ID = id
+			results = append(results, c)
+		}
+	}
+	return results, nil
+}
+
 // MockEventPublisher is a mock implementation for testing
 type MockEventPublisher struct {
 	mu         sync.Mutex
@@ -236,6 +687,21 @@ func (m *MockDeviceStore) GetByMAC(ctx context.Context, macAddress string) (*Dev
 	return nil, ErrNotFound
 }
 
+func (m *MockDeviceStore) List(ctx context.Context) ([]Device, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]Device, 0, len(m.data))
+	for _, device := range m.data {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	return devices, nil
+}
+
 func (m *MockDeviceStore) UpdateLastSeen(ctx context.Context, deviceID string) error {
 	if m.UpdateErr != nil {
 		return m.UpdateErr
@@ -243,12 +709,10 @@ func (m *MockDeviceStore) UpdateLastSeen(ctx context.Context, deviceID string) e
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	device, ok := m.data[deviceID]
-	if !ok {
+	if _, ok := m.data[deviceID]; !ok {
 		return ErrNotFound
 	}
-	device.LastSeen = device.LastSeen // Would be updated in real implementation
-	m.data[deviceID] = device
+	// LastSeen would be updated in real implementation
 	return nil
 }
 
@@ -285,12 +749,30 @@ func (m *MockDeviceStore) Revoke(ctx context.Context, deviceID string) error {
 	return nil
 }
 
+func (m *MockDeviceStore) UpdateTags(ctx context.Context, deviceID string, tags []string) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.data[deviceID]
+	if !ok {
+		return ErrNotFound
+	}
+	device.Tags = tags
+	m.data[deviceID] = device
+	return nil
+}
+
 // MockSchemaStore is a mock implementation for testing
 type MockSchemaStore struct {
-	mu      sync.RWMutex
-	data    map[string]MeasurementSchema
-	SaveErr error
-	GetErr  error
+	mu        sync.RWMutex
+	data      map[string]MeasurementSchema
+	SaveErr   error
+	GetErr    error
+	ListErr   error
+	DeleteErr error
 }
 
 func NewMockSchemaStore() *MockSchemaStore {
@@ -325,3 +807,298 @@ func (m *MockSchemaStore) Get(ctx context.Context, appName, version string) (*Me
 	}
 	return &schema, nil
 }
+
+func (m *MockSchemaStore) ListVersions(ctx context.Context, appName string) ([]MeasurementSchema, error) {
+	if m.ListErr != nil {
+		return nil, m.ListErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var schemas []MeasurementSchema
+	for key, schema := range m.data {
+		version, ok := strings.CutPrefix(key, appName+":")
+		if !ok {
+			continue
+		}
+		schema.AppName, schema.Version = appName, version
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+func (m *MockSchemaStore) List(ctx context.Context) ([]MeasurementSchema, error) {
+	if m.ListErr != nil {
+		return nil, m.ListErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var schemas []MeasurementSchema
+	for key, schema := range m.data {
+		appName, version, _ := strings.Cut(key, ":")
+		schemas = append(schemas, MeasurementSchema{
+			AppName:   appName,
+			Version:   version,
+			CreatedAt: schema.CreatedAt,
+		})
+	}
+	return schemas, nil
+}
+
+func (m *MockSchemaStore) Delete(ctx context.Context, appName, version string) error {
+	if m.DeleteErr != nil {
+		return m.DeleteErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := appName + ":" + version
+	if _, ok := m.data[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.data, key)
+	return nil
+}
+
+// MockQuarantineStore is a mock implementation for testing
+type MockQuarantineStore struct {
+	mu        sync.RWMutex
+	data      map[string]QuarantinedPayload
+	nextID    int
+	SaveErr   error
+	GetErr    error
+	UpdateErr error
+}
+
+func NewMockQuarantineStore() *MockQuarantineStore {
+	return &MockQuarantineStore{
+		data: make(map[string]QuarantinedPayload),
+	}
+}
+
+func (m *MockQuarantineStore) Save(ctx context.Context, p *QuarantinedPayload) (string, error) {
+	if m.SaveErr != nil {
+		return "", m.SaveErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	id := fmt.Sprintf("q-%d", m.nextID)
+	m.data[id] = *p
+	return id, nil
+}
+
+func (m *MockQuarantineStore) GetByID(ctx context.Context, id string) (*QuarantinedPayload, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.data[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p.ID = id
+	return &p, nil
+}
+
+func (m *MockQuarantineStore) ListPage(ctx context.Context, q QuarantineQuery, limit int, after *PageCursor) ([]QuarantinedPayload, *PageCursor, error) {
+	if m.GetErr != nil {
+		return nil, nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := func(field, want string) bool { return want == "" || field == want }
+	var results []QuarantinedPayload
+	for id, p := range m.data {
+		if matches(p.DeviceID, q.DeviceID) && matches(p.AppName, q.AppName) && matches(p.AppVersion, q.AppVersion) &&
+			matches(p.Reason, q.Reason) && matches(p.Status, q.Status) && isAfterCursor(p.ReceivedAt, id, after, OrderDesc) {
+			p.ID = id
+			results = append(results, p)
+		}
+	}
+
+	// Newest first, document ID as tie-breaker
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		return a.ReceivedAt.After(b.ReceivedAt) || (a.ReceivedAt.Equal(b.ReceivedAt) && a.ID > b.ID)
+	})
+
+	if len(results) <= limit {
+		return results, nil, nil
+	}
+	results = results[:limit]
+	last := results[len(results)-1]
+	return results, &PageCursor{Time: last.ReceivedAt, ID: last.ID}, nil
+}
+
+func (m *MockQuarantineStore) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.data[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for k, v := range updates {
+		switch k {
+		case "status":
+			p.Status = v.(string)
+		case "reason":
+			p.Reason = v.(string)
+		case "error":
+			p.Error = v.(string)
+		case "unknown_ids":
+			p.UnknownIDs = v.([]uint32)
+		case "replay_attempts":
+			p.ReplayAttempts = v.(int)
+		case "replayed_at":
+			t := v.(time.Time)
+			p.ReplayedAt = &t
+		}
+	}
+	m.data[id] = p
+	return nil
+}
+
+// MockScheduleStore is a mock implementation for testing
+type MockScheduleStore struct {
+	mu        sync.RWMutex
+	data      map[string]CommandSchedule
+	nextID    int
+	SaveErr   error
+	GetErr    error
+	UpdateErr error
+}
+
+func NewMockScheduleStore() *MockScheduleStore {
+	return &MockScheduleStore{
+		data: make(map[string]CommandSchedule),
+	}
+}
+
+func (m *MockScheduleStore) Save(ctx context.Context, schedule *CommandSchedule) (string, error) {
+	if m.SaveErr != nil {
+		return "", m.SaveErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	id := fmt.Sprintf("sched-%d", m.nextID)
+	m.data[id] = *schedule
+	return id, nil
+}
+
+func (m *MockScheduleStore) GetByID(ctx context.Context, id string) (*CommandSchedule, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	schedule, ok := m.data[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	schedule.ID = id
+	return &schedule, nil
+}
+
+func (m *MockScheduleStore) List(ctx context.Context) ([]CommandSchedule, error) {
+	return m.ListDue(ctx, time.Time{})
+}
+
+func (m *MockScheduleStore) ListDue(ctx context.Context, t time.Time) ([]CommandSchedule, error) {
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []CommandSchedule
+	for id, schedule := range m.data {
+		if t.IsZero() || !schedule.NextRunAt.After(t) {
+			schedule.ID = id
+			results = append(results, schedule)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].NextRunAt.Before(results[j].NextRunAt) })
+	return results, nil
+}
+
+func (m *MockScheduleStore) Claim(ctx context.Context, id string, runAt, next time.Time) (bool, error) {
+	if m.UpdateErr != nil {
+		return false, m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.data[id]
+	if !ok || !schedule.NextRunAt.Equal(runAt) {
+		return false, nil
+	}
+	schedule.NextRunAt = next
+	schedule.LastRunAt = &runAt
+	m.data[id] = schedule
+	return true, nil
+}
+
+func (m *MockScheduleStore) Unclaim(ctx context.Context, id string, runAt, next time.Time) (bool, error) {
+	if m.UpdateErr != nil {
+		return false, m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.data[id]
+	if !ok || !schedule.NextRunAt.Equal(next) {
+		return false, nil
+	}
+	schedule.NextRunAt = runAt
+	m.data[id] = schedule
+	return true, nil
+}
+
+func (m *MockScheduleStore) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.data[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for k, v := range updates {
+		switch k {
+		case "last_campaign_id":
+			schedule.LastCampaignID = v.(string)
+		case "last_error":
+			schedule.LastError = v.(string)
+		}
+	}
+	m.data[id] = schedule
+	return nil
+}
+
+func (m *MockScheduleStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.data, id)
+	return nil
+}
@@ -49,6 +49,65 @@ func TestMockTelemetryStore_Errors(t *testing.T) {
 	if err != ErrNotFound {
 		t.Errorf("expected ErrNotFound, got %v", err)
 	}
+
+	_, err = store.Query(ctx, "test", TelemetryQuery{Limit: 10})
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMockTelemetryStore_Query(t *testing.T) {
+	store := NewMockTelemetryStore()
+	ctx := context.Background()
+
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, typ := range []string{"temperature", "humidity", "temperature", "temperature"} {
+		store.Save(ctx, &TelemetryData{
+			DeviceID:  "test-device",
+			Type:      typ,
+			Value:     float64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	store.Save(ctx, &TelemetryData{DeviceID: "other-device", Type: "temperature", Timestamp: base})
+
+	// Time window is [from, to)
+	results, err := store.Query(ctx, "test-device", TelemetryQuery{
+		From:  base.Add(1 * time.Hour),
+		To:    base.Add(3 * time.Hour),
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 results in window, got %d", len(results))
+	}
+
+	// Type filter with ascending order
+	results, err = store.Query(ctx, "test-device", TelemetryQuery{
+		Types: []string{"temperature"},
+		Order: OrderAsc,
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 temperature results, got %d", len(results))
+	}
+	if !results[0].Timestamp.Equal(base) {
+		t.Errorf("expected oldest reading first, got %v", results[0].Timestamp)
+	}
+
+	// Default order is newest first, limit applies after ordering
+	results, err = store.Query(ctx, "test-device", TelemetryQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].Timestamp.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("expected newest reading, got %+v", results)
+	}
 }
 
 func TestMockCommandStore_CRUD(t *testing.T) {
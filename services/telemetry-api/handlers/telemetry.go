@@ -3,8 +3,10 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -12,7 +14,13 @@ import (
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/validate"
 )
 
-// HandleTelemetry handles POST /telemetry - ingests telemetry data (JSON)
+// MaxTelemetryQueryTypes caps the repeatable type filter on GET /telemetry and
+// GET /telemetry/aggregate. Firestore "in" queries accept up to 30 values; 10 is a
+// product limit that keeps per-type work bounded (an aggregate request computes one
+// series per type).
+const MaxTelemetryQueryTypes = 10
+
+// HandleTelemetry handles POST /telemetry - ingests telemetry data (JSON, CBOR or MessagePack)
 func (h *Handlers) HandleTelemetry(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	reqID := middleware.GetRequestID(ctx)
@@ -24,8 +32,14 @@ func (h *Handlers) HandleTelemetry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	requestKey, err := idempotencyKey(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var data TelemetryData
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+	if err := decodeTelemetryBody(r, &data); err != nil {
 		h.jsonError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -44,25 +58,64 @@ func (h *Handlers) HandleTelemetry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateMsgID(data.MsgID); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := normalizeValue(&data); err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set server-side timestamp if not provided
 	if data.Timestamp.IsZero() {
 		data.Timestamp = time.Now().UTC()
 	}
 	data.CreatedAt = time.Now().UTC()
 
-	// Store telemetry data
-	id, err := h.telemetryStore.Save(ctx, &data)
-	if err != nil {
-		h.logger.Error("failed to store telemetry",
-			"request_id", reqID,
-			"error", err,
-			"device_id", deviceID,
-			"type", data.Type,
-		)
-		h.jsonError(w, "failed to store telemetry", http.StatusInternalServerError)
-		return
+	data.ID = ""
+	if key := readingKey(data.MsgID, requestKey, 0); key != "" {
+		// Idempotent write: a retry maps to the document of the first attempt
+		setIdempotentID(&data, key)
+		out, err := h.saveTelemetryBatch(ctx, reqID, []TelemetryData{data}, []int{0}, BatchAtomic)
+		if err != nil {
+			h.jsonError(w, "failed to store telemetry", http.StatusInternalServerError)
+			return
+		}
+		if out.duplicates > 0 {
+			// Answer with the reading stored by the first attempt
+			stored, err := h.telemetryStore.GetByID(ctx, data.ID)
+			if err != nil {
+				h.logger.Error("failed to load stored telemetry",
+					"request_id", reqID,
+					"error", err,
+					"device_id", deviceID,
+				)
+				h.jsonError(w, "failed to store telemetry", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			h.jsonResponse(w, stored, http.StatusCreated)
+			return
+		}
+	} else {
+		// Store telemetry data
+		id, err := h.telemetryStore.Save(ctx, &data)
+		if err != nil {
+			h.logger.Error("failed to store telemetry",
+				"request_id", reqID,
+				"error", err,
+				"device_id", deviceID,
+				"type", data.Type,
+			)
+			h.jsonError(w, "failed to store telemetry", http.StatusInternalServerError)
+			return
+		}
+		data.ID = id
 	}
-	data.ID = id
+
+	h.applyRollups(ctx, reqID, []TelemetryData{data})
 
 	// Publish to event stream for async processing
 	if err := h.publishTelemetry(ctx, &data); err != nil {
@@ -77,7 +130,36 @@ func (h *Handlers) HandleTelemetry(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, data, http.StatusCreated)
 }
 
-// HandleTelemetryBatch handles POST /telemetry/batch - ingests multiple telemetry readings (JSON)
+// Batch item rejection categories
+const (
+	RejectValidation = "validation" // The reading is invalid; resending it unchanged will fail again
+	RejectStorage    = "storage"    // The reading was valid but could not be stored; safe to retry
+)
+
+// Batch item rejection reason codes
+const (
+	ReasonMissingType  = "missing_type"
+	ReasonInvalidType  = "invalid_type"
+	ReasonInvalidMsgID = "invalid_msg_id"
+	ReasonInvalidValue = "invalid_value"
+	ReasonStoreFailed  = "store_failed"
+
+	// ReasonTimestampOutOfWindow rejects a protobuf sample group (see TimestampWindow)
+	ReasonTimestampOutOfWindow = "timestamp_out_of_window"
+)
+
+// BatchItemError describes a batch reading that was not stored
+type BatchItemError struct {
+	Index    int    `json:"index"`    // Position in the request array
+	Category string `json:"category"` // RejectValidation or RejectStorage
+	Code     string `json:"code"`     // Machine-readable Reason* code
+	Message  string `json:"message"`
+}
+
+// HandleTelemetryBatch handles POST /telemetry/batch - ingests multiple telemetry readings (JSON, CBOR or MessagePack)
+// Readings are written in a single SaveBatch call; ?mode=atomic stores all or nothing,
+// the default best_effort mode stores every reading it can. Readings that are not stored are
+// listed under "rejected"; with ?strict=true any invalid reading rejects the whole batch.
 func (h *Handlers) HandleTelemetryBatch(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	reqID := middleware.GetRequestID(ctx)
@@ -88,8 +170,28 @@ func (h *Handlers) HandleTelemetryBatch(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	mode, err := parseBatchMode(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestKey, err := idempotencyKey(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	strict := false
+	if v := r.URL.Query().Get("strict"); v != "" {
+		if strict, err = strconv.ParseBool(v); err != nil {
+			h.jsonError(w, "invalid strict: must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var readings []TelemetryData
-	if err := json.NewDecoder(r.Body).Decode(&readings); err != nil {
+	if err := decodeTelemetryBody(r, &readings); err != nil {
 		h.jsonError(w, "invalid request body: expected array", http.StatusBadRequest)
 		return
 	}
@@ -105,7 +207,9 @@ func (h *Handlers) HandleTelemetryBatch(w http.ResponseWriter, r *http.Request)
 	}
 
 	now := time.Now().UTC()
-	saved := 0
+	valid := make([]TelemetryData, 0, len(readings))
+	indexes := make([]int, 0, len(readings)) // valid[i] came from readings[indexes[i]]
+	rejected := []BatchItemError{}
 
 	for i := range readings {
 		data := &readings[i]
@@ -114,33 +218,57 @@ func (h *Handlers) HandleTelemetryBatch(w http.ResponseWriter, r *http.Request)
 		data.DeviceID = deviceID
 
 		if data.Type == "" {
-			continue // Skip invalid readings
+			rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonMissingType, Message: "type is required"})
+			continue
 		}
 
 		if err := validate.TelemetryType(data.Type); err != nil {
-			continue // Skip invalid types
+			rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonInvalidType, Message: fmt.Sprintf("invalid telemetry type: %v", err)})
+			continue
+		}
+
+		if err := validateMsgID(data.MsgID); err != nil {
+			rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonInvalidMsgID, Message: err.Error()})
+			continue
 		}
 
+		if err := normalizeValue(data); err != nil {
+			rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonInvalidValue, Message: err.Error()})
+			continue
+		}
+		data.ID = "" // IDs are server-assigned (or derived from msg_id / Idempotency-Key)
+		setIdempotentID(data, readingKey(data.MsgID, requestKey, i))
+
 		if data.Timestamp.IsZero() {
 			data.Timestamp = now
 		}
 		data.CreatedAt = now
 
-		id, err := h.telemetryStore.Save(ctx, data)
-		if err != nil {
-			h.logger.Error("failed to store telemetry in batch",
-				"request_id", reqID,
-				"error", err,
-				"device_id", deviceID,
-				"index", i,
-			)
-			continue
-		}
-		data.ID = id
-		saved++
+		valid = append(valid, *data)
+		indexes = append(indexes, i)
+	}
 
+	if strict && len(rejected) > 0 {
+		h.jsonResponse(w, map[string]interface{}{
+			"error":    fmt.Sprintf("batch rejected: %d invalid readings", len(rejected)),
+			"received": len(readings),
+			"rejected": rejected,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	out, err := h.saveTelemetryBatch(ctx, reqID, valid, indexes, mode)
+	if err != nil {
+		h.jsonError(w, "failed to store telemetry batch", http.StatusInternalServerError)
+		return
+	}
+	stored := out.stored
+	rejected = append(rejected, out.failed...)
+	sort.Slice(rejected, func(i, j int) bool { return rejected[i].Index < rejected[j].Index })
+
+	for i := range stored {
 		// Publish each reading
-		if err := h.publishTelemetry(ctx, data); err != nil {
+		if err := h.publishTelemetry(ctx, &stored[i]); err != nil {
 			h.logger.Error("failed to publish telemetry event",
 				"request_id", reqID,
 				"error", err,
@@ -148,13 +276,105 @@ func (h *Handlers) HandleTelemetryBatch(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	h.applyRollups(ctx, reqID, stored)
+
+	if out.duplicates > 0 && len(stored) == 0 && len(out.failed) == 0 {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+
+	// Duplicates count as saved so a retried request reports the original result
 	h.jsonResponse(w, map[string]interface{}{
-		"saved":    saved,
-		"received": len(readings),
+		"saved":      len(stored) + out.duplicates,
+		"duplicates": out.duplicates,
+		"received":   len(readings),
+		"mode":       mode,
+		"rejected":   rejected,
 	}, http.StatusCreated)
 }
 
+// parseBatchMode reads the ?mode= batch write mode (default best_effort)
+func parseBatchMode(r *http.Request) (string, error) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "":
+		return BatchBestEffort, nil
+	case BatchAtomic, BatchBestEffort:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode: must be %s or %s", BatchAtomic, BatchBestEffort)
+	}
+}
+
+// batchSaveOutcome is the result of saveTelemetryBatch
+type batchSaveOutcome struct {
+	stored     []TelemetryData  // Newly written readings, with IDs
+	duplicates int              // Readings already stored (idempotent retries and in-request repeats)
+	failed     []BatchItemError // Best-effort write failures
+}
+
+// saveTelemetryBatch stores readings with a single SaveBatch call. Readings with a preset
+// (idempotent) ID that was already stored, or that repeat an earlier reading of the same
+// request, are counted as duplicates instead of being written again. indexes maps each
+// reading to its position in the request. An error means nothing was stored.
+func (h *Handlers) saveTelemetryBatch(ctx context.Context, reqID string, readings []TelemetryData, indexes []int, mode string) (batchSaveOutcome, error) {
+	var out batchSaveOutcome
+
+	// Drop in-request repeats: a document can only be created once per write
+	seen := make(map[string]bool, len(readings))
+	unique := make([]TelemetryData, 0, len(readings))
+	uniqueIdx := make([]int, 0, len(readings))
+	for i := range readings {
+		if id := readings[i].ID; id != "" {
+			if seen[id] {
+				out.duplicates++
+				continue
+			}
+			seen[id] = true
+		}
+		unique = append(unique, readings[i])
+		uniqueIdx = append(uniqueIdx, indexes[i])
+	}
+	if len(unique) == 0 {
+		return out, nil
+	}
+
+	results, err := h.telemetryStore.SaveBatch(ctx, unique, mode)
+	var partial *BatchWriteError
+	if err != nil && !errors.As(err, &partial) {
+		h.logger.Error("failed to store telemetry batch",
+			"request_id", reqID,
+			"error", err,
+			"device_id", unique[0].DeviceID,
+			"mode", mode,
+			"readings", len(unique),
+		)
+		return out, err
+	}
+
+	out.stored = make([]TelemetryData, 0, len(unique))
+	for i := range unique {
+		if partial != nil && partial.Failed[i] != nil {
+			h.logger.Error("failed to store telemetry in batch",
+				"request_id", reqID,
+				"error", partial.Failed[i],
+				"device_id", unique[i].DeviceID,
+				"index", uniqueIdx[i],
+			)
+			out.failed = append(out.failed, BatchItemError{Index: uniqueIdx[i], Category: RejectStorage, Code: ReasonStoreFailed, Message: "failed to store reading"})
+			continue
+		}
+		if results[i].Duplicate {
+			out.duplicates++
+			continue
+		}
+		unique[i].ID = results[i].ID
+		out.stored = append(out.stored, unique[i])
+	}
+	return out, nil
+}
+
 // GetTelemetry handles GET /telemetry - retrieves telemetry for authenticated device
+// Supports from/to (RFC 3339), repeatable type filters and order=asc|desc on the reading timestamp,
+// paginated via limit + page_token (next_page_token is returned while more results exist)
 func (h *Handlers) GetTelemetry(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	reqID := middleware.GetRequestID(ctx)
@@ -166,23 +386,70 @@ func (h *Handlers) GetTelemetry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse and validate limit parameter
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100
-	if limitStr != "" {
-		l, err := strconv.Atoi(limitStr)
-		if err != nil || l < 1 {
-			h.jsonError(w, "invalid limit: must be a positive integer", http.StatusBadRequest)
+	query := r.URL.Query()
+
+	limit, err := parsePageSize(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	after, err := decodePageToken(query.Get("page_token"))
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := TelemetryQuery{
+		Limit: limit,
+		Order: OrderDesc,
+	}
+
+	// Time window (RFC 3339, from inclusive, to exclusive)
+	if fromStr := query.Get("from"); fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			h.jsonError(w, "invalid from: must be an RFC 3339 timestamp", http.StatusBadRequest)
 			return
 		}
-		if l > 1000 {
-			h.jsonError(w, "invalid limit: maximum is 1000", http.StatusBadRequest)
+		q.From = from.UTC()
+	}
+	if toStr := query.Get("to"); toStr != "" {
+		to, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			h.jsonError(w, "invalid to: must be an RFC 3339 timestamp", http.StatusBadRequest)
 			return
 		}
-		limit = l
+		q.To = to.UTC()
 	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		h.jsonError(w, "invalid time range: to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	// Measurement types (repeatable: ?type=temperature&type=humidity)
+	types := query["type"]
+	if len(types) > MaxTelemetryQueryTypes {
+		h.jsonError(w, fmt.Sprintf("too many types: maximum is %d", MaxTelemetryQueryTypes), http.StatusBadRequest)
+		return
+	}
+	for _, t := range types {
+		if err := validate.TelemetryType(t); err != nil {
+			h.jsonError(w, fmt.Sprintf("invalid telemetry type: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	q.Types = types
 
-	results, err := h.telemetryStore.GetByDeviceID(ctx, deviceID, limit)
+	if order := query.Get("order"); order != "" {
+		if order != OrderAsc && order != OrderDesc {
+			h.jsonError(w, "invalid order: must be asc or desc", http.StatusBadRequest)
+			return
+		}
+		q.Order = order
+	}
+
+	results, next, err := h.telemetryStore.QueryPage(ctx, deviceID, q, after)
 	if err != nil {
 		h.logger.Error("failed to retrieve telemetry",
 			"request_id", reqID,
@@ -193,10 +460,15 @@ func (h *Handlers) GetTelemetry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.jsonResponse(w, map[string]interface{}{
+	response := map[string]interface{}{
 		"data":  results,
 		"count": len(results),
-	}, http.StatusOK)
+	}
+	if token := encodePageToken(next); token != "" {
+		response["next_page_token"] = token
+	}
+
+	h.jsonResponse(w, response, http.StatusOK)
 }
 
 // publishTelemetry publishes telemetry data to event stream
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/cbor"
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/msgpack"
+)
+
+// Binary request body media types of POST /telemetry and /telemetry/batch
+const (
+	CBORContentType    = "application/cbor"
+	MsgpackContentType = "application/msgpack"
+)
+
+// telemetryBodyDecoder returns the decoder for a binary telemetry body, or nil for
+// JSON (the default for any other Content-Type, as before binary bodies existed).
+func telemetryBodyDecoder(r *http.Request) func([]byte) (interface{}, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case CBORContentType:
+		return cbor.Decode
+	case MsgpackContentType, "application/x-msgpack", "application/vnd.msgpack":
+		return msgpack.Decode
+	}
+	return nil
+}
+
+// decodeTelemetryBody decodes a JSON, CBOR or MessagePack request body into a
+// *TelemetryData or *[]TelemetryData. Binary bodies are decoded into the readings
+// directly: byte strings become bytes_value as they are, and CBOR date/time tags or
+// MessagePack timestamps become timestamps.
+func decodeTelemetryBody(r *http.Request, v interface{}) error {
+	decode := telemetryBodyDecoder(r)
+	if decode == nil {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	generic, err := decode(body)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *TelemetryData:
+		return telemetryFromValue(generic, v)
+	case *[]TelemetryData:
+		items, ok := generic.([]interface{})
+		if !ok {
+			return errors.New("expected an array of readings")
+		}
+		readings := make([]TelemetryData, len(items))
+		for i, item := range items {
+			if err := telemetryFromValue(item, &readings[i]); err != nil {
+				return fmt.Errorf("reading %d: %w", i, err)
+			}
+		}
+		*v = readings
+		return nil
+	default:
+		return fmt.Errorf("cannot decode telemetry into %T", v)
+	}
+}
+
+// telemetryFromValue fills d from a decoded CBOR/MessagePack map, accepting the fields
+// and value forms of the JSON body. Unknown fields and null values are ignored; the
+// server-assigned id, device_id and created_at are not read.
+func telemetryFromValue(v interface{}, d *TelemetryData) error {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("expected a map")
+	}
+
+	var err error
+	for key, value := range fields {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "type":
+			d.Type, err = decodedString(value)
+		case "unit":
+			d.Unit, err = decodedString(value)
+		case "value_type":
+			d.ValueType, err = decodedString(value)
+		case "msg_id":
+			d.MsgID, err = decodedString(value)
+		case "timestamp":
+			d.Timestamp, err = decodedTime(value)
+		case "value":
+			d.Value, err = decodedFloat(value)
+		case "int_value":
+			var n int64
+			n, err = decodedInt(value)
+			d.IntValue = &n
+		case "uint_value":
+			var n uint64
+			n, err = decodedUint(value)
+			d.UintValue = &n
+		case "bool_value":
+			b, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("expected a boolean, got %T", value)
+			}
+			d.BoolValue = &b
+		case "string_value":
+			var s string
+			s, err = decodedString(value)
+			d.StringValue = &s
+		case "bytes_value":
+			d.BytesValue, err = decodedBytes(value)
+		case "list_value":
+			d.ListValue, err = decodedFloats(value)
+		case "metadata":
+			d.Metadata, err = decodedMetadata(value)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func decodedString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %T", v)
+	}
+	return s, nil
+}
+
+// decodedTime accepts a date/time tag or timestamp extension, or RFC 3339 text
+func decodedTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	}
+	return time.Time{}, fmt.Errorf("expected a timestamp, got %T", v)
+}
+
+func decodedFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, errors.New("must be a finite number")
+		}
+		return n, nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+// decodedInt accepts integers, and floats without a fraction, within the int64 range
+func decodedInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not a signed 64-bit integer", v)
+}
+
+// decodedUint accepts unsigned integers, floats without a fraction and decimal text
+func decodedUint(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case float64:
+		if n == math.Trunc(n) && n >= 0 && n < math.MaxUint64 {
+			return uint64(n), nil
+		}
+	case string:
+		if u, err := strconv.ParseUint(n, 10, 64); err == nil {
+			return u, nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not an unsigned 64-bit integer", v)
+}
+
+// decodedBytes accepts a byte string, or base64 text as in JSON bodies
+func decodedBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return base64.StdEncoding.DecodeString(b)
+	}
+	return nil, fmt.Errorf("expected a byte string, got %T", v)
+}
+
+func decodedFloats(v interface{}) ([]float64, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %T", v)
+	}
+	list := make([]float64, len(items))
+	for i, item := range items {
+		f, err := decodedFloat(item)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		list[i] = f
+	}
+	return list, nil
+}
+
+// decodedMetadata converts a decoded map to values Firestore can store: integers that
+// do not fit int64 become floats, non-finite floats are rejected
+func decodedMetadata(v interface{}) (map[string]interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", v)
+	}
+	for key, value := range m {
+		value, err := metadataValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func metadataValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case uint64:
+		if val <= math.MaxInt64 {
+			return int64(val), nil
+		}
+		return float64(val), nil
+	case float64:
+		return decodedFloat(val)
+	case map[string]interface{}:
+		return decodedMetadata(val)
+	case []interface{}:
+		for i, item := range val {
+			item, err := metadataValue(item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = item
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func postTelemetryBody(t *testing.T, handler http.HandlerFunc, path, contentType, hexBody string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := hex.DecodeString(hexBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestHandleTelemetry_CBOR(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	// {"type": "temperature", "value": 21.5 (float32), "device_id": "spoofed",
+	//  "timestamp": 1(1767225600), "unit": "C"}
+	w := postTelemetryBody(t, h.HandleTelemetry, "/telemetry", "application/cbor",
+		"a564747970656b74656d70657261747572656576616c7565fa41ac0000696465766963655f69646773706f6f6665646974696d657374616d70c11a6955b90064756e69746143")
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response TelemetryData
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.DeviceID != telTestDeviceUUID {
+		t.Errorf("expected device_id from auth context, got %q", response.DeviceID)
+	}
+	if response.Type != "temperature" || response.Value != 21.5 || response.Unit != "C" {
+		t.Errorf("unexpected reading: %+v", response)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !response.Timestamp.Equal(want) {
+		t.Errorf("expected timestamp %s, got %s", want, response.Timestamp)
+	}
+}
+
+func TestHandleTelemetry_CBORByteString(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	// {"type": "frame", "bytes_value": h'010203'}
+	w := postTelemetryBody(t, h.HandleTelemetry, "/telemetry", "application/cbor; charset=binary",
+		"a26474797065656672616d656b62797465735f76616c756543010203")
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	for _, d := range mockStore.data {
+		if d.ValueType != ValueTypeBytes || !bytes.Equal(d.BytesValue, []byte{1, 2, 3}) {
+			t.Errorf("unexpected reading: %+v", d)
+		}
+	}
+}
+
+func TestHandleTelemetry_InvalidBinaryBody(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	tests := []struct {
+		contentType string
+		hexBody     string
+	}{
+		{CBORContentType, "a1"},                             // Truncated map
+		{CBORContentType, "a16474797065f97e00"},             // {"type": NaN}
+		{MsgpackContentType, "c1"},                          // Never-used type byte
+		{MsgpackContentType, "81a474797065a139"},            // {"type": "9"} fails validation
+		{CBORContentType, "a164747970656b74656d7065726174"}, // Truncated text
+	}
+	for _, tt := range tests {
+		w := postTelemetryBody(t, h.HandleTelemetry, "/telemetry", tt.contentType, tt.hexBody)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status %d, got %d", tt.contentType, tt.hexBody, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestHandleTelemetryBatch_Msgpack(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	// [{"type": "temperature", "value": 21.5, "timestamp": <timestamp 32: 1767225600>},
+	//  {"type": "bad type!", "int_value": -1}]
+	w := postTelemetryBody(t, h.HandleTelemetryBatch, "/telemetry/batch", "application/msgpack",
+		"9283a474797065ab74656d7065726174757265a576616c7565cb4035800000000000a974696d657374616d70d6ff6955b90082a474797065a9626164207479706521a9696e745f76616c7565ff")
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response struct {
+		Saved    int              `json:"saved"`
+		Rejected []BatchItemError `json:"rejected"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Saved != 1 || len(response.Rejected) != 1 || response.Rejected[0].Code != ReasonInvalidType {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	for _, d := range mockStore.data {
+		if d.DeviceID != telTestDeviceUUID || d.Value != 21.5 || !d.Timestamp.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected reading: %+v", d)
+		}
+	}
+}
+
+func TestHandleTelemetryBatch_CBORNotArray(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	w := postTelemetryBody(t, h.HandleTelemetryBatch, "/telemetry/batch", CBORContentType, "a0") // {}
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestTelemetryFromValue(t *testing.T) {
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var d TelemetryData
+	err := telemetryFromValue(map[string]interface{}{
+		"type":        "counter",
+		"timestamp":   ts,
+		"uint_value":  uint64(math.MaxUint64),
+		"bytes_value": []byte{0xff, 0x00},
+		"list_value":  []interface{}{uint64(1), int64(-2), 2.5},
+		"metadata":    map[string]interface{}{"boot": uint64(7), "raw": []byte{1}},
+		"device_id":   "spoofed",
+		"extra":       "ignored",
+		"unit":        nil,
+	}, &d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Type != "counter" || !d.Timestamp.Equal(ts) || d.DeviceID != "" {
+		t.Errorf("unexpected reading: %+v", d)
+	}
+	if d.UintValue == nil || *d.UintValue != math.MaxUint64 {
+		t.Errorf("expected exact uint_value, got %v", d.UintValue)
+	}
+	if !bytes.Equal(d.BytesValue, []byte{0xff, 0x00}) || !slices.Equal(d.ListValue, []float64{1, -2, 2.5}) {
+		t.Errorf("unexpected values: %v %v", d.BytesValue, d.ListValue)
+	}
+	if d.Metadata["boot"] != int64(7) || !bytes.Equal(d.Metadata["raw"].([]byte), []byte{1}) {
+		t.Errorf("unexpected metadata: %#v", d.Metadata)
+	}
+
+	invalid := []map[string]interface{}{
+		{"type": int64(1)},
+		{"int_value": uint64(math.MaxUint64)},
+		{"int_value": 1.5},
+		{"uint_value": int64(-1)},
+		{"bool_value": "true"},
+		{"value": math.Inf(1)},
+		{"list_value": []interface{}{"1"}},
+		{"metadata": map[string]interface{}{"x": math.NaN()}},
+		{"timestamp": uint64(1767225600)},
+	}
+	for _, fields := range invalid {
+		if err := telemetryFromValue(fields, &TelemetryData{}); err == nil {
+			t.Errorf("%v: expected error", fields)
+		}
+	}
+}
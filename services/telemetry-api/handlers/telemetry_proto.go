@@ -1,22 +1,28 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"strconv"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
 )
 
 // Measurement represents a decoded measurement from the device.
 // ID is the semantic identifier defined by firmware (0 to UINT32_MAX).
-// Value type is auto-detected from the protobuf wire format.
+// Value type is auto-detected from the protobuf wire format, then re-decoded
+// from Fields using the schema's declared type (see resolveMeasurementValues).
 type Measurement struct {
-	ID    uint32
-	Value interface{}
+	ID     uint32
+	Value  interface{}
+	MsgID  string        // Optional client message ID (idempotent retries)
+	Fields []proto.Field // Raw value fields in wire order
 }
 
 // Measurement proto field numbers (defined by the proto schema)
@@ -29,59 +35,235 @@ const (
 	measurementFieldUint32 uint32 = 6
 	measurementFieldUint64 uint32 = 7
 	measurementFieldBool   uint32 = 8
+	measurementFieldMsgID  uint32 = 9
+	measurementFieldString uint32 = 10
+	measurementFieldBytes  uint32 = 11
+	measurementFieldPacked uint32 = 12 // Packed repeated scalar (schema type "repeated <scalar>")
 )
 
+// MeasurementBatch and SampleGroup proto field numbers
+const (
+	batchFieldMeasurements uint32 = 1 // repeated Measurement (sampled at the batch timestamp)
+	batchFieldGroups       uint32 = 2 // repeated SampleGroup (offline backlog)
+
+	groupFieldTimestamp    uint32 = 1 // uint64 milliseconds since epoch
+	groupFieldMeasurements uint32 = 2 // repeated Measurement
+)
+
+// SampleGroup is a set of measurements sampled at the same time.
+// Devices buffering readings while offline upload one group per sample.
+type SampleGroup struct {
+	TimestampMs  uint64 // 0 = use the batch timestamp
+	Measurements []Measurement
+}
+
+// MeasurementBatch is a decoded MeasurementBatch protobuf
+type MeasurementBatch struct {
+	Measurements []Measurement // Measurements sharing the batch timestamp
+	Groups       []SampleGroup // Measurements with their own timestamps
+}
+
 // decodeMeasurementBatch decodes a MeasurementBatch protobuf into Measurement structs.
 // Uses the generic protobuf decoder and interprets fields based on the measurement schema.
-func decodeMeasurementBatch(data []byte) ([]Measurement, error) {
-	// Decode the batch - field 1 contains repeated Measurement messages
-	messages, err := proto.DecodeRepeated(data, 1)
-	if err != nil {
-		return nil, err
+// Device payloads are untrusted: decoding is strict (no groups) with depth and field limits,
+// which also apply to the embedded groups and measurements.
+// The batch is walked in a single pass with proto.Reader, without intermediate messages.
+func decodeMeasurementBatch(data []byte) (*MeasurementBatch, error) {
+	batch := &MeasurementBatch{}
+	d := &batchDecoder{}
+
+	r := proto.NewReaderWithOptions(data, proto.StrictOptions)
+	for r.Next() {
+		field := r.Field()
+		if field.Value.WireType != proto.WireBytes {
+			continue
+		}
+		switch field.Num {
+		case batchFieldMeasurements:
+			m, err := d.measurement(field.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode embedded message: %w", err)
+			}
+			batch.Measurements = append(batch.Measurements, m)
+		case batchFieldGroups:
+			group, err := d.sampleGroup(field.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode sample group: %w", err)
+			}
+			batch.Groups = append(batch.Groups, group)
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode outer message: %w", err)
 	}
 
-	measurements := make([]Measurement, 0, len(messages))
-	for _, msg := range messages {
-		m := Measurement{}
+	return batch, nil
+}
 
-		// Get measurement ID (field 1)
-		if idField := msg.GetField(measurementFieldID); idField != nil {
-			m.ID = idField.Value.AsUint32()
-		}
+// batchDecoder holds state shared by the measurements of one batch
+type batchDecoder struct {
+	// Backing array of Measurement.Fields: one allocation per growth instead of one per
+	// measurement. Each measurement's slice is capped, so appending to it copies.
+	fields []proto.Field
+}
 
-		// Auto-detect value from which oneof field is present
-		for _, field := range msg {
-			switch field.Num {
-			case measurementFieldFloat:
-				m.Value = field.Value.AsFloat32()
-			case measurementFieldDouble:
-				m.Value = field.Value.AsFloat64()
-			case measurementFieldInt32:
-				m.Value = field.Value.AsInt32()
-			case measurementFieldInt64:
-				m.Value = field.Value.AsInt64()
-			case measurementFieldUint32:
-				m.Value = field.Value.AsUint32()
-			case measurementFieldUint64:
-				m.Value = field.Value.AsUint64()
-			case measurementFieldBool:
-				m.Value = field.Value.AsBool()
-			default:
+// sampleGroup decodes an embedded SampleGroup message
+func (d *batchDecoder) sampleGroup(v proto.Value) (SampleGroup, error) {
+	group := SampleGroup{}
+	hasTimestamp := false
+
+	r := v.Reader()
+	for r.Next() {
+		field := r.Field()
+		switch field.Num {
+		case groupFieldTimestamp:
+			if !hasTimestamp { // First occurrence wins
+				group.TimestampMs = field.Value.AsUint64()
+				hasTimestamp = true
+			}
+		case groupFieldMeasurements:
+			if field.Value.WireType != proto.WireBytes {
 				continue
 			}
-			break // Found the value field
+			m, err := d.measurement(field.Value)
+			if err != nil {
+				return SampleGroup{}, fmt.Errorf("failed to decode embedded message: %w", err)
+			}
+			group.Measurements = append(group.Measurements, m)
+		}
+	}
+	return group, r.Err()
+}
+
+// measurement decodes an embedded Measurement message
+func (d *batchDecoder) measurement(v proto.Value) (Measurement, error) {
+	m := Measurement{}
+	hasID, hasMsgID, hasValue := false, false, false
+	start := len(d.fields)
+
+	r := v.Reader()
+	for r.Next() {
+		field := r.Field()
+		switch field.Num {
+		case measurementFieldID:
+			if !hasID {
+				m.ID = field.Value.AsUint32()
+				hasID = true
+			}
+			continue
+		case measurementFieldMsgID:
+			if !hasMsgID {
+				m.MsgID = field.Value.AsString()
+				hasMsgID = true
+			}
+			continue
+		}
+
+		// Keep every value field for schema-driven decoding
+		d.fields = append(d.fields, field)
+
+		// Auto-detect value from the first oneof field present
+		if !hasValue {
+			m.Value, hasValue = wireValue(field)
 		}
+	}
+	if err := r.Err(); err != nil {
+		return Measurement{}, err
+	}
+	if end := len(d.fields); end > start {
+		m.Fields = d.fields[start:end:end]
+	}
+
+	return m, nil
+}
 
-		measurements = append(measurements, m)
+// wireValue returns the value of a Measurement oneof field, typed by its field number
+func wireValue(field proto.Field) (interface{}, bool) {
+	switch field.Num {
+	case measurementFieldFloat:
+		return field.Value.AsFloat32(), true
+	case measurementFieldDouble:
+		return field.Value.AsFloat64(), true
+	case measurementFieldInt32:
+		return field.Value.AsInt32(), true
+	case measurementFieldInt64:
+		return field.Value.AsInt64(), true
+	case measurementFieldUint32:
+		return field.Value.AsUint32(), true
+	case measurementFieldUint64:
+		return field.Value.AsUint64(), true
+	case measurementFieldBool:
+		return field.Value.AsBool(), true
+	case measurementFieldString:
+		return field.Value.AsString(), true
+	case measurementFieldBytes:
+		return append([]byte(nil), field.Value.Bytes...), true
 	}
+	return nil, false
+}
+
+// Default sample timestamp acceptance window
+const (
+	DefaultMaxSampleAge        = 30 * 24 * time.Hour
+	DefaultMaxSampleFutureSkew = 5 * time.Minute
+)
+
+// TimestampWindow bounds device-supplied sample timestamps relative to server time.
+// Zero fields use DefaultMaxSampleAge / DefaultMaxSampleFutureSkew.
+type TimestampWindow struct {
+	MaxAge        time.Duration // How far in the past a sample may be (offline backlog)
+	MaxFutureSkew time.Duration // How far ahead a device clock may run
+}
+
+// check returns an error when ts lies outside the window around now
+func (tw TimestampWindow) check(ts, now time.Time) error {
+	maxAge, maxSkew := tw.MaxAge, tw.MaxFutureSkew
+	if maxAge == 0 {
+		maxAge = DefaultMaxSampleAge
+	}
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxSampleFutureSkew
+	}
+	if ts.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("timestamp %s is older than %s", ts.Format(time.RFC3339), maxAge)
+	}
+	if ts.After(now.Add(maxSkew)) {
+		return fmt.Errorf("timestamp %s is more than %s in the future", ts.Format(time.RFC3339), maxSkew)
+	}
+	return nil
+}
 
-	return measurements, nil
+// timestampMeasurement returns the time of a "timestamp" measurement (milliseconds), if any
+func timestampMeasurement(measurements []Measurement, idToMeta map[uint32]MeasurementMeta) (time.Time, bool) {
+	for _, m := range measurements {
+		meta, ok := idToMeta[m.ID]
+		if !ok || meta.Name != "timestamp" {
+			continue
+		}
+		switch ts := m.Value.(type) {
+		case uint64:
+			return time.UnixMilli(int64(ts)).UTC(), true
+		case int64:
+			return time.UnixMilli(ts).UTC(), true
+		case uint32:
+			return time.UnixMilli(int64(ts)).UTC(), true
+		case int32:
+			return time.UnixMilli(int64(ts)).UTC(), true
+		}
+		return time.Time{}, false
+	}
+	return time.Time{}, false
 }
 
 // HandleTelemetryProto handles POST /telemetry/proto
-// Accepts protobuf-encoded MeasurementBatch and decodes it using the device's schema
+// Accepts protobuf-encoded MeasurementBatch and decodes it using the device's schema.
+// Payloads that fail because of the schema (missing, mismatched or incomplete) are
+// quarantined for replay when a quarantine store is configured; malformed payloads are
+// rejected, as no schema change can make them decode.
 // Must be called with AuthMiddleware - device ID comes from verified token
 func (h *Handlers) HandleTelemetryProto(w http.ResponseWriter, r *http.Request) {
+	reqID := middleware.GetRequestID(r.Context())
+
 	// Get device ID from authenticated context (set by AuthMiddleware)
 	deviceID := GetDeviceIDFromContext(r.Context())
 	if deviceID == "" {
@@ -89,6 +271,19 @@ func (h *Handlers) HandleTelemetryProto(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Storage mode: ?mode=atomic (all or nothing) or best_effort (default)
+	mode, err := parseBatchMode(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestKey, err := idempotencyKey(r)
+	if err != nil {
+		h.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Lookup device for app/version info
 	device, err := h.deviceStore.GetByID(r.Context(), deviceID)
 	if err != nil {
@@ -96,25 +291,150 @@ func (h *Handlers) HandleTelemetryProto(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get schema for this device's app/version (cached)
-	schema, err := h.schemaStore.Get(r.Context(), device.AppName, device.AppVersion)
+	// Read protobuf body into a pooled buffer; nothing may keep it past this request
+	buf, err := readProtoBody(r)
 	if err != nil {
-		h.jsonError(w, "schema not found for device app/version", http.StatusNotFound)
+		h.jsonError(w, "failed to read request body", http.StatusBadRequest)
 		return
 	}
+	defer releaseProtoBody(buf)
+	body := buf.Bytes()
 
-	// Read protobuf body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		h.jsonError(w, "failed to read request body", http.StatusBadRequest)
+	up := protoUpload{
+		deviceID:   deviceID,
+		appName:    device.AppName,
+		appVersion: device.AppVersion,
+		body:       body,
+		mode:       mode,
+		requestKey: requestKey,
+		receivedAt: time.Now().UTC(),
+	}
+	res, ingestErr := h.ingestProto(r.Context(), reqID, up)
+	if ingestErr != nil {
+		// The payload is kept, so the device must not resend it
+		if id, ok := h.quarantinePayload(r.Context(), reqID, up, ingestErr.reason, ingestErr.message, nil); ok {
+			h.jsonResponse(w, map[string]interface{}{
+				"message":       "telemetry quarantined",
+				"quarantine_id": id,
+				"reason":        ingestErr.reason,
+				"error":         ingestErr.message,
+			}, http.StatusAccepted)
+			return
+		}
+		h.jsonError(w, ingestErr.message, ingestErr.status)
 		return
 	}
 
+	// Update device last seen
+	if err := h.deviceStore.UpdateLastSeen(r.Context(), deviceID); err != nil {
+		h.logger.Warn("failed to update device last_seen", "error", err, "device_id", deviceID)
+	}
+
+	if res.out.duplicates > 0 && len(res.out.stored) == 0 && len(res.rejected) == 0 && len(res.rejectedGroups) == 0 {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	response := map[string]interface{}{
+		"message":      "telemetry received",
+		"measurements": res.saved,
+		"duplicates":   res.out.duplicates,
+	}
+	if len(res.rejected) > 0 {
+		response["rejected"] = res.rejected
+	}
+	if len(res.rejectedGroups) > 0 {
+		response["rejected_groups"] = res.rejectedGroups
+	}
+	if len(res.unknownIDs) > 0 {
+		// Measurements the schema does not know yet are kept for replay
+		if id, ok := h.quarantinePayload(r.Context(), reqID, up, QuarantineUnknownMeasurement, unknownIDsMessage(res.unknownIDs), res.unknownIDs); ok {
+			response["quarantine_id"] = id
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// protoBodyPool recycles request body buffers of HandleTelemetryProto.
+// io.ReadAll regrows and copies its buffer several times for a large batch.
+var protoBodyPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledProtoBody caps the buffers returned to protoBodyPool (the telemetry body limit)
+const maxPooledProtoBody = 1 << 20
+
+// readProtoBody reads the request body into a buffer from protoBodyPool.
+// Release it with releaseProtoBody.
+func readProtoBody(r *http.Request) (*bytes.Buffer, error) {
+	buf := protoBodyPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if r.ContentLength > 0 && r.ContentLength <= maxPooledProtoBody {
+		buf.Grow(int(r.ContentLength) + bytes.MinRead) // ReadFrom needs MinRead spare bytes to see EOF
+	}
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		releaseProtoBody(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// releaseProtoBody returns a buffer to protoBodyPool
+func releaseProtoBody(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledProtoBody+bytes.MinRead {
+		return // Let oversized buffers be collected
+	}
+	protoBodyPool.Put(buf)
+}
+
+// protoUpload is a protobuf MeasurementBatch to ingest for a device
+type protoUpload struct {
+	deviceID   string
+	appName    string // Firmware app and version selecting the schema
+	appVersion string
+	body       []byte // May be a pooled buffer: copy anything kept after the request
+	mode       string
+	requestKey string          // Idempotency key ("" = none)
+	onlyIDs    map[uint32]bool // Ingest only these measurement IDs (nil = all)
+	receivedAt time.Time       // Server time of the upload: default reading time and TimestampWindow reference
+}
+
+// protoIngestResult summarizes an ingested protobuf upload
+type protoIngestResult struct {
+	saved          int // Stored plus duplicate readings
+	out            batchSaveOutcome
+	rejected       []BatchItemError // Invalid measurements, indexed across the request
+	rejectedGroups []BatchItemError
+	unknownIDs     []uint32 // Measurement IDs missing from the schema (sorted)
+}
+
+// protoIngestError is a rejected protobuf upload. Rejections with a quarantine
+// reason depend on the schema and can succeed on replay once it is fixed.
+type protoIngestError struct {
+	status  int
+	message string
+	reason  string // Quarantine* reason ("" = not quarantined)
+}
+
+// ingestProto decodes a protobuf upload with the schema of its app/version and stores
+// the readings. Shared by HandleTelemetryProto and quarantine replays.
+func (h *Handlers) ingestProto(ctx context.Context, reqID string, up protoUpload) (*protoIngestResult, *protoIngestError) {
 	// Decode protobuf using the measurement-specific decoder
-	measurements, err := decodeMeasurementBatch(body)
+	batch, err := decodeMeasurementBatch(up.body)
 	if err != nil {
-		h.jsonError(w, fmt.Sprintf("failed to decode protobuf: %v", err), http.StatusBadRequest)
-		return
+		return nil, &protoIngestError{status: http.StatusBadRequest, message: fmt.Sprintf("failed to decode protobuf: %v", err)}
+	}
+
+	// Get schema for this device's app/version (cached)
+	schema, err := h.schemaStore.Get(ctx, up.appName, up.appVersion)
+	if err != nil {
+		return nil, &protoIngestError{http.StatusNotFound, "schema not found for device app/version", QuarantineSchemaNotFound}
+	}
+	if schema.Version != "" && schema.Version != up.appVersion {
+		h.logger.Debug("using fallback schema",
+			"request_id", reqID,
+			"app", up.appName,
+			"app_version", up.appVersion,
+			"schema_version", schema.Version,
+		)
 	}
 
 	// Build ID lookup map from schema (id -> metadata)
@@ -123,131 +443,151 @@ func (h *Handlers) HandleTelemetryProto(w http.ResponseWriter, r *http.Request)
 		idToMeta[meta.ID] = meta
 	}
 
-	// Process measurements
-	now := time.Now().UTC()
-	var timestamp time.Time
-	var savedCount int
-
-	// First pass: find timestamp
-	for _, m := range measurements {
-		meta, ok := idToMeta[m.ID]
-		if ok && meta.Name == "timestamp" {
-			// Timestamp is in milliseconds
-			switch ts := m.Value.(type) {
-			case uint64:
-				timestamp = time.UnixMilli(int64(ts))
-			case int64:
-				timestamp = time.UnixMilli(ts)
-			case uint32:
-				timestamp = time.UnixMilli(int64(ts))
-			case int32:
-				timestamp = time.UnixMilli(int64(ts))
-			}
-			break
+	// Interpret values with the types declared by the schema
+	if err := resolveMeasurementValues(batch.Measurements, idToMeta); err != nil {
+		return nil, &protoIngestError{http.StatusBadRequest, fmt.Sprintf("invalid measurement: %v", err), QuarantineInvalidMeasurement}
+	}
+	for g := range batch.Groups {
+		if err := resolveMeasurementValues(batch.Groups[g].Measurements, idToMeta); err != nil {
+			return nil, &protoIngestError{http.StatusBadRequest, fmt.Sprintf("invalid measurement in sample group %d: %v", g, err), QuarantineInvalidMeasurement}
 		}
 	}
 
-	// If no timestamp in payload, use server time
-	if timestamp.IsZero() {
+	// Process measurements as of the upload, also when replayed from quarantine
+	now := up.receivedAt
+
+	// Batch timestamp: a "timestamp" measurement (milliseconds), else server time
+	timestamp, ok := timestampMeasurement(batch.Measurements, idToMeta)
+	if !ok {
 		timestamp = now
+	} else if err := h.config.TimestampWindow.check(timestamp, now); err != nil {
+		return nil, &protoIngestError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid batch timestamp: %v", err)}
 	}
 
-	// Second pass: save measurements
-	for _, m := range measurements {
-		meta, ok := idToMeta[m.ID]
-		if !ok {
-			h.logger.Warn("unknown measurement ID", "id", m.ID, "device_id", deviceID)
-			continue
+	// Flat measurements come first, then each sample group with its own timestamp.
+	// Measurements are indexed in that order across the whole request (idempotency keys).
+	samples := append([]SampleGroup{{Measurements: batch.Measurements}}, batch.Groups...)
+	sampleTimes := make([]time.Time, len(samples)) // Zero = rejected sample group
+	sampleTimes[0] = timestamp
+	var rejectedGroups []BatchItemError
+	for g, group := range batch.Groups {
+		groupTime := timestamp
+		if group.TimestampMs > 0 {
+			groupTime = time.UnixMilli(int64(group.TimestampMs)).UTC()
+		} else if ts, ok := timestampMeasurement(group.Measurements, idToMeta); ok {
+			groupTime = ts
 		}
-
-		// Skip timestamp measurement (already extracted)
-		if meta.Name == "timestamp" {
+		if err := h.config.TimestampWindow.check(groupTime, now); err != nil {
+			rejectedGroups = append(rejectedGroups, BatchItemError{Index: g, Category: RejectValidation, Code: ReasonTimestampOutOfWindow, Message: err.Error()})
 			continue
 		}
+		sampleTimes[g+1] = groupTime
+	}
 
-		if m.Value == nil {
-			continue
-		}
+	// Convert measurements to readings
+	readings := make([]TelemetryData, 0, len(batch.Measurements))
+	indexes := make([]int, 0, len(batch.Measurements))
+	unknown := make(map[uint32]bool)
+	var rejected []BatchItemError
+	i := -1
+	for s, sample := range samples {
+		for _, m := range sample.Measurements {
+			i++
+			if sampleTimes[s].IsZero() {
+				continue // Rejected sample group
+			}
+			if up.onlyIDs != nil && !up.onlyIDs[m.ID] {
+				continue // Stored by an earlier attempt
+			}
 
-		// Convert to float64 for storage
-		floatVal, err := toFloat64(m.Value)
-		if err != nil {
-			h.logger.Warn("failed to convert value", "error", err, "measurement", meta.Name)
-			continue
-		}
+			meta, ok := idToMeta[m.ID]
+			if !ok {
+				h.logger.Warn("unknown measurement ID", "id", m.ID, "device_id", up.deviceID)
+				unknown[m.ID] = true
+				continue
+			}
 
-		data := &TelemetryData{
-			DeviceID:  deviceID,
-			Timestamp: timestamp,
-			Type:      meta.Name,
-			Value:     floatVal,
-			Unit:      meta.Unit,
-			CreatedAt: now,
-		}
+			// Skip timestamp measurement (already extracted)
+			if meta.Name == "timestamp" {
+				continue
+			}
 
-		if _, err := h.telemetryStore.Save(r.Context(), data); err != nil {
-			h.logger.Error("failed to save telemetry", "error", err, "measurement", meta.Name)
-			continue
+			if m.Value == nil {
+				continue
+			}
+
+			if err := validateMsgID(m.MsgID); err != nil {
+				rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonInvalidMsgID, Message: err.Error()})
+				continue
+			}
+
+			data := TelemetryData{
+				DeviceID:  up.deviceID,
+				Timestamp: sampleTimes[s],
+				Type:      meta.Name,
+				Unit:      meta.Unit,
+				MsgID:     m.MsgID,
+				CreatedAt: now,
+			}
+
+			// Keep the native value type (schema type, else wire type)
+			if err := setTypedValue(&data, meta.Type, m.Value); err != nil {
+				rejected = append(rejected, BatchItemError{Index: i, Category: RejectValidation, Code: ReasonInvalidValue, Message: err.Error()})
+				continue
+			}
+			setIdempotentID(&data, readingKey(m.MsgID, up.requestKey, i))
+			readings = append(readings, data)
+			indexes = append(indexes, i)
 		}
-		savedCount++
 	}
 
-	// Update device last seen
-	if err := h.deviceStore.UpdateLastSeen(r.Context(), deviceID); err != nil {
-		h.logger.Warn("failed to update device last_seen", "error", err, "device_id", deviceID)
+	if up.mode == BatchAtomic && len(readings) > MaxAtomicBatchSize {
+		return nil, &protoIngestError{status: http.StatusBadRequest, message: fmt.Sprintf("batch too large for atomic mode: maximum %d measurements", MaxAtomicBatchSize)}
+	}
+
+	// Save all measurements in one round trip
+	out, err := h.saveTelemetryBatch(ctx, reqID, readings, indexes, up.mode)
+	if err != nil {
+		return nil, &protoIngestError{status: http.StatusInternalServerError, message: "failed to store telemetry"}
 	}
 
-	// Publish event
-	if h.publisher != nil {
+	h.applyRollups(ctx, reqID, out.stored)
+
+	// Publish event (replayed readings were already published by the first attempt)
+	if h.publisher != nil && len(out.stored) > 0 {
 		eventData := map[string]interface{}{
-			"device_id":   deviceID,
-			"app_name":    device.AppName,
-			"app_version": device.AppVersion,
-			"count":       savedCount,
+			"device_id":   up.deviceID,
+			"app_name":    up.appName,
+			"app_version": up.appVersion,
+			"count":       len(out.stored),
 			"timestamp":   timestamp,
 		}
 		eventJSON, _ := json.Marshal(eventData)
-		if err := h.publisher.Publish(r.Context(), TelemetryTopic, eventJSON); err != nil {
+		if err := h.publisher.Publish(ctx, TelemetryTopic, eventJSON); err != nil {
 			h.logger.Warn("failed to publish telemetry event", "error", err)
 		}
 	}
 
+	res := &protoIngestResult{
+		// Duplicates count as saved so a retried request reports the original result
+		saved:          len(out.stored) + out.duplicates,
+		out:            out,
+		rejected:       append(rejected, out.failed...),
+		rejectedGroups: rejectedGroups,
+	}
+	slices.SortFunc(res.rejected, func(a, b BatchItemError) int { return a.Index - b.Index })
+	for id := range unknown {
+		res.unknownIDs = append(res.unknownIDs, id)
+	}
+	slices.Sort(res.unknownIDs)
+
 	h.logger.Info("telemetry batch processed",
-		"device_id", deviceID,
-		"measurements", savedCount,
+		"device_id", up.deviceID,
+		"measurements", res.saved,
+		"sample_groups", len(batch.Groups),
+		"rejected_groups", len(rejectedGroups),
+		"unknown_ids", len(res.unknownIDs),
 		"timestamp", timestamp,
 	)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":      "telemetry received",
-		"measurements": savedCount,
-	})
-}
-
-func toFloat64(v interface{}) (float64, error) {
-	switch val := v.(type) {
-	case float32:
-		return float64(val), nil
-	case float64:
-		return val, nil
-	case int32:
-		return float64(val), nil
-	case int64:
-		return float64(val), nil
-	case uint32:
-		return float64(val), nil
-	case uint64:
-		return float64(val), nil
-	case bool:
-		if val {
-			return 1, nil
-		}
-		return 0, nil
-	case string:
-		return strconv.ParseFloat(val, 64)
-	default:
-		return 0, fmt.Errorf("unsupported type: %T", v)
-	}
+	return res, nil
 }
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/proto"
+)
+
+const protoTestDeviceUUID = "550e8400-e29b-41d4-a716-446655440040"
+
+// protoMeasurement is a test measurement encoded as {id, double value}
+type protoMeasurement struct {
+	id    uint32
+	value float64
+}
+
+// appendBytesField appends a length-delimited field
+func appendBytesField(buf []byte, fieldNum uint32, data []byte) []byte {
+	return append(buf, new(proto.Builder).Bytes(fieldNum, data).Build()...)
+}
+
+// appendMeasurements encodes double-valued measurements as repeated field fieldNum
+func appendMeasurements(buf []byte, fieldNum uint32, measurements []protoMeasurement) []byte {
+	b := new(proto.Builder)
+	for _, m := range measurements {
+		b.Message(fieldNum, new(proto.Builder).
+			Uint32(measurementFieldID, m.id).
+			Double(measurementFieldDouble, m.value))
+	}
+	return append(buf, b.Build()...)
+}
+
+// encodeMeasurementBatch encodes a MeasurementBatch with double-valued measurements
+func encodeMeasurementBatch(measurements ...protoMeasurement) []byte {
+	return appendMeasurements(nil, batchFieldMeasurements, measurements)
+}
+
+// appendSampleGroup encodes a SampleGroup onto a MeasurementBatch
+func appendSampleGroup(batch []byte, ts time.Time, measurements ...protoMeasurement) []byte {
+	group := new(proto.Builder).Uint64(groupFieldTimestamp, uint64(ts.UnixMilli())).Build()
+	group = appendMeasurements(group, groupFieldMeasurements, measurements)
+	return appendBytesField(batch, batchFieldGroups, group)
+}
+
+func newProtoTestHandlers(t testing.TB) (*Handlers, *MockTelemetryStore) {
+	t.Helper()
+
+	devices := NewMockDeviceStore()
+	devices.Register(context.Background(), &Device{DeviceID: protoTestDeviceUUID, AppName: "measurement-probe", AppVersion: "1.0.0"})
+
+	schemas := NewMockSchemaStore()
+	schemas.Save(context.Background(), "measurement-probe", "1.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"temperature": {ID: 1, Name: "temperature", Type: "double", Unit: "°C"},
+			"humidity":    {ID: 2, Name: "humidity", Type: "double", Unit: "%"},
+		},
+	})
+
+	telemetry := NewMockTelemetryStore()
+	return NewWithStores(telemetry, nil, devices, schemas, nil, nil), telemetry
+}
+
+func postProto(h *Handlers, query string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/proto"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req = withDeviceContext(req, protoTestDeviceUUID)
+	w := httptest.NewRecorder()
+	h.HandleTelemetryProto(w, req)
+	return w
+}
+
+func TestHandleTelemetryProto_SavesBatch(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if telemetry.SaveBatchCalls != 1 {
+		t.Errorf("expected 1 SaveBatch call, got %d", telemetry.SaveBatchCalls)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["measurements"] != float64(2) {
+		t.Errorf("expected 2 measurements, got %v", response["measurements"])
+	}
+}
+
+func TestHandleTelemetryProto_AtomicFailure(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	telemetry.SaveBatchErrs = map[int]error{0: errors.New("write conflict")}
+
+	w := postProto(h, "?mode=atomic", encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40}))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if len(telemetry.data) != 0 {
+		t.Errorf("atomic batch must store nothing on failure, stored %d", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_BestEffortPartialFailure(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	telemetry.SaveBatchErrs = map[int]error{0: errors.New("write conflict")}
+
+	w := postProto(h, "", encodeMeasurementBatch(protoMeasurement{1, 21.5}, protoMeasurement{2, 40}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["measurements"] != float64(1) {
+		t.Errorf("expected 1 measurement, got %v", response["measurements"])
+	}
+}
+
+func TestHandleTelemetryProto_PackedWaveform(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	h.schemaStore.Save(context.Background(), "measurement-probe", "1.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"waveform": {ID: 3, Name: "waveform", Type: "repeated float"},
+		},
+	})
+
+	// 256 samples in a single packed field
+	var samples []byte
+	for i := 0; i < 256; i++ {
+		samples = binary.LittleEndian.AppendUint32(samples, math.Float32bits(float32(i)/4))
+	}
+	body := new(proto.Builder).Message(batchFieldMeasurements, new(proto.Builder).
+		Uint32(measurementFieldID, 3).
+		Bytes(measurementFieldPacked, samples)).Build()
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	for _, d := range telemetry.data {
+		if d.Type != "waveform" || len(d.ListValue) != 256 || d.ListValue[255] != 63.75 {
+			t.Errorf("unexpected reading: %+v", d)
+		}
+	}
+	if len(telemetry.data) != 1 {
+		t.Errorf("expected 1 reading, got %d", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_RejectsGroups(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+
+	// Deprecated group wire types are tolerated by proto.Decode but not in device payloads
+	body := encodeMeasurementBatch(protoMeasurement{1, 21.5})
+	body = append(body, 0x1b, 0x1c) // Empty group, field 3
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if len(telemetry.data) != 0 {
+		t.Errorf("expected nothing stored, got %d readings", len(telemetry.data))
+	}
+}
+
+func TestHandleTelemetryProto_InvalidMode(t *testing.T) {
+	h, _ := newProtoTestHandlers(t)
+
+	w := postProto(h, "?mode=all", encodeMeasurementBatch(protoMeasurement{1, 21.5}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleTelemetryProto_SampleGroups(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	older := now.Add(-2 * time.Hour)
+	body := encodeMeasurementBatch(protoMeasurement{1, 21.5})
+	body = appendSampleGroup(body, older, protoMeasurement{1, 19}, protoMeasurement{2, 55})
+	body = appendSampleGroup(body, now.Add(-time.Hour), protoMeasurement{1, 20})
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["measurements"] != float64(4) {
+		t.Errorf("expected 4 measurements, got %v", response["measurements"])
+	}
+
+	byValue := make(map[float64]time.Time)
+	for _, d := range telemetry.data {
+		byValue[d.Value] = d.Timestamp
+	}
+	if !byValue[19].Equal(older) || !byValue[55].Equal(older) {
+		t.Errorf("expected first group at %v, got %v / %v", older, byValue[19], byValue[55])
+	}
+	if !byValue[20].Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected second group at %v, got %v", now.Add(-time.Hour), byValue[20])
+	}
+	if byValue[21.5].Before(now) {
+		t.Errorf("flat measurement should use server time, got %v", byValue[21.5])
+	}
+}
+
+func TestHandleTelemetryProto_SampleGroupOutOfWindow(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	h.config.TimestampWindow = TimestampWindow{MaxAge: 24 * time.Hour, MaxFutureSkew: time.Minute}
+
+	now := time.Now().UTC()
+	var body []byte
+	body = appendSampleGroup(body, now.Add(-48*time.Hour), protoMeasurement{1, 1})
+	body = appendSampleGroup(body, now.Add(-time.Hour), protoMeasurement{1, 2})
+	body = appendSampleGroup(body, now.Add(time.Hour), protoMeasurement{1, 3})
+
+	w := postProto(h, "", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Measurements   int              `json:"measurements"`
+		RejectedGroups []BatchItemError `json:"rejected_groups"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Measurements != 1 || len(telemetry.data) != 1 {
+		t.Errorf("expected only the in-window group to be stored, got %d", response.Measurements)
+	}
+	if len(response.RejectedGroups) != 2 ||
+		response.RejectedGroups[0].Index != 0 || response.RejectedGroups[1].Index != 2 ||
+		response.RejectedGroups[0].Code != ReasonTimestampOutOfWindow {
+		t.Errorf("unexpected rejected groups: %+v", response.RejectedGroups)
+	}
+}
+
+func TestTimestampWindow_Defaults(t *testing.T) {
+	now := time.Now()
+	var tw TimestampWindow
+
+	if err := tw.check(now.Add(-DefaultMaxSampleAge+time.Minute), now); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := tw.check(now.Add(-DefaultMaxSampleAge-time.Minute), now); err == nil {
+		t.Error("expected error for sample older than the window")
+	}
+	if err := tw.check(now.Add(DefaultMaxSampleFutureSkew+time.Minute), now); err == nil {
+		t.Error("expected error for sample in the future")
+	}
+}
+
+// benchmarkMeasurementBatch encodes 500 double measurements: 300 flat and 10 sample groups of 20
+func benchmarkMeasurementBatch() []byte {
+	measurements := make([]protoMeasurement, 300)
+	for i := range measurements {
+		measurements[i] = protoMeasurement{uint32(i%2 + 1), float64(i)}
+	}
+	body := encodeMeasurementBatch(measurements...)
+	ts := time.Now()
+	for g := 0; g < 10; g++ {
+		body = appendSampleGroup(body, ts.Add(-time.Duration(g)*time.Minute), measurements[:20]...)
+	}
+	return body
+}
+
+func BenchmarkDecodeMeasurementBatch(b *testing.B) {
+	body := benchmarkMeasurementBatch()
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeMeasurementBatch(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHandleTelemetryProto(b *testing.B) {
+	body := benchmarkMeasurementBatch()
+	h, telemetry := newProtoTestHandlers(b)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if w := postProto(h, "", body); w.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		telemetry.data = make(map[string]TelemetryData)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 // Test UUIDs for telemetry tests
@@ -372,6 +373,143 @@ func TestGetTelemetry_TypeFilter(t *testing.T) {
 	}
 }
 
+func TestGetTelemetry_TimeRangeAndTypes(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, typ := range []string{"temperature", "humidity", "pressure", "temperature"} {
+		mockStore.Save(context.Background(), &TelemetryData{
+			DeviceID:  telTestDeviceUUID,
+			Type:      typ,
+			Value:     float64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/telemetry?from=2026-01-15T10:00:00Z&to=2026-01-15T13:00:00Z&type=temperature&type=humidity&order=asc", nil)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetry(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data  []TelemetryData `json:"data"`
+		Count int             `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second temperature reading (13:00) is excluded by the exclusive upper bound
+	if response.Count != 2 {
+		t.Fatalf("expected count 2, got %d", response.Count)
+	}
+	if response.Data[0].Type != "temperature" || response.Data[1].Type != "humidity" {
+		t.Errorf("expected ascending [temperature humidity], got [%s %s]", response.Data[0].Type, response.Data[1].Type)
+	}
+}
+
+func TestGetTelemetry_InvalidQueryParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"invalid from", "from=yesterday"},
+		{"invalid to", "to=2026-01-15"},
+		{"to before from", "from=2026-01-15T12:00:00Z&to=2026-01-15T10:00:00Z"},
+		{"invalid order", "order=newest"},
+		{"invalid type", "type=123invalid"},
+		{"too many types", "type=a&type=b&type=c&type=d&type=e&type=f&type=g&type=h&type=i&type=j&type=k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/telemetry?"+tt.query, nil)
+			req = withDeviceContext(req, telTestDeviceUUID)
+			w := httptest.NewRecorder()
+
+			h.GetTelemetry(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTelemetry_Pagination(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		mockStore.Save(context.Background(), &TelemetryData{
+			DeviceID:  telTestDeviceUUID,
+			Type:      "temperature",
+			Value:     float64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	var seen []float64
+	pageToken := ""
+	for pages := 0; pages < 10; pages++ {
+		req := httptest.NewRequest(http.MethodGet, "/telemetry?limit=2&order=asc&page_token="+pageToken, nil)
+		req = withDeviceContext(req, telTestDeviceUUID)
+		w := httptest.NewRecorder()
+
+		h.GetTelemetry(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data          []TelemetryData `json:"data"`
+			NextPageToken string          `json:"next_page_token"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range response.Data {
+			seen = append(seen, d.Value)
+		}
+		if response.NextPageToken == "" {
+			break
+		}
+		pageToken = response.NextPageToken
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 readings across pages, got %d", len(seen))
+	}
+	for i, v := range seen {
+		if v != float64(i) {
+			t.Errorf("reading %d: expected value %v, got %v", i, float64(i), v)
+		}
+	}
+}
+
+func TestGetTelemetry_InvalidPageToken(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/telemetry?page_token=garbage!", nil)
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.GetTelemetry(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
 func TestHandleTelemetry_EmptyBody(t *testing.T) {
 	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
 
@@ -692,3 +830,239 @@ func TestHandleTelemetryBatch_PublishError(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
 	}
 }
+
+func TestHandleTelemetryBatch_SingleRoundTrip(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	body := `[
+		{"type": "temperature", "value": 23.5},
+		{"type": "humidity", "value": 65.0},
+		{"type": "pressure", "value": 1013.25}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if mockStore.SaveBatchCalls != 1 {
+		t.Errorf("expected 1 SaveBatch call, got %d", mockStore.SaveBatchCalls)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["saved"] != float64(3) || response["mode"] != BatchBestEffort {
+		t.Errorf("unexpected response: %v", response)
+	}
+}
+
+func TestHandleTelemetryBatch_BestEffortPartialFailure(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockStore.SaveBatchErrs = map[int]error{1: errors.New("write conflict")}
+	mockPublisher := NewMockEventPublisher()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, mockPublisher)
+
+	body := `[{"type": "temperature", "value": 1}, {"type": "temperature", "value": 2}, {"type": "temperature", "value": 3}]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?mode=best_effort", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["saved"] != float64(2) {
+		t.Errorf("expected 2 saved, got %v", response["saved"])
+	}
+	if len(mockPublisher.Published) != 2 {
+		t.Errorf("expected only stored readings to be published, got %d", len(mockPublisher.Published))
+	}
+}
+
+func TestHandleTelemetryBatch_AtomicFailure(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockStore.SaveBatchErrs = map[int]error{1: errors.New("write conflict")}
+	mockPublisher := NewMockEventPublisher()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, mockPublisher)
+
+	body := `[{"type": "temperature", "value": 1}, {"type": "temperature", "value": 2}]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?mode=atomic", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if len(mockStore.data) != 0 {
+		t.Errorf("atomic batch must store nothing on failure, stored %d", len(mockStore.data))
+	}
+	if len(mockPublisher.Published) != 0 {
+		t.Errorf("expected no published events, got %d", len(mockPublisher.Published))
+	}
+}
+
+func TestHandleTelemetryBatch_WholeBatchFailure(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	mockStore.SaveBatchErr = errors.New("firestore unavailable")
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(`[{"type": "temperature", "value": 1}]`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestHandleTelemetryBatch_InvalidMode(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?mode=sometimes", bytes.NewBufferString(`[{"type": "temperature", "value": 1}]`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleTelemetryBatch_ReportsRejectedItems(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	// Index into the valid readings passed to SaveBatch (request index 3)
+	mockStore.SaveBatchErrs = map[int]error{1: errors.New("write conflict")}
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	body := `[
+		{"type": "temperature", "value": 1},
+		{"value": 2},
+		{"type": "bad type!", "value": 3},
+		{"type": "humidity", "value": 4}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Saved    int              `json:"saved"`
+		Received int              `json:"received"`
+		Rejected []BatchItemError `json:"rejected"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Saved != 1 || response.Received != 4 {
+		t.Errorf("unexpected counts: %+v", response)
+	}
+
+	want := []struct {
+		index    int
+		category string
+		code     string
+	}{
+		{1, RejectValidation, ReasonMissingType},
+		{2, RejectValidation, ReasonInvalidType},
+		{3, RejectStorage, ReasonStoreFailed},
+	}
+	if len(response.Rejected) != len(want) {
+		t.Fatalf("expected %d rejected items, got %+v", len(want), response.Rejected)
+	}
+	for i, exp := range want {
+		got := response.Rejected[i]
+		if got.Index != exp.index || got.Category != exp.category || got.Code != exp.code {
+			t.Errorf("rejected[%d] = %+v, want index %d %s/%s", i, got, exp.index, exp.category, exp.code)
+		}
+	}
+}
+
+func TestHandleTelemetryBatch_NoRejectedItems(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch", bytes.NewBufferString(`[{"type": "temperature", "value": 1}]`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if rejected, ok := response["rejected"].([]interface{}); !ok || len(rejected) != 0 {
+		t.Errorf("expected empty rejected list, got %v", response["rejected"])
+	}
+}
+
+func TestHandleTelemetryBatch_StrictRejectsBatch(t *testing.T) {
+	mockStore := NewMockTelemetryStore()
+	h := NewWithStores(mockStore, nil, nil, nil, nil, nil)
+
+	body := `[{"type": "temperature", "value": 1}, {"value": 2}]`
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?strict=true", bytes.NewBufferString(body))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if len(mockStore.data) != 0 {
+		t.Errorf("strict batch must store nothing, stored %d", len(mockStore.data))
+	}
+
+	var response struct {
+		Error    string           `json:"error"`
+		Rejected []BatchItemError `json:"rejected"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Error == "" || len(response.Rejected) != 1 || response.Rejected[0].Index != 1 {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
+
+func TestHandleTelemetryBatch_StrictAllValid(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?strict=true", bytes.NewBufferString(`[{"type": "temperature", "value": 1}]`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestHandleTelemetryBatch_InvalidStrict(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/batch?strict=maybe", bytes.NewBufferString(`[{"type": "temperature", "value": 1}]`))
+	req = withDeviceContext(req, telTestDeviceUUID)
+	w := httptest.NewRecorder()
+
+	h.HandleTelemetryBatch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
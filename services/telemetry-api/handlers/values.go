@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Telemetry value types (TelemetryData.ValueType). Readings without a value type
+// are plain floating point numbers stored in Value.
+const (
+	ValueTypeFloat  = "float"
+	ValueTypeInt    = "int"
+	ValueTypeUint   = "uint"
+	ValueTypeBool   = "bool"
+	ValueTypeString = "string"
+	ValueTypeBytes  = "bytes"
+	ValueTypeList   = "list" // Repeated numeric values
+)
+
+// valueTypeForSchema maps a MeasurementMeta.Type (protobuf scalar type name) to a value type.
+// Unknown or empty schema types return "" (the wire type decides).
+func valueTypeForSchema(schemaType string) string {
+	if strings.HasPrefix(schemaType, repeatedPrefix) {
+		return ValueTypeList
+	}
+	switch schemaType {
+	case "float", "double":
+		return ValueTypeFloat
+	case "int32", "int64", "sint32", "sint64", "sfixed32", "sfixed64", "int", "enum":
+		return ValueTypeInt
+	case "uint32", "uint64", "fixed32", "fixed64", "uint":
+		return ValueTypeUint
+	case "bool":
+		return ValueTypeBool
+	case "string":
+		return ValueTypeString
+	case "bytes":
+		return ValueTypeBytes
+	default:
+		return ""
+	}
+}
+
+// valueTypeOf returns the value type of a decoded wire value
+func valueTypeOf(v interface{}) string {
+	switch v.(type) {
+	case float32, float64:
+		return ValueTypeFloat
+	case int32, int64:
+		return ValueTypeInt
+	case uint32, uint64:
+		return ValueTypeUint
+	case bool:
+		return ValueTypeBool
+	case string:
+		return ValueTypeString
+	case []byte:
+		return ValueTypeBytes
+	case []float64:
+		return ValueTypeList
+	default:
+		return ""
+	}
+}
+
+// setTypedValue stores a decoded value in its native representation, using the
+// schema type when the value converts to it and the wire type otherwise.
+// Numeric and boolean values also keep a float64 approximation in Value
+// so aggregation and rollups keep working.
+func setTypedValue(d *TelemetryData, schemaType string, v interface{}) error {
+	wireType := valueTypeOf(v)
+	valueType := valueTypeForSchema(schemaType)
+	if valueType == "" {
+		valueType = wireType
+	}
+
+	err := storeValue(d, valueType, v)
+	if err != nil && valueType != wireType {
+		return storeValue(d, wireType, v)
+	}
+	return err
+}
+
+// storeValue converts v to valueType and sets the matching typed field
+func storeValue(d *TelemetryData, valueType string, v interface{}) error {
+	d.clearValue()
+
+	switch valueType {
+	case ValueTypeFloat:
+		f, err := toFloat64(v)
+		if err != nil {
+			return err
+		}
+		d.Value = f
+		return nil // Plain float readings have no value type
+
+	case ValueTypeInt:
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		d.IntValue = &n
+		d.Value = float64(n)
+
+	case ValueTypeUint:
+		n, err := toUint64(v)
+		if err != nil {
+			return err
+		}
+		d.UintValue = &n
+		d.Value = float64(n)
+
+	case ValueTypeBool:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("cannot convert %T to bool", v)
+		}
+		d.BoolValue = &b
+		d.Value = 0
+		if b {
+			d.Value = 1
+		}
+
+	case ValueTypeString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("cannot convert %T to string", v)
+		}
+		d.StringValue = &s
+		d.Value = 0
+
+	case ValueTypeBytes:
+		switch b := v.(type) {
+		case []byte:
+			d.BytesValue = b
+		case string:
+			d.BytesValue = []byte(b)
+		default:
+			return fmt.Errorf("cannot convert %T to bytes", v)
+		}
+		d.Value = 0
+
+	case ValueTypeList:
+		list, ok := v.([]float64)
+		if !ok {
+			return fmt.Errorf("cannot convert %T to list", v)
+		}
+		d.ListValue = list
+		d.Value = 0
+
+	default:
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+
+	d.ValueType = valueType
+	return nil
+}
+
+// clearValue resets the value of a reading
+func (d *TelemetryData) clearValue() {
+	d.Value = 0
+	d.ValueType = ""
+	d.IntValue = nil
+	d.UintValue = nil
+	d.BoolValue = nil
+	d.StringValue = nil
+	d.BytesValue = nil
+	d.ListValue = nil
+}
+
+// normalizeValue validates the typed value fields of a JSON reading and derives
+// ValueType and the float64 Value from whichever typed field is set
+func normalizeValue(d *TelemetryData) error {
+	set := 0
+	valueType := ""
+	if d.IntValue != nil {
+		set++
+		valueType = ValueTypeInt
+		d.Value = float64(*d.IntValue)
+	}
+	if d.UintValue != nil {
+		set++
+		valueType = ValueTypeUint
+		d.Value = float64(*d.UintValue)
+	}
+	if d.BoolValue != nil {
+		set++
+		valueType = ValueTypeBool
+		d.Value = 0
+		if *d.BoolValue {
+			d.Value = 1
+		}
+	}
+	if d.StringValue != nil {
+		set++
+		valueType = ValueTypeString
+		d.Value = 0
+	}
+	if d.BytesValue != nil {
+		set++
+		valueType = ValueTypeBytes
+		d.Value = 0
+	}
+	if d.ListValue != nil {
+		set++
+		valueType = ValueTypeList
+		d.Value = 0
+	}
+
+	if set > 1 {
+		return errors.New("at most one of int_value, uint_value, bool_value, string_value, bytes_value and list_value may be set")
+	}
+	if d.ValueType != "" && d.ValueType != valueType && !(d.ValueType == ValueTypeFloat && set == 0) {
+		return fmt.Errorf("value_type %q does not match the value fields", d.ValueType)
+	}
+	d.ValueType = valueType
+	return nil
+}
+
+// IsNumeric reports whether the reading has a single numeric Value (string, bytes and list readings do not)
+func (d *TelemetryData) IsNumeric() bool {
+	return d.ValueType != ValueTypeString && d.ValueType != ValueTypeBytes && d.ValueType != ValueTypeList
+}
+
+// firestoreDoc returns a copy of the reading to write to Firestore, which has no unsigned
+// 64-bit integer type: UintValue is stored as decimal text (UintText)
+func (d *TelemetryData) firestoreDoc() *TelemetryData {
+	doc := *d
+	doc.UintText = ""
+	if d.UintValue != nil {
+		doc.UintText = strconv.FormatUint(*d.UintValue, 10)
+	}
+	return &doc
+}
+
+// decodeUint restores UintValue from UintText after reading from Firestore
+func (d *TelemetryData) decodeUint() error {
+	if d.UintText == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(d.UintText, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid uint_value %q: %w", d.UintText, err)
+	}
+	d.UintValue = &n
+	return nil
+}
+
+// MarshalJSON writes uint_value as a decimal string: JavaScript clients cannot represent
+// integers above 2^53 exactly as JSON numbers
+func (d TelemetryData) MarshalJSON() ([]byte, error) {
+	type plain TelemetryData
+	var uintText *string
+	if d.UintValue != nil {
+		text := strconv.FormatUint(*d.UintValue, 10)
+		uintText = &text
+	}
+	return json.Marshal(struct {
+		plain
+		UintValue *string `json:"uint_value,omitempty"`
+	}{plain(d), uintText})
+}
+
+// UnmarshalJSON accepts uint_value as a JSON number or a decimal string
+func (d *TelemetryData) UnmarshalJSON(b []byte) error {
+	type plain TelemetryData
+	aux := struct {
+		*plain
+		UintValue json.RawMessage `json:"uint_value,omitempty"`
+	}{plain: (*plain)(d)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if len(aux.UintValue) == 0 || string(aux.UintValue) == "null" {
+		return nil
+	}
+
+	text := string(aux.UintValue)
+	if aux.UintValue[0] == '"' {
+		if err := json.Unmarshal(aux.UintValue, &text); err != nil {
+			return err
+		}
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid uint_value %s: must be an unsigned 64-bit integer", aux.UintValue)
+	}
+	d.UintValue = &n
+	return nil
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case float32:
+		return float64(val), nil
+	case float64:
+		return val, nil
+	case int32:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case uint32:
+		return float64(val), nil
+	case uint64:
+		return float64(val), nil
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(val, 64)
+	default:
+		return 0, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch val := v.(type) {
+	case int32:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case uint32:
+		return int64(val), nil
+	case uint64:
+		if val > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", val)
+		}
+		return int64(val), nil
+	case string:
+		return strconv.ParseInt(val, 10, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to int", v)
+	}
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch val := v.(type) {
+	case uint32:
+		return uint64(val), nil
+	case uint64:
+		return val, nil
+	case int32:
+		if val < 0 {
+			return 0, fmt.Errorf("negative value %d for unsigned type", val)
+		}
+		return uint64(val), nil
+	case int64:
+		if val < 0 {
+			return 0, fmt.Errorf("negative value %d for unsigned type", val)
+		}
+		return uint64(val), nil
+	case string:
+		return strconv.ParseUint(val, 10, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to uint", v)
+	}
+}
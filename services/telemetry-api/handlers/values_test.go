@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetTypedValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		schemaType string
+		value      interface{}
+		wantType   string
+		check      func(d TelemetryData) bool
+	}{
+		{"double", "double", float64(21.5), "", func(d TelemetryData) bool { return d.Value == 21.5 }},
+		{"uint64 counter above 2^53", "uint64", uint64(1<<53 + 1), ValueTypeUint, func(d TelemetryData) bool {
+			return d.UintValue != nil && *d.UintValue == 1<<53+1
+		}},
+		{"int64 from wire", "", int64(-5), ValueTypeInt, func(d TelemetryData) bool {
+			return d.IntValue != nil && *d.IntValue == -5 && d.Value == -5
+		}},
+		{"bool", "bool", true, ValueTypeBool, func(d TelemetryData) bool {
+			return d.BoolValue != nil && *d.BoolValue && d.Value == 1
+		}},
+		{"string", "string", "on", ValueTypeString, func(d TelemetryData) bool {
+			return d.StringValue != nil && *d.StringValue == "on"
+		}},
+		{"bytes", "bytes", []byte{0x01, 0x02}, ValueTypeBytes, func(d TelemetryData) bool {
+			return len(d.BytesValue) == 2
+		}},
+		{"schema int from uint32 wire", "int32", uint32(7), ValueTypeInt, func(d TelemetryData) bool {
+			return d.IntValue != nil && *d.IntValue == 7
+		}},
+		{"schema mismatch falls back to wire type", "bool", float64(2.5), "", func(d TelemetryData) bool {
+			return d.Value == 2.5 && d.BoolValue == nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d TelemetryData
+			if err := setTypedValue(&d, tt.schemaType, tt.value); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if d.ValueType != tt.wantType {
+				t.Errorf("expected value type %q, got %q", tt.wantType, d.ValueType)
+			}
+			if !tt.check(d) {
+				t.Errorf("unexpected reading: %+v", d)
+			}
+		})
+	}
+}
+
+func TestSetTypedValue_Invalid(t *testing.T) {
+	var d TelemetryData
+	if err := setTypedValue(&d, "", struct{}{}); err == nil {
+		t.Error("expected error for unsupported value")
+	}
+
+	// A negative value cannot be stored as unsigned: the wire type is kept
+	if err := setTypedValue(&d, "uint32", int32(-1)); err != nil || d.ValueType != ValueTypeInt {
+		t.Errorf("expected signed fallback, got %+v (%v)", d, err)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	n := int64(42)
+	d := TelemetryData{IntValue: &n}
+	if err := normalizeValue(&d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.ValueType != ValueTypeInt || d.Value != 42 {
+		t.Errorf("unexpected reading: %+v", d)
+	}
+
+	b := true
+	both := TelemetryData{IntValue: &n, BoolValue: &b}
+	if err := normalizeValue(&both); err == nil {
+		t.Error("expected error for multiple typed values")
+	}
+
+	mismatch := TelemetryData{ValueType: ValueTypeBool, IntValue: &n}
+	if err := normalizeValue(&mismatch); err == nil {
+		t.Error("expected error for mismatched value_type")
+	}
+}
+
+func TestTelemetryData_UintText(t *testing.T) {
+	n := uint64(1<<64 - 1)
+	d := TelemetryData{UintValue: &n}
+	doc := d.firestoreDoc()
+	if d.UintText != "" {
+		t.Error("firestoreDoc must not modify the reading")
+	}
+
+	var stored TelemetryData
+	stored.UintText = doc.UintText
+	if err := stored.decodeUint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.UintValue == nil || *stored.UintValue != n {
+		t.Errorf("expected %d to round trip, got %v", n, stored.UintValue)
+	}
+}
+
+func TestHandleTelemetryProto_PreservesUint64(t *testing.T) {
+	h, telemetry := newProtoTestHandlers(t)
+	h.schemaStore.Save(context.Background(), "measurement-probe", "1.0.0", &MeasurementSchema{
+		Measurements: map[string]MeasurementMeta{
+			"energy": {ID: 3, Name: "energy", Type: "uint64", Unit: "Wh"},
+		},
+	})
+
+	const counter = uint64(1<<53 + 1) // Not representable as float64
+	var msg []byte
+	msg = binary.AppendUvarint(msg, uint64(measurementFieldID)<<3)
+	msg = binary.AppendUvarint(msg, 3)
+	msg = binary.AppendUvarint(msg, uint64(measurementFieldUint64)<<3)
+	msg = binary.AppendUvarint(msg, counter)
+
+	w := postProto(h, "", appendBytesField(nil, batchFieldMeasurements, msg))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(telemetry.data) != 1 {
+		t.Fatalf("expected 1 stored reading, got %d", len(telemetry.data))
+	}
+	for _, d := range telemetry.data {
+		if d.ValueType != ValueTypeUint || d.UintValue == nil || *d.UintValue != counter {
+			t.Errorf("expected exact uint64 counter, got %+v", d)
+		}
+
+		out, _ := json.Marshal(d)
+		if !strings.Contains(string(out), `"uint_value":"9007199254740993"`) {
+			t.Errorf("expected uint_value as a string in JSON, got %s", out)
+		}
+	}
+}
+
+func TestTelemetryData_UintValueJSON(t *testing.T) {
+	for _, in := range []string{`{"uint_value": 18446744073709551615}`, `{"uint_value": "18446744073709551615"}`} {
+		var d TelemetryData
+		if err := json.Unmarshal([]byte(in), &d); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if d.UintValue == nil || *d.UintValue != 1<<64-1 {
+			t.Errorf("%s: got %v", in, d.UintValue)
+		}
+	}
+	for _, in := range []string{`{"uint_value": -1}`, `{"uint_value": "1.5"}`, `{"uint_value": true}`} {
+		var d TelemetryData
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+
+	// Other fields are unaffected
+	out, _ := json.Marshal(TelemetryData{Type: "temperature", Value: 21.5})
+	if string(out) != `{"device_id":"","timestamp":"0001-01-01T00:00:00Z","type":"temperature","value":21.5,"created_at":"0001-01-01T00:00:00Z"}` {
+		t.Errorf("unexpected JSON %s", out)
+	}
+}
+
+func TestHandleTelemetryBatch_InvalidValue(t *testing.T) {
+	h := NewWithStores(NewMockTelemetryStore(), nil, nil, nil, nil, nil)
+
+	w := postBatch(h, "", `[{"type": "relay", "bool_value": true}, {"type": "relay", "bool_value": true, "int_value": 1}]`)
+
+	var response struct {
+		Saved    int              `json:"saved"`
+		Rejected []BatchItemError `json:"rejected"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Saved != 1 {
+		t.Errorf("expected 1 saved reading, got %d", response.Saved)
+	}
+	if len(response.Rejected) != 1 || response.Rejected[0].Index != 1 || response.Rejected[0].Code != ReasonInvalidValue {
+		t.Errorf("expected invalid_value rejection, got %+v", response.Rejected)
+	}
+}
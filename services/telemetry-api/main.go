@@ -9,6 +9,7 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Command schedule time zones in the distroless image
 
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/handlers"
 	"github.com/ddanielski/home-monitoring/services/telemetry-api/pkg/middleware"
@@ -60,6 +61,47 @@ func main() {
 		slog.Warn("GITHUB_ACTIONS_API_KEY not set - schema upload endpoints will only accept admin key")
 	}
 
+	// Telemetry retention (JSON policy, see handlers.ParseRetentionPolicy)
+	retention, err := handlers.ParseRetentionPolicy(os.Getenv("RETENTION_POLICY"))
+	if err != nil {
+		slog.Error("invalid RETENTION_POLICY", "error", err)
+		os.Exit(1)
+	}
+
+	// Optional in-process retention sweeper (otherwise trigger POST /admin/retention/run, e.g. from Cloud Scheduler)
+	var retentionSweepInterval time.Duration
+	if v := os.Getenv("RETENTION_SWEEP_INTERVAL"); v != "" {
+		retentionSweepInterval, err = time.ParseDuration(v)
+		if err != nil || retentionSweepInterval <= 0 {
+			slog.Error("invalid RETENTION_SWEEP_INTERVAL", "value", v)
+			os.Exit(1)
+		}
+	}
+
+	// Acceptance window for device-supplied sample timestamps (defaults: 30 days past, 5 minutes ahead)
+	var timestampWindow handlers.TimestampWindow
+	if v := os.Getenv("TELEMETRY_MAX_SAMPLE_AGE"); v != "" {
+		timestampWindow.MaxAge, err = time.ParseDuration(v)
+		if err != nil || timestampWindow.MaxAge <= 0 {
+			slog.Error("invalid TELEMETRY_MAX_SAMPLE_AGE", "value", v)
+			os.Exit(1)
+		}
+	}
+	if v := os.Getenv("TELEMETRY_MAX_FUTURE_SKEW"); v != "" {
+		timestampWindow.MaxFutureSkew, err = time.ParseDuration(v)
+		if err != nil || timestampWindow.MaxFutureSkew <= 0 {
+			slog.Error("invalid TELEMETRY_MAX_FUTURE_SKEW", "value", v)
+			os.Exit(1)
+		}
+	}
+
+	// Default compatibility check for schema uploads (none, backward or strict)
+	schemaCompat, err := handlers.ParseSchemaCompatMode(os.Getenv("SCHEMA_COMPAT_MODE"))
+	if err != nil {
+		slog.Error("invalid SCHEMA_COMPAT_MODE", "error", err)
+		os.Exit(1)
+	}
+
 	serviceName := os.Getenv("K_SERVICE")
 	if serviceName == "" {
 		serviceName = "telemetry-api"
@@ -69,8 +111,11 @@ func main() {
 	// Initialize handlers with dependencies
 	ctx := context.Background()
 	h, err := handlers.New(ctx, handlers.Config{
-		ProjectID:  projectID,
-		ServiceURL: serviceAudience,
+		ProjectID:       projectID,
+		ServiceURL:      serviceAudience,
+		Retention:       retention,
+		TimestampWindow: timestampWindow,
+		SchemaCompat:    schemaCompat,
 	})
 	if err != nil {
 		slog.Error("failed to initialize handlers", "error", err)
@@ -78,6 +123,27 @@ func main() {
 	}
 	defer h.Close()
 
+	if retentionSweepInterval > 0 && !retention.IsZero() {
+		sweepCtx, stopSweeper := context.WithCancel(ctx)
+		defer stopSweeper()
+		h.StartRetentionSweeper(sweepCtx, retentionSweepInterval)
+	}
+
+	// Wake long-polling devices (GET /commands?wait=) for commands created on other instances
+	watchCtx, stopCommandWatcher := context.WithCancel(ctx)
+	defer stopCommandWatcher()
+	h.StartCommandWatcher(watchCtx)
+
+	// End command streams on this instance when a device is revoked on another one
+	revokeCtx, stopRevocationWatcher := context.WithCancel(ctx)
+	defer stopRevocationWatcher()
+	h.StartRevocationWatcher(revokeCtx)
+
+	// Materialize recurring commands (e.g. nightly recalibration) without an external cron job
+	schedCtx, stopCommandScheduler := context.WithCancel(ctx)
+	defer stopCommandScheduler()
+	h.StartCommandScheduler(schedCtx)
+
 	// Admin auth middleware
 	adminAuth := handlers.NewAdminAuthMiddleware(handlers.AdminAuthConfig{
 		APIKey:              adminAPIKey,
@@ -111,8 +177,12 @@ func main() {
 	mux.HandleFunc("POST /telemetry/batch", h.AuthMiddleware(h.HandleTelemetryBatch))
 	mux.HandleFunc("POST /telemetry/proto", h.AuthMiddleware(h.HandleTelemetryProto))
 	mux.HandleFunc("GET /telemetry", h.AuthMiddleware(h.GetTelemetry))
+	mux.HandleFunc("GET /telemetry/aggregate", h.AuthMiddleware(h.GetTelemetryAggregate))
 	mux.HandleFunc("GET /commands", h.AuthMiddleware(h.GetCommands))
-	mux.HandleFunc("POST /commands/{id}/ack", h.AuthMiddleware(h.AckCommand)) // Device acknowledges command
+	mux.HandleFunc("GET /commands/stream", h.AuthMiddleware(h.StreamCommands))          // SSE or WebSocket push
+	mux.HandleFunc("POST /commands/{id}/ack", h.AuthMiddleware(h.AckCommand))           // Device acknowledges command
+	mux.HandleFunc("POST /commands/{id}/complete", h.AuthMiddleware(h.CompleteCommand)) // Device reports success
+	mux.HandleFunc("POST /commands/{id}/fail", h.AuthMiddleware(h.FailCommand))         // Device reports failure
 	mux.HandleFunc("GET /devices/{id}", h.AuthMiddleware(h.GetDevice))
 	mux.HandleFunc("PUT /devices/info", h.AuthMiddleware(h.UpdateDeviceInfo)) // Device updates its own info
 
@@ -122,37 +192,34 @@ func main() {
 	// =========================================================================
 	mux.HandleFunc("POST /admin/devices/provision", adminAuth.RequireAdminKey(h, h.ProvisionDevice))
 	mux.HandleFunc("POST /admin/devices/{id}/revoke", adminAuth.RequireAdminKey(h, h.RevokeDevice))
+	mux.HandleFunc("PUT /admin/devices/{id}/tags", adminAuth.RequireAdminKey(h, h.SetDeviceTags))
 	mux.HandleFunc("POST /admin/commands", adminAuth.RequireAdminKey(h, h.CreateCommand))
+	mux.HandleFunc("POST /admin/commands/bulk", adminAuth.RequireAdminKey(h, h.CreateBulkCommand))
+	mux.HandleFunc("GET /admin/commands/{id}", adminAuth.RequireAdminKey(h, h.GetCommand))
 	mux.HandleFunc("DELETE /admin/commands/{id}", adminAuth.RequireAdminKey(h, h.DeleteCommand))
+	mux.HandleFunc("GET /admin/campaigns/{id}", adminAuth.RequireAdminKey(h, h.GetCampaign))
+	mux.HandleFunc("POST /admin/schedules", adminAuth.RequireAdminKey(h, h.CreateSchedule))
+	mux.HandleFunc("GET /admin/schedules", adminAuth.RequireAdminKey(h, h.ListSchedules))
+	mux.HandleFunc("GET /admin/schedules/{id}", adminAuth.RequireAdminKey(h, h.GetSchedule))
+	mux.HandleFunc("DELETE /admin/schedules/{id}", adminAuth.RequireAdminKey(h, h.DeleteSchedule))
+	mux.HandleFunc("POST /admin/rollups/rebuild", adminAuth.RequireAdminKey(h, h.RebuildRollups))
+	mux.HandleFunc("POST /admin/retention/run", adminAuth.RequireAdminKey(h, h.RunRetention))
+	mux.HandleFunc("GET /admin/quarantine", adminAuth.RequireAdminKey(h, h.ListQuarantine))
+	mux.HandleFunc("GET /admin/quarantine/{id}", adminAuth.RequireAdminKey(h, h.GetQuarantined))
+	mux.HandleFunc("POST /admin/quarantine/{id}/replay", adminAuth.RequireAdminKey(h, h.ReplayQuarantined))
+	mux.HandleFunc("POST /admin/quarantine/replay", adminAuth.RequireAdminKey(h, h.ReplayQuarantine))
 	mux.HandleFunc("POST /admin/schemas/{app}/{version}", adminAuth.RequireGithubActionsKey(h, h.UploadSchema))
 	mux.HandleFunc("GET /admin/schemas/{app}/{version}", adminAuth.RequireGithubActionsKey(h, h.GetSchema))
+	mux.HandleFunc("DELETE /admin/schemas/{app}/{version}", adminAuth.RequireGithubActionsKey(h, h.DeleteSchema))
+	mux.HandleFunc("GET /admin/schemas/{app}", adminAuth.RequireGithubActionsKey(h, h.ListSchemaVersions))
+	mux.HandleFunc("GET /admin/schemas", adminAuth.RequireGithubActionsKey(h, h.ListSchemaApps))
 
-	// Apply middleware chain (order matters: first is outermost)
-	handler := middleware.Chain(mux,
-		// 1. Request ID first (available to all other middleware)
-		middleware.RequestID,
-		// 2. Security headers
-		middleware.SecurityHeaders,
-		// 3. Panic recovery
-		middleware.Recovery(logger),
-		// 4. CORS handling
-		middleware.CORS(middleware.CORSConfig{
-			AllowedAdminOrigins:  adminOrigins,
-			AllowAllForDeviceAPI: true,
-		}),
-		// 5. Body size limits
-		middleware.BodyLimit(middleware.BodyLimitConfig{
-			DefaultLimit: DefaultBodyLimit,
-			PathLimits: map[string]int64{
-				"/telemetry":     TelemetryBodyLimit,
-				"/admin/schemas": SchemaBodyLimit,
-			},
-		}),
-		// 6. Request logging (last to capture accurate timing)
-		middleware.Logging(logger),
-	)
+	handler := newHandler(mux, logger, adminOrigins)
 
 	// Server configuration
+	// Streaming routes (GET /commands/stream, long-polls) set their own per-write
+	// deadlines instead of WriteTimeout, and WebSockets clear both timeouts
+	// (see TestNewHandler_StreamOutlivesWriteTimeout)
 	server := &http.Server{
 		Addr:              ":" + port,
 		Handler:           handler,
@@ -163,6 +230,9 @@ func main() {
 		MaxHeaderBytes:    1 << 16,         // 64KB max headers
 	}
 
+	// Shutdown waits for active requests; ask streaming devices to reconnect elsewhere
+	server.RegisterOnShutdown(h.CloseCommandStreams)
+
 	// Graceful shutdown
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -189,6 +259,35 @@ func main() {
 	}
 }
 
+// newHandler applies the middleware chain to the routes (order matters: first is outermost).
+// Wrapped response writers implement Unwrap, so streaming handlers keep control of write
+// deadlines and flushing through http.ResponseController.
+func newHandler(mux http.Handler, logger *slog.Logger, adminOrigins []string) http.Handler {
+	return middleware.Chain(mux,
+		// 1. Request ID first (available to all other middleware)
+		middleware.RequestID,
+		// 2. Security headers
+		middleware.SecurityHeaders,
+		// 3. Panic recovery
+		middleware.Recovery(logger),
+		// 4. CORS handling
+		middleware.CORS(middleware.CORSConfig{
+			AllowedAdminOrigins:  adminOrigins,
+			AllowAllForDeviceAPI: true,
+		}),
+		// 5. Body size limits
+		middleware.BodyLimit(middleware.BodyLimitConfig{
+			DefaultLimit: DefaultBodyLimit,
+			PathLimits: map[string]int64{
+				"/telemetry":     TelemetryBodyLimit,
+				"/admin/schemas": SchemaBodyLimit,
+			},
+		}),
+		// 6. Request logging (last to capture accurate timing)
+		middleware.Logging(logger),
+	)
+}
+
 // parseCommaSeparated splits a comma-separated string into a slice of trimmed strings.
 func parseCommaSeparated(s string) []string {
 	if s == "" {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddanielski/home-monitoring/services/telemetry-api/handlers"
+)
+
+// TestNewHandler_StreamOutlivesWriteTimeout checks that a command stream behind the
+// middleware chain keeps delivering events after the server's WriteTimeout (30s in
+// production, shortened here): every wrapper must let the stream set its own deadlines.
+func TestNewHandler_StreamOutlivesWriteTimeout(t *testing.T) {
+	const deviceID = "550e8400-e29b-41d4-a716-446655440000"
+	token := strings.Repeat("t", 120)
+
+	auth := handlers.NewMockAuthService()
+	auth.AddToken(token, deviceID, nil)
+	h := handlers.NewWithStores(nil, handlers.NewMockCommandStore(), nil, nil, auth, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /commands/stream", h.AuthMiddleware(h.StreamCommands))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	const writeTimeout = 200 * time.Millisecond
+	srv := httptest.NewUnstartedServer(newHandler(mux, logger, nil))
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/commands/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	waitForLine := func(prefix string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream ended before %q", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", prefix)
+			}
+		}
+	}
+
+	waitForLine("retry:")
+	time.Sleep(2 * writeTimeout)
+
+	// A command created after the WriteTimeout elapsed still reaches the device
+	body := `{"device_id": "` + deviceID + `", "type": "reboot"}`
+	w := httptest.NewRecorder()
+	h.CreateCommand(w, httptest.NewRequest(http.MethodPost, "/admin/commands", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	waitForLine("event: command")
+}
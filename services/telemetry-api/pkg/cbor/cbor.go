@@ -0,0 +1,317 @@
+// Package cbor decodes CBOR (RFC 8949) into generic Go values.
+// It covers the data model devices use for telemetry - maps with text keys,
+// arrays, numbers, strings, byte strings, booleans, null and date/time tags -
+// without generated code or reflection.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxDepth bounds the nesting of arrays, maps and tags in a decoded item
+const MaxDepth = 32
+
+// Major types
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Tags with a decoded representation
+const (
+	tagDateTimeString = 0 // RFC 3339 text
+	tagEpochDateTime  = 1 // Seconds since the epoch (integer or float)
+)
+
+// additional information value for indefinite lengths and the "break" stop code
+const infoIndefinite = 31
+
+// Decode decodes a single CBOR data item. Values map to:
+//
+//	unsigned integer          uint64
+//	negative integer          int64 (error below math.MinInt64)
+//	byte string               []byte
+//	text string               string (must be valid UTF-8)
+//	array                     []interface{}
+//	map                       map[string]interface{} (keys must be text)
+//	false, true               bool
+//	null, undefined           nil
+//	half, single, double      float64
+//	tag 0, tag 1              time.Time (UTC)
+//
+// Other tags decode to their content. Trailing data after the item is an error.
+func Decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(data)-d.pos)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+var errTruncated = errors.New("unexpected end of data")
+
+// errBreak is returned by value when it reads the stop code of an indefinite-length item
+var errBreak = errors.New("unexpected break")
+
+// head reads an initial byte and its argument. Indefinite lengths have info infoIndefinite.
+func (d *decoder) head() (major byte, info byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info = b>>5, b&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		n := 1 << (info - 24) // 1, 2, 4 or 8 bytes
+		if len(d.data)-d.pos < n {
+			return 0, 0, 0, errTruncated
+		}
+		p := d.data[d.pos:]
+		d.pos += n
+		switch n {
+		case 1:
+			arg = uint64(p[0])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(p))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(p))
+		default:
+			arg = binary.BigEndian.Uint64(p)
+		}
+		return major, info, arg, nil
+	case info == infoIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("reserved additional information %d", info)
+	}
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("nesting exceeds depth limit %d", MaxDepth)
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == infoIndefinite
+
+	switch major {
+	case majorUint:
+		if indefinite {
+			return nil, errors.New("indefinite length integer")
+		}
+		return arg, nil
+
+	case majorNegInt:
+		if indefinite {
+			return nil, errors.New("indefinite length integer")
+		}
+		if arg > math.MaxInt64 {
+			return nil, errors.New("negative integer out of range")
+		}
+		return -1 - int64(arg), nil
+
+	case majorBytes, majorText:
+		b, err := d.str(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorBytes {
+			return b, nil
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("text string is not valid UTF-8")
+		}
+		return string(b), nil
+
+	case majorArray:
+		// Every element takes at least one byte: never preallocate past the data
+		items := make([]interface{}, 0, min(arg, uint64(len(d.data)-d.pos)))
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if indefinite && err == errBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+
+	case majorMap:
+		m := make(map[string]interface{}, min(arg, uint64(len(d.data)-d.pos)/2))
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if indefinite && err == errBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a text string", k)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				if err == errBreak {
+					return nil, fmt.Errorf("map key %q has no value", key)
+				}
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+
+	case majorTag:
+		if indefinite {
+			return nil, errors.New("indefinite length tag")
+		}
+		content, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeTag(arg, content)
+
+	default: // majorSimple
+		return simple(info, arg)
+	}
+}
+
+// str reads a byte or text string, joining the chunks of an indefinite-length one
+func (d *decoder) str(major byte, length uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		if length > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		b := append([]byte(nil), d.data[d.pos:d.pos+int(length)]...)
+		d.pos += int(length)
+		return b, nil
+	}
+
+	b := []byte{}
+	for {
+		chunkMajor, info, arg, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor == majorSimple && info == infoIndefinite {
+			return b, nil
+		}
+		if chunkMajor != major || info == infoIndefinite {
+			return nil, errors.New("invalid chunk in indefinite length string")
+		}
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		b = append(b, d.data[d.pos:d.pos+int(arg)]...)
+		d.pos += int(arg)
+	}
+}
+
+// simple decodes major type 7: simple values, floats and the break stop code
+func simple(info byte, arg uint64) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		return halfToFloat64(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case infoIndefinite:
+		return nil, errBreak
+	default:
+		return nil, fmt.Errorf("unsupported simple value %d", arg)
+	}
+}
+
+// decodeTag interprets the content of a tagged item
+func decodeTag(tag uint64, content interface{}) (interface{}, error) {
+	switch tag {
+	case tagDateTimeString:
+		s, ok := content.(string)
+		if !ok {
+			return nil, errors.New("tag 0 requires a text string")
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("tag 0: %w", err)
+		}
+		return t.UTC(), nil
+	case tagEpochDateTime:
+		switch secs := content.(type) {
+		case uint64:
+			if secs > math.MaxInt64 {
+				return nil, errors.New("tag 1 epoch out of range")
+			}
+			return time.Unix(int64(secs), 0).UTC(), nil
+		case int64:
+			return time.Unix(secs, 0).UTC(), nil
+		case float64:
+			if math.IsNaN(secs) || math.IsInf(secs, 0) || math.Abs(secs) > 1<<62 {
+				return nil, errors.New("tag 1 epoch out of range")
+			}
+			whole, frac := math.Modf(secs)
+			return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+		default:
+			return nil, errors.New("tag 1 requires a number")
+		}
+	default:
+		return content, nil
+	}
+}
+
+// halfToFloat64 converts an IEEE 754 half-precision float
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
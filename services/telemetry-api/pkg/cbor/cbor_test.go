@@ -0,0 +1,129 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Examples from RFC 8949 Appendix A
+func TestDecode_RFCExamples(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", uint64(0)},
+		{"17", uint64(23)},
+		{"1818", uint64(24)},
+		{"1903e8", uint64(1000)},
+		{"1bffffffffffffffff", uint64(math.MaxUint64)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"f90000", 0.0},
+		{"f93c00", 1.0},
+		{"f97bff", 65504.0},
+		{"f90001", 5.960464477539063e-08},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"83010203", []interface{}{uint64(1), uint64(2), uint64(3)}},
+		{"a26161016162820203", map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+		{"c074323031332d30332d32315432303a30343a30305a", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c11a514b67b0", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c1fb41d452d9ec200000", time.Date(2013, 3, 21, 20, 4, 0, 500000000, time.UTC)},
+		{"d74401020304", []byte{1, 2, 3, 4}}, // Unknown tag 23: content only
+	}
+	for _, tt := range tests {
+		got, err := Decode(mustHex(t, tt.hex))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecode_SpecialFloats(t *testing.T) {
+	if v, _ := Decode(mustHex(t, "f97c00")); v != math.Inf(1) {
+		t.Errorf("expected +Inf, got %v", v)
+	}
+	if v, _ := Decode(mustHex(t, "f9c400")); v != -4.0 {
+		t.Errorf("expected -4, got %v", v)
+	}
+	if v, _ := Decode(mustHex(t, "f97e00")); !math.IsNaN(v.(float64)) {
+		t.Errorf("expected NaN, got %v", v)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := map[string]string{
+		"empty":                 "",
+		"truncated argument":    "19",
+		"truncated string":      "6449",
+		"trailing data":         "0000",
+		"reserved info":         "1c",
+		"invalid UTF-8":         "61ff",
+		"integer key":           "a10102",
+		"negative out of range": "3bffffffffffffffff",
+		"stray break":           "ff",
+		"break in definite":     "82ff",
+		"missing map value":     "bf6161ff",
+		"mixed chunks":          "5f6161ff",
+		"unterminated array":    "9f01",
+		"bad date":              "c06161",
+		"huge array":            "9bffffffffffffffff",
+	}
+	for name, h := range tests {
+		if _, err := Decode(mustHex(t, h)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecode_DepthLimit(t *testing.T) {
+	deep := make([]byte, MaxDepth+2)
+	for i := range deep {
+		deep[i] = 0x81 // Array of one element
+	}
+	if _, err := Decode(deep); err == nil {
+		t.Error("expected error for nesting beyond MaxDepth")
+	}
+
+	ok := append(make([]byte, 0, MaxDepth+1), deep[:MaxDepth]...)
+	ok = append(ok, 0x00)
+	if _, err := Decode(ok); err != nil {
+		t.Errorf("unexpected error at MaxDepth: %v", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(mustHex(f, "a26161016162820203"))
+	f.Add(mustHex(f, "bf61610161629f0203ffff"))
+	f.Add(mustHex(f, "c11a514b67b0"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Decode(data) // Must not panic
+	})
+}
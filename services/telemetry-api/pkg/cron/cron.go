@@ -0,0 +1,190 @@
+// Package cron parses standard 5-field cron expressions and computes their next run.
+// Fields are minute, hour, day of month, month and day of week; each accepts "*",
+// values, ranges ("1-5"), steps ("*/15", "0-30/10") and comma-separated lists.
+// Months and weekdays also accept names ("JAN", "sun"); Sunday is 0 or 7.
+// The macros @yearly, @monthly, @weekly, @daily (@midnight) and @hourly are supported.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // Bit n set = value n matches
+	domAny, dowAny                bool   // Field starts with "*": the other day field decides alone
+	spec                          string
+}
+
+// field describes the values accepted by one cron field
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names of min, min+1, ... (optional)
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearchYears bounds Next for expressions that (almost) never match, e.g. "0 0 30 2 *"
+const maxSearchYears = 5
+
+// Parse parses a cron expression
+func Parse(spec string) (Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := Schedule{spec: spec}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	// Like Vixie cron, a day field starting with "*" (e.g. "*/2") leaves the decision to the other
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parse parses one comma-separated field into a bit set
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepStr)
+			}
+			step = n
+		}
+
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(first); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if hi, err = f.value(last); err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, fmt.Errorf("invalid %s range %q", f.name, rng)
+				}
+			case !hasStep:
+				hi = lo // Single value; "5/15" means from 5 to the maximum
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of the field
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q: must be %d-%d", f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first matching minute strictly after t, evaluated in t's location,
+// or the zero time if the expression matches nothing in the next years.
+// Wall-clock times skipped by a daylight saving change do not run; times repeated by
+// one run once.
+func (s Schedule) Next(t time.Time) time.Time {
+	after, loc := t, t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.Year() + maxSearchYears
+
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0, !t.After(after):
+			// The second check skips the other occurrence of a wall-clock time repeated by
+			// a daylight saving change when after is within it
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's day rule: when both day fields are restricted,
+// either one matching is enough
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,130 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"1,,2 * * * *",
+		"@often",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	base := time.Date(2026, 10, 14, 10, 17, 30, 0, time.UTC) // Wednesday
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"* * * * *", base, time.Date(2026, 10, 14, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", base, time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", base, time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * sun", base, time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", base, time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * MON-FRI", base, time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", base, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", base, time.Date(2026, 10, 14, 10, 25, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", base, time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)},
+		{"@monthly", base, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", base, time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", base, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", base, time.Time{}},
+		// Both day fields restricted: either matches (the 20th or the next Monday)
+		{"0 0 20 * mon", base, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		// A day of month starting with "*" defers to the day of week
+		{"0 0 */2 * mon", base, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		// Strictly after
+		{"18 10 * * *", time.Date(2026, 10, 14, 10, 18, 0, 0, time.UTC), time.Date(2026, 10, 15, 10, 18, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext_Location(t *testing.T) {
+	loc := mustLoad(t, "Europe/Skopje")
+	s, _ := Parse("0 3 * * sun")
+
+	// Summer: 03:00 CEST is 01:00 UTC
+	got := s.Next(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC).In(loc))
+	if want := time.Date(2026, 7, 5, 1, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Winter: 03:00 CET is 02:00 UTC
+	got = s.Next(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC).In(loc))
+	if want := time.Date(2026, 12, 6, 2, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNext_DaylightSaving(t *testing.T) {
+	loc := mustLoad(t, "Europe/Berlin")
+
+	// 2026-03-29 02:00 CET jumps to 03:00 CEST: 02:30 does not exist that day
+	s, _ := Parse("30 2 * * *")
+	got := s.Next(time.Date(2026, 3, 29, 0, 0, 0, 0, loc))
+	if want := time.Date(2026, 3, 30, 2, 30, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("spring forward: got %v, want %v", got, want)
+	}
+
+	// 2026-10-25 03:00 CEST falls back to 02:00 CET: 02:30 happens twice but runs once
+	first := s.Next(time.Date(2026, 10, 25, 0, 0, 0, 0, loc))
+	if first.Day() != 25 || first.Hour() != 2 || first.Minute() != 30 {
+		t.Fatalf("fall back: got %v", first)
+	}
+	if next := s.Next(first); next.Day() != 26 {
+		t.Errorf("fall back: ran again at %v", next)
+	}
+	// Every minute keeps moving forward through the repeated hour
+	every, _ := Parse("* * * * *")
+	for at, i := time.Date(2026, 10, 25, 1, 50, 0, 0, loc), 0; i < 150; i++ {
+		next := every.Next(at)
+		if !next.After(at) {
+			t.Fatalf("Next(%v) = %v is not after", at, next)
+		}
+		at = next
+	}
+}
+
+func TestString(t *testing.T) {
+	s, _ := Parse("@daily")
+	if s.String() != "@daily" {
+		t.Errorf("String() = %q", s.String())
+	}
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -284,3 +286,21 @@ func TestChain(t *testing.T) {
 		}
 	}
 }
+
+func TestLogging_ResponseController(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := Logging(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event"))
+		// Streaming handlers flush through the logging wrapper
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("expected flush to reach the underlying writer, got %v", err)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/commands/stream", nil))
+
+	if !w.Flushed {
+		t.Error("expected response to be flushed")
+	}
+}
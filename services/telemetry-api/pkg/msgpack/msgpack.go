@@ -0,0 +1,252 @@
+// Package msgpack decodes MessagePack into generic Go values.
+// It covers the data model devices use for telemetry - maps with string keys,
+// arrays, numbers, strings, binary, booleans, nil and the timestamp extension -
+// without generated code or reflection.
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxDepth bounds the nesting of arrays and maps in a decoded value
+const MaxDepth = 32
+
+// extTimestamp is the predefined timestamp extension type
+const extTimestamp = -1
+
+// Decode decodes a single MessagePack value. Values map to:
+//
+//	positive integers         uint64
+//	negative integers         int64
+//	float 32, float 64        float64
+//	str                       string (must be valid UTF-8)
+//	bin                       []byte
+//	array                     []interface{}
+//	map                       map[string]interface{} (keys must be str)
+//	true, false               bool
+//	nil                       nil
+//	timestamp extension       time.Time (UTC)
+//
+// Other extension types are an error, as is trailing data after the value.
+func Decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(data)-d.pos)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+var errTruncated = errors.New("unexpected end of data")
+
+// next returns the next n bytes
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes (1, 2, 4 or 8)
+func (d *decoder) uint(size uint64) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("nesting exceeds depth limit %d", MaxDepth)
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f: // positive fixint
+		return uint64(c), nil
+	case c >= 0xe0: // negative fixint
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapValue(uint64(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(uint64(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(uint64(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), bin...), nil
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		bits, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(bits))), nil
+	case 0xcb:
+		bits, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(bits), nil
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := uint64(1) << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf: // map 16/32
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	default: // 0xc1 is never used
+		return nil, fmt.Errorf("invalid type byte 0x%02x", c)
+	}
+}
+
+func (d *decoder) str(n uint64) (string, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("str is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+func (d *decoder) array(n uint64, depth int) ([]interface{}, error) {
+	// Every element takes at least one byte: never preallocate past the data
+	items := make([]interface{}, 0, min(n, uint64(len(d.data)-d.pos)))
+	for i := uint64(0); i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (d *decoder) mapValue(n uint64, depth int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, min(n, uint64(len(d.data)-d.pos)/2))
+	for i := uint64(0); i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key %v is not a str", k)
+		}
+		if m[key], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ext decodes an extension value with n data bytes
+func (d *decoder) ext(n uint64) (interface{}, error) {
+	t, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t[0]) != extTimestamp {
+		return nil, fmt.Errorf("unsupported extension type %d", int8(t[0]))
+	}
+
+	switch n {
+	case 4: // timestamp 32: seconds
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8: // timestamp 64: 30-bit nanoseconds, 34-bit seconds
+		v := binary.BigEndian.Uint64(data)
+		nsec := v >> 34
+		if nsec > 999999999 {
+			return nil, errors.New("timestamp nanoseconds out of range")
+		}
+		return time.Unix(int64(v&0x3ffffffff), int64(nsec)).UTC(), nil
+	case 12: // timestamp 96: 32-bit nanoseconds, signed 64-bit seconds
+		nsec := binary.BigEndian.Uint32(data)
+		if nsec > 999999999 {
+			return nil, errors.New("timestamp nanoseconds out of range")
+		}
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)).UTC(), nil
+	default:
+		return nil, fmt.Errorf("invalid timestamp length %d", n)
+	}
+}
@@ -0,0 +1,111 @@
+package msgpack
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", uint64(0)},
+		{"7f", uint64(127)},
+		{"cc80", uint64(128)},
+		{"cd0100", uint64(256)},
+		{"ce00010000", uint64(65536)},
+		{"cfffffffffffffffff", uint64(math.MaxUint64)},
+		{"ff", int64(-1)},
+		{"e0", int64(-32)},
+		{"d080", int64(-128)},
+		{"d1ff00", int64(-256)},
+		{"d2ffff0000", int64(-65536)},
+		{"d38000000000000000", int64(math.MinInt64)},
+		{"ca3fc00000", 1.5},
+		{"cb3ff199999999999a", 1.1},
+		{"c0", nil},
+		{"c2", false},
+		{"c3", true},
+		{"a3616263", "abc"},
+		{"d903616263", "abc"},
+		{"da0003616263", "abc"},
+		{"c4020102", []byte{1, 2}},
+		{"c500020102", []byte{1, 2}},
+		{"93010203", []interface{}{uint64(1), uint64(2), uint64(3)}},
+		{"dc0002c0c3", []interface{}{nil, true}},
+		{"82a16101a16292a178ff", map[string]interface{}{"a": uint64(1), "b": []interface{}{"x", int64(-1)}}},
+		{"de0001a16101", map[string]interface{}{"a": uint64(1)}},
+		{"d6ff514b67b0", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"d7ff77359400514b67b0", time.Date(2013, 3, 21, 20, 4, 0, 500000000, time.UTC)},
+		{"c70cff1dcd6500ffffffffffffffff", time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := Decode(mustHex(t, tt.hex))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "",
+		"never used":        "c1",
+		"truncated uint":    "cd01",
+		"truncated str":     "a3616263"[:6],
+		"trailing data":     "0000",
+		"invalid UTF-8":     "a1ff",
+		"integer key":       "810102",
+		"missing map value": "81a161",
+		"unknown extension": "d40501",
+		"bad timestamp":     "c703ff010203",
+		"timestamp nanos":   "d7ffffffffff00000000",
+		"huge array":        "ddffffffff",
+	}
+	for name, h := range tests {
+		if _, err := Decode(mustHex(t, h)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecode_DepthLimit(t *testing.T) {
+	deep := make([]byte, MaxDepth+2)
+	for i := range deep {
+		deep[i] = 0x91 // Array of one element
+	}
+	if _, err := Decode(deep); err == nil {
+		t.Error("expected error for nesting beyond MaxDepth")
+	}
+
+	ok := append(make([]byte, 0, MaxDepth+1), deep[:MaxDepth]...)
+	ok = append(ok, 0x00)
+	if _, err := Decode(ok); err != nil {
+		t.Errorf("unexpected error at MaxDepth: %v", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(mustHex(f, "82a16101a16292a178ff"))
+	f.Add(mustHex(f, "d7ff77359400514b67b0"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Decode(data) // Must not panic
+	})
+}
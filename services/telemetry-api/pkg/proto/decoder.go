@@ -14,10 +14,12 @@ import (
 type WireType uint8
 
 const (
-	WireVarint  WireType = 0
-	WireFixed64 WireType = 1
-	WireBytes   WireType = 2
-	WireFixed32 WireType = 5
+	WireVarint     WireType = 0
+	WireFixed64    WireType = 1
+	WireBytes      WireType = 2
+	WireStartGroup WireType = 3 // Deprecated groups: skipped by Decode, rejected in strict mode
+	WireEndGroup   WireType = 4
+	WireFixed32    WireType = 5
 )
 
 // Value represents a decoded protobuf field value with its wire type
@@ -27,8 +29,23 @@ type Value struct {
 	Fixed32  uint32 // For WireFixed32
 	Fixed64  uint64 // For WireFixed64
 	Bytes    []byte // For WireBytes (embedded messages, strings, bytes)
+
+	// Set by DecodeWithOptions so AsMessage keeps applying the options one level deeper
+	opts  *DecodeOptions
+	depth int
+}
+
+// DecodeOptions hardens decoding of untrusted payloads. The zero value is the
+// tolerant behaviour of Decode; zero limits are unlimited.
+type DecodeOptions struct {
+	Strict    bool // Reject group wire types and field number 0 instead of tolerating them
+	MaxDepth  int  // Nesting depth of embedded messages decoded with AsMessage, and of skipped groups
+	MaxFields int  // Fields per message, including the contents of skipped groups
 }
 
+// StrictOptions are suitable for payloads from devices
+var StrictOptions = DecodeOptions{Strict: true, MaxDepth: 16, MaxFields: 10000}
+
 // Field represents a decoded protobuf field
 type Field struct {
 	Num   uint32
@@ -38,66 +55,119 @@ type Field struct {
 // Message represents a decoded protobuf message as a list of fields
 type Message []Field
 
-// Decode decodes raw protobuf wire format into a Message
+// Decode decodes raw protobuf wire format into a Message.
+// Deprecated groups (wire types 3 and 4) are skipped.
 func Decode(data []byte) (Message, error) {
+	return decode(data, nil, 1)
+}
+
+// DecodeWithOptions decodes like Decode, applying opts to this message and to
+// embedded messages later decoded from its values with AsMessage.
+func DecodeWithOptions(data []byte, opts DecodeOptions) (Message, error) {
+	if opts == (DecodeOptions{}) {
+		return Decode(data)
+	}
+	return decode(data, &opts, 1)
+}
+
+func decode(data []byte, opts *DecodeOptions, depth int) (Message, error) {
 	var fields Message
+	r := newReader(data, opts, depth)
+	for r.Next() {
+		fields = append(fields, r.field)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return fields, nil
+}
+
+// checkField applies the options to the count-th field of a message
+func (o *DecodeOptions) checkField(fieldNum uint32, wireType WireType, count int) error {
+	if o == nil {
+		return nil
+	}
+	if o.MaxFields > 0 && count > o.MaxFields {
+		return fmt.Errorf("message exceeds field limit %d", o.MaxFields)
+	}
+	if o.Strict {
+		if fieldNum == 0 {
+			return errors.New("invalid field number 0")
+		}
+		if wireType == WireStartGroup || wireType == WireEndGroup {
+			return fmt.Errorf("field %d: group wire types are not accepted", fieldNum)
+		}
+	}
+	return nil
+}
+
+// skipGroup skips the contents of a group opened by fieldNum, up to and including
+// its matching end group tag. Nested groups are tracked with an explicit stack so
+// deeply nested input cannot exhaust the call stack.
+// Returns the bytes consumed and the number of fields skipped.
+func skipGroup(data []byte, fieldNum uint32, opts *DecodeOptions, depth, count int) (int, int, error) {
+	open := []uint32{fieldNum}
 	pos := 0
+	skipped := 0
+
+	for len(open) > 0 {
+		if opts != nil && opts.MaxDepth > 0 && depth+len(open) > opts.MaxDepth {
+			return 0, 0, fmt.Errorf("group nesting exceeds depth limit %d", opts.MaxDepth)
+		}
 
-	for pos < len(data) {
 		tag, n := decodeVarint(data[pos:])
 		if n == 0 {
-			return nil, errors.New("failed to decode tag")
+			return 0, 0, fmt.Errorf("field %d: unterminated group", open[len(open)-1])
 		}
 		pos += n
 
-		fieldNum := uint32(tag >> 3)
+		num := uint32(tag >> 3)
 		wireType := WireType(tag & 0x7)
 
-		field := Field{Num: fieldNum, Value: Value{WireType: wireType}}
+		skipped++
+		if opts != nil && opts.MaxFields > 0 && count+skipped > opts.MaxFields {
+			return 0, 0, fmt.Errorf("message exceeds field limit %d", opts.MaxFields)
+		}
 
 		switch wireType {
 		case WireVarint:
-			val, n := decodeVarint(data[pos:])
-			if n == 0 {
-				return nil, fmt.Errorf("field %d: failed to decode varint", fieldNum)
+			if _, n = decodeVarint(data[pos:]); n == 0 {
+				return 0, 0, fmt.Errorf("field %d: failed to decode varint", num)
 			}
-			field.Value.Varint = val
 			pos += n
-
 		case WireFixed64:
 			if pos+8 > len(data) {
-				return nil, fmt.Errorf("field %d: not enough data for fixed64", fieldNum)
+				return 0, 0, fmt.Errorf("field %d: not enough data for fixed64", num)
 			}
-			field.Value.Fixed64 = binary.LittleEndian.Uint64(data[pos:])
 			pos += 8
-
 		case WireBytes:
 			length, n := decodeVarint(data[pos:])
 			if n == 0 {
-				return nil, fmt.Errorf("field %d: failed to decode length", fieldNum)
+				return 0, 0, fmt.Errorf("field %d: failed to decode length", num)
 			}
 			pos += n
-			if pos+int(length) > len(data) {
-				return nil, fmt.Errorf("field %d: bytes length exceeds data", fieldNum)
+			if length > uint64(len(data)-pos) {
+				return 0, 0, fmt.Errorf("field %d: bytes length exceeds data", num)
 			}
-			field.Value.Bytes = data[pos : pos+int(length)]
 			pos += int(length)
-
 		case WireFixed32:
 			if pos+4 > len(data) {
-				return nil, fmt.Errorf("field %d: not enough data for fixed32", fieldNum)
+				return 0, 0, fmt.Errorf("field %d: not enough data for fixed32", num)
 			}
-			field.Value.Fixed32 = binary.LittleEndian.Uint32(data[pos:])
 			pos += 4
-
+		case WireStartGroup:
+			open = append(open, num)
+		case WireEndGroup:
+			if num != open[len(open)-1] {
+				return 0, 0, fmt.Errorf("field %d: end group does not match start group %d", num, open[len(open)-1])
+			}
+			open = open[:len(open)-1]
 		default:
-			return nil, fmt.Errorf("field %d: unknown wire type %d", fieldNum, wireType)
+			return 0, 0, fmt.Errorf("field %d: unknown wire type %d", num, wireType)
 		}
-
-		fields = append(fields, field)
 	}
 
-	return fields, nil
+	return pos, skipped, nil
 }
 
 // GetField returns the first field with the given field number, or nil if not found
@@ -198,9 +268,82 @@ func (v Value) AsString() string {
 	return string(v.Bytes)
 }
 
-// AsMessage decodes Bytes as an embedded protobuf message
+// AsMessage decodes Bytes as an embedded protobuf message.
+// Values from DecodeWithOptions decode with the same options, one level deeper.
 func (v Value) AsMessage() (Message, error) {
-	return Decode(v.Bytes)
+	return decode(v.Bytes, v.opts, v.depth+1)
+}
+
+// Packed repeated scalars - a single WireBytes value holding consecutive elements.
+// Each helper also accepts one unpacked element of the matching wire type, since
+// encoders may emit repeated scalars either way.
+
+// AsPackedVarints decodes packed varints (int32, int64, uint32, uint64, sint32, sint64, bool, enum).
+// Interpret elements with the Varint helpers, e.g. VarintValue(x).AsSint32().
+func (v Value) AsPackedVarints() ([]uint64, error) {
+	switch v.WireType {
+	case WireVarint:
+		return []uint64{v.Varint}, nil
+	case WireBytes:
+	default:
+		return nil, fmt.Errorf("wire type %d is not a packed varint field", v.WireType)
+	}
+
+	// Every element ends in exactly one byte without the continuation bit
+	count := 0
+	for _, b := range v.Bytes {
+		if b < 0x80 {
+			count++
+		}
+	}
+	values := make([]uint64, 0, count)
+	for data := v.Bytes; len(data) > 0; {
+		x, n := decodeVarint(data)
+		if n == 0 {
+			return nil, errors.New("truncated packed varint")
+		}
+		values = append(values, x)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+// AsPackedFixed32 decodes packed 4-byte elements (fixed32, sfixed32, float)
+func (v Value) AsPackedFixed32() ([]uint32, error) {
+	switch v.WireType {
+	case WireFixed32:
+		return []uint32{v.Fixed32}, nil
+	case WireBytes:
+	default:
+		return nil, fmt.Errorf("wire type %d is not a packed fixed32 field", v.WireType)
+	}
+	if len(v.Bytes)%4 != 0 {
+		return nil, errors.New("truncated packed fixed32")
+	}
+	values := make([]uint32, len(v.Bytes)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(v.Bytes[i*4:])
+	}
+	return values, nil
+}
+
+// AsPackedFixed64 decodes packed 8-byte elements (fixed64, sfixed64, double)
+func (v Value) AsPackedFixed64() ([]uint64, error) {
+	switch v.WireType {
+	case WireFixed64:
+		return []uint64{v.Fixed64}, nil
+	case WireBytes:
+	default:
+		return nil, fmt.Errorf("wire type %d is not a packed fixed64 field", v.WireType)
+	}
+	if len(v.Bytes)%8 != 0 {
+		return nil, errors.New("truncated packed fixed64")
+	}
+	values := make([]uint64, len(v.Bytes)/8)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint64(v.Bytes[i*8:])
+	}
+	return values, nil
 }
 
 func decodeVarint(data []byte) (uint64, int) {
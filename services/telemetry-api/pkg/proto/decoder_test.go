@@ -148,8 +148,8 @@ func TestDecode_InvalidTag(t *testing.T) {
 }
 
 func TestDecode_UnknownWireType(t *testing.T) {
-	// Wire type 3 is deprecated "start group"
-	data := encodeTag(1, 3)
+	// Wire types 6 and 7 are not defined
+	data := encodeTag(1, 6)
 	_, err := Decode(data)
 	if err == nil {
 		t.Error("expected error for unknown wire type")
@@ -347,3 +347,179 @@ func TestValue_AsMessage(t *testing.T) {
 		t.Errorf("expected 42, got %d", msg.GetField(1).Value.Varint)
 	}
 }
+
+func TestDecode_SkipsGroups(t *testing.T) {
+	// Field 1 = 7, group 2 { 3 = "x", group 4 { 5 = 1 } }, field 6 = 8
+	var data []byte
+	data = append(data, encodeTag(1, WireVarint)...)
+	data = append(data, 7)
+	data = append(data, encodeTag(2, WireStartGroup)...)
+	data = append(data, new(Builder).String(3, "x").Build()...)
+	data = append(data, encodeTag(4, WireStartGroup)...)
+	data = append(data, new(Builder).Fixed32(5, 1).Build()...)
+	data = append(data, encodeTag(4, WireEndGroup)...)
+	data = append(data, encodeTag(2, WireEndGroup)...)
+	data = append(data, encodeTag(6, WireVarint)...)
+	data = append(data, 8)
+
+	msg, err := Decode(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msg) != 2 || msg[0].Value.Varint != 7 || msg[1].Num != 6 || msg[1].Value.Varint != 8 {
+		t.Errorf("expected fields 1 and 6 only, got %+v", msg)
+	}
+
+	if _, err := DecodeWithOptions(data, StrictOptions); err == nil {
+		t.Error("expected strict mode to reject groups")
+	}
+}
+
+func TestDecode_MalformedGroups(t *testing.T) {
+	tests := map[string][]byte{
+		"unterminated":     encodeTag(1, WireStartGroup),
+		"stray end":        encodeTag(1, WireEndGroup),
+		"mismatched end":   append(encodeTag(1, WireStartGroup), encodeTag(2, WireEndGroup)...),
+		"truncated inside": append(encodeTag(1, WireStartGroup), encodeTag(2, WireFixed64)...),
+	}
+	for name, data := range tests {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecode_OverflowingLength(t *testing.T) {
+	data := append(encodeTag(1, WireBytes), encodeVarint(math.MaxUint64)...)
+	if _, err := Decode(data); err == nil {
+		t.Error("expected error for length overflowing int")
+	}
+}
+
+func TestDecodeWithOptions_FieldLimit(t *testing.T) {
+	var b Builder
+	for i := 0; i < 5; i++ {
+		b.Varint(1, uint64(i))
+	}
+	opts := DecodeOptions{MaxFields: 4}
+
+	if _, err := DecodeWithOptions(b.Build(), opts); err == nil {
+		t.Error("expected error for 5 fields with limit 4")
+	}
+	opts.MaxFields = 5
+	if msg, err := DecodeWithOptions(b.Build(), opts); err != nil || len(msg) != 5 {
+		t.Errorf("expected 5 fields, got %d (%v)", len(msg), err)
+	}
+
+	// Skipped group contents count too
+	var data []byte
+	data = append(data, encodeTag(1, WireStartGroup)...)
+	data = append(data, b.Build()...)
+	data = append(data, encodeTag(1, WireEndGroup)...)
+	if _, err := DecodeWithOptions(data, DecodeOptions{MaxFields: 5}); err == nil {
+		t.Error("expected skipped group fields to count against the limit")
+	}
+}
+
+func TestDecodeWithOptions_DepthLimit(t *testing.T) {
+	// Three levels: outer { 1: middle { 1: inner { 1 = 42 } } }
+	inner := new(Builder).Varint(1, 42)
+	middle := new(Builder).Message(1, inner)
+	data := new(Builder).Message(1, middle).Build()
+
+	walk := func(opts DecodeOptions) error {
+		msg, err := DecodeWithOptions(data, opts)
+		for level := 1; err == nil && level < 3; level++ {
+			msg, err = msg.GetField(1).Value.AsMessage()
+		}
+		return err
+	}
+
+	if err := walk(DecodeOptions{MaxDepth: 3}); err != nil {
+		t.Errorf("unexpected error at depth 3: %v", err)
+	}
+	if err := walk(DecodeOptions{MaxDepth: 2}); err == nil {
+		t.Error("expected AsMessage to enforce the depth limit")
+	}
+
+	// Groups nested deeper than the limit
+	var groups []byte
+	for i := 0; i < 20; i++ {
+		groups = append(groups, encodeTag(1, WireStartGroup)...)
+	}
+	for i := 0; i < 20; i++ {
+		groups = append(groups, encodeTag(1, WireEndGroup)...)
+	}
+	if _, err := Decode(groups); err != nil {
+		t.Errorf("unexpected error without limits: %v", err)
+	}
+	if _, err := DecodeWithOptions(groups, DecodeOptions{MaxDepth: 16}); err == nil {
+		t.Error("expected error for groups nested beyond the depth limit")
+	}
+}
+
+func TestDecodeWithOptions_StrictFieldZero(t *testing.T) {
+	data := append(encodeTag(0, WireVarint), 1)
+	if _, err := Decode(data); err != nil {
+		t.Errorf("unexpected error in tolerant mode: %v", err)
+	}
+	if _, err := DecodeWithOptions(data, StrictOptions); err == nil {
+		t.Error("expected strict mode to reject field number 0")
+	}
+}
+
+func TestValue_AsPackedVarints(t *testing.T) {
+	var packed []byte
+	for _, x := range []uint64{0, 1, 150, math.MaxUint64} {
+		packed = AppendVarint(packed, x)
+	}
+	packed = AppendVarint(packed, ZigZag32(-3))
+
+	got, err := BytesValue(packed).AsPackedVarints()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 5 || got[2] != 150 || got[3] != math.MaxUint64 || VarintValue(got[4]).AsSint32() != -3 {
+		t.Errorf("unexpected elements: %v", got)
+	}
+
+	if got, err := VarintValue(9).AsPackedVarints(); err != nil || len(got) != 1 || got[0] != 9 {
+		t.Errorf("expected unpacked element 9, got %v (%v)", got, err)
+	}
+	if _, err := BytesValue([]byte{0x96}).AsPackedVarints(); err == nil {
+		t.Error("expected error for truncated varint")
+	}
+	if _, err := Fixed32Value(1).AsPackedVarints(); err == nil {
+		t.Error("expected error for fixed32 wire type")
+	}
+}
+
+func TestValue_AsPackedFixed(t *testing.T) {
+	var packed32, packed64 []byte
+	for _, x := range []float64{0.5, -1.25, 1000} {
+		packed32 = binary.LittleEndian.AppendUint32(packed32, math.Float32bits(float32(x)))
+		packed64 = binary.LittleEndian.AppendUint64(packed64, math.Float64bits(x))
+	}
+
+	got32, err := BytesValue(packed32).AsPackedFixed32()
+	if err != nil || len(got32) != 3 || Fixed32Value(got32[1]).AsFloat32() != -1.25 {
+		t.Errorf("unexpected fixed32 elements: %v (%v)", got32, err)
+	}
+	got64, err := BytesValue(packed64).AsPackedFixed64()
+	if err != nil || len(got64) != 3 || Fixed64Value(got64[2]).AsFloat64() != 1000 {
+		t.Errorf("unexpected fixed64 elements: %v (%v)", got64, err)
+	}
+
+	if _, err := BytesValue(packed32[:5]).AsPackedFixed32(); err == nil {
+		t.Error("expected error for truncated fixed32")
+	}
+	if _, err := BytesValue(packed64[:12]).AsPackedFixed64(); err == nil {
+		t.Error("expected error for truncated fixed64")
+	}
+	if got, err := Float64Value(2).AsPackedFixed64(); err != nil || len(got) != 1 {
+		t.Errorf("expected one unpacked element, got %v (%v)", got, err)
+	}
+	if _, err := VarintValue(1).AsPackedFixed32(); err == nil {
+		t.Error("expected error for varint wire type")
+	}
+}
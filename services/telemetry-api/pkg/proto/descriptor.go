@@ -0,0 +1,293 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldType is a google.protobuf.FieldDescriptorProto.Type value
+type FieldType int32
+
+const (
+	TypeDouble   FieldType = 1
+	TypeFloat    FieldType = 2
+	TypeInt64    FieldType = 3
+	TypeUint64   FieldType = 4
+	TypeInt32    FieldType = 5
+	TypeFixed64  FieldType = 6
+	TypeFixed32  FieldType = 7
+	TypeBool     FieldType = 8
+	TypeString   FieldType = 9
+	TypeGroup    FieldType = 10
+	TypeMessage  FieldType = 11
+	TypeBytes    FieldType = 12
+	TypeUint32   FieldType = 13
+	TypeEnum     FieldType = 14
+	TypeSfixed32 FieldType = 15
+	TypeSfixed64 FieldType = 16
+	TypeSint32   FieldType = 17
+	TypeSint64   FieldType = 18
+)
+
+var fieldTypeNames = map[FieldType]string{
+	TypeDouble: "double", TypeFloat: "float", TypeInt64: "int64", TypeUint64: "uint64",
+	TypeInt32: "int32", TypeFixed64: "fixed64", TypeFixed32: "fixed32", TypeBool: "bool",
+	TypeString: "string", TypeGroup: "group", TypeMessage: "message", TypeBytes: "bytes",
+	TypeUint32: "uint32", TypeEnum: "enum", TypeSfixed32: "sfixed32", TypeSfixed64: "sfixed64",
+	TypeSint32: "sint32", TypeSint64: "sint64",
+}
+
+// String returns the .proto name of the type ("sint32", "message", ...)
+func (t FieldType) String() string {
+	if name, ok := fieldTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", int32(t))
+}
+
+// FieldLabel is a google.protobuf.FieldDescriptorProto.Label value
+type FieldLabel int32
+
+const (
+	LabelOptional FieldLabel = 1
+	LabelRequired FieldLabel = 2
+	LabelRepeated FieldLabel = 3
+)
+
+// FieldDescriptor describes a message field
+type FieldDescriptor struct {
+	Name     string
+	Number   int32
+	Label    FieldLabel
+	Type     FieldType
+	TypeName string // Fully-qualified message or enum name (without leading dot)
+}
+
+// MessageDescriptor describes a message type, including its nested declarations
+type MessageDescriptor struct {
+	Name     string
+	FullName string // Package-qualified name, e.g. "probe.v1.Reading.Env"
+	Fields   []FieldDescriptor
+	Nested   []*MessageDescriptor
+	Enums    []*EnumDescriptor
+}
+
+// EnumDescriptor describes an enum type
+type EnumDescriptor struct {
+	Name     string
+	FullName string
+	Values   []EnumValue
+}
+
+// EnumValue is a named enum number
+type EnumValue struct {
+	Name   string
+	Number int32
+}
+
+// FileDescriptor describes a .proto file
+type FileDescriptor struct {
+	Name     string
+	Package  string
+	Messages []*MessageDescriptor
+	Enums    []*EnumDescriptor
+}
+
+// DescriptorSet is a decoded google.protobuf.FileDescriptorSet with lookup by full name
+type DescriptorSet struct {
+	Files    []*FileDescriptor
+	messages map[string]*MessageDescriptor
+	enums    map[string]*EnumDescriptor
+}
+
+// Message returns the message type with the given fully-qualified name (leading dot optional)
+func (s *DescriptorSet) Message(fullName string) *MessageDescriptor {
+	return s.messages[strings.TrimPrefix(fullName, ".")]
+}
+
+// Enum returns the enum type with the given fully-qualified name (leading dot optional)
+func (s *DescriptorSet) Enum(fullName string) *EnumDescriptor {
+	return s.enums[strings.TrimPrefix(fullName, ".")]
+}
+
+// Messages returns every message type in the set, nested types included
+func (s *DescriptorSet) Messages() []*MessageDescriptor {
+	var all []*MessageDescriptor
+	var walk func([]*MessageDescriptor)
+	walk = func(msgs []*MessageDescriptor) {
+		for _, m := range msgs {
+			all = append(all, m)
+			walk(m.Nested)
+		}
+	}
+	for _, f := range s.Files {
+		walk(f.Messages)
+	}
+	return all
+}
+
+// Descriptor proto field numbers (google/protobuf/descriptor.proto)
+const (
+	fdsFile = 1
+
+	fileName        = 1
+	filePackage     = 2
+	fileMessageType = 4
+	fileEnumType    = 5
+
+	msgName       = 1
+	msgField      = 2
+	msgNestedType = 3
+	msgEnumType   = 4
+
+	fieldName     = 1
+	fieldNumber   = 3
+	fieldLabel    = 4
+	fieldType     = 5
+	fieldTypeName = 6
+
+	enumName  = 1
+	enumValue = 2
+
+	enumValueName   = 1
+	enumValueNumber = 2
+)
+
+// ParseFileDescriptorSet decodes a serialized google.protobuf.FileDescriptorSet
+// (e.g. the output of protoc --descriptor_set_out). Options and source info are ignored.
+func ParseFileDescriptorSet(data []byte) (*DescriptorSet, error) {
+	msg, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode descriptor set: %w", err)
+	}
+
+	set := &DescriptorSet{
+		messages: make(map[string]*MessageDescriptor),
+		enums:    make(map[string]*EnumDescriptor),
+	}
+	for _, f := range msg.GetAllFields(fdsFile) {
+		fileMsg, err := embedded(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor: %w", err)
+		}
+		file := &FileDescriptor{
+			Name:    stringField(fileMsg, fileName),
+			Package: stringField(fileMsg, filePackage),
+		}
+		for _, mf := range fileMsg.GetAllFields(fileMessageType) {
+			m, err := set.parseMessage(mf, file.Package)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Name, err)
+			}
+			file.Messages = append(file.Messages, m)
+		}
+		for _, ef := range fileMsg.GetAllFields(fileEnumType) {
+			e, err := set.parseEnum(ef, file.Package)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Name, err)
+			}
+			file.Enums = append(file.Enums, e)
+		}
+		set.Files = append(set.Files, file)
+	}
+
+	if len(set.Files) == 0 {
+		return nil, fmt.Errorf("descriptor set contains no files")
+	}
+	return set, nil
+}
+
+func (s *DescriptorSet) parseMessage(f Field, scope string) (*MessageDescriptor, error) {
+	msg, err := embedded(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message descriptor: %w", err)
+	}
+
+	m := &MessageDescriptor{Name: stringField(msg, msgName)}
+	m.FullName = qualify(scope, m.Name)
+
+	for _, ff := range msg.GetAllFields(msgField) {
+		fieldMsg, err := embedded(ff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field descriptor in %s: %w", m.FullName, err)
+		}
+		fd := FieldDescriptor{
+			Name:     stringField(fieldMsg, fieldName),
+			TypeName: strings.TrimPrefix(stringField(fieldMsg, fieldTypeName), "."),
+		}
+		if v := fieldMsg.GetField(fieldNumber); v != nil {
+			fd.Number = v.Value.AsInt32()
+		}
+		if v := fieldMsg.GetField(fieldLabel); v != nil {
+			fd.Label = FieldLabel(v.Value.AsInt32())
+		}
+		if v := fieldMsg.GetField(fieldType); v != nil {
+			fd.Type = FieldType(v.Value.AsInt32())
+		}
+		m.Fields = append(m.Fields, fd)
+	}
+	for _, nf := range msg.GetAllFields(msgNestedType) {
+		nested, err := s.parseMessage(nf, m.FullName)
+		if err != nil {
+			return nil, err
+		}
+		m.Nested = append(m.Nested, nested)
+	}
+	for _, ef := range msg.GetAllFields(msgEnumType) {
+		e, err := s.parseEnum(ef, m.FullName)
+		if err != nil {
+			return nil, err
+		}
+		m.Enums = append(m.Enums, e)
+	}
+
+	s.messages[m.FullName] = m
+	return m, nil
+}
+
+func (s *DescriptorSet) parseEnum(f Field, scope string) (*EnumDescriptor, error) {
+	msg, err := embedded(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enum descriptor: %w", err)
+	}
+
+	e := &EnumDescriptor{Name: stringField(msg, enumName)}
+	e.FullName = qualify(scope, e.Name)
+	for _, vf := range msg.GetAllFields(enumValue) {
+		valueMsg, err := embedded(vf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enum value in %s: %w", e.FullName, err)
+		}
+		v := EnumValue{Name: stringField(valueMsg, enumValueName)}
+		if n := valueMsg.GetField(enumValueNumber); n != nil {
+			v.Number = n.Value.AsInt32()
+		}
+		e.Values = append(e.Values, v)
+	}
+
+	s.enums[e.FullName] = e
+	return e, nil
+}
+
+// embedded decodes a length-delimited field as a message
+func embedded(f Field) (Message, error) {
+	if f.Value.WireType != WireBytes {
+		return nil, fmt.Errorf("field %d: expected length-delimited value", f.Num)
+	}
+	return f.Value.AsMessage()
+}
+
+// stringField returns the string value of a field ("" when absent)
+func stringField(m Message, num uint32) string {
+	if f := m.GetField(num); f != nil {
+		return f.Value.AsString()
+	}
+	return ""
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
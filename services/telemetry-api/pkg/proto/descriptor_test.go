@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"testing"
+)
+
+// Helpers to hand-encode descriptor messages
+func bytesField(num uint32, data []byte) []byte {
+	b := append(encodeTag(num, WireBytes), encodeVarint(uint64(len(data)))...)
+	return append(b, data...)
+}
+
+func varintField(num uint32, v uint64) []byte {
+	return append(encodeTag(num, WireVarint), encodeVarint(v)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fieldDesc(name string, number int32, label FieldLabel, typ FieldType, typeName string) []byte {
+	b := concat(
+		bytesField(fieldName, []byte(name)),
+		varintField(fieldNumber, uint64(number)),
+		varintField(fieldLabel, uint64(label)),
+		varintField(fieldType, uint64(typ)),
+	)
+	if typeName != "" {
+		b = append(b, bytesField(fieldTypeName, []byte(typeName))...)
+	}
+	return b
+}
+
+func TestParseFileDescriptorSet(t *testing.T) {
+	nested := concat(
+		bytesField(msgName, []byte("Env")),
+		bytesField(msgField, fieldDesc("energy_wh", 20, LabelOptional, TypeUint64, "")),
+	)
+	message := concat(
+		bytesField(msgName, []byte("Measurements")),
+		bytesField(msgField, fieldDesc("temperature", 1, LabelOptional, TypeFloat, "")),
+		bytesField(msgField, fieldDesc("env", 2, LabelOptional, TypeMessage, ".probe.v1.Measurements.Env")),
+		bytesField(msgNestedType, nested),
+	)
+	enum := concat(
+		bytesField(enumName, []byte("Mode")),
+		bytesField(enumValue, concat(bytesField(enumValueName, []byte("OFF")), varintField(enumValueNumber, 0))),
+		bytesField(enumValue, concat(bytesField(enumValueName, []byte("HEAT")), varintField(enumValueNumber, 1))),
+	)
+	file := concat(
+		bytesField(fileName, []byte("probe.proto")),
+		bytesField(filePackage, []byte("probe.v1")),
+		bytesField(fileMessageType, message),
+		bytesField(fileEnumType, enum),
+	)
+
+	set, err := ParseFileDescriptorSet(bytesField(fdsFile, file))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := set.Message(".probe.v1.Measurements")
+	if msg == nil || len(msg.Fields) != 2 {
+		t.Fatalf("expected Measurements with 2 fields, got %+v", msg)
+	}
+	if f := msg.Fields[1]; f.Type != TypeMessage || f.TypeName != "probe.v1.Measurements.Env" {
+		t.Errorf("unexpected nested field: %+v", f)
+	}
+	env := set.Message("probe.v1.Measurements.Env")
+	if env == nil || env.Fields[0].Number != 20 || env.Fields[0].Type.String() != "uint64" {
+		t.Errorf("unexpected nested message: %+v", env)
+	}
+	mode := set.Enum("probe.v1.Mode")
+	if mode == nil || len(mode.Values) != 2 || mode.Values[1].Name != "HEAT" || mode.Values[1].Number != 1 {
+		t.Errorf("unexpected enum: %+v", mode)
+	}
+	if len(set.Messages()) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(set.Messages()))
+	}
+}
+
+func TestParseFileDescriptorSet_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", []byte{0x0a, 0x05, 0x01}},
+		{"file not a message", varintField(fdsFile, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFileDescriptorSet(tt.data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Encode serializes a Message to protobuf wire format, fields in order.
+// It is the inverse of Decode: Decode(Encode(m)) returns m.
+func Encode(m Message) ([]byte, error) {
+	return AppendMessage(nil, m)
+}
+
+// AppendMessage appends the wire format of m to buf
+func AppendMessage(buf []byte, m Message) ([]byte, error) {
+	for _, f := range m {
+		var err error
+		if buf, err = AppendField(buf, f); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// AppendField appends one field (tag and value) to buf
+func AppendField(buf []byte, f Field) ([]byte, error) {
+	v := f.Value
+	switch v.WireType {
+	case WireVarint:
+		buf = AppendTag(buf, f.Num, WireVarint)
+		return AppendVarint(buf, v.Varint), nil
+	case WireFixed64:
+		buf = AppendTag(buf, f.Num, WireFixed64)
+		return binary.LittleEndian.AppendUint64(buf, v.Fixed64), nil
+	case WireBytes:
+		buf = AppendTag(buf, f.Num, WireBytes)
+		buf = AppendVarint(buf, uint64(len(v.Bytes)))
+		return append(buf, v.Bytes...), nil
+	case WireFixed32:
+		buf = AppendTag(buf, f.Num, WireFixed32)
+		return binary.LittleEndian.AppendUint32(buf, v.Fixed32), nil
+	default:
+		return nil, fmt.Errorf("field %d: unknown wire type %d", f.Num, v.WireType)
+	}
+}
+
+// AppendTag appends a field tag (field number and wire type)
+func AppendTag(buf []byte, fieldNum uint32, wt WireType) []byte {
+	return AppendVarint(buf, uint64(fieldNum)<<3|uint64(wt))
+}
+
+// AppendVarint appends v in base-128 varint encoding
+func AppendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// ZigZag32 maps a signed value to the unsigned sint32 encoding (inverse of Value.AsSint32)
+func ZigZag32(v int32) uint64 {
+	return uint64(uint32((v << 1) ^ (v >> 31)))
+}
+
+// ZigZag64 maps a signed value to the unsigned sint64 encoding (inverse of Value.AsSint64)
+func ZigZag64(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// Value constructors - the inverse of the As* interpretation helpers
+
+// VarintValue returns a raw varint value
+func VarintValue(v uint64) Value {
+	return Value{WireType: WireVarint, Varint: v}
+}
+
+// Int32Value encodes an int32 (negative values take 10 bytes, as in protobuf)
+func Int32Value(v int32) Value {
+	return VarintValue(uint64(int64(v)))
+}
+
+// Int64Value encodes an int64
+func Int64Value(v int64) Value {
+	return VarintValue(uint64(v))
+}
+
+// Uint32Value encodes a uint32
+func Uint32Value(v uint32) Value {
+	return VarintValue(uint64(v))
+}
+
+// Uint64Value encodes a uint64
+func Uint64Value(v uint64) Value {
+	return VarintValue(v)
+}
+
+// BoolValue encodes a bool
+func BoolValue(v bool) Value {
+	if v {
+		return VarintValue(1)
+	}
+	return VarintValue(0)
+}
+
+// Sint32Value encodes a ZigZag sint32
+func Sint32Value(v int32) Value {
+	return VarintValue(ZigZag32(v))
+}
+
+// Sint64Value encodes a ZigZag sint64
+func Sint64Value(v int64) Value {
+	return VarintValue(ZigZag64(v))
+}
+
+// Fixed32Value encodes a fixed32 (also used for sfixed32 via uint32 conversion)
+func Fixed32Value(v uint32) Value {
+	return Value{WireType: WireFixed32, Fixed32: v}
+}
+
+// Fixed64Value encodes a fixed64 (also used for sfixed64 via uint64 conversion)
+func Fixed64Value(v uint64) Value {
+	return Value{WireType: WireFixed64, Fixed64: v}
+}
+
+// Float32Value encodes a float
+func Float32Value(v float32) Value {
+	return Fixed32Value(math.Float32bits(v))
+}
+
+// Float64Value encodes a double
+func Float64Value(v float64) Value {
+	return Fixed64Value(math.Float64bits(v))
+}
+
+// BytesValue encodes a length-delimited bytes value
+func BytesValue(v []byte) Value {
+	return Value{WireType: WireBytes, Bytes: v}
+}
+
+// StringValue encodes a string
+func StringValue(v string) Value {
+	return BytesValue([]byte(v))
+}
+
+// MessageValue encodes an embedded message
+func MessageValue(m Message) (Value, error) {
+	data, err := Encode(m)
+	if err != nil {
+		return Value{}, err
+	}
+	return BytesValue(data), nil
+}
+
+// Builder encodes a message field by field, without building a Message first.
+// The zero value is ready to use; methods return the builder for chaining.
+//
+//	var b proto.Builder
+//	b.String(1, "reboot").Int64(2, -5).Message(3, new(proto.Builder).Bool(1, true))
+//	data := b.Build()
+type Builder struct {
+	buf []byte
+}
+
+// Build returns the encoded message. The builder may be used to append further fields.
+func (b *Builder) Build() []byte {
+	return b.buf
+}
+
+// Len returns the encoded size so far
+func (b *Builder) Len() int {
+	return len(b.buf)
+}
+
+// Varint appends a raw varint field
+func (b *Builder) Varint(num uint32, v uint64) *Builder {
+	b.buf = AppendTag(b.buf, num, WireVarint)
+	b.buf = AppendVarint(b.buf, v)
+	return b
+}
+
+// Int32 appends an int32 field
+func (b *Builder) Int32(num uint32, v int32) *Builder {
+	return b.Varint(num, uint64(int64(v)))
+}
+
+// Int64 appends an int64 field
+func (b *Builder) Int64(num uint32, v int64) *Builder {
+	return b.Varint(num, uint64(v))
+}
+
+// Uint32 appends a uint32 field
+func (b *Builder) Uint32(num uint32, v uint32) *Builder {
+	return b.Varint(num, uint64(v))
+}
+
+// Uint64 appends a uint64 field
+func (b *Builder) Uint64(num uint32, v uint64) *Builder {
+	return b.Varint(num, v)
+}
+
+// Bool appends a bool field
+func (b *Builder) Bool(num uint32, v bool) *Builder {
+	if v {
+		return b.Varint(num, 1)
+	}
+	return b.Varint(num, 0)
+}
+
+// Sint32 appends a ZigZag-encoded sint32 field
+func (b *Builder) Sint32(num uint32, v int32) *Builder {
+	return b.Varint(num, ZigZag32(v))
+}
+
+// Sint64 appends a ZigZag-encoded sint64 field
+func (b *Builder) Sint64(num uint32, v int64) *Builder {
+	return b.Varint(num, ZigZag64(v))
+}
+
+// Fixed32 appends a fixed32 field
+func (b *Builder) Fixed32(num uint32, v uint32) *Builder {
+	b.buf = AppendTag(b.buf, num, WireFixed32)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, v)
+	return b
+}
+
+// Fixed64 appends a fixed64 field
+func (b *Builder) Fixed64(num uint32, v uint64) *Builder {
+	b.buf = AppendTag(b.buf, num, WireFixed64)
+	b.buf = binary.LittleEndian.AppendUint64(b.buf, v)
+	return b
+}
+
+// Float appends a float field
+func (b *Builder) Float(num uint32, v float32) *Builder {
+	return b.Fixed32(num, math.Float32bits(v))
+}
+
+// Double appends a double field
+func (b *Builder) Double(num uint32, v float64) *Builder {
+	return b.Fixed64(num, math.Float64bits(v))
+}
+
+// Bytes appends a length-delimited bytes field
+func (b *Builder) Bytes(num uint32, v []byte) *Builder {
+	b.buf = AppendTag(b.buf, num, WireBytes)
+	b.buf = AppendVarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+	return b
+}
+
+// String appends a string field
+func (b *Builder) String(num uint32, v string) *Builder {
+	b.buf = AppendTag(b.buf, num, WireBytes)
+	b.buf = AppendVarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+	return b
+}
+
+// Message appends an embedded message field
+func (b *Builder) Message(num uint32, m *Builder) *Builder {
+	return b.Bytes(num, m.Build())
+}
@@ -0,0 +1,170 @@
+package proto
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncode_RoundTrip(t *testing.T) {
+	nested, err := MessageValue(Message{{Num: 1, Value: StringValue("inner")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := Message{
+		{Num: 1, Value: Uint64Value(150)},
+		{Num: 2, Value: Float32Value(3.14)},
+		{Num: 3, Value: Float64Value(-2.5)},
+		{Num: 4, Value: StringValue("hello")},
+		{Num: 5, Value: nested},
+		{Num: 1, Value: Uint64Value(151)}, // Repeated field, order preserved
+	}
+
+	data, err := Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, msg)
+	}
+
+	inner, err := got.GetField(5).Value.AsMessage()
+	if err != nil || inner.GetField(1).Value.AsString() != "inner" {
+		t.Errorf("nested message not decoded: %+v (%v)", inner, err)
+	}
+}
+
+func TestEncode_KnownBytes(t *testing.T) {
+	// Field 1 = 150 is the canonical protobuf encoding example
+	data, err := Encode(Message{{Num: 1, Value: VarintValue(150)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x08, 0x96, 0x01}; !bytes.Equal(data, want) {
+		t.Errorf("got % x, want % x", data, want)
+	}
+}
+
+func TestEncode_UnknownWireType(t *testing.T) {
+	_, err := Encode(Message{{Num: 1, Value: Value{WireType: 3}}})
+	if err == nil {
+		t.Error("expected error for unknown wire type")
+	}
+}
+
+func TestValueConstructors(t *testing.T) {
+	if v := Int32Value(-1); v.AsInt32() != -1 || len(AppendVarint(nil, v.Varint)) != 10 {
+		t.Errorf("Int32Value(-1) = %+v", v)
+	}
+	if v := Int64Value(math.MinInt64); v.AsInt64() != math.MinInt64 {
+		t.Errorf("Int64Value = %+v", v)
+	}
+	if v := Uint32Value(math.MaxUint32); v.AsUint32() != math.MaxUint32 {
+		t.Errorf("Uint32Value = %+v", v)
+	}
+	if !BoolValue(true).AsBool() || BoolValue(false).AsBool() {
+		t.Error("BoolValue mismatch")
+	}
+	for _, n := range []int32{0, -1, 1, math.MinInt32, math.MaxInt32} {
+		if got := Sint32Value(n).AsSint32(); got != n {
+			t.Errorf("Sint32Value(%d) decoded as %d", n, got)
+		}
+	}
+	for _, n := range []int64{0, -1, 1, math.MinInt64, math.MaxInt64} {
+		if got := Sint64Value(n).AsSint64(); got != n {
+			t.Errorf("Sint64Value(%d) decoded as %d", n, got)
+		}
+	}
+}
+
+func TestZigZag(t *testing.T) {
+	tests := []struct {
+		in   int32
+		want uint64
+	}{
+		{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {math.MaxInt32, 0xfffffffe}, {math.MinInt32, 0xffffffff},
+	}
+	for _, tt := range tests {
+		if got := ZigZag32(tt.in); got != tt.want {
+			t.Errorf("ZigZag32(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+		if got := ZigZag64(int64(tt.in)); got != tt.want {
+			t.Errorf("ZigZag64(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+	b.Int32(1, -7).
+		Uint64(2, math.MaxUint64).
+		Sint32(3, -7).
+		Sint64(4, -70000).
+		Bool(5, true).
+		Fixed32(6, 0xdeadbeef).
+		Fixed64(7, 1).
+		Float(8, 1.5).
+		Double(9, 2.25).
+		String(10, "id").
+		Bytes(11, []byte{0, 1}).
+		Message(12, new(Builder).Int64(1, 42))
+
+	msg, err := Decode(b.Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg) != 12 || b.Len() != len(b.Build()) {
+		t.Fatalf("expected 12 fields, got %d", len(msg))
+	}
+	if msg.GetField(1).Value.AsInt32() != -7 ||
+		msg.GetField(2).Value.AsUint64() != math.MaxUint64 ||
+		msg.GetField(3).Value.AsSint32() != -7 ||
+		msg.GetField(4).Value.AsSint64() != -70000 ||
+		!msg.GetField(5).Value.AsBool() ||
+		msg.GetField(6).Value.Fixed32 != 0xdeadbeef ||
+		msg.GetField(7).Value.Fixed64 != 1 ||
+		msg.GetField(8).Value.AsFloat32() != 1.5 ||
+		msg.GetField(9).Value.AsFloat64() != 2.25 ||
+		msg.GetField(10).Value.AsString() != "id" ||
+		!bytes.Equal(msg.GetField(11).Value.Bytes, []byte{0, 1}) {
+		t.Errorf("unexpected decoded fields: %+v", msg)
+	}
+	inner, err := msg.GetField(12).Value.AsMessage()
+	if err != nil || inner.GetField(1).Value.AsInt64() != 42 {
+		t.Errorf("nested message mismatch: %+v (%v)", inner, err)
+	}
+}
+
+// FuzzDecodeEncode checks that anything Decode accepts re-encodes to an equivalent message
+func FuzzDecodeEncode(f *testing.F) {
+	f.Add([]byte{0x08, 0x96, 0x01})
+	f.Add(new(Builder).String(1, "x").Double(2, 1).Fixed32(3, 7).Message(4, new(Builder).Sint64(1, -1)).Build())
+	f.Add([]byte{0x08, 0x80, 0x80, 0x00})             // Non-canonical varint
+	f.Add([]byte{0x0b, 0x08, 0x01, 0x0c, 0x10, 0x02}) // Skipped group, then field 2
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Decode(data)
+		if err != nil {
+			return
+		}
+		encoded, err := Encode(msg)
+		if err != nil {
+			t.Fatalf("Encode failed for decoded message: %v", err)
+		}
+		again, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode failed for re-encoded message: %v", err)
+		}
+		if len(msg) == 0 && len(again) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(again, msg) {
+			t.Fatalf("re-encoded message differs:\n got %+v\nwant %+v", again, msg)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Reader iterates over the fields of an encoded message without building a Message.
+// Field values alias the input and nothing is allocated per field, so large batches
+// can be walked in a single pass:
+//
+//	r := proto.NewReader(data)
+//	for r.Next() {
+//		f := r.Field()
+//		// ...
+//	}
+//	if err := r.Err(); err != nil {
+//		// ...
+//	}
+//
+// Deprecated groups are skipped, as with Decode.
+type Reader struct {
+	data  []byte
+	pos   int
+	count int // Fields seen, including skipped ones
+	field Field
+	err   error
+	opts  *DecodeOptions
+	depth int
+}
+
+// NewReader returns a Reader over data
+func NewReader(data []byte) Reader {
+	return newReader(data, nil, 1)
+}
+
+// NewReaderWithOptions returns a Reader applying opts, like DecodeWithOptions.
+// Readers and messages of embedded values inherit the options one level deeper.
+func NewReaderWithOptions(data []byte, opts DecodeOptions) Reader {
+	if opts == (DecodeOptions{}) {
+		return NewReader(data)
+	}
+	return newReader(data, &opts, 1)
+}
+
+// Reader returns a Reader over Bytes as an embedded message (AsMessage without building it)
+func (v Value) Reader() Reader {
+	return newReader(v.Bytes, v.opts, v.depth+1)
+}
+
+func newReader(data []byte, opts *DecodeOptions, depth int) Reader {
+	r := Reader{data: data, opts: opts, depth: depth}
+	if opts != nil && opts.MaxDepth > 0 && depth > opts.MaxDepth {
+		r.err = fmt.Errorf("message nesting exceeds depth limit %d", opts.MaxDepth)
+	}
+	return r
+}
+
+// Next advances to the next field. It returns false at the end of the message
+// or on error; check Err afterwards.
+func (r *Reader) Next() bool {
+	for r.err == nil && r.pos < len(r.data) {
+		if r.readField() {
+			return true
+		}
+	}
+	return false
+}
+
+// Field returns the current field. Its Bytes alias the input.
+func (r *Reader) Field() Field {
+	return r.field
+}
+
+// Err returns the error that stopped the iteration, if any
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// readField decodes the field at pos. It returns false when the field was
+// skipped (a group) or on error.
+func (r *Reader) readField() bool {
+	data := r.data
+	pos := r.pos
+
+	tag, n := decodeVarint(data[pos:])
+	if n == 0 {
+		r.err = errors.New("failed to decode tag")
+		return false
+	}
+	pos += n
+
+	fieldNum := uint32(tag >> 3)
+	wireType := WireType(tag & 0x7)
+
+	r.count++
+	if err := r.opts.checkField(fieldNum, wireType, r.count); err != nil {
+		r.err = err
+		return false
+	}
+
+	field := Field{Num: fieldNum, Value: Value{WireType: wireType}}
+	if r.opts != nil {
+		field.Value.opts, field.Value.depth = r.opts, r.depth
+	}
+
+	switch wireType {
+	case WireVarint:
+		val, n := decodeVarint(data[pos:])
+		if n == 0 {
+			r.err = fmt.Errorf("field %d: failed to decode varint", fieldNum)
+			return false
+		}
+		field.Value.Varint = val
+		pos += n
+
+	case WireFixed64:
+		if pos+8 > len(data) {
+			r.err = fmt.Errorf("field %d: not enough data for fixed64", fieldNum)
+			return false
+		}
+		field.Value.Fixed64 = binary.LittleEndian.Uint64(data[pos:])
+		pos += 8
+
+	case WireBytes:
+		length, n := decodeVarint(data[pos:])
+		if n == 0 {
+			r.err = fmt.Errorf("field %d: failed to decode length", fieldNum)
+			return false
+		}
+		pos += n
+		if length > uint64(len(data)-pos) { // Also rejects lengths that overflow int
+			r.err = fmt.Errorf("field %d: bytes length exceeds data", fieldNum)
+			return false
+		}
+		field.Value.Bytes = data[pos : pos+int(length)]
+		pos += int(length)
+
+	case WireFixed32:
+		if pos+4 > len(data) {
+			r.err = fmt.Errorf("field %d: not enough data for fixed32", fieldNum)
+			return false
+		}
+		field.Value.Fixed32 = binary.LittleEndian.Uint32(data[pos:])
+		pos += 4
+
+	case WireStartGroup:
+		skipped, groupFields, err := skipGroup(data[pos:], fieldNum, r.opts, r.depth, r.count)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.pos = pos + skipped
+		r.count += groupFields
+		return false
+
+	case WireEndGroup:
+		r.err = fmt.Errorf("field %d: end group without start group", fieldNum)
+		return false
+
+	default:
+		r.err = fmt.Errorf("field %d: unknown wire type %d", fieldNum, wireType)
+		return false
+	}
+
+	r.pos = pos
+	r.field = field
+	return true
+}
@@ -0,0 +1,152 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+// benchmarkBatch encodes n measurement-like messages {1: id, 3: double} at field 1
+func benchmarkBatch(n int) []byte {
+	var b Builder
+	for i := 0; i < n; i++ {
+		b.Message(1, new(Builder).Uint32(1, uint32(i%32)).Double(3, float64(i)/10))
+	}
+	return b.Build()
+}
+
+func TestReader_MatchesDecode(t *testing.T) {
+	data := new(Builder).
+		Varint(1, 150).
+		String(2, "x").
+		Fixed32(3, 7).
+		Double(4, 2.5).
+		Message(5, new(Builder).Bool(1, true)).
+		Build()
+	// A skipped group between fields
+	data = append(data, encodeTag(6, WireStartGroup)...)
+	data = append(data, encodeTag(6, WireEndGroup)...)
+	data = append(data, new(Builder).Varint(7, 1).Build()...)
+
+	want, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Message
+	r := NewReader(data)
+	for r.Next() {
+		got = append(got, r.Field())
+	}
+	if r.Err() != nil {
+		t.Fatalf("unexpected error: %v", r.Err())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reader fields differ:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestReader_Error(t *testing.T) {
+	data := append(new(Builder).Varint(1, 1).Build(), encodeTag(2, WireFixed64)...)
+
+	r := NewReader(data)
+	fields := 0
+	for r.Next() {
+		fields++
+	}
+	if fields != 1 || r.Err() == nil {
+		t.Errorf("expected 1 field then an error, got %d fields (%v)", fields, r.Err())
+	}
+	if r.Next() {
+		t.Error("Next must keep returning false after an error")
+	}
+}
+
+func TestReader_EmbeddedInheritsOptions(t *testing.T) {
+	inner := new(Builder).Varint(1, 1).Varint(1, 2).Varint(1, 3)
+	data := new(Builder).Message(1, inner).Build()
+
+	r := NewReaderWithOptions(data, DecodeOptions{MaxFields: 2})
+	if !r.Next() {
+		t.Fatalf("expected the outer field: %v", r.Err())
+	}
+	er := r.Field().Value.Reader()
+	for er.Next() {
+	}
+	if er.Err() == nil {
+		t.Error("expected the embedded reader to enforce the field limit")
+	}
+
+	r = NewReaderWithOptions(data, DecodeOptions{MaxDepth: 1})
+	r.Next()
+	if er := r.Field().Value.Reader(); er.Next() || er.Err() == nil {
+		t.Error("expected the embedded reader to enforce the depth limit")
+	}
+}
+
+func TestReader_NoAllocs(t *testing.T) {
+	data := benchmarkBatch(100)
+	allocs := testing.AllocsPerRun(100, func() {
+		r := NewReader(data)
+		for r.Next() {
+			er := r.Field().Value.Reader()
+			for er.Next() {
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %.1f", allocs)
+	}
+}
+
+// Decoding a 500-measurement batch and every embedded measurement
+
+func BenchmarkDecode(b *testing.B) {
+	data := benchmarkBatch(500)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msgs, err := DecodeRepeated(data, 1)
+		if err != nil || len(msgs) != 500 {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	data := benchmarkBatch(500)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		r := NewReader(data)
+		for r.Next() {
+			er := r.Field().Value.Reader()
+			for er.Next() {
+			}
+			if er.Err() != nil {
+				b.Fatal(er.Err())
+			}
+			n++
+		}
+		if r.Err() != nil || n != 500 {
+			b.Fatal(r.Err())
+		}
+	}
+}
+
+func BenchmarkReader_Strict(b *testing.B) {
+	data := benchmarkBatch(500)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := NewReaderWithOptions(data, StrictOptions)
+		for r.Next() {
+			er := r.Field().Value.Reader()
+			for er.Next() {
+			}
+		}
+		if r.Err() != nil {
+			b.Fatal(r.Err())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// comparator is a single "<op><version>" constraint
+type comparator struct {
+	op      string
+	version Version
+}
+
+// Range is a set of space-separated constraints that must all hold,
+// e.g. ">=1.4.0 <2.0.0". Supported operators are >=, >, <=, <, = (or none).
+type Range struct {
+	comparators []comparator
+}
+
+// ParseRange parses a version range
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, term := range strings.Fields(s) {
+		op := ""
+		for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(term, candidate) {
+				op = candidate
+				break
+			}
+		}
+		v, err := Parse(strings.TrimPrefix(term, op))
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		if op == "" {
+			op = "="
+		}
+		r.comparators = append(r.comparators, comparator{op: op, version: v})
+	}
+	if len(r.comparators) == 0 {
+		return Range{}, fmt.Errorf("invalid range %q: no constraints", s)
+	}
+	return r, nil
+}
+
+// Contains reports whether v satisfies every constraint of the range
+func (r Range) Contains(v Version) bool {
+	for _, c := range r.comparators {
+		cmp := v.Compare(c.version)
+		var ok bool
+		switch c.op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		default:
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the range with normalized versions
+func (r Range) String() string {
+	terms := make([]string, len(r.comparators))
+	for i, c := range r.comparators {
+		terms[i] = c.op + c.version.String()
+	}
+	return strings.Join(terms, " ")
+}
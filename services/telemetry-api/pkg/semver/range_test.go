@@ -0,0 +1,62 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{">=1.4.0 <2.0.0", "1.4.0", true},
+		{">=1.4.0 <2.0.0", "1.9.12", true},
+		{">=1.4.0 <2.0.0", "2.0.0", false},
+		{">=1.4.0 <2.0.0", "1.3.9", false},
+		{">=1.4.0 <2.0.0", "2.0.0-rc.1", true}, // Prereleases order before their release
+		{">1.0.0", "1.0.0", false},
+		{"<=1.0.0", "1.0.0", true},
+		{"1.2.3", "v1.2.3", true},
+		{"=1.2.3", "1.2.4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rng+"/"+tt.version, func(t *testing.T) {
+			r, err := ParseRange(tt.rng)
+			if err != nil {
+				t.Fatalf("ParseRange(%q): %v", tt.rng, err)
+			}
+			if got := r.Contains(mustParse(t, tt.version)); got != tt.want {
+				t.Errorf("Contains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRange_Invalid(t *testing.T) {
+	for _, s := range []string{"", "   ", ">=", ">=1.x", "~1.2.0", ">=1.0.0 || <0.5.0"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("ParseRange(%q): expected error", s)
+		}
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	r, err := ParseRange(">=v1.4 <2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != ">=1.4.0 <2.0.0" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return v
+}
@@ -0,0 +1,62 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Version
+		wantErr bool
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{"1.2", Version{Major: 1, Minor: 2}, false},
+		{"2024.01.15", Version{Major: 2024, Minor: 1, Patch: 15}, false},
+		{"1.0.0-rc.1+build.5", Version{Major: 1, Prerelease: "rc.1"}, false},
+		{"", Version{}, true},
+		{"1.2.3.4", Version{}, true},
+		{"1.x.0", Version{}, true},
+		{"1.0.0-", Version{}, true},
+		{"beta", Version{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareStrings(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "v1.0.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0-alpha", "1.0.0-1", 1},
+		{"1.0.0-rc", "1.0.0-rc.1", -1},
+		{"beta", "1.0.0", -1},
+		{"alpha", "beta", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := CompareStrings(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareStrings(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+// Package websocket implements RFC 6455 WebSockets: the opening handshake, framing,
+// fragmented messages and control frames (ping, pong, close). Extensions such as
+// permessage-deflate and subprotocols are not supported.
+//
+// Servers call Upgrade from an HTTP handler; Dial is a minimal client (used by tests
+// and tools). Reads must come from one goroutine; writes are safe for concurrent use.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is a frame opcode
+type MessageType int
+
+// Message types (RFC 6455 section 5.2)
+const (
+	continuationFrame MessageType = 0
+	TextMessage       MessageType = 1
+	BinaryMessage     MessageType = 2
+	CloseMessage      MessageType = 8
+	PingMessage       MessageType = 9
+	PongMessage       MessageType = 10
+)
+
+// Close codes (RFC 6455 section 7.4.1); 4000-4999 are free for applications
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+)
+
+// DefaultReadLimit is the largest message ReadMessage accepts unless changed by SetReadLimit
+const DefaultReadLimit = 64 * 1024
+
+// maxControlPayload is the largest payload of ping, pong and close frames
+const maxControlPayload = 125
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned when the opening handshake is not a valid WebSocket upgrade
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// ErrClosed is returned when writing after a close frame was sent
+var ErrClosed = errors.New("websocket: close sent")
+
+// CloseError is returned by ReadMessage when the peer closed the connection
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", e.Code, e.Text)
+}
+
+// Conn is a WebSocket connection
+type Conn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	client    bool // Clients mask the frames they send, servers must not
+	readLimit int64
+	idle      time.Duration // Read deadline extension per frame (0 = none)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{conn: conn, br: br, client: client, readLimit: DefaultReadLimit}
+}
+
+// IsUpgrade reports whether r asks for a WebSocket connection
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the opening handshake and takes over the connection. header is added
+// to the 101 response. On failure an HTTP error has been written and the error wraps
+// ErrBadHandshake. Deadlines the server set on the connection are cleared.
+func Upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: not an upgrade request", ErrBadHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: unsupported version", ErrBadHandshake)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: invalid key", ErrBadHandshake)
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("%w: %v", ErrBadHandshake, err)
+	}
+	// Server read/write timeouts are meant for requests, not long-lived connections
+	netConn.SetDeadline(time.Time{})
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	for k, values := range header {
+		for _, v := range values {
+			resp.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	resp.WriteString("\r\n")
+	if _, err := io.WriteString(netConn, resp.String()); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return newConn(netConn, brw.Reader, false), nil
+}
+
+// Dial opens a client connection to a ws://, wss://, http:// or https:// URL. When the
+// server refuses the upgrade, the error wraps ErrBadHandshake and the response is returned.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	secure := u.Scheme == "wss" || u.Scheme == "https"
+	host := u.Host
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secure {
+		tlsConn := tls.Client(netConn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return nil, nil, err
+		}
+		netConn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+		defer netConn.SetDeadline(time.Time{})
+	}
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	httpURL := *u
+	httpURL.Scheme = "http"
+	if secure {
+		httpURL.Scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		netConn.Close()
+		return nil, resp, fmt.Errorf("%w: status %s", ErrBadHandshake, resp.Status)
+	}
+	return newConn(netConn, br, true), resp, nil
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts; larger messages close the
+// connection with CloseMessageTooBig
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetReadIdleTimeout makes every received frame, including pongs and pings, extend the
+// read deadline by d, so a peer that answers pings stays connected without sending messages
+func (c *Conn) SetReadIdleTimeout(d time.Duration) {
+	c.idle = d
+}
+
+// SetReadDeadline sets the deadline for the next ReadMessage
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close closes the underlying connection without a close handshake
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ReadMessage returns the next text or binary message, reassembling fragments. Pings are
+// answered and pongs skipped. A close frame from the peer is answered and returned as a
+// *CloseError; protocol violations close the connection with the matching code.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var msgType MessageType
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, payload); err != nil && !errors.Is(err, ErrClosed) {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message inside a fragmented message")
+			}
+			msgType = op
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if int64(len(msg))+int64(len(payload)) > c.readLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8 in text message")
+			}
+			return msgType, msg, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload
+func (c *Conn) readFrame() (fin bool, op MessageType, payload []byte, err error) {
+	if c.idle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	op = MessageType(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, "wrong frame masking")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if op >= CloseMessage && (!fin || length > maxControlPayload) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > uint64(c.readLimit) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose answers a close frame and returns it as a *CloseError
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(CloseInvalidPayload, "invalid UTF-8 in close reason")
+		}
+	}
+
+	code := closeErr.Code
+	if code == CloseNoStatus {
+		code = CloseNormal
+	}
+	c.WriteClose(code, "")
+	return closeErr
+}
+
+// fail sends a close frame for a protocol violation and returns it as an error
+func (c *Conn) fail(code int, reason string) error {
+	c.WriteClose(code, reason)
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// WriteMessage sends a text or binary message in one frame
+func (c *Conn) WriteMessage(msgType MessageType, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return fmt.Errorf("websocket: WriteMessage with message type %d", msgType)
+	}
+	return c.writeFrame(msgType, data)
+}
+
+// WritePing sends a ping; the peer answers with a pong carrying the same data
+func (c *Conn) WritePing(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: ping payload too large")
+	}
+	return c.writeFrame(PingMessage, data)
+}
+
+// WriteClose starts (or answers) the close handshake. Later writes return ErrClosed.
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	return c.writeFrame(CloseMessage, payload)
+}
+
+// writeFrame sends one final frame
+func (c *Conn) writeFrame(op MessageType, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	if op == CloseMessage {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(op))
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// maskBytes applies (or removes) the client masking key
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a client key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma-separated header contains token (case-insensitive)
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEchoServer echoes every message until the client closes. Read errors are sent on errs.
+func newEchoServer(t *testing.T, readLimit int64) (*httptest.Server, <-chan error) {
+	t.Helper()
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, http.Header{"X-Test": {"1"}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if readLimit > 0 {
+			conn.SetReadLimit(readLimit)
+		}
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := conn.WriteMessage(msgType, data); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, errs
+}
+
+func dial(t *testing.T, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, resp, err := Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if resp.Header.Get("X-Test") != "1" {
+		t.Errorf("expected upgrade response header, got %v", resp.Header)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// rawFrame builds a client frame by hand (masked unless mask is false)
+func rawFrame(fin bool, op MessageType, payload []byte, mask bool) []byte {
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+	if len(payload) > 125 {
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	} else {
+		frame = append(frame, maskBit|byte(len(payload)))
+	}
+	if !mask {
+		return append(frame, payload...)
+	}
+	key := [4]byte{1, 2, 3, 4}
+	masked := append([]byte(nil), payload...)
+	maskBytes(key, masked)
+	return append(append(frame, key[:]...), masked...)
+}
+
+// expectClose reads until the server's close frame and checks its code
+func expectClose(t *testing.T, conn *Conn, code int) {
+	t.Helper()
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != code {
+		t.Fatalf("expected close code %d, got %v", code, err)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey = %s", got)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	srv, _ := newEchoServer(t, 1<<20)
+	conn := dial(t, srv.URL)
+	conn.SetReadLimit(1 << 20)
+
+	messages := []struct {
+		msgType MessageType
+		data    []byte
+	}{
+		{TextMessage, []byte("hello")},
+		{TextMessage, []byte{}},
+		{BinaryMessage, []byte{0, 1, 2, 255}},
+		{BinaryMessage, bytes.Repeat([]byte{7}, 300)},     // 16-bit length
+		{BinaryMessage, bytes.Repeat([]byte{9}, 0x10010)}, // 64-bit length
+	}
+	for _, m := range messages {
+		if err := conn.WriteMessage(m.msgType, m.data); err != nil {
+			t.Fatal(err)
+		}
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != m.msgType || !bytes.Equal(data, m.data) {
+			t.Errorf("echo mismatch for %d bytes (type %d)", len(m.data), msgType)
+		}
+	}
+}
+
+func TestFragmentedMessageWithInterleavedPing(t *testing.T) {
+	srv, _ := newEchoServer(t, 0)
+	conn := dial(t, srv.URL)
+
+	var frames []byte
+	frames = append(frames, rawFrame(false, TextMessage, []byte("hel"), true)...)
+	frames = append(frames, rawFrame(true, PingMessage, []byte("p"), true)...) // Control frames may interleave
+	frames = append(frames, rawFrame(false, continuationFrame, []byte("lo "), true)...)
+	frames = append(frames, rawFrame(true, continuationFrame, []byte("world"), true)...)
+	if _, err := conn.conn.Write(frames); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client skips the pong and returns the reassembled echo
+	msgType, data, err := conn.ReadMessage()
+	if err != nil || msgType != TextMessage || string(data) != "hello world" {
+		t.Fatalf("got (%d, %q, %v)", msgType, data, err)
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	srv, errs := newEchoServer(t, 0)
+	conn := dial(t, srv.URL)
+
+	if err := conn.WriteClose(CloseGoingAway, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, CloseGoingAway)
+
+	var closeErr *CloseError
+	if err := <-errs; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Text != "bye" {
+		t.Errorf("server: expected close 1001 bye, got %v", err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+}
+
+func TestProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		limit int64
+		code  int
+	}{
+		{"unmasked client frame", rawFrame(true, TextMessage, []byte("x"), false), 0, CloseProtocolError},
+		{"reserved bits", append([]byte{0xc1}, rawFrame(true, TextMessage, nil, true)[1:]...), 0, CloseProtocolError},
+		{"unknown opcode", rawFrame(true, 3, nil, true), 0, CloseProtocolError},
+		{"fragmented ping", rawFrame(false, PingMessage, nil, true), 0, CloseProtocolError},
+		{"oversized ping", rawFrame(true, PingMessage, make([]byte, 126), true), 0, CloseProtocolError},
+		{"lone continuation", rawFrame(true, continuationFrame, []byte("x"), true), 0, CloseProtocolError},
+		{"invalid UTF-8", rawFrame(true, TextMessage, []byte{0xff, 0xfe}, true), 0, CloseInvalidPayload},
+		{"too big", rawFrame(true, BinaryMessage, make([]byte, 200), true), 100, CloseMessageTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, errs := newEchoServer(t, tt.limit)
+			conn := dial(t, srv.URL)
+
+			if _, err := conn.conn.Write(tt.frame); err != nil {
+				t.Fatal(err)
+			}
+			expectClose(t, conn, tt.code)
+			if err := <-errs; err == nil {
+				t.Error("expected server read error")
+			}
+		})
+	}
+}
+
+func TestUpgrade_BadHandshake(t *testing.T) {
+	srv, _ := newEchoServer(t, 0)
+
+	// Plain HTTP request
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// Unsupported version
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("expected 426 with supported version, got %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestDial_Refused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, resp, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !errors.Is(err, ErrBadHandshake) || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected refused handshake with 401, got %v", err)
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if IsUpgrade(req) {
+		t.Error("plain request reported as upgrade")
+	}
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "WebSocket")
+	if !IsUpgrade(req) {
+		t.Error("upgrade request not detected")
+	}
+}
@@ -122,6 +122,8 @@ module "cloud_run" {
   allow_unauthenticated            = var.allow_unauthenticated
   admin_api_key_secret_id          = module.secrets.admin_api_key_secret_id
   github_actions_api_key_secret_id = module.secrets.github_actions_api_key_secret_id
+  min_instance_count               = var.min_instance_count
+  cpu_idle                         = var.cpu_idle
 
   depends_on = [
     google_project_service.apis,
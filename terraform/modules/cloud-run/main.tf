@@ -39,6 +39,18 @@ variable "github_actions_api_key_secret_id" {
   type        = string
 }
 
+variable "min_instance_count" {
+  description = "Instances kept running; 1 keeps the in-process command scheduler and retention sweeper alive"
+  type        = number
+  default     = 0
+}
+
+variable "cpu_idle" {
+  description = "Throttle CPU outside requests; false lets background loops run between requests"
+  type        = bool
+  default     = true
+}
+
 
 resource "google_cloud_run_v2_service" "telemetry_api" {
   name     = "telemetry-api"
@@ -56,7 +68,7 @@ resource "google_cloud_run_v2_service" "telemetry_api" {
     service_account = var.service_account
 
     scaling {
-      min_instance_count = 0
+      min_instance_count = var.min_instance_count
       max_instance_count = 10
     }
 
@@ -68,7 +80,7 @@ resource "google_cloud_run_v2_service" "telemetry_api" {
           cpu    = "1"
           memory = "512Mi"
         }
-        cpu_idle = true
+        cpu_idle = var.cpu_idle
       }
 
       env {
@@ -127,7 +139,7 @@ resource "google_cloud_run_v2_service" "telemetry_api" {
       }
     }
 
-    timeout                          = "300s"
+    timeout                          = "3600s" # Command streams (GET /commands/stream) stay open up to 55 minutes
     max_instance_request_concurrency = 80
   }
 
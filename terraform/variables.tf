@@ -44,3 +44,15 @@ variable "github_repositories" {
   type        = list(string)
   default     = []
 }
+
+variable "min_instance_count" {
+  description = "Cloud Run instances kept running (0 scales to zero)"
+  type        = number
+  default     = 0
+}
+
+variable "cpu_idle" {
+  description = "Throttle Cloud Run CPU outside requests"
+  type        = bool
+  default     = true
+}